@@ -12,7 +12,9 @@ import (
 	"log"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"strings"
 )
 
 // HTTPLogger can be used to log http requests
@@ -45,18 +47,39 @@ func (l *HTTPLogger) Handler(next http.Handler) http.Handler {
 		next.ServeHTTP(crw, r)
 
 		addr := r.RemoteAddr
+		uri := redactURI(r)
 		if err == nil {
 			rBuf := bytes.Buffer{}
 			_, _ = rBuf.ReadFrom(rdr)
-			l.Printf("(%s) \"%s %s\" %d -> %v -> %v", addr, r.Method, r.RequestURI,
+			l.Printf("(%s) \"%s %s\" %d -> %v -> %v", addr, r.Method, uri,
 				crw.status, rBuf.String(), crw.buf.String())
 		} else {
-			l.Printf("(%s) \"%s %s\" %d", addr, r.Method, r.RequestURI, crw.status)
+			l.Printf("(%s) \"%s %s\" %d", addr, r.Method, uri, crw.status)
 		}
 
 	})
 }
 
+// redactURI returns the request URI with the token query parameter (used
+// to pass a JWT to stream requests) redacted so it does not end up in logs.
+// handlers shift the URL path, so RequestURI is used for the path.
+func redactURI(r *http.Request) string {
+	path, query, _ := strings.Cut(r.RequestURI, "?")
+
+	q, err := url.ParseQuery(query)
+	if err != nil {
+		// we can't tell if there is a token, so drop the query
+		return path
+	}
+
+	if !q.Has("token") {
+		return r.RequestURI
+	}
+
+	q.Set("token", "REDACTED")
+	return path + "?" + q.Encode()
+}
+
 type customResponseWriter struct {
 	http.ResponseWriter
 	status int
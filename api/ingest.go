@@ -0,0 +1,79 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// ingestMaxBody limits the size of posted data
+const ingestMaxBody = 1 << 20
+
+// ingest keys are used in NATS subjects
+var reIngestKey = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// Ingest handles JSON posted by external devices to /v1/ingest/<key>. The
+// data is mapped to points by the HTTP ingest node with the key. Requests
+// are authorized with the token configured in the HTTP ingest node rather
+// than a user JWT.
+type Ingest struct {
+	nc *nats.Conn
+}
+
+// NewIngestHandler returns a new ingest handler
+func NewIngestHandler(nc *nats.Conn) http.Handler {
+	return &Ingest{nc}
+}
+
+// ServeHTTP serves ingest requests
+func (h *Ingest) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(res, "only POST allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	key, _ := ShiftPath(req.URL.Path)
+	if !reIngestKey.MatchString(key) {
+		http.Error(res, "Not Found", http.StatusNotFound)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(req.Body, ingestMaxBody))
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// devices that can't set headers can pass the token as a query parameter
+	token := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if token == "" {
+		token = req.URL.Query().Get("token")
+	}
+
+	result, err := client.SendIngest(h.nc, key, data.IngestRequest{Token: token, Body: body})
+	if err != nil {
+		if errors.Is(err, nats.ErrNoResponders) {
+			http.Error(res, "Not Found", http.StatusNotFound)
+			return
+		}
+		http.Error(res, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	if result.Status != http.StatusOK {
+		http.Error(res, result.Error, result.Status)
+		return
+	}
+
+	err = encode(res, data.StandardResponse{Success: true})
+	if err != nil {
+		log.Println("Error encoding ingest response: ", err)
+	}
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/client"
+)
+
+// Metrics exposes node points selected by exporter nodes in the Prometheus
+// text format.
+type Metrics struct {
+	nc *nats.Conn
+	// the cache is created on the first request so we don't subscribe to
+	// all point changes if metrics are not used
+	lock  sync.Mutex
+	cache *client.ExporterCache
+}
+
+// NewMetricsHandler returns a new metrics handler
+func NewMetricsHandler(nc *nats.Conn) http.Handler {
+	return &Metrics{nc: nc}
+}
+
+func (h *Metrics) getCache() (*client.ExporterCache, error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if h.cache == nil {
+		var err error
+		h.cache, err = client.NewExporterCache(h.nc)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return h.cache, nil
+}
+
+// ServeHTTP serves metrics requests. Exporter nodes are only included if the
+// request has a matching bearer token, or they allow anonymous requests.
+func (h *Metrics) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(res, "only GET allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+
+	cache, err := h.getCache()
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	points, err := cache.GetExportedPoints(token)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	res.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, err = res.Write(client.FormatPrometheus(points))
+	if err != nil {
+		log.Println("Error writing metrics: ", err)
+	}
+}
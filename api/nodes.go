@@ -2,9 +2,12 @@ package api
 
 import (
 	"encoding/json"
+	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/nats-io/nats.go"
@@ -57,6 +60,14 @@ func (h *Nodes) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 	var validUser bool
 	var userID string
 
+	// browsers can't set headers for EventSource or WebSocket requests, so
+	// stream requests can pass the JWT as a query parameter
+	if head == "stream" && req.Header.Get("Authorization") == "" {
+		if token := req.URL.Query().Get("token"); token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+	}
+
 	if req.Header.Get("Authorization") != h.authToken {
 		// all requests require valid JWT or authToken validation
 		validUser, userID = h.check.Valid(req)
@@ -161,7 +172,79 @@ func (h *Nodes) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 		http.Error(res, "only POST allowed", http.StatusMethodNotAllowed)
 		return
 
+	case "history":
+		if req.Method != http.MethodGet {
+			http.Error(res, "only GET allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		h.history(res, req, id)
+
+	case "stream":
+		if req.Method != http.MethodGet {
+			http.Error(res, "only GET allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		h.stream(res, req, id)
+
+	case "tree":
+		if req.Method != http.MethodGet {
+			http.Error(res, "only GET allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		tree, err := client.GetNodeTree(h.nc, id)
+		if err != nil {
+			http.Error(res, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		err = encode(res, tree)
+		if err != nil {
+			log.Println("Error encoding node tree: ", err)
+		}
+
+	case "export":
+		if req.Method != http.MethodGet {
+			http.Error(res, "only GET allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		y, err := client.ExportNodes(h.nc, id)
+		if err != nil {
+			http.Error(res, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		res.Header().Set("Content-Type", "application/yaml")
+		_, err = res.Write(y)
+		if err != nil {
+			log.Println("Error writing export: ", err)
+		}
+
+	case "import":
+		if req.Method != http.MethodPost {
+			http.Error(res, "only POST allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		h.importNodes(res, req, id, userID)
+
 	case "parents":
+		var parent string
+		parent, req.URL.Path = ShiftPath(req.URL.Path)
+		if parent != "" {
+			// /v1/nodes/:id/parents/:parent/points
+			if req.URL.Path != "/points" || req.Method != http.MethodPost {
+				http.Error(res, "Not Found", http.StatusNotFound)
+				return
+			}
+
+			h.processEdgePoints(res, req, id, parent, userID)
+			return
+		}
+
 		switch req.Method {
 		case http.MethodPost:
 			var nodeMove NodeMove
@@ -322,3 +405,105 @@ func (h *Nodes) processPoints(res http.ResponseWriter, req *http.Request, id, us
 		return
 	}
 }
+
+func (h *Nodes) processEdgePoints(res http.ResponseWriter, req *http.Request, id, parent, userID string) {
+	var points data.Points
+	err := decode(req.Body, &points)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	for i := range points {
+		points[i].Origin = userID
+	}
+
+	err = client.SendEdgePoints(h.nc, id, parent, points, true)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = encode(res, data.StandardResponse{Success: true, ID: id})
+	if err != nil {
+		log.Println("Error encoding response: ", err)
+	}
+}
+
+// importNodes imports YAML (in the format returned by the export endpoint)
+// under the parent node. New IDs are generated unless the preserveIds query
+// parameter is true.
+func (h *Nodes) importNodes(res http.ResponseWriter, req *http.Request, parent, userID string) {
+	y, err := io.ReadAll(req.Body)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	preserveIDs, _ := strconv.ParseBool(req.URL.Query().Get("preserveIds"))
+
+	err = client.ImportNodes(h.nc, parent, y, userID, preserveIDs)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = encode(res, data.StandardResponse{Success: true, ID: parent})
+	if err != nil {
+		log.Println("Error encoding response: ", err)
+	}
+}
+
+// history returns historical point data for a node. Query parameters:
+// type (required), key, start and stop (RFC3339, start defaults to 24h ago),
+// window (aggregate window duration, e.g. 5m), and aggregate (mean, min, max, ...)
+func (h *Nodes) history(res http.ResponseWriter, req *http.Request, id string) {
+	v := req.URL.Query()
+
+	q := data.HistoryQuery{
+		Type:            v.Get("type"),
+		Key:             v.Get("key"),
+		AggregateWindow: v.Get("window"),
+		Aggregate:       v.Get("aggregate"),
+		Start:           time.Now().Add(-24 * time.Hour),
+	}
+
+	var err error
+
+	if start := v.Get("start"); start != "" {
+		q.Start, err = time.Parse(time.RFC3339, start)
+		if err != nil {
+			http.Error(res, "invalid start: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if stop := v.Get("stop"); stop != "" {
+		q.Stop, err = time.Parse(time.RFC3339, stop)
+		if err != nil {
+			http.Error(res, "invalid stop: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	err = q.Validate()
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	points, err := client.GetHistory(h.nc, id, q)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if points == nil {
+		points = data.Points{}
+	}
+
+	err = encode(res, points)
+	if err != nil {
+		log.Println("Error encoding history: ", err)
+	}
+}
@@ -0,0 +1,354 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// apiParam is a path or query parameter of an API operation
+type apiParam struct {
+	name     string
+	in       string
+	desc     string
+	required bool
+	typ      string
+}
+
+// apiOperation describes an endpoint of the v1 API. Request and response
+// bodies are Go values that are converted to schemas with reflection, so
+// the document stays in sync with the types.
+type apiOperation struct {
+	path    string
+	method  string
+	id      string
+	summary string
+	params  []apiParam
+	// request body, nil if none
+	body any
+	// content type for non-JSON bodies
+	bodyType string
+	// response body, nil if the response is a StandardResponse
+	response     any
+	responseType string
+	// set for endpoints that don't need authorization
+	public bool
+}
+
+var paramID = apiParam{name: "id", in: "path", desc: "node ID", required: true, typ: "string"}
+
+// apiOperations lists all v1 API endpoints
+var apiOperations = []apiOperation{
+	{path: "/nodes", method: http.MethodGet, id: "getNodes",
+		summary: "Get all nodes the user has access to", response: []data.NodeEdge{}},
+	{path: "/nodes", method: http.MethodPost, id: "insertNode",
+		summary: "Insert a new node. An ID is generated if not set", body: data.NodeEdge{}},
+	{path: "/nodes/{id}", method: http.MethodGet, id: "getNode",
+		summary: "Get all instances of a node", params: []apiParam{paramID}, response: []data.NodeEdge{}},
+	{path: "/nodes/{id}", method: http.MethodDelete, id: "deleteNode",
+		summary: "Delete a node from a parent", params: []apiParam{paramID}, body: NodeDelete{}},
+	{path: "/nodes/{id}/tree", method: http.MethodGet, id: "getNodeTree",
+		summary: "Get a node and all of its descendants", params: []apiParam{paramID},
+		response: data.NodeEdgeChildren{}},
+	{path: "/nodes/{id}/points", method: http.MethodPost, id: "postPoints",
+		summary: "Write node points. Returns after the points are stored",
+		params:  []apiParam{paramID}, body: data.Points{}},
+	{path: "/nodes/{id}/parents/{parent}/points", method: http.MethodPost, id: "postEdgePoints",
+		summary: "Write edge points. Returns after the points are stored",
+		params: []apiParam{paramID, {name: "parent", in: "path", desc: "parent node ID",
+			required: true, typ: "string"}},
+		body: data.Points{}},
+	{path: "/nodes/{id}/parents", method: http.MethodPost, id: "moveNode",
+		summary: "Move a node to a new parent", params: []apiParam{paramID}, body: NodeMove{}},
+	{path: "/nodes/{id}/parents", method: http.MethodPut, id: "copyNode",
+		summary: "Mirror or duplicate a node under a new parent", params: []apiParam{paramID},
+		body: NodeCopy{}},
+	{path: "/nodes/{id}/export", method: http.MethodGet, id: "exportNodes",
+		summary: "Export a node and its descendants as YAML", params: []apiParam{paramID},
+		response: "", responseType: "application/yaml"},
+	{path: "/nodes/{id}/import", method: http.MethodPost, id: "importNodes",
+		summary: "Import YAML nodes under a node", body: "", bodyType: "application/yaml",
+		params: []apiParam{paramID, {name: "preserveIds", in: "query",
+			desc: "keep the node IDs in the YAML", typ: "boolean"}}},
+	{path: "/nodes/{id}/history", method: http.MethodGet, id: "getHistory",
+		summary: "Get historical points from the database", response: data.Points{},
+		params: []apiParam{paramID,
+			{name: "type", in: "query", desc: "point type", required: true, typ: "string"},
+			{name: "key", in: "query", desc: "point key", typ: "string"},
+			{name: "start", in: "query", desc: "RFC3339 start time, defaults to 24h ago", typ: "string"},
+			{name: "stop", in: "query", desc: "RFC3339 stop time", typ: "string"},
+			{name: "window", in: "query", desc: "aggregate window, for example 5m", typ: "string"},
+			{name: "aggregate", in: "query", desc: "mean, min, max, sum, count, first, last, or median",
+				typ: "string"},
+		}},
+	{path: "/nodes/{id}/stream", method: http.MethodGet, id: "streamPoints",
+		summary:  "Stream point updates as server-sent events, or WebSocket messages if upgraded",
+		response: StreamEvent{}, responseType: "text/event-stream",
+		params: []apiParam{paramID,
+			{name: "subtree", in: "query", desc: "include all nodes under the node", typ: "boolean"},
+			{name: "token", in: "query", desc: "JWT for clients that can't set headers", typ: "string"},
+		}},
+	{path: "/nodes/{id}/not", method: http.MethodPost, id: "notify",
+		summary: "Send a notification to node users", params: []apiParam{paramID},
+		body: data.Notification{}},
+	{path: "/users", method: http.MethodGet, id: "getUsers",
+		summary:  "Get all users the user can see. Passwords are not returned",
+		response: []client.User{}},
+	{path: "/users", method: http.MethodPost, id: "insertUser",
+		summary: "Create a user under the parent node", body: client.User{}},
+	{path: "/users/{id}", method: http.MethodGet, id: "getUser",
+		summary: "Get a user", params: []apiParam{paramID}, response: client.User{}},
+	{path: "/users/{id}", method: http.MethodPut, id: "updateUser",
+		summary: "Replace user fields. The password is kept if not set",
+		params:  []apiParam{paramID}, body: client.User{}},
+	{path: "/users/{id}", method: http.MethodPatch, id: "patchUser",
+		summary: "Update the user fields in the body", params: []apiParam{paramID},
+		body: client.User{}},
+	{path: "/users/{id}", method: http.MethodDelete, id: "deleteUser",
+		summary: "Delete a user", params: []apiParam{paramID, {name: "parent", in: "query",
+			desc: "parent to delete from, defaults to the first parent", typ: "string"}}},
+	{path: "/groups", method: http.MethodGet, id: "getGroups",
+		summary: "Get all groups the user can see", response: []Group{}},
+	{path: "/groups", method: http.MethodPost, id: "insertGroup",
+		summary: "Create a group under the parent node", body: Group{}},
+	{path: "/groups/{id}", method: http.MethodGet, id: "getGroup",
+		summary: "Get a group", params: []apiParam{paramID}, response: Group{}},
+	{path: "/groups/{id}", method: http.MethodPut, id: "updateGroup",
+		summary: "Replace group fields", params: []apiParam{paramID}, body: Group{}},
+	{path: "/groups/{id}", method: http.MethodPatch, id: "patchGroup",
+		summary: "Update the group fields in the body", params: []apiParam{paramID},
+		body: Group{}},
+	{path: "/groups/{id}", method: http.MethodDelete, id: "deleteGroup",
+		summary: "Delete a group", params: []apiParam{paramID, {name: "parent", in: "query",
+			desc: "parent to delete from, defaults to the first parent", typ: "string"}}},
+	{path: "/sync/downstream", method: http.MethodGet, id: "getSyncDownstream",
+		summary: "Get instances that sync to this instance", response: []data.NodeEdge{}},
+	{path: "/ingest/{key}", method: http.MethodPost, id: "ingest",
+		summary: "Post JSON that is mapped to points by the HTTP ingest node with the key",
+		public:  true, body: map[string]any{},
+		params: []apiParam{{name: "key", in: "path", desc: "HTTP ingest node key", required: true,
+			typ: "string"}, {name: "token", in: "query",
+			desc: "token for devices that can't set the Authorization header", typ: "string"}}},
+	{path: "/auth", method: http.MethodPost, id: "login",
+		summary: "Get a JWT", public: true, response: data.Auth{},
+		body: struct {
+			Email    string `json:"email"`
+			Password string `json:"password"`
+		}{}, bodyType: "application/x-www-form-urlencoded"},
+}
+
+// openAPI builds OpenAPI 3 documents
+type openAPI struct {
+	schemas map[string]any
+}
+
+// schema returns the schema for a type. Named structs are added to the
+// components and referenced.
+func (o *openAPI) schema(t reflect.Type) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t {
+	case reflect.TypeOf(time.Time{}):
+		return map[string]any{"type": "string", "format": "date-time"}
+	case reflect.TypeOf([]byte{}):
+		return map[string]any{"type": "string", "format": "byte"}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer", "format": "int64"}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16:
+		return map[string]any{"type": "integer", "format": "int32"}
+	case reflect.Float32:
+		return map[string]any{"type": "number", "format": "float"}
+	case reflect.Float64:
+		return map[string]any{"type": "number", "format": "double"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": o.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": o.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return o.structSchema(t)
+		}
+		name := t.Name()
+		if _, ok := o.schemas[name]; !ok {
+			// placeholder in case the type refers to itself
+			o.schemas[name] = nil
+			o.schemas[name] = o.structSchema(t)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + name}
+	default:
+		return map[string]any{}
+	}
+}
+
+// structSchema returns the schema for a struct. Properties are not marked
+// as required as missing fields in requests are zero values.
+func (o *openAPI) structSchema(t reflect.Type) map[string]any {
+	properties := make(map[string]any)
+	o.structFields(t, properties)
+	return map[string]any{"type": "object", "properties": properties}
+}
+
+func (o *openAPI) structFields(t reflect.Type, properties map[string]any) {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name, _, _ := strings.Cut(tag, ",")
+
+		// embedded structs without a name are inlined like encoding/json
+		if sf.Anonymous && name == "" && sf.Type.Kind() == reflect.Struct {
+			o.structFields(sf.Type, properties)
+			continue
+		}
+
+		if !sf.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = sf.Name
+		}
+
+		properties[name] = o.schema(sf.Type)
+	}
+}
+
+func (o *openAPI) content(v any, contentType string) map[string]any {
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	return map[string]any{contentType: map[string]any{"schema": o.schema(reflect.TypeOf(v))}}
+}
+
+// newOpenAPIDoc returns the OpenAPI document for the v1 API
+func newOpenAPIDoc() map[string]any {
+	o := &openAPI{schemas: make(map[string]any)}
+
+	paths := make(map[string]map[string]any)
+
+	for _, op := range apiOperations {
+		operation := map[string]any{
+			"operationId": op.id,
+			"summary":     op.summary,
+		}
+
+		var params []any
+		for _, p := range op.params {
+			params = append(params, map[string]any{
+				"name":        p.name,
+				"in":          p.in,
+				"description": p.desc,
+				"required":    p.required,
+				"schema":      map[string]any{"type": p.typ},
+			})
+		}
+		if len(params) > 0 {
+			operation["parameters"] = params
+		}
+
+		if op.body != nil {
+			operation["requestBody"] = map[string]any{
+				"required": true,
+				"content":  o.content(op.body, op.bodyType),
+			}
+		}
+
+		response := op.response
+		if response == nil {
+			response = data.StandardResponse{}
+		}
+
+		operation["responses"] = map[string]any{
+			"200": map[string]any{
+				"description": "OK",
+				"content":     o.content(response, op.responseType),
+			},
+			"default": map[string]any{"description": "error message"},
+		}
+
+		if op.public {
+			operation["security"] = []any{}
+		}
+
+		if paths[op.path] == nil {
+			paths[op.path] = make(map[string]any)
+		}
+		paths[op.path][strings.ToLower(op.method)] = operation
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   "Simple IoT",
+			"version": "1",
+		},
+		"servers": []any{map[string]any{"url": "/v1"}},
+		"paths":   paths,
+		"components": map[string]any{
+			"schemas": o.schemas,
+			"securitySchemes": map[string]any{
+				"jwt": map[string]any{
+					"type":         "http",
+					"scheme":       "bearer",
+					"bearerFormat": "JWT",
+				},
+				"authToken": map[string]any{
+					"type": "apiKey",
+					"in":   "header",
+					"name": "Authorization",
+				},
+			},
+		},
+		"security": []any{
+			map[string]any{"jwt": []any{}},
+			map[string]any{"authToken": []any{}},
+		},
+	}
+}
+
+// OpenAPI serves the OpenAPI document for the v1 API
+type OpenAPI struct {
+	once sync.Once
+	doc  map[string]any
+}
+
+// NewOpenAPIHandler returns a handler for the OpenAPI document
+func NewOpenAPIHandler() http.Handler {
+	return &OpenAPI{}
+}
+
+// ServeHTTP serves the OpenAPI document
+func (h *OpenAPI) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(res, "only GET allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	h.once.Do(func() {
+		h.doc = newOpenAPIDoc()
+	})
+
+	res.Header().Set("Content-Type", "application/json")
+	err := encode(res, h.doc)
+	if err != nil {
+		log.Println("Error encoding OpenAPI document: ", err)
+	}
+}
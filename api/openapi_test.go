@@ -0,0 +1,57 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+)
+
+func TestOpenAPI(t *testing.T) {
+	res := httptest.NewRecorder()
+	NewOpenAPIHandler().ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if res.Code != http.StatusOK {
+		t.Fatal("unexpected status: ", res.Code)
+	}
+
+	var doc struct {
+		Paths      map[string]map[string]map[string]any
+		Components struct {
+			Schemas map[string]any
+		}
+	}
+
+	body := res.Body.Bytes()
+
+	err := json.Unmarshal(body, &doc)
+	if err != nil {
+		t.Fatal("Error decoding document: ", err)
+	}
+
+	ids := make(map[string]bool)
+	for path, ops := range doc.Paths {
+		for method, op := range ops {
+			id, _ := op["operationId"].(string)
+			if id == "" || ids[id] {
+				t.Errorf("%v %v: missing or duplicate operationId: %v", method, path, id)
+			}
+			ids[id] = true
+		}
+	}
+
+	for _, s := range []string{"NodeEdge", "NodeEdgeChildren", "Point", "User", "Group"} {
+		if _, ok := doc.Components.Schemas[s]; !ok {
+			t.Error("missing schema: ", s)
+		}
+	}
+
+	// all references must resolve
+	refs := regexp.MustCompile(`"#/components/schemas/([^"]+)"`).FindAllSubmatch(body, -1)
+	for _, r := range refs {
+		if _, ok := doc.Components.Schemas[string(r[1])]; !ok {
+			t.Error("unresolved reference: ", string(r[1]))
+		}
+	}
+}
@@ -16,6 +16,7 @@ type App struct {
 	PublicHandler  http.Handler
 	V1ApiHandler   http.Handler
 	WebsocketProxy http.Handler
+	MetricsHandler http.Handler
 }
 
 // Top level handler for http requests in the coap-server process
@@ -31,6 +32,8 @@ func (h *App) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 	case "/sign-in":
 		req.URL.Path = "/"
 		h.PublicHandler.ServeHTTP(res, req)
+	case "/metrics":
+		h.MetricsHandler.ServeHTTP(res, req)
 
 	default:
 		head, path := ShiftPath(req.URL.Path)
@@ -68,6 +71,7 @@ func NewAppHandler(args ServerArgs) http.Handler {
 		PublicHandler:  http.FileServer(args.Filesystem),
 		V1ApiHandler:   v1,
 		WebsocketProxy: wsProxy,
+		MetricsHandler: NewMetricsHandler(args.Nc),
 	}
 }
 
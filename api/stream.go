@@ -0,0 +1,188 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// streamKeepAlive is how often we send something to idle stream clients so
+// proxies don't close the connection
+const streamKeepAlive = 30 * time.Second
+
+// streamBufferSize is the number of events buffered for a slow stream client
+// before events are dropped
+const streamBufferSize = 100
+
+// StreamEvent is sent to clients of the /v1/nodes/:id/stream endpoint for
+// each point update.
+type StreamEvent struct {
+	NodeID string `json:"nodeId"`
+	// Parent is set for edge points
+	Parent string      `json:"parent,omitempty"`
+	Points data.Points `json:"points"`
+}
+
+var streamUpgrader = websocket.Upgrader{
+	// stream clients authenticate with a token rather than cookies, so
+	// cross origin requests are allowed
+	CheckOrigin: func(*http.Request) bool { return true },
+}
+
+// stream sends point updates for a node, or for all nodes in the subtree if
+// the subtree query parameter is true. WebSocket is used if the client
+// requests an upgrade, otherwise server-sent events.
+func (h *Nodes) stream(res http.ResponseWriter, req *http.Request, id string) {
+	subtree, _ := strconv.ParseBool(req.URL.Query().Get("subtree"))
+
+	events := make(chan StreamEvent, streamBufferSize)
+
+	handler := func(msg *nats.Msg) {
+		// up.<upID>.<nodeID> for node points and
+		// up.<upID>.<nodeID>.<parentID> for edge points
+		chunks := strings.Split(msg.Subject, ".")
+		if len(chunks) < 3 {
+			return
+		}
+
+		points, err := data.PbDecodePoints(msg.Data)
+		if err != nil {
+			log.Println("Stream: error decoding points: ", err)
+			return
+		}
+
+		e := StreamEvent{NodeID: chunks[2], Points: points}
+		if len(chunks) > 3 {
+			e.Parent = chunks[3]
+		}
+
+		select {
+		case events <- e:
+		default:
+			log.Println("Stream: client too slow, dropping points for node: ", e.NodeID)
+		}
+	}
+
+	subjects := []string{fmt.Sprintf("up.%v.%v", id, id), fmt.Sprintf("up.%v.%v.*", id, id)}
+	if subtree {
+		subjects = []string{fmt.Sprintf("up.%v.>", id)}
+	}
+
+	for _, s := range subjects {
+		sub, err := h.nc.Subscribe(s, handler)
+		if err != nil {
+			http.Error(res, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		defer func() {
+			err := sub.Unsubscribe()
+			if err != nil {
+				log.Println("Stream: error unsubscribing: ", err)
+			}
+		}()
+	}
+
+	if websocket.IsWebSocketUpgrade(req) {
+		h.streamWebsocket(res, req, events)
+	} else {
+		h.streamSSE(res, req, events)
+	}
+}
+
+func (h *Nodes) streamSSE(res http.ResponseWriter, req *http.Request, events <-chan StreamEvent) {
+	flusher, ok := res.(http.Flusher)
+	if !ok {
+		http.Error(res, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	res.Header().Set("Content-Type", "text/event-stream")
+	res.Header().Set("Cache-Control", "no-cache")
+	res.Header().Set("Connection", "keep-alive")
+	res.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		var err error
+
+		select {
+		case <-req.Context().Done():
+			return
+		case <-keepAlive.C:
+			_, err = res.Write([]byte(": keepalive\n\n"))
+		case e := <-events:
+			var d []byte
+			d, err = json.Marshal(e)
+			if err != nil {
+				log.Println("Stream: error encoding event: ", err)
+				continue
+			}
+			_, err = fmt.Fprintf(res, "event: points\ndata: %s\n\n", d)
+		}
+
+		if err != nil {
+			return
+		}
+
+		flusher.Flush()
+	}
+}
+
+func (h *Nodes) streamWebsocket(res http.ResponseWriter, req *http.Request, events <-chan StreamEvent) {
+	conn, err := streamUpgrader.Upgrade(res, req, nil)
+	if err != nil {
+		// Upgrade has already sent an error response
+		log.Println("Stream: websocket upgrade error: ", err)
+		return
+	}
+
+	defer conn.Close()
+
+	// we don't expect anything from the client, but need to read to
+	// process control messages and detect when the connection is closed
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		var err error
+
+		select {
+		case <-closed:
+			return
+		case <-keepAlive.C:
+			err = conn.WriteControl(websocket.PingMessage, nil,
+				time.Now().Add(10*time.Second))
+		case e := <-events:
+			err = conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			if err == nil {
+				err = conn.WriteJSON(e)
+			}
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
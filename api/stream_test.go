@@ -0,0 +1,225 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	natsserver "github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// testValidator accepts a single JWT
+type testValidator struct{}
+
+func (testValidator) Valid(req *http.Request) (bool, string) {
+	return req.Header.Get("Authorization") == "Bearer good-jwt", "user1"
+}
+
+// startStreamTest starts a NATS server and an HTTP server for the nodes
+// handler
+func startStreamTest(t *testing.T) (*nats.Conn, *httptest.Server) {
+	ns, err := natsserver.NewServer(&natsserver.Options{Port: -1, NoSigs: true, NoLog: true})
+	if err != nil {
+		t.Fatal("Error creating NATS server: ", err)
+	}
+
+	go ns.Start()
+	t.Cleanup(ns.Shutdown)
+
+	if !ns.ReadyForConnections(5 * time.Second) {
+		t.Fatal("NATS server did not start")
+	}
+
+	nc, err := nats.Connect(ns.ClientURL())
+	if err != nil {
+		t.Fatal("Error connecting to NATS: ", err)
+	}
+	t.Cleanup(nc.Close)
+
+	srv := httptest.NewServer(NewNodesHandler(testValidator{}, "server-token", nc))
+	t.Cleanup(srv.Close)
+
+	return nc, srv
+}
+
+// sendUpPoints publishes points the way the store does when a point changes
+func sendUpPoints(t *testing.T, nc *nats.Conn, subject string, value float64) {
+	points := data.Points{{Type: data.PointTypeValue, Value: value}}
+	d, err := points.ToPb()
+	if err != nil {
+		t.Fatal("Error encoding points: ", err)
+	}
+
+	err = nc.Publish(subject, d)
+	if err != nil {
+		t.Fatal("Error publishing points: ", err)
+	}
+}
+
+// readSSE returns the next points event from a server-sent events stream
+func readSSE(t *testing.T, r *bufio.Reader) StreamEvent {
+	ch := make(chan StreamEvent, 1)
+
+	go func() {
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				close(ch)
+				return
+			}
+
+			if d, ok := strings.CutPrefix(strings.TrimSpace(line), "data: "); ok {
+				var e StreamEvent
+				if json.Unmarshal([]byte(d), &e) == nil {
+					ch <- e
+					return
+				}
+			}
+		}
+	}()
+
+	select {
+	case e, ok := <-ch:
+		if !ok {
+			t.Fatal("stream closed")
+		}
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for stream event")
+	}
+
+	return StreamEvent{}
+}
+
+func TestStreamAuth(t *testing.T) {
+	_, srv := startStreamTest(t)
+
+	for _, uri := range []string{"/node1/stream", "/node1/stream?token=bad-jwt"} {
+		res, err := http.Get(srv.URL + uri)
+		if err != nil {
+			t.Fatal("Error getting stream: ", err)
+		}
+		res.Body.Close()
+
+		if res.StatusCode != http.StatusUnauthorized {
+			t.Errorf("%v: expected status 401, got %v", uri, res.StatusCode)
+		}
+	}
+
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + "/node1/stream?token=bad-jwt"
+	conn, res, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err == nil {
+		conn.Close()
+		t.Fatal("websocket connected with bad token")
+	}
+
+	if res == nil || res.StatusCode != http.StatusUnauthorized {
+		t.Fatal("expected websocket status 401, got: ", res)
+	}
+}
+
+func TestStreamSSE(t *testing.T) {
+	nc, srv := startStreamTest(t)
+
+	// node stream
+	res, err := http.Get(srv.URL + "/node1/stream?token=good-jwt")
+	if err != nil {
+		t.Fatal("Error getting stream: ", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK ||
+		res.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatal("unexpected response: ", res.Status, res.Header)
+	}
+
+	r := bufio.NewReader(res.Body)
+
+	// child points are not sent on a node stream
+	sendUpPoints(t, nc, "up.node1.child1", 1)
+	sendUpPoints(t, nc, "up.node1.node1", 2)
+
+	e := readSSE(t, r)
+	if e.NodeID != "node1" || len(e.Points) != 1 || e.Points[0].Value != 2 {
+		t.Fatalf("unexpected node event: %+v", e)
+	}
+
+	// subtree stream
+	resTree, err := http.Get(srv.URL + "/node1/stream?subtree=true&token=good-jwt")
+	if err != nil {
+		t.Fatal("Error getting stream: ", err)
+	}
+	defer resTree.Body.Close()
+
+	rTree := bufio.NewReader(resTree.Body)
+
+	sendUpPoints(t, nc, "up.node1.child1.node1", 3)
+
+	e = readSSE(t, rTree)
+	if e.NodeID != "child1" || e.Parent != "node1" || e.Points[0].Value != 3 {
+		t.Fatalf("unexpected subtree event: %+v", e)
+	}
+}
+
+func TestStreamWebsocket(t *testing.T) {
+	nc, srv := startStreamTest(t)
+
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + "/node1/stream?subtree=true"
+
+	// the JWT can also be sent in the Authorization header
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL,
+		http.Header{"Authorization": []string{"Bearer good-jwt"}})
+	if err != nil {
+		t.Fatal("Error connecting websocket: ", err)
+	}
+	defer conn.Close()
+
+	sendUpPoints(t, nc, "up.node1.child1", 4)
+
+	err = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var e StreamEvent
+	err = conn.ReadJSON(&e)
+	if err != nil {
+		t.Fatal("Error reading event: ", err)
+	}
+
+	if e.NodeID != "child1" || e.Points[0].Value != 4 {
+		t.Fatalf("unexpected event: %+v", e)
+	}
+}
+
+func TestHTTPLoggerRedactsToken(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewHTTPLogger("test: ")
+	l.SetOutput(&buf)
+
+	h := l.Handler(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		// handlers shift the path
+		req.URL.Path = "/stream"
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/nodes/node1/stream?subtree=true&token=secret-jwt", nil)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	out := buf.String()
+	if strings.Contains(out, "secret-jwt") {
+		t.Fatal("token logged: ", out)
+	}
+
+	if !strings.Contains(out, "/v1/nodes/node1/stream?") ||
+		!strings.Contains(out, "subtree=true") {
+		t.Fatal("request URI not logged: ", out)
+	}
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/client"
+)
+
+// Sync handles requests about instances that sync to this instance
+type Sync struct {
+	check     RequestValidator
+	nc        *nats.Conn
+	authToken string
+}
+
+// NewSyncHandler returns a new sync handler
+func NewSyncHandler(v RequestValidator, authToken string, nc *nats.Conn) http.Handler {
+	return &Sync{v, nc, authToken}
+}
+
+// ServeHTTP serves sync requests
+func (h *Sync) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	if req.Header.Get("Authorization") != h.authToken {
+		validUser, _ := h.check.Valid(req)
+		if !validUser {
+			http.Error(res, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	var head string
+	head, req.URL.Path = ShiftPath(req.URL.Path)
+
+	switch head {
+	case "downstream":
+		if req.Method != http.MethodGet {
+			http.Error(res, "only GET allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		nodes, err := client.GetSyncDownstream(h.nc)
+		if err != nil {
+			http.Error(res, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		err = encode(res, nodes)
+		if err != nil {
+			log.Println("Error encoding downstream instances: ", err)
+		}
+	default:
+		http.Error(res, "Not Found", http.StatusNotFound)
+	}
+}
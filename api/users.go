@@ -0,0 +1,337 @@
+package api
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// Group is a group node. Groups are used to organize users and devices.
+type Group struct {
+	ID          string `node:"id" json:"id"`
+	Parent      string `node:"parent" json:"parent"`
+	Description string `point:"description" json:"description"`
+}
+
+// typedNodes handles requests for nodes of a specific type. T is a node
+// struct that can be used with data.Encode and data.Decode.
+type typedNodes[T any] struct {
+	check     RequestValidator
+	nc        *nats.Conn
+	authToken string
+	nodeType  string
+	// clean removes fields that should not be returned, like passwords
+	clean func(*T)
+	// keep restores fields a PUT should not clear when they are left
+	// out, like passwords that are never returned
+	keep func(old T, t *T)
+}
+
+// NewUsersHandler returns a handler for user requests
+func NewUsersHandler(v RequestValidator, authToken string, nc *nats.Conn) http.Handler {
+	return &typedNodes[client.User]{
+		check:     v,
+		nc:        nc,
+		authToken: authToken,
+		nodeType:  data.NodeTypeUser,
+		clean:     func(u *client.User) { u.Pass = "" },
+		keep: func(old client.User, u *client.User) {
+			if u.Pass == "" {
+				u.Pass = old.Pass
+			}
+		},
+	}
+}
+
+// NewGroupsHandler returns a handler for group requests
+func NewGroupsHandler(v RequestValidator, authToken string, nc *nats.Conn) http.Handler {
+	return &typedNodes[Group]{
+		check:     v,
+		nc:        nc,
+		authToken: authToken,
+		nodeType:  data.NodeTypeGroup,
+	}
+}
+
+// ServeHTTP serves requests for users or groups
+func (h *typedNodes[T]) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	var userID string
+
+	if req.Header.Get("Authorization") != h.authToken {
+		var validUser bool
+		validUser, userID = h.check.Valid(req)
+		if !validUser {
+			http.Error(res, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	var id string
+	id, req.URL.Path = ShiftPath(req.URL.Path)
+
+	if id == "" {
+		switch req.Method {
+		case http.MethodGet:
+			h.list(res, userID)
+		case http.MethodPost:
+			h.insert(res, req, userID)
+		default:
+			http.Error(res, "invalid method", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+		h.get(res, id, userID)
+	case http.MethodPut, http.MethodPatch:
+		h.update(res, req, id, userID)
+	case http.MethodDelete:
+		h.delete(res, req, id, userID)
+	default:
+		http.Error(res, "invalid method", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *typedNodes[T]) decode(n data.NodeEdge) (T, error) {
+	var ret T
+	err := data.Decode(data.NodeEdgeChildren{NodeEdge: n}, &ret)
+	if h.clean != nil {
+		h.clean(&ret)
+	}
+	return ret, err
+}
+
+// list returns all nodes of this type the user can see. Requests with the
+// server auth token see the whole tree.
+func (h *typedNodes[T]) list(res http.ResponseWriter, userID string) {
+	nodes, err := h.visible(userID)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	ret := []T{}
+	seen := make(map[string]bool)
+
+	for _, n := range nodes {
+		// mirrored nodes are only returned once
+		if n.Type != h.nodeType || seen[n.ID] {
+			continue
+		}
+		seen[n.ID] = true
+
+		t, err := h.decode(n)
+		if err != nil {
+			log.Printf("Error decoding %v node: %v\n", h.nodeType, err)
+			continue
+		}
+		ret = append(ret, t)
+	}
+
+	err = encode(res, ret)
+	if err != nil {
+		log.Println("Error encoding nodes: ", err)
+	}
+}
+
+// visible returns the nodes the user can see, or all nodes in the tree if
+// userID is blank
+func (h *typedNodes[T]) visible(userID string) ([]data.NodeEdge, error) {
+	if userID != "" {
+		return client.GetNodesForUser(h.nc, userID)
+	}
+
+	root, err := client.GetRootNode(h.nc)
+	if err != nil {
+		return nil, err
+	}
+
+	tree, err := client.GetNodeTree(h.nc, root.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var ret []data.NodeEdge
+
+	var walk func(n data.NodeEdgeChildren)
+	walk = func(n data.NodeEdgeChildren) {
+		ret = append(ret, n.NodeEdge)
+		for _, c := range n.Children {
+			walk(c)
+		}
+	}
+
+	walk(tree)
+
+	return ret, nil
+}
+
+// find returns the node with the ID if it is of this type and visible to the
+// user. Errors are written to res.
+func (h *typedNodes[T]) find(res http.ResponseWriter, id, userID string) (data.NodeEdge, bool) {
+	nodes, err := client.GetNodes(h.nc, "all", id, "", false)
+	if err != nil && err != data.ErrDocumentNotFound {
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+		return data.NodeEdge{}, false
+	}
+
+	if len(nodes) < 1 || nodes[0].Type != h.nodeType {
+		http.Error(res, "Not Found", http.StatusNotFound)
+		return data.NodeEdge{}, false
+	}
+
+	if userID != "" {
+		visible, err := client.GetNodesForUser(h.nc, userID)
+		if err != nil {
+			http.Error(res, err.Error(), http.StatusInternalServerError)
+			return data.NodeEdge{}, false
+		}
+
+		for _, n := range visible {
+			if n.ID == id {
+				return nodes[0], true
+			}
+		}
+
+		http.Error(res, "Not Found", http.StatusNotFound)
+		return data.NodeEdge{}, false
+	}
+
+	return nodes[0], true
+}
+
+func (h *typedNodes[T]) get(res http.ResponseWriter, id, userID string) {
+	node, ok := h.find(res, id, userID)
+	if !ok {
+		return
+	}
+
+	t, err := h.decode(node)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = encode(res, t)
+	if err != nil {
+		log.Println("Error encoding node: ", err)
+	}
+}
+
+// update replaces the node fields with the request body for PUT, or only the
+// fields in the body for PATCH. The ID and parent are not changed.
+func (h *typedNodes[T]) update(res http.ResponseWriter, req *http.Request, id, userID string) {
+	node, ok := h.find(res, id, userID)
+	if !ok {
+		return
+	}
+
+	var old T
+	err := data.Decode(data.NodeEdgeChildren{NodeEdge: node}, &old)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var t T
+	if req.Method == http.MethodPatch {
+		t = old
+	}
+
+	if err := decode(req.Body, &t); err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.Method == http.MethodPut && h.keep != nil {
+		h.keep(old, &t)
+	}
+
+	points, err := data.DiffPoints(old, t)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	for i := range points {
+		points[i].Origin = userID
+	}
+
+	if len(points) > 0 {
+		err = client.SendNodePoints(h.nc, id, points, true)
+		if err != nil {
+			http.Error(res, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	err = encode(res, data.StandardResponse{Success: true, ID: id})
+	if err != nil {
+		log.Println("Error encoding response: ", err)
+	}
+}
+
+func (h *typedNodes[T]) insert(res http.ResponseWriter, req *http.Request, userID string) {
+	var t T
+	if err := decode(req.Body, &t); err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	node, err := data.Encode(t)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if node.Parent == "" {
+		http.Error(res, "parent is required", http.StatusBadRequest)
+		return
+	}
+
+	if node.ID == "" {
+		node.ID = uuid.New().String()
+	}
+
+	err = client.SendNode(h.nc, node, userID)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = encode(res, data.StandardResponse{Success: true, ID: node.ID})
+	if err != nil {
+		log.Println("Error encoding response: ", err)
+	}
+}
+
+// delete removes the node from the parent in the parent query parameter,
+// or from its first parent if not set
+func (h *typedNodes[T]) delete(res http.ResponseWriter, req *http.Request, id, userID string) {
+	parent := req.URL.Query().Get("parent")
+
+	node, ok := h.find(res, id, userID)
+	if !ok {
+		return
+	}
+
+	if parent == "" {
+		parent = node.Parent
+	}
+
+	err := client.DeleteNode(h.nc, id, parent, userID)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	err = encode(res, data.StandardResponse{Success: true, ID: id})
+	if err != nil {
+		log.Println("Error encoding response: ", err)
+	}
+}
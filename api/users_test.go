@@ -0,0 +1,147 @@
+package api_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/simpleiot/simpleiot/api"
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+	"github.com/simpleiot/simpleiot/server"
+)
+
+// bearerValidator accepts the bearer token as the user ID
+type bearerValidator struct{}
+
+func (bearerValidator) Valid(req *http.Request) (bool, string) {
+	id, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	return ok, id
+}
+
+func usersRequest(t *testing.T, h http.Handler, method, path, auth string, body any) *httptest.ResponseRecorder {
+	var b bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&b).Encode(body); err != nil {
+			t.Fatal("Error encoding body: ", err)
+		}
+	}
+
+	req := httptest.NewRequest(method, path, &b)
+	req.Header.Set("Authorization", auth)
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+	return res
+}
+
+func TestUsers(t *testing.T) {
+	nc, root, stop, err := server.TestServer()
+	if err != nil {
+		t.Fatal("Error starting test server: ", err)
+	}
+	defer stop()
+
+	group := api.Group{ID: "group1", Parent: root.ID, Description: "group 1"}
+	groupNode, err := data.Encode(group)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = client.SendNode(nc, groupNode, "")
+	if err != nil {
+		t.Fatal("Error sending group: ", err)
+	}
+
+	users := []client.User{
+		{ID: "user1", Parent: group.ID, FirstName: "one", Email: "one@test.com", Pass: "pass1"},
+		{ID: "user2", Parent: root.ID, FirstName: "two", Email: "two@test.com", Pass: "pass2"},
+	}
+
+	for _, u := range users {
+		n, err := data.Encode(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = client.SendNode(nc, n, "")
+		if err != nil {
+			t.Fatal("Error sending user: ", err)
+		}
+	}
+
+	h := api.NewUsersHandler(bearerValidator{}, "server-token", nc)
+
+	list := func(auth string) map[string]client.User {
+		res := usersRequest(t, h, http.MethodGet, "/", auth, nil)
+		if res.Code != http.StatusOK {
+			t.Fatal("list failed: ", res.Code, res.Body.String())
+		}
+		var l []client.User
+		if err := json.Unmarshal(res.Body.Bytes(), &l); err != nil {
+			t.Fatal("Error decoding users: ", err)
+		}
+		ret := make(map[string]client.User)
+		for _, u := range l {
+			ret[u.ID] = u
+		}
+		return ret
+	}
+
+	all := list("server-token")
+	if _, ok := all["user2"]; !ok || len(all) < 3 {
+		t.Fatal("server token should see all users: ", all)
+	}
+
+	scoped := list("Bearer user1")
+	if len(scoped) != 1 || scoped["user1"].FirstName != "one" {
+		t.Fatal("user1 should only see itself: ", scoped)
+	}
+
+	res := usersRequest(t, h, http.MethodGet, "/user2", "Bearer user1", nil)
+	if res.Code != http.StatusNotFound {
+		t.Fatal("user1 should not get user2: ", res.Code)
+	}
+
+	res = usersRequest(t, h, http.MethodPatch, "/user2", "Bearer user1",
+		map[string]string{"firstName": "hacked"})
+	if res.Code != http.StatusNotFound {
+		t.Fatal("user1 should not update user2: ", res.Code)
+	}
+
+	res = usersRequest(t, h, http.MethodPatch, "/user1", "Bearer user1",
+		map[string]string{"lastName": "last"})
+	if res.Code != http.StatusOK {
+		t.Fatal("patch failed: ", res.Code, res.Body.String())
+	}
+
+	res = usersRequest(t, h, http.MethodPut, "/user1", "server-token",
+		client.User{FirstName: "uno", Email: "uno@test.com"})
+	if res.Code != http.StatusOK {
+		t.Fatal("put failed: ", res.Code, res.Body.String())
+	}
+
+	nodes, err := client.GetNodes(nc, "all", "user1", "", false)
+	if err != nil || len(nodes) < 1 {
+		t.Fatal("Error getting user1: ", err)
+	}
+
+	var u client.User
+	err = data.Decode(data.NodeEdgeChildren{NodeEdge: nodes[0]}, &u)
+	if err != nil {
+		t.Fatal("Error decoding user1: ", err)
+	}
+
+	// PUT clears fields that are not set, except the password
+	exp := client.User{ID: "user1", Parent: group.ID, FirstName: "uno",
+		Email: "uno@test.com", Pass: "pass1"}
+	if u != exp {
+		t.Fatalf("unexpected user after update: %+v", u)
+	}
+
+	res = usersRequest(t, h, http.MethodGet, "/user1", "server-token", nil)
+	if !strings.Contains(res.Body.String(), `"firstName":"uno"`) ||
+		strings.Contains(res.Body.String(), "pass1") {
+		t.Fatal("unexpected get response: ", res.Body.String())
+	}
+}
@@ -6,11 +6,13 @@ import (
 
 // V1 handles v1 api requests
 type V1 struct {
-	GroupsHandler http.Handler
-	UsersHandler  http.Handler
-	NodesHandler  http.Handler
-	AuthHandler   http.Handler
-	MsgHandler    http.Handler
+	GroupsHandler  http.Handler
+	UsersHandler   http.Handler
+	NodesHandler   http.Handler
+	AuthHandler    http.Handler
+	SyncHandler    http.Handler
+	OpenAPIHandler http.Handler
+	IngestHandler  http.Handler
 }
 
 // Top level handler for http requests in the coap-server process
@@ -22,6 +24,16 @@ func (h *V1) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 		h.NodesHandler.ServeHTTP(res, req)
 	case "auth":
 		h.AuthHandler.ServeHTTP(res, req)
+	case "sync":
+		h.SyncHandler.ServeHTTP(res, req)
+	case "users":
+		h.UsersHandler.ServeHTTP(res, req)
+	case "groups":
+		h.GroupsHandler.ServeHTTP(res, req)
+	case "ingest":
+		h.IngestHandler.ServeHTTP(res, req)
+	case "openapi.json":
+		h.OpenAPIHandler.ServeHTTP(res, req)
 	default:
 		http.Error(res, "Not Found", http.StatusNotFound)
 	}
@@ -32,6 +44,11 @@ func NewV1Handler(args ServerArgs) http.Handler {
 	return &V1{
 		NodesHandler: NewNodesHandler(args.JwtAuth,
 			args.AuthToken, args.Nc),
-		AuthHandler: NewAuthHandler(args.Nc),
+		AuthHandler:    NewAuthHandler(args.Nc),
+		SyncHandler:    NewSyncHandler(args.JwtAuth, args.AuthToken, args.Nc),
+		UsersHandler:   NewUsersHandler(args.JwtAuth, args.AuthToken, args.Nc),
+		GroupsHandler:  NewGroupsHandler(args.JwtAuth, args.AuthToken, args.Nc),
+		OpenAPIHandler: NewOpenAPIHandler(),
+		IngestHandler:  NewIngestHandler(args.Nc),
 	}
 }
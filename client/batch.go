@@ -0,0 +1,110 @@
+package client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// Batch encodings
+const (
+	BatchEncodingNone = "none"
+	BatchEncodingGzip = "gzip"
+)
+
+// batchMaxSize limits the size of a decompressed batch so that a small
+// compressed message can't use up all memory.
+const batchMaxSize = 16 * 1024 * 1024
+
+// EncodeBatchPoints encodes a batch of points for multiple nodes into a
+// single message. Node points are stored in the Points field of an entry,
+// and edge points in the EdgePoints field (with Parent set). If compress
+// is true, the payload is gzip compressed. The subject to send the payload
+// to is returned along with the payload.
+func EncodeBatchPoints(batch data.Nodes, compress bool) (string, []byte, error) {
+	d, err := batch.ToPb()
+	if err != nil {
+		return "", nil, err
+	}
+
+	if !compress {
+		return SubjectBatchPoints(BatchEncodingNone), d, nil
+	}
+
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+
+	_, err = w.Write(d)
+	if err != nil {
+		return "", nil, err
+	}
+
+	err = w.Close()
+	if err != nil {
+		return "", nil, err
+	}
+
+	return SubjectBatchPoints(BatchEncodingGzip), buf.Bytes(), nil
+}
+
+// DecodeBatchPointsMsg decodes a NATS message created by EncodeBatchPoints
+func DecodeBatchPointsMsg(msg *nats.Msg) (data.Nodes, error) {
+	chunks := strings.Split(msg.Subject, ".")
+	if len(chunks) < 2 {
+		return nil, fmt.Errorf("Invalid batch subject: %v", msg.Subject)
+	}
+
+	d := msg.Data
+
+	switch chunks[1] {
+	case BatchEncodingNone:
+	case BatchEncodingGzip:
+		r, err := gzip.NewReader(bytes.NewReader(msg.Data))
+		if err != nil {
+			return nil, fmt.Errorf("Error decompressing batch: %w", err)
+		}
+
+		d, err = io.ReadAll(io.LimitReader(r, batchMaxSize+1))
+		if err != nil {
+			return nil, fmt.Errorf("Error decompressing batch: %w", err)
+		}
+
+		if len(d) > batchMaxSize {
+			return nil, fmt.Errorf("Decompressed batch exceeds %v bytes", batchMaxSize)
+		}
+	default:
+		return nil, fmt.Errorf("Unsupported batch encoding: %v", chunks[1])
+	}
+
+	return data.PbDecodeNodes(d)
+}
+
+// SendBatchPoints sends a batch of node and edge points. See EncodeBatchPoints.
+func SendBatchPoints(nc *nats.Conn, batch data.Nodes, compress bool, ack bool) error {
+	subject, d, err := EncodeBatchPoints(batch, compress)
+	if err != nil {
+		return err
+	}
+
+	if ack {
+		msg, err := nc.Request(subject, d, time.Second)
+		if err != nil {
+			return err
+		}
+
+		if len(msg.Data) > 0 {
+			return errors.New(string(msg.Data))
+		}
+
+		return nil
+	}
+
+	return nc.Publish(subject, d)
+}
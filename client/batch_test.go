@@ -0,0 +1,79 @@
+package client_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+func TestBatchPointsEncodeDecode(t *testing.T) {
+	now := time.Now()
+
+	batch := data.Nodes{
+		{ID: "node1", Points: data.Points{
+			{Type: data.PointTypeValue, Value: 1, Time: now},
+			{Type: data.PointTypeValue, Value: 2, Time: now.Add(time.Second)},
+		}},
+		{ID: "node2", Parent: "node1", EdgePoints: data.Points{
+			{Type: data.PointTypeTombstone, Time: now},
+		}},
+	}
+
+	for _, compress := range []bool{false, true} {
+		subject, d, err := client.EncodeBatchPoints(batch, compress)
+		if err != nil {
+			t.Fatal("Error encoding batch: ", err)
+		}
+
+		decoded, err := client.DecodeBatchPointsMsg(&nats.Msg{Subject: subject, Data: d})
+		if err != nil {
+			t.Fatal("Error decoding batch: ", err)
+		}
+
+		if len(decoded) != len(batch) {
+			t.Fatal("Decoded batch has wrong length")
+		}
+
+		if decoded[0].ID != "node1" || len(decoded[0].Points) != 2 ||
+			decoded[0].Points[1].Value != 2 {
+			t.Fatal("node points not decoded correctly: ", decoded[0])
+		}
+
+		if decoded[1].ID != "node2" || decoded[1].Parent != "node1" ||
+			len(decoded[1].EdgePoints) != 1 {
+			t.Fatal("edge points not decoded correctly: ", decoded[1])
+		}
+	}
+}
+
+func TestBatchPointsDecodeLimit(t *testing.T) {
+	// a few KB of compressed zeros expand to more than the batch limit
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	zeros := make([]byte, 1024*1024)
+	for i := 0; i < 20; i++ {
+		_, err := w.Write(zeros)
+		if err != nil {
+			t.Fatal("Error compressing: ", err)
+		}
+	}
+
+	err := w.Close()
+	if err != nil {
+		t.Fatal("Error compressing: ", err)
+	}
+
+	_, err = client.DecodeBatchPointsMsg(&nats.Msg{
+		Subject: client.SubjectBatchPoints(client.BatchEncodingGzip),
+		Data:    buf.Bytes(),
+	})
+	if err == nil || !strings.Contains(err.Error(), "exceeds") {
+		t.Fatal("oversized batch was not rejected: ", err)
+	}
+}
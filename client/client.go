@@ -45,6 +45,12 @@ func DefaultClients(nc *nats.Conn) (*Group, error) {
 	sync := NewManager(nc, NewSyncClient, nil)
 	g.Add(sync)
 
+	syncMqtt := NewManager(nc, NewSyncMQTTClient, nil)
+	g.Add(syncMqtt)
+
+	httpIngest := NewManager(nc, NewHTTPIngestClient, nil)
+	g.Add(httpIngest)
+
 	metrics := NewManager(nc, NewMetricsClient, nil)
 	g.Add(metrics)
 
@@ -0,0 +1,131 @@
+package client
+
+import (
+	"sync"
+	"time"
+)
+
+// dbBufferMemMaxCount limits the in-memory buffer when no limit is configured
+const dbBufferMemMaxCount = 1000
+
+// dbBuffer holds batches of points that could not be written to the
+// database. If a file is configured, batches are stored on disk so they
+// survive a restart, otherwise they are kept in memory.
+type dbBuffer struct {
+	lock     sync.Mutex
+	queue    *syncQueue
+	mem      []dbBufferEntry
+	nextID   int64
+	maxCount int
+	maxAge   time.Duration
+}
+
+type dbBufferEntry struct {
+	id   int64
+	time time.Time
+	data []byte
+}
+
+// newDbBuffer opens a buffer. maxCount is the maximum number of batches and
+// maxAge the maximum age of a batch. The oldest batches are dropped first
+// when either limit is exceeded.
+func newDbBuffer(file string, maxCount int, maxAge time.Duration) (*dbBuffer, error) {
+	b := &dbBuffer{maxCount: maxCount, maxAge: maxAge}
+
+	if file == "" {
+		if b.maxCount <= 0 {
+			b.maxCount = dbBufferMemMaxCount
+		}
+		return b, nil
+	}
+
+	var err error
+	b.queue, err = newSyncQueue(file, maxCount, maxAge)
+	if err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// push adds a batch to the end of the buffer
+func (b *dbBuffer) push(d []byte) error {
+	if b.queue != nil {
+		return b.queue.push("", d)
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.nextID++
+	b.mem = append(b.mem, dbBufferEntry{b.nextID, time.Now(), d})
+	b.pruneMem()
+
+	return nil
+}
+
+func (b *dbBuffer) pruneMem() {
+	if b.maxAge > 0 {
+		cutoff := time.Now().Add(-b.maxAge)
+		for len(b.mem) > 0 && b.mem[0].time.Before(cutoff) {
+			b.mem = b.mem[1:]
+		}
+	}
+
+	if len(b.mem) > b.maxCount {
+		b.mem = b.mem[len(b.mem)-b.maxCount:]
+	}
+}
+
+// len returns the number of batches in the buffer
+func (b *dbBuffer) len() (int, error) {
+	if b.queue != nil {
+		return b.queue.len()
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.pruneMem()
+	return len(b.mem), nil
+}
+
+// replay writes all buffered batches in order. A batch is only removed
+// after write returns successfully.
+func (b *dbBuffer) replay(write func(d []byte) error) error {
+	if b.queue != nil {
+		_, err := b.queue.replay(func(_ string, d []byte) error {
+			return write(d)
+		})
+		return err
+	}
+
+	for {
+		b.lock.Lock()
+		b.pruneMem()
+		if len(b.mem) == 0 {
+			b.lock.Unlock()
+			return nil
+		}
+		e := b.mem[0]
+		b.lock.Unlock()
+
+		err := write(e.data)
+		if err != nil {
+			return err
+		}
+
+		b.lock.Lock()
+		// the entry may have been pruned while we were writing
+		if len(b.mem) > 0 && b.mem[0].id == e.id {
+			b.mem = b.mem[1:]
+		}
+		b.lock.Unlock()
+	}
+}
+
+func (b *dbBuffer) close() error {
+	if b.queue != nil {
+		return b.queue.close()
+	}
+	return nil
+}
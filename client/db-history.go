@@ -0,0 +1,90 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+func (dbc *DbClient) handleHistory(msg *nats.Msg) {
+	// subject is history.<nodeID>
+	chunks := strings.Split(msg.Subject, ".")
+	if len(chunks) != 2 {
+		dbc.historyRespond(msg, nil, fmt.Errorf("invalid history subject: %v", msg.Subject))
+		return
+	}
+
+	var q data.HistoryQuery
+	err := json.Unmarshal(msg.Data, &q)
+	if err != nil {
+		dbc.historyRespond(msg, nil, fmt.Errorf("error decoding history query: %v", err))
+		return
+	}
+
+	err = q.Validate()
+	if err != nil {
+		dbc.historyRespond(msg, nil, err)
+		return
+	}
+
+	dbc.newHistory <- dbHistoryRequest{msg: msg, nodeID: chunks[1], query: q}
+}
+
+type dbHistoryRequest struct {
+	msg    *nats.Msg
+	nodeID string
+	query  data.HistoryQuery
+}
+
+// history runs a history query. Every db client receives history requests,
+// but only answers for nodes it writes points for, and only if its database
+// can be queried. Queries are run in a goroutine so that slow queries don't
+// block writes.
+func (dbc *DbClient) history(r dbHistoryRequest) {
+	backend := dbc.backend
+
+	go func() {
+		if !dbc.meta.covers(r.nodeID) {
+			return
+		}
+
+		if backend == nil {
+			dbc.historyRespond(r.msg, nil, errors.New("db backend not configured"))
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+		defer cancel()
+		points, err := backend.history(ctx, r.nodeID, r.query)
+		if errors.Is(err, errDbHistoryNotSupported) {
+			// leave the request for a db that can be queried
+			return
+		}
+		dbc.historyRespond(r.msg, points, err)
+	}()
+}
+
+func (dbc *DbClient) historyRespond(msg *nats.Msg, points data.Points, err error) {
+	res := data.HistoryResult{Points: points}
+	if err != nil {
+		res.Error = err.Error()
+	}
+
+	d, err := json.Marshal(res)
+	if err != nil {
+		log.Println("DB: error encoding history result: ", err)
+		return
+	}
+
+	err = msg.Respond(d)
+	if err != nil {
+		log.Println("DB: error responding to history request: ", err)
+	}
+}
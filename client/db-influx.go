@@ -0,0 +1,150 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+	"github.com/influxdata/influxdb-client-go/v2/api"
+	influxhttp "github.com/influxdata/influxdb-client-go/v2/api/http"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// dbInflux writes points to InfluxDB 2.x
+type dbInflux struct {
+	client   influxdb2.Client
+	writeAPI api.WriteAPIBlocking
+	org      string
+	bucket   string
+}
+
+func newDbInflux(config Db) *dbInflux {
+	client := influxdb2.NewClientWithOptions(config.URI, config.AuthToken,
+		influxdb2.DefaultOptions().SetHTTPRequestTimeout(10))
+
+	return &dbInflux{
+		client: client,
+		// we do our own buffering and retries, so use the blocking API
+		writeAPI: client.WriteAPIBlocking(config.Org, config.Bucket),
+		org:      config.Org,
+		bucket:   config.Bucket,
+	}
+}
+
+func (i *dbInflux) write(ctx context.Context, records []dbRecord) error {
+	lines := make([]string, len(records))
+
+	for j, r := range records {
+		fields := map[string]interface{}{
+			"value": r.Value,
+		}
+
+		if !r.HR {
+			fields["text"] = r.Text
+		}
+
+		p := influxdb2.NewPoint(r.Measurement, r.Tags, fields, r.Time)
+		lines[j] = write.PointToLineProtocol(p, time.Nanosecond)
+	}
+
+	err := i.writeAPI.WriteRecord(ctx, strings.Join(lines, "\n"))
+
+	var httpErr *influxhttp.Error
+	if errors.As(err, &httpErr) && dbRejectedStatus(httpErr.StatusCode) {
+		return fmt.Errorf("%w: %v", errDbRejected, err)
+	}
+
+	return err
+}
+
+func (i *dbInflux) close() {
+	i.client.Close()
+}
+
+var fluxStringReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+func fluxString(s string) string {
+	return `"` + fluxStringReplacer.Replace(s) + `"`
+}
+
+// historyFlux returns a flux query for the value field of node points
+func historyFlux(bucket, nodeID string, q data.HistoryQuery) string {
+	stop := q.Stop
+	if stop.IsZero() {
+		stop = time.Now()
+	}
+
+	filter := fmt.Sprintf(`r._measurement == "points" and r._field == "value" and r.nodeID == %v and r.type == %v`,
+		fluxString(nodeID), fluxString(q.Type))
+
+	if q.Key != "" {
+		filter += fmt.Sprintf(` and r.key == %v`, fluxString(q.Key))
+	}
+
+	query := fmt.Sprintf(`from(bucket: %v)
+  |> range(start: %v, stop: %v)
+  |> filter(fn: (r) => %v)`,
+		fluxString(bucket), q.Start.UTC().Format(time.RFC3339Nano),
+		stop.UTC().Format(time.RFC3339Nano), filter)
+
+	if q.AggregateWindow != "" {
+		// flux durations don't allow fractional units, so use ms
+		d, _ := time.ParseDuration(q.AggregateWindow)
+		fn := q.Aggregate
+		if fn == "" {
+			fn = "mean"
+		}
+		query += fmt.Sprintf(`
+  |> aggregateWindow(every: %vms, fn: %v, createEmpty: false)`, d.Milliseconds(), fn)
+	}
+
+	return query
+}
+
+func (i *dbInflux) history(ctx context.Context, nodeID string, q data.HistoryQuery) (data.Points, error) {
+	result, err := i.client.QueryAPI(i.org).Query(ctx, historyFlux(i.bucket, nodeID, q))
+	if err != nil {
+		return nil, err
+	}
+
+	defer result.Close()
+
+	var points data.Points
+
+	for result.Next() {
+		r := result.Record()
+
+		p := data.Point{Time: r.Time(), Type: q.Type}
+
+		if key, ok := r.ValueByKey("key").(string); ok {
+			p.Key = key
+		}
+
+		switch v := r.Value().(type) {
+		case float64:
+			p.Value = v
+		case int64:
+			p.Value = float64(v)
+		case uint64:
+			p.Value = float64(v)
+		}
+
+		points = append(points, p)
+	}
+
+	if result.Err() != nil {
+		return nil, result.Err()
+	}
+
+	// each key is returned in a separate table
+	sort.SliceStable(points, func(i, j int) bool {
+		return points[i].Time.Before(points[j].Time)
+	})
+
+	return points, nil
+}
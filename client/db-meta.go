@@ -0,0 +1,169 @@
+package client
+
+import (
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// dbMaxPathDepth limits how far up the tree we look when building the path
+const dbMaxPathDepth = 20
+
+// dbNodeMeta is node metadata that is added as tags to measurements
+type dbNodeMeta struct {
+	description string
+	nodeType    string
+	// descriptions of the parent nodes from the db node parent down,
+	// separated by /
+	path string
+	// custom tags from tag points on the node
+	tags map[string]string
+}
+
+// dbMeta caches node metadata so we don't need to look up the node for
+// every point that is written.
+type dbMeta struct {
+	lock  sync.Mutex
+	nc    *nats.Conn
+	top   string
+	nodes map[string]dbNodeMeta
+	// nodes that are (true) or are not (false) in the subtree of top
+	covered map[string]bool
+}
+
+func newDbMeta(nc *nats.Conn, top string) *dbMeta {
+	return &dbMeta{nc: nc, top: top, nodes: make(map[string]dbNodeMeta),
+		covered: make(map[string]bool)}
+}
+
+// get returns the metadata for a node
+func (m *dbMeta) get(nodeID string) dbNodeMeta {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if meta, ok := m.nodes[nodeID]; ok {
+		return meta
+	}
+
+	meta := dbNodeMeta{tags: make(map[string]string)}
+
+	nodes, err := GetNodes(m.nc, "all", nodeID, "", false)
+	if err != nil {
+		log.Printf("DB: error getting node %v for tags: %v\n", nodeID, err)
+		// don't cache so we try again next time
+		return meta
+	}
+
+	if len(nodes) > 0 {
+		n := nodes[0]
+		meta.description = n.Desc()
+		meta.nodeType = n.Type
+		for _, p := range n.Points {
+			if p.Type == data.PointTypeTag && p.Key != "" && p.Text != "" {
+				meta.tags[p.Key] = p.Text
+			}
+		}
+		meta.path = m.path(n)
+	}
+
+	m.nodes[nodeID] = meta
+
+	return meta
+}
+
+// path returns the descriptions of the parents of a node up to the parent
+// of the db node. If a node has more than one parent, the first is used.
+func (m *dbMeta) path(n data.NodeEdge) string {
+	var descs []string
+
+	parent := n.Parent
+	for i := 0; i < dbMaxPathDepth; i++ {
+		if parent == "" || parent == "none" || n.ID == m.top {
+			break
+		}
+
+		nodes, err := GetNodes(m.nc, "all", parent, "", false)
+		if err != nil || len(nodes) < 1 {
+			break
+		}
+
+		n = nodes[0]
+		descs = append([]string{n.Desc()}, descs...)
+		parent = n.Parent
+	}
+
+	return "/" + strings.Join(descs, "/")
+}
+
+// covers returns true if the node is the parent of the db node or below it,
+// which means the db node writes points for it.
+func (m *dbMeta) covers(nodeID string) bool {
+	m.lock.Lock()
+	c, ok := m.covered[nodeID]
+	m.lock.Unlock()
+
+	if ok {
+		return c
+	}
+
+	ids := []string{nodeID}
+	seen := map[string]bool{nodeID: true}
+
+	for i := 0; i < dbMaxPathDepth && len(ids) > 0 && !c; i++ {
+		var next []string
+		for _, id := range ids {
+			if id == m.top {
+				c = true
+				break
+			}
+
+			nodes, err := GetNodes(m.nc, "all", id, "", false)
+			if err != nil {
+				log.Printf("DB: error getting node %v: %v\n", id, err)
+				// don't cache so we try again next time
+				return false
+			}
+
+			for _, n := range nodes {
+				if !seen[n.Parent] {
+					seen[n.Parent] = true
+					next = append(next, n.Parent)
+				}
+			}
+		}
+		ids = next
+	}
+
+	m.lock.Lock()
+	m.covered[nodeID] = c
+	m.lock.Unlock()
+
+	return c
+}
+
+// update invalidates cached metadata when points that change it arrive
+func (m *dbMeta) update(nodeID string, points data.Points) {
+	for _, p := range points {
+		switch p.Type {
+		case data.PointTypeDescription, data.PointTypeTombstone:
+			// descriptions are used in the path of child nodes, and
+			// moving a node changes the path of all its children
+			m.reset()
+			return
+		case data.PointTypeTag:
+			m.lock.Lock()
+			delete(m.nodes, nodeID)
+			m.lock.Unlock()
+		}
+	}
+}
+
+func (m *dbMeta) reset() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.nodes = make(map[string]dbNodeMeta)
+	m.covered = make(map[string]bool)
+}
@@ -0,0 +1,206 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/klauspost/compress/s2"
+	"github.com/simpleiot/simpleiot/data"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// dbPrometheusPrefix is added to point types to create metric names
+const dbPrometheusPrefix = "siot_"
+
+// dbPrometheus writes numeric node points to a Prometheus remote write
+// endpoint (Prometheus, Mimir, Cortex, VictoriaMetrics, ...). Each point type
+// is a metric and the tags are labels. Text points and edge points are not
+// written.
+type dbPrometheus struct {
+	uri    string
+	token  string
+	tenant string
+	client *http.Client
+}
+
+func newDbPrometheus(config Db) *dbPrometheus {
+	return &dbPrometheus{
+		uri:    config.URI,
+		token:  config.AuthToken,
+		tenant: config.Org,
+		client: &http.Client{},
+	}
+}
+
+// promSample is a sample in a remote write time series
+type promSample struct {
+	value float64
+	// ms since epoch
+	timestamp int64
+}
+
+type promSeries struct {
+	// sorted by name
+	labels  [][2]string
+	samples []promSample
+}
+
+func (p *dbPrometheus) write(ctx context.Context, records []dbRecord) error {
+	series := make(map[string]*promSeries)
+
+	for _, r := range records {
+		if r.Measurement != "points" || r.Text != "" {
+			continue
+		}
+
+		labels := [][2]string{{"__name__", dbPrometheusPrefix + promName(r.Tags["type"])}}
+		for k, v := range r.Tags {
+			if k == "type" {
+				continue
+			}
+			labels = append(labels, [2]string{promName(k), v})
+		}
+
+		sort.Slice(labels, func(i, j int) bool {
+			return labels[i][0] < labels[j][0]
+		})
+
+		var key strings.Builder
+		for _, l := range labels {
+			key.WriteString(l[0] + "\x00" + l[1] + "\x00")
+		}
+
+		s, ok := series[key.String()]
+		if !ok {
+			s = &promSeries{labels: labels}
+			series[key.String()] = s
+		}
+
+		s.samples = append(s.samples, promSample{r.Value, r.Time.UnixMilli()})
+	}
+
+	if len(series) == 0 {
+		return nil
+	}
+
+	// samples must be in time order for each series
+	for _, s := range series {
+		sort.SliceStable(s.samples, func(i, j int) bool {
+			return s.samples[i].timestamp < s.samples[j].timestamp
+		})
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.uri,
+		bytes.NewReader(s2.EncodeSnappy(nil, promWriteRequest(series))))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	if p.token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.token)
+	}
+	if p.tenant != "" {
+		req.Header.Set("X-Scope-OrgID", p.tenant)
+	}
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode/100 == 2 {
+		return nil
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+	err = fmt.Errorf("remote write error: %v: %v", res.Status, strings.TrimSpace(string(body)))
+
+	if dbRejectedStatus(res.StatusCode) {
+		return fmt.Errorf("%w: %v", errDbRejected, err)
+	}
+
+	return err
+}
+
+// promWriteRequest encodes a prometheus.WriteRequest protobuf message
+func promWriteRequest(series map[string]*promSeries) []byte {
+	var ret []byte
+
+	for _, s := range series {
+		var ts []byte
+
+		for _, l := range s.labels {
+			var label []byte
+			label = protowire.AppendTag(label, 1, protowire.BytesType)
+			label = protowire.AppendString(label, l[0])
+			label = protowire.AppendTag(label, 2, protowire.BytesType)
+			label = protowire.AppendString(label, l[1])
+
+			ts = protowire.AppendTag(ts, 1, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, label)
+		}
+
+		for _, smp := range s.samples {
+			var sample []byte
+			sample = protowire.AppendTag(sample, 1, protowire.Fixed64Type)
+			sample = protowire.AppendFixed64(sample, math.Float64bits(smp.value))
+			sample = protowire.AppendTag(sample, 2, protowire.VarintType)
+			sample = protowire.AppendVarint(sample, uint64(smp.timestamp))
+
+			ts = protowire.AppendTag(ts, 2, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, sample)
+		}
+
+		ret = protowire.AppendTag(ret, 1, protowire.BytesType)
+		ret = protowire.AppendBytes(ret, ts)
+	}
+
+	return ret
+}
+
+// promName converts a SIOT point type or tag name to a valid Prometheus
+// metric or label name. camelCase is converted to snake_case.
+func promName(s string) string {
+	var ret strings.Builder
+
+	runes := []rune(s)
+	for i, r := range runes {
+		switch {
+		case unicode.IsUpper(r):
+			// don't split acronyms like ID
+			if i > 0 && !unicode.IsUpper(runes[i-1]) {
+				ret.WriteRune('_')
+			}
+			ret.WriteRune(unicode.ToLower(r))
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			if i == 0 && unicode.IsDigit(r) {
+				ret.WriteRune('_')
+			}
+			ret.WriteRune(r)
+		default:
+			ret.WriteRune('_')
+		}
+	}
+
+	return ret.String()
+}
+
+func (p *dbPrometheus) history(_ context.Context, _ string, _ data.HistoryQuery) (data.Points, error) {
+	return nil, errDbHistoryNotSupported
+}
+
+func (p *dbPrometheus) close() {
+	p.client.CloseIdleConnections()
+}
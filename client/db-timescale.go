@@ -0,0 +1,242 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// dbTimescaleTables maps measurements to tables
+var dbTimescaleTables = map[string]string{
+	"points":     "points",
+	"edgePoints": "edge_points",
+}
+
+var dbTimescaleColumns = []string{"time", "node_id", "parent_id", "type", "key",
+	"value", "text", "tags"}
+
+// dbTimescaleAggregates maps history aggregates to SQL
+var dbTimescaleAggregates = map[string]string{
+	"":       "avg(value)",
+	"mean":   "avg(value)",
+	"min":    "min(value)",
+	"max":    "max(value)",
+	"sum":    "sum(value)",
+	"count":  "count(value)",
+	"first":  "first(value, time)",
+	"last":   "last(value, time)",
+	"median": "percentile_cont(0.5) WITHIN GROUP (ORDER BY value)",
+}
+
+// dbTimescale writes points to PostgreSQL. If the TimescaleDB extension is
+// installed, the tables are created as hypertables.
+type dbTimescale struct {
+	pool *pgxpool.Pool
+	// the schema is created on the first write as the database may not be
+	// available when the client starts
+	schemaLock sync.Mutex
+	schemaDone bool
+}
+
+func newDbTimescale(config Db) (*dbTimescale, error) {
+	pool, err := pgxpool.New(context.Background(), config.URI)
+	if err != nil {
+		return nil, fmt.Errorf("error opening postgres: %v", err)
+	}
+
+	return &dbTimescale{pool: pool}, nil
+}
+
+func (ts *dbTimescale) schema(ctx context.Context) error {
+	ts.schemaLock.Lock()
+	defer ts.schemaLock.Unlock()
+
+	if ts.schemaDone {
+		return nil
+	}
+
+	var timescale bool
+	err := ts.pool.QueryRow(ctx,
+		`SELECT count(*) > 0 FROM pg_extension WHERE extname = 'timescaledb'`).Scan(&timescale)
+	if err != nil {
+		return err
+	}
+
+	for _, table := range dbTimescaleTables {
+		_, err := ts.pool.Exec(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %v (
+			time TIMESTAMPTZ NOT NULL,
+			node_id TEXT NOT NULL,
+			parent_id TEXT,
+			type TEXT NOT NULL,
+			key TEXT,
+			value DOUBLE PRECISION,
+			text TEXT,
+			tags JSONB)`, table))
+		if err != nil {
+			return fmt.Errorf("error creating table %v: %v", table, err)
+		}
+
+		if timescale {
+			_, err = ts.pool.Exec(ctx, `SELECT create_hypertable($1, 'time', if_not_exists => TRUE)`, table)
+			if err != nil {
+				return fmt.Errorf("error creating hypertable %v: %v", table, err)
+			}
+		}
+
+		_, err = ts.pool.Exec(ctx, fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %v_node_type_time
+			ON %v (node_id, type, time DESC)`, table, table))
+		if err != nil {
+			return fmt.Errorf("error creating index on %v: %v", table, err)
+		}
+	}
+
+	ts.schemaDone = true
+
+	return nil
+}
+
+// write uses COPY to insert points in batches
+func (ts *dbTimescale) write(ctx context.Context, records []dbRecord) error {
+	err := ts.schema(ctx)
+	if err != nil {
+		return err
+	}
+
+	rows := make(map[string][][]any)
+
+	for _, r := range records {
+		table, ok := dbTimescaleTables[r.Measurement]
+		if !ok {
+			continue
+		}
+
+		var tags map[string]string
+		for k, v := range r.Tags {
+			switch k {
+			case "nodeID", "parentID", "type", "key":
+				continue
+			}
+			if tags == nil {
+				tags = make(map[string]string)
+			}
+			tags[k] = v
+		}
+
+		var parentID, key, text, tagsValue any
+		if v := r.Tags["parentID"]; v != "" {
+			parentID = v
+		}
+		if v := r.Tags["key"]; v != "" {
+			key = v
+		}
+		if !r.HR {
+			text = r.Text
+		}
+		if tags != nil {
+			tagsValue = tags
+		}
+
+		rows[table] = append(rows[table], []any{r.Time, r.Tags["nodeID"], parentID,
+			r.Tags["type"], key, r.Value, text, tagsValue})
+	}
+
+	tx, err := ts.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		// this is a noop if the transaction was committed
+		_ = tx.Rollback(ctx)
+	}()
+
+	for table, r := range rows {
+		_, err := tx.CopyFrom(ctx, pgx.Identifier{table}, dbTimescaleColumns,
+			pgx.CopyFromRows(r))
+		if err != nil {
+			return ts.checkRejected(err)
+		}
+	}
+
+	return ts.checkRejected(tx.Commit(ctx))
+}
+
+// checkRejected marks data and constraint errors as rejected
+func (ts *dbTimescale) checkRejected(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) &&
+		(strings.HasPrefix(pgErr.Code, "22") || strings.HasPrefix(pgErr.Code, "23")) {
+		return fmt.Errorf("%w: %v", errDbRejected, err)
+	}
+	return err
+}
+
+// history queries node points. Aggregation requires the TimescaleDB
+// extension.
+func (ts *dbTimescale) history(ctx context.Context, nodeID string, q data.HistoryQuery) (data.Points, error) {
+	stop := q.Stop
+	if stop.IsZero() {
+		stop = time.Now()
+	}
+
+	args := []any{nodeID, q.Type, q.Start, stop}
+	where := `node_id = $1 AND type = $2 AND time >= $3 AND time < $4`
+	if q.Key != "" {
+		args = append(args, q.Key)
+		where += fmt.Sprintf(` AND key = $%v`, len(args))
+	}
+
+	var query string
+
+	if q.AggregateWindow == "" {
+		query = fmt.Sprintf(`SELECT time, coalesce(key, ''), value FROM points
+			WHERE %v ORDER BY time`, where)
+	} else {
+		agg, ok := dbTimescaleAggregates[q.Aggregate]
+		if !ok {
+			return nil, fmt.Errorf("invalid history aggregate: %v", q.Aggregate)
+		}
+
+		d, _ := time.ParseDuration(q.AggregateWindow)
+		args = append(args, fmt.Sprintf("%v milliseconds", d.Milliseconds()))
+		query = fmt.Sprintf(`SELECT time_bucket($%v::interval, time) AS t,
+			coalesce(key, ''), (%v)::double precision FROM points WHERE %v GROUP BY t, key ORDER BY t`,
+			len(args), agg, where)
+	}
+
+	rows, err := ts.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var points data.Points
+
+	for rows.Next() {
+		p := data.Point{Type: q.Type}
+		var value *float64
+		err := rows.Scan(&p.Time, &p.Key, &value)
+		if err != nil {
+			return nil, err
+		}
+		if value != nil {
+			p.Value = *value
+		}
+		points = append(points, p)
+	}
+
+	return points, rows.Err()
+}
+
+func (ts *dbTimescale) close() {
+	ts.pool.Close()
+}
@@ -1,12 +1,17 @@
 package client
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
+	"os"
+	"path"
 	"strings"
+	"time"
 
-	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
-	"github.com/influxdata/influxdb-client-go/v2/api"
 	"github.com/nats-io/nats.go"
 	"github.com/simpleiot/simpleiot/data"
 )
@@ -16,10 +21,91 @@ type Db struct {
 	ID          string `node:"id"`
 	Parent      string `node:"parent"`
 	Description string `point:"description"`
-	URI         string `point:"uri"`
-	Org         string `point:"org"`
-	Bucket      string `point:"bucket"`
-	AuthToken   string `point:"authToken"`
+	// Type is the database backend: influx (default), timescale, or
+	// prometheus
+	Type      string `point:"type"`
+	URI       string `point:"uri"`
+	Org       string `point:"org"`
+	Bucket    string `point:"bucket"`
+	AuthToken string `point:"authToken"`
+	// node metadata to add as tags to each measurement. Custom tags are
+	// added from tag points on the node.
+	TagDescription bool `point:"tagDescription"`
+	TagNodeType    bool `point:"tagNodeType"`
+	TagPath        bool `point:"tagPath"`
+	// BufferFile is where points are stored while the database is
+	// unavailable. If blank, a file in the SIOT data directory is used.
+	BufferFile           string `point:"bufferFile"`
+	BufferMaxCount       int    `point:"bufferMaxCount"`
+	BufferMaxAge         int    `point:"bufferMaxAge"`
+	BufferDepth          int    `point:"bufferDepth"`
+	WriteErrorCount      int    `point:"writeErrorCount"`
+	WriteErrorCountReset bool   `point:"writeErrorCountReset"`
+	Error                string `point:"error"`
+}
+
+// dbFlushPeriod is how often points are written to the database
+const dbFlushPeriod = time.Second
+
+// dbMaxBackoff is the maximum time between write retries
+const dbMaxBackoff = 5 * time.Minute
+
+type dbWriteResult struct {
+	records []dbRecord
+	err     error
+}
+
+// dbRecord is a point along with the tags it is stored with. Records are
+// JSON encoded when they are buffered.
+type dbRecord struct {
+	// Measurement is points or edgePoints
+	Measurement string            `json:"measurement"`
+	Tags        map[string]string `json:"tags"`
+	Value       float64           `json:"value"`
+	Text        string            `json:"text,omitempty"`
+	// HR is set for high rate points, which only have a value
+	HR   bool      `json:"hr,omitempty"`
+	Time time.Time `json:"time"`
+}
+
+// errDbRejected is returned by a backend when the database rejects the data,
+// so retrying the write won't help.
+var errDbRejected = errors.New("data rejected by database")
+
+// dbRejectedStatus returns true if an HTTP status code means the database
+// rejected the data itself (malformed or too large). Other errors such as
+// auth or a wrong URL are retried after they are fixed, so the data is kept.
+func dbRejectedStatus(code int) bool {
+	switch code {
+	case http.StatusBadRequest,
+		http.StatusRequestEntityTooLarge,
+		http.StatusUnprocessableEntity:
+		return true
+	}
+	return false
+}
+
+// errDbHistoryNotSupported is returned by backends that can't be queried
+var errDbHistoryNotSupported = errors.New("history queries are not supported by this database type")
+
+// dbBackend writes records to a database
+type dbBackend interface {
+	write(ctx context.Context, records []dbRecord) error
+	history(ctx context.Context, nodeID string, q data.HistoryQuery) (data.Points, error)
+	close()
+}
+
+func newDbBackend(config Db) (dbBackend, error) {
+	switch config.Type {
+	case "", data.PointValueInflux:
+		return newDbInflux(config), nil
+	case data.PointValueTimescale:
+		return newDbTimescale(config)
+	case data.PointValuePrometheus:
+		return newDbPrometheus(config), nil
+	default:
+		return nil, fmt.Errorf("unknown db type: %v", config.Type)
+	}
 }
 
 // DbClient is a SIOT database client
@@ -30,10 +116,21 @@ type DbClient struct {
 	newPoints     chan NewPoints
 	newEdgePoints chan NewPoints
 	newDbPoints   chan NewPoints
+	newHrPoints   chan NewPoints
+	writeDone     chan dbWriteResult
 	upSub         *nats.Subscription
+	upSubEdge     *nats.Subscription
 	upSubHr       *nats.Subscription
-	client        influxdb2.Client
-	writeAPI      api.WriteAPI
+	historySub    *nats.Subscription
+	newHistory    chan dbHistoryRequest
+	meta          *dbMeta
+	backend       dbBackend
+	buffer        *dbBuffer
+	// records waiting to be written
+	records  []dbRecord
+	writing  bool
+	attempts int
+	retry    time.Time
 }
 
 // NewDbClient ...
@@ -45,6 +142,10 @@ func NewDbClient(nc *nats.Conn, config Db) Client {
 		newPoints:     make(chan NewPoints),
 		newEdgePoints: make(chan NewPoints),
 		newDbPoints:   make(chan NewPoints),
+		newHrPoints:   make(chan NewPoints),
+		writeDone:     make(chan dbWriteResult),
+		newHistory:    make(chan dbHistoryRequest),
+		meta:          newDbMeta(nc, config.Parent),
 	}
 }
 
@@ -52,7 +153,6 @@ func NewDbClient(nc *nats.Conn, config Db) Client {
 func (dbc *DbClient) Run() error {
 	log.Println("Starting db client: ", dbc.config.Description)
 
-	// FIXME, we probably want to store edge points too ...
 	subject := fmt.Sprintf("up.%v.*", dbc.config.Parent)
 
 	var err error
@@ -77,6 +177,29 @@ func (dbc *DbClient) Run() error {
 		return err
 	}
 
+	subjectEdge := fmt.Sprintf("up.%v.*.*", dbc.config.Parent)
+
+	dbc.upSubEdge, err = dbc.nc.Subscribe(subjectEdge, func(msg *nats.Msg) {
+		points, err := data.PbDecodePoints(msg.Data)
+		if err != nil {
+			log.Println("Error decoding points in db upSubEdge: ", err)
+			return
+		}
+
+		// find node and parent ID for points
+		chunks := strings.Split(msg.Subject, ".")
+		if len(chunks) != 4 {
+			log.Println("db client up edge sub, malformed subject: ", msg.Subject)
+			return
+		}
+
+		dbc.newDbPoints <- NewPoints{chunks[2], chunks[3], points}
+	})
+
+	if err != nil {
+		return err
+	}
+
 	subjectHR := fmt.Sprintf("phrup.%v.*", dbc.config.Parent)
 
 	dbc.upSubHr, err = dbc.nc.Subscribe(subjectHR, func(msg *nats.Msg) {
@@ -87,52 +210,36 @@ func (dbc *DbClient) Run() error {
 			return
 		}
 
-		nodeID := chunks[2]
+		var points data.Points
 
 		err := data.DecodeSerialHrPayload(msg.Data, func(pt data.Point) {
-			p := influxdb2.NewPoint("points",
-				map[string]string{
-					"nodeID": nodeID,
-					"key":    pt.Key,
-					"type":   pt.Type,
-				},
-				map[string]interface{}{
-					"value": pt.Value,
-				},
-				pt.Time)
-			dbc.writeAPI.WritePoint(p)
+			points = append(points, pt)
 		})
 
 		if err != nil {
 			log.Println("DB: error decoding HR data: ", err)
 		}
+
+		if len(points) > 0 {
+			dbc.newHrPoints <- NewPoints{chunks[2], "", points}
+		}
 	})
 
 	if err != nil {
 		return fmt.Errorf("Rule error subscribing to upsub: %v", err)
 	}
 
-	setupAPI := func() {
-		log.Println("Setting up Influx API")
-		// you can set things like retries, batching, precision, etc in client options.
-		dbc.client = influxdb2.NewClientWithOptions(dbc.config.URI,
-			dbc.config.AuthToken, influxdb2.DefaultOptions())
-		dbc.writeAPI = dbc.client.WriteAPI(dbc.config.Org, dbc.config.Bucket)
-
-		influxErrors := dbc.writeAPI.Errors()
+	dbc.historySub, err = dbc.nc.Subscribe(SubjectHistory("*"), dbc.handleHistory)
 
-		go func() {
-			for err := range influxErrors {
-				if err != nil {
-					log.Println("Influx write error: ", err)
-				}
-
-			}
-			log.Println("Influxdb write api closed")
-		}()
+	if err != nil {
+		return fmt.Errorf("DB error subscribing to history requests: %v", err)
 	}
 
-	setupAPI()
+	dbc.setupBackend()
+	dbc.openBuffer()
+
+	flushTicker := time.NewTicker(dbFlushPeriod)
+	defer flushTicker.Stop()
 
 done:
 	for {
@@ -148,13 +255,32 @@ done:
 
 			for _, p := range pts.Points {
 				switch p.Type {
-				case data.PointTypeURI,
+				case data.PointTypeType,
+					data.PointTypeURI,
 					data.PointTypeOrg,
 					data.PointTypeBucket,
 					data.PointTypeAuthToken:
-					// we need to restart the influx write API
-					dbc.client.Close()
-					setupAPI()
+					// we need to restart the backend
+					dbc.setupBackend()
+				case data.PointTypeBufferFile,
+					data.PointTypeBufferMaxCount,
+					data.PointTypeBufferMaxAge:
+					dbc.openBuffer()
+				}
+			}
+
+			if dbc.config.WriteErrorCountReset {
+				dbc.config.WriteErrorCount = 0
+				dbc.config.WriteErrorCountReset = false
+
+				points := data.Points{
+					{Type: data.PointTypeWriteErrorCount, Value: 0},
+					{Type: data.PointTypeWriteErrorCountReset, Value: 0},
+				}
+
+				err = SendPoints(dbc.nc, SubjectNodePoints(dbc.config.ID), points, false)
+				if err != nil {
+					log.Println("Error resetting db write error count: ", err)
 				}
 			}
 
@@ -164,28 +290,358 @@ done:
 				log.Println("error merging new points: ", err)
 			}
 		case pts := <-dbc.newDbPoints:
+			dbc.meta.update(pts.ID, pts.Points)
+			for _, point := range pts.Points {
+				dbc.addPoint(pts.ID, pts.Parent, point, false)
+			}
+		case pts := <-dbc.newHrPoints:
 			for _, point := range pts.Points {
-				p := influxdb2.NewPoint("points",
-					map[string]string{
-						"nodeID": pts.ID,
-						"key":    point.Key,
-						"type":   point.Type,
-					},
-					map[string]interface{}{
-						"value": point.Value,
-						"text":  point.Text,
-					},
-					point.Time)
-				dbc.writeAPI.WritePoint(p)
+				dbc.addPoint(pts.ID, "", point, true)
 			}
+		case r := <-dbc.newHistory:
+			dbc.history(r)
+		case <-flushTicker.C:
+			dbc.flush()
+		case r := <-dbc.writeDone:
+			dbc.writeComplete(r)
 		}
 	}
 
 	// clean up
-	dbc.client.Close()
+	for _, sub := range []*nats.Subscription{dbc.upSub, dbc.upSubEdge, dbc.upSubHr, dbc.historySub} {
+		err := sub.Unsubscribe()
+		if err != nil {
+			log.Println("DB: error unsubscribing: ", err)
+		}
+	}
+
+	if dbc.writing {
+		dbc.writeComplete(<-dbc.writeDone)
+	}
+
+	// save anything we have not written yet so it is written next time
+	if len(dbc.records) > 0 && dbc.buffer != nil {
+		dbc.bufferRecords(dbc.records)
+	}
+
+	if dbc.buffer != nil {
+		err := dbc.buffer.close()
+		if err != nil {
+			log.Println("DB: error closing buffer: ", err)
+		}
+	}
+
+	if dbc.backend != nil {
+		dbc.backend.close()
+	}
+
 	return nil
 }
 
+// setupBackend (re)creates the backend after the db type or connection
+// settings change.
+func (dbc *DbClient) setupBackend() {
+	if dbc.writing {
+		// wait for the write in progress to finish with the old backend
+		dbc.writeComplete(<-dbc.writeDone)
+	}
+
+	if dbc.backend != nil {
+		dbc.backend.close()
+		dbc.backend = nil
+	}
+
+	log.Printf("DB: %v: setting up %v backend\n", dbc.config.Description, dbc.config.Type)
+
+	var err error
+	dbc.backend, err = newDbBackend(dbc.config)
+	if err != nil {
+		log.Printf("DB: %v: %v\n", dbc.config.Description, err)
+	}
+
+	// retry right away with the new settings
+	dbc.attempts = 0
+	dbc.retry = time.Time{}
+}
+
+func (dbc *DbClient) bufferRecords(records []dbRecord) {
+	d, err := json.Marshal(records)
+	if err != nil {
+		log.Println("DB: error encoding points: ", err)
+		return
+	}
+
+	err = dbc.buffer.push(d)
+	if err != nil {
+		log.Println("DB: error buffering points: ", err)
+	}
+}
+
+// addPoint queues a point to be written to the database. Node points are
+// written to the points measurement and edge points to the edgePoints
+// measurement. High rate points only have a value.
+func (dbc *DbClient) addPoint(nodeID, parentID string, point data.Point, hr bool) {
+	if point.Time.IsZero() {
+		point.Time = time.Now()
+	}
+
+	measurement := "points"
+	tags := map[string]string{
+		"nodeID": nodeID,
+		"key":    point.Key,
+		"type":   point.Type,
+	}
+
+	if parentID != "" {
+		measurement = "edgePoints"
+		tags["parentID"] = parentID
+	}
+
+	dbc.addTags(nodeID, tags)
+
+	// blank tags are not stored
+	for k, v := range tags {
+		if v == "" {
+			delete(tags, k)
+		}
+	}
+
+	r := dbRecord{
+		Measurement: measurement,
+		Tags:        tags,
+		Value:       point.Value,
+		HR:          hr,
+		Time:        point.Time,
+	}
+
+	if !hr {
+		r.Text = point.Text
+	}
+
+	dbc.records = append(dbc.records, r)
+}
+
+// addTags adds node metadata tags. Custom tags never replace the standard
+// tags.
+func (dbc *DbClient) addTags(nodeID string, tags map[string]string) {
+	meta := dbc.meta.get(nodeID)
+
+	for k, v := range meta.tags {
+		if _, ok := tags[k]; !ok {
+			tags[k] = v
+		}
+	}
+
+	if dbc.config.TagDescription && meta.description != "" {
+		tags["description"] = meta.description
+	}
+
+	if dbc.config.TagNodeType && meta.nodeType != "" {
+		tags["nodeType"] = meta.nodeType
+	}
+
+	if dbc.config.TagPath {
+		tags["path"] = meta.path
+	}
+}
+
+// openBuffer (re)opens the buffer used to store points while the database
+// is unavailable. Points in an in-memory buffer are moved to the new buffer.
+func (dbc *DbClient) openBuffer() {
+	if dbc.writing {
+		// wait for the write in progress to finish with the old buffer
+		dbc.writeComplete(<-dbc.writeDone)
+	}
+
+	b, err := newDbBuffer(dbBufferFile(dbc.config), dbc.config.BufferMaxCount,
+		time.Duration(dbc.config.BufferMaxAge)*time.Hour)
+	if err != nil {
+		log.Printf("DB: %v: error opening buffer, buffering in memory: %v\n",
+			dbc.config.Description, err)
+		b, _ = newDbBuffer("", dbc.config.BufferMaxCount,
+			time.Duration(dbc.config.BufferMaxAge)*time.Hour)
+	}
+
+	if dbc.buffer != nil {
+		if dbc.buffer.queue == nil {
+			err := dbc.buffer.replay(b.push)
+			if err != nil {
+				log.Println("DB: error moving buffered points: ", err)
+			}
+		}
+
+		err := dbc.buffer.close()
+		if err != nil {
+			log.Println("DB: error closing buffer: ", err)
+		}
+	}
+
+	dbc.buffer = b
+	dbc.sendBufferDepth()
+}
+
+// dbBufferFile returns the buffer file for a db node. If no file is
+// configured, the buffer is stored in the SIOT data directory.
+func dbBufferFile(config Db) string {
+	if config.BufferFile != "" {
+		return config.BufferFile
+	}
+
+	dir := os.Getenv("SIOT_DATA")
+	if dir == "" {
+		dir = "./"
+	}
+
+	return path.Join(dir, "db-buffer-"+config.ID+".sqlite")
+}
+
+// flush starts writing buffered and new points to the database. Writes
+// happen in a goroutine so that we keep receiving points while the database
+// is slow or unavailable. While writes are failing, we back off and new
+// points are added to the buffer.
+func (dbc *DbClient) flush() {
+	if dbc.writing {
+		return
+	}
+
+	if time.Now().Before(dbc.retry) {
+		// store new points in the buffer right away so they are not lost
+		// if we are stopped before the next retry
+		if len(dbc.records) > 0 {
+			dbc.bufferRecords(dbc.records)
+			dbc.records = nil
+			dbc.sendBufferDepth()
+		}
+		return
+	}
+
+	depth, err := dbc.buffer.len()
+	if err != nil {
+		log.Println("DB: error reading buffer: ", err)
+	}
+
+	if len(dbc.records) == 0 && depth == 0 {
+		return
+	}
+
+	records := dbc.records
+	dbc.records = nil
+
+	backend := dbc.backend
+	buffer := dbc.buffer
+
+	if backend == nil {
+		// the backend is misconfigured, so keep the points until it is fixed
+		dbc.writeComplete(dbWriteResult{records, errors.New("db backend not configured")})
+		return
+	}
+
+	dbc.writing = true
+
+	go func() {
+		write := func(records []dbRecord) error {
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+			defer cancel()
+			err := backend.write(ctx, records)
+			if errors.Is(err, errDbRejected) {
+				// retrying won't help
+				log.Println("DB: points rejected, dropping: ", err)
+				return nil
+			}
+			return err
+		}
+
+		// buffered points are written first so points are written in order
+		err := buffer.replay(func(d []byte) error {
+			var buffered []dbRecord
+			err := json.Unmarshal(d, &buffered)
+			if err != nil {
+				log.Println("DB: error decoding buffered points, dropping: ", err)
+				return nil
+			}
+			return write(buffered)
+		})
+
+		if err == nil && len(records) > 0 {
+			err = write(records)
+		}
+
+		dbc.writeDone <- dbWriteResult{records, err}
+	}()
+}
+
+func (dbc *DbClient) writeComplete(r dbWriteResult) {
+	dbc.writing = false
+
+	if r.err == nil {
+		if dbc.attempts > 0 {
+			log.Printf("DB: %v: write recovered after %v attempts\n",
+				dbc.config.Description, dbc.attempts)
+			dbc.attempts = 0
+			dbc.retry = time.Time{}
+		}
+
+		dbc.sendBufferDepth()
+
+		if dbc.config.Error != "" {
+			dbc.config.Error = ""
+			err := SendNodePoint(dbc.nc, dbc.config.ID,
+				data.Point{Type: data.PointTypeError, Text: ""}, false)
+			if err != nil {
+				log.Println("DB: error sending error point: ", err)
+			}
+		}
+		return
+	}
+
+	if len(r.records) > 0 {
+		dbc.bufferRecords(r.records)
+	}
+
+	dbc.attempts++
+	backoff := ExpBackoff(dbc.attempts, dbMaxBackoff)
+	dbc.retry = time.Now().Add(backoff)
+
+	log.Printf("DB: %v: write error, retrying in %v: %v\n",
+		dbc.config.Description, backoff.Round(time.Second), r.err)
+
+	dbc.config.WriteErrorCount++
+	dbc.config.Error = r.err.Error()
+
+	points := data.Points{
+		{Type: data.PointTypeWriteErrorCount, Value: float64(dbc.config.WriteErrorCount)},
+		{Type: data.PointTypeError, Text: dbc.config.Error},
+	}
+
+	err := SendNodePoints(dbc.nc, dbc.config.ID, points, false)
+	if err != nil {
+		log.Println("DB: error sending write error points: ", err)
+	}
+
+	dbc.sendBufferDepth()
+}
+
+// sendBufferDepth updates the bufferDepth point if it has changed
+func (dbc *DbClient) sendBufferDepth() {
+	depth, err := dbc.buffer.len()
+	if err != nil {
+		log.Println("DB: error reading buffer: ", err)
+		return
+	}
+
+	if depth == dbc.config.BufferDepth {
+		return
+	}
+
+	dbc.config.BufferDepth = depth
+
+	err = SendNodePoint(dbc.nc, dbc.config.ID,
+		data.Point{Type: data.PointTypeBufferDepth, Value: float64(depth)}, false)
+	if err != nil {
+		log.Println("DB: error sending buffer depth: ", err)
+	}
+}
+
 // Stop sends a signal to the Run function to exit
 func (dbc *DbClient) Stop(_ error) {
 	close(dbc.stop)
@@ -0,0 +1,394 @@
+package client
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// exporterMaxDepth limits how deep we walk the node tree when collecting
+// exported points
+const exporterMaxDepth = 30
+
+// Exporter selects which node points are exposed on the HTTP /metrics
+// endpoint for Prometheus to scrape.
+type Exporter struct {
+	ID          string `node:"id"`
+	Parent      string `node:"parent"`
+	Description string `point:"description"`
+	// comma separated list of node IDs. The subtree under each of these
+	// nodes is exported. If blank, the subtree under the parent of the
+	// exporter node is exported.
+	ExportNodes string `point:"exportNodes"`
+	// comma separated list of point types. If blank, all numeric points
+	// are exported.
+	ExportPointTypes string `point:"exportPointTypes"`
+	// the scrape request must include this token as a bearer token
+	AuthToken string `point:"authToken"`
+	// if set and there is no auth token, points are exported to anyone
+	AllowAnonymous bool `point:"allowAnonymous"`
+	Disable        bool `point:"disable"`
+}
+
+// authorized returns true if a scrape request with this bearer token may
+// read the points selected by the exporter. Exporters without an auth token
+// are only used if anonymous requests are allowed.
+func (e Exporter) authorized(token string) bool {
+	if e.AuthToken == "" {
+		return e.AllowAnonymous
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(e.AuthToken)) == 1
+}
+
+// ExportedPoint is a numeric node point selected by an exporter node
+type ExportedPoint struct {
+	NodeID      string
+	Description string
+	NodeType    string
+	Parent      string
+	Point       data.Point
+}
+
+// GetExportedPoints walks the node tree, finds all exporter nodes, and
+// returns the points they select. Exporter nodes are only included if token
+// matches their auth token, or they allow anonymous requests. Points are returned once, even if they are
+// selected by more than one exporter. Use ExporterCache to avoid walking the
+// tree for every request.
+func GetExportedPoints(nc *nats.Conn, token string) ([]ExportedPoint, error) {
+	tree, err := getExporterTree(nc)
+	if err != nil {
+		return nil, err
+	}
+
+	return exportedPoints(tree, token), nil
+}
+
+func getExporterTree(nc *nats.Conn) (*data.NodeEdgeChildren, error) {
+	root, err := GetRootNode(nc)
+	if err != nil {
+		return nil, fmt.Errorf("error getting root node: %w", err)
+	}
+
+	tree := data.NodeEdgeChildren{NodeEdge: root}
+	err = exporterTree(nc, &tree, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tree, nil
+}
+
+// exporterIndex calls fn for every node in the tree
+func exporterIndex(n *data.NodeEdgeChildren, fn func(n *data.NodeEdgeChildren)) {
+	fn(n)
+	for i := range n.Children {
+		exporterIndex(&n.Children[i], fn)
+	}
+}
+
+func exportedPoints(tree *data.NodeEdgeChildren, token string) []ExportedPoint {
+	// index all nodes in the tree so we can find the exported subtrees
+	nodes := make(map[string]*data.NodeEdgeChildren)
+	var exporters []Exporter
+
+	exporterIndex(tree, func(n *data.NodeEdgeChildren) {
+		if _, ok := nodes[n.ID]; !ok {
+			nodes[n.ID] = n
+		}
+
+		if n.Type == data.NodeTypeExporter {
+			var e Exporter
+			err := data.Decode(*n, &e)
+			if err == nil {
+				exporters = append(exporters, e)
+			}
+		}
+	})
+
+	var ret []ExportedPoint
+	seen := make(map[string]bool)
+
+	var collect func(n *data.NodeEdgeChildren, pointTypes map[string]bool)
+	collect = func(n *data.NodeEdgeChildren, pointTypes map[string]bool) {
+		for _, p := range n.Points {
+			if p.Text != "" || p.Tombstone != 0 {
+				continue
+			}
+
+			if len(pointTypes) > 0 && !pointTypes[p.Type] {
+				continue
+			}
+
+			key := n.ID + "." + n.Parent + "." + p.Type + "." + p.Key
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			ret = append(ret, ExportedPoint{
+				NodeID:      n.ID,
+				Description: n.Desc(),
+				NodeType:    n.Type,
+				Parent:      n.Parent,
+				Point:       p,
+			})
+		}
+
+		for i := range n.Children {
+			collect(&n.Children[i], pointTypes)
+		}
+	}
+
+	for _, e := range exporters {
+		if e.Disable || !e.authorized(token) {
+			continue
+		}
+
+		pointTypes := splitList(e.ExportPointTypes)
+
+		subtrees := splitList(e.ExportNodes)
+		if len(subtrees) == 0 {
+			subtrees = map[string]bool{e.Parent: true}
+		}
+
+		for id := range subtrees {
+			n, ok := nodes[id]
+			if !ok {
+				continue
+			}
+			collect(n, pointTypes)
+		}
+	}
+
+	return ret
+}
+
+func exporterTree(nc *nats.Conn, node *data.NodeEdgeChildren, depth int) error {
+	if depth >= exporterMaxDepth {
+		return nil
+	}
+
+	children, err := GetNodes(nc, node.ID, "all", "", false)
+	if err != nil {
+		return fmt.Errorf("error getting children of %v: %w", node.ID, err)
+	}
+
+	for _, c := range children {
+		nec := data.NodeEdgeChildren{NodeEdge: c}
+		err := exporterTree(nc, &nec, depth+1)
+		if err != nil {
+			return err
+		}
+		node.Children = append(node.Children, nec)
+	}
+
+	return nil
+}
+
+// ExporterCache caches the node tree so that exported points can be returned
+// without walking the tree for each request. Node point changes are applied
+// to the cached tree. Edge point changes (nodes added, moved, or deleted) mark
+// the cache stale, and the tree is walked again on the next request.
+type ExporterCache struct {
+	nc   *nats.Conn
+	subs []*nats.Subscription
+	// only one request walks the tree at a time
+	walkLock sync.Mutex
+
+	lock sync.Mutex
+	// nil if the tree needs to be walked
+	tree *data.NodeEdgeChildren
+	// all instances of each node in the tree (mirrored nodes occur more
+	// than once)
+	nodes map[string][]*data.NodeEdgeChildren
+	// point changes received while the tree is being walked
+	walking bool
+	pending []NewPoints
+	// set if an edge changed while the tree was being walked
+	stale bool
+}
+
+// NewExporterCache subscribes to point changes and returns a new cache.
+// Close must be called when done.
+func NewExporterCache(nc *nats.Conn) (*ExporterCache, error) {
+	c := &ExporterCache{nc: nc}
+
+	sub, err := nc.Subscribe(SubjectNodeAllPoints(), func(msg *nats.Msg) {
+		id, points, err := DecodeNodePointsMsg(msg)
+		if err != nil {
+			return
+		}
+		c.update(NewPoints{ID: id, Points: points})
+	})
+	if err != nil {
+		return nil, err
+	}
+	c.subs = append(c.subs, sub)
+
+	sub, err = nc.Subscribe(SubjectEdgeAllPoints(), func(_ *nats.Msg) {
+		c.lock.Lock()
+		defer c.lock.Unlock()
+		c.tree = nil
+		c.nodes = nil
+		if c.walking {
+			c.stale = true
+		}
+	})
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	c.subs = append(c.subs, sub)
+
+	return c, nil
+}
+
+func (c *ExporterCache) update(pts NewPoints) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.walking {
+		c.pending = append(c.pending, pts)
+	}
+
+	for _, n := range c.nodes[pts.ID] {
+		for _, p := range pts.Points {
+			n.Points.Add(p)
+		}
+	}
+}
+
+// walk walks the node tree and caches it. c.walkLock must be held.
+func (c *ExporterCache) walk() (*data.NodeEdgeChildren, error) {
+	c.lock.Lock()
+	c.walking = true
+	c.stale = false
+	c.pending = nil
+	c.lock.Unlock()
+
+	// don't block point updates while walking the tree
+	tree, err := getExporterTree(c.nc)
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.walking = false
+	pending := c.pending
+	c.pending = nil
+
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make(map[string][]*data.NodeEdgeChildren)
+	exporterIndex(tree, func(n *data.NodeEdgeChildren) {
+		nodes[n.ID] = append(nodes[n.ID], n)
+	})
+
+	// apply changes that may have been missed while walking
+	for _, pts := range pending {
+		for _, n := range nodes[pts.ID] {
+			for _, p := range pts.Points {
+				n.Points.Add(p)
+			}
+		}
+	}
+
+	if !c.stale {
+		c.tree = tree
+		c.nodes = nodes
+	}
+
+	return tree, nil
+}
+
+// GetExportedPoints returns the points selected by exporter nodes. See
+// GetExportedPoints for details.
+func (c *ExporterCache) GetExportedPoints(token string) ([]ExportedPoint, error) {
+	c.walkLock.Lock()
+	defer c.walkLock.Unlock()
+
+	c.lock.Lock()
+	tree := c.tree
+	c.lock.Unlock()
+
+	if tree == nil {
+		var err error
+		tree, err = c.walk()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return exportedPoints(tree, token), nil
+}
+
+// Close unsubscribes from point changes
+func (c *ExporterCache) Close() {
+	for _, sub := range c.subs {
+		err := sub.Unsubscribe()
+		if err != nil {
+			log.Println("Exporter: error unsubscribing: ", err)
+		}
+	}
+}
+
+// FormatPrometheus formats exported points in the Prometheus text exposition
+// format. Each point type is a gauge named siot_<type> in snake_case.
+func FormatPrometheus(points []ExportedPoint) []byte {
+	metrics := make(map[string][]string)
+
+	for _, p := range points {
+		name := dbPrometheusPrefix + promName(p.Point.Type)
+
+		labels := []string{
+			promLabel("node_id", p.NodeID),
+			promLabel("description", p.Description),
+			promLabel("type", p.NodeType),
+			promLabel("parent", p.Parent),
+		}
+
+		if p.Point.Key != "" && p.Point.Key != "0" {
+			labels = append(labels, promLabel("key", p.Point.Key))
+		}
+
+		metrics[name] = append(metrics[name], fmt.Sprintf("%v{%v} %v", name,
+			strings.Join(labels, ","),
+			strconv.FormatFloat(p.Point.Value, 'g', -1, 64)))
+	}
+
+	names := make([]string, 0, len(metrics))
+	for name := range metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var ret bytes.Buffer
+
+	for _, name := range names {
+		samples := metrics[name]
+		sort.Strings(samples)
+		fmt.Fprintf(&ret, "# TYPE %v gauge\n", name)
+		for _, s := range samples {
+			ret.WriteString(s + "\n")
+		}
+	}
+
+	return ret.Bytes()
+}
+
+func promLabel(name, value string) string {
+	value = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+	return name + `="` + value + `"`
+}
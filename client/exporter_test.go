@@ -0,0 +1,196 @@
+package client_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+	"github.com/simpleiot/simpleiot/server"
+)
+
+func TestExporter(t *testing.T) {
+	nc, root, stop, err := server.TestServer()
+
+	if err != nil {
+		t.Fatal("Error starting test server: ", err)
+	}
+
+	defer stop()
+
+	v := client.Variable{ID: "var1", Parent: root.ID, Description: "tank \"A\"", Value: 23.5}
+	err = client.SendNodeType(nc, v, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	e := client.Exporter{
+		ID:               "exp1",
+		Parent:           root.ID,
+		Description:      "exporter",
+		ExportNodes:      v.ID,
+		ExportPointTypes: "value",
+		AllowAnonymous:   true,
+	}
+	err = client.SendNodeType(nc, e, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	// a second exporter that requires a token
+	e2 := client.Exporter{
+		ID:          "exp2",
+		Parent:      root.ID,
+		ExportNodes: v.ID,
+		AuthToken:   "secret",
+	}
+	err = client.SendNodeType(nc, e2, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	// exporters without a token are not public unless anonymous requests
+	// are allowed
+	v2 := client.Variable{ID: "var2", Parent: root.ID, Description: "private", Value: 7}
+	err = client.SendNodeType(nc, v2, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	e3 := client.Exporter{
+		ID:          "exp3",
+		Parent:      root.ID,
+		ExportNodes: v2.ID,
+	}
+	err = client.SendNodeType(nc, e3, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	points, err := client.GetExportedPoints(nc, "")
+	if err != nil {
+		t.Fatal("Error getting exported points: ", err)
+	}
+
+	if len(points) != 1 {
+		t.Fatalf("expected 1 point, got %v: %+v", len(points), points)
+	}
+
+	out := string(client.FormatPrometheus(points))
+	exp := `siot_value{node_id="var1",description="tank \"A\"",type="variable",parent="` +
+		root.ID + `"} 23.5`
+	if !strings.Contains(out, exp) || !strings.Contains(out, "# TYPE siot_value gauge") {
+		t.Fatal("unexpected metrics output: ", out)
+	}
+
+	// the token exporter exports all numeric points of the variable, but
+	// duplicates are only returned once
+	points, err = client.GetExportedPoints(nc, "secret")
+	if err != nil {
+		t.Fatal("Error getting exported points: ", err)
+	}
+
+	for _, p := range points {
+		if p.NodeID != v.ID {
+			t.Fatal("point from unexpected node exported: ", p)
+		}
+		if p.Point.Type == data.PointTypeDescription {
+			t.Fatal("text point exported")
+		}
+	}
+
+	out = string(client.FormatPrometheus(points))
+	if strings.Count(out, "siot_value{") != 1 {
+		t.Fatal("duplicate value point: ", out)
+	}
+}
+
+func TestExporterCache(t *testing.T) {
+	nc, root, stop, err := server.TestServer()
+
+	if err != nil {
+		t.Fatal("Error starting test server: ", err)
+	}
+
+	defer stop()
+
+	v := client.Variable{ID: "var1", Parent: root.ID, Description: "var1", Value: 1}
+	err = client.SendNodeType(nc, v, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	e := client.Exporter{
+		ID:               "exp1",
+		Parent:           root.ID,
+		Description:      "exporter",
+		ExportPointTypes: "value",
+		AllowAnonymous:   true,
+	}
+	err = client.SendNodeType(nc, e, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	cache, err := client.NewExporterCache(nc)
+	if err != nil {
+		t.Fatal("Error creating cache: ", err)
+	}
+
+	defer cache.Close()
+
+	// waitValues waits until the exported values match
+	waitValues := func(exp map[string]float64) {
+		start := time.Now()
+		for {
+			points, err := cache.GetExportedPoints("")
+			if err != nil {
+				t.Fatal("Error getting exported points: ", err)
+			}
+
+			values := make(map[string]float64)
+			for _, p := range points {
+				values[p.NodeID] = p.Point.Value
+			}
+
+			if reflect.DeepEqual(values, exp) {
+				return
+			}
+
+			if time.Since(start) > 2*time.Second {
+				t.Fatalf("expected %v, got %v", exp, values)
+			}
+
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+
+	waitValues(map[string]float64{"var1": 1})
+
+	// point changes are applied to the cached tree
+	err = client.SendNodePoint(nc, v.ID, data.Point{Type: data.PointTypeValue, Value: 2}, true)
+	if err != nil {
+		t.Fatal("Error sending point: ", err)
+	}
+
+	waitValues(map[string]float64{"var1": 2})
+
+	// new nodes are picked up
+	v2 := client.Variable{ID: "var2", Parent: root.ID, Description: "var2", Value: 3}
+	err = client.SendNodeType(nc, v2, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	waitValues(map[string]float64{"var1": 2, "var2": 3})
+
+	// deleted nodes are removed
+	err = client.DeleteNode(nc, v.ID, root.ID, "test")
+	if err != nil {
+		t.Fatal("Error deleting node: ", err)
+	}
+
+	waitValues(map[string]float64{"var2": 3})
+}
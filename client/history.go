@@ -0,0 +1,42 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// GetHistory requests historical point data for a node. The query is
+// answered by a db client, so a db node must be configured. Points are
+// returned in time order.
+func GetHistory(nc *nats.Conn, nodeID string, q data.HistoryQuery) (data.Points, error) {
+	err := q.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := json.Marshal(q)
+	if err != nil {
+		return nil, err
+	}
+
+	msg, err := nc.Request(SubjectHistory(nodeID), d, time.Second*20)
+	if err != nil {
+		return nil, err
+	}
+
+	var ret data.HistoryResult
+	err = json.Unmarshal(msg.Data, &ret)
+	if err != nil {
+		return nil, err
+	}
+
+	if ret.Error != "" {
+		return nil, errors.New(ret.Error)
+	}
+
+	return ret.Points, nil
+}
@@ -0,0 +1,516 @@
+package client
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// httpIngestMaxDevices is the default limit of device nodes an HTTP ingest
+// client creates
+const httpIngestMaxDevices = 100
+
+// HTTPIngest maps JSON posted to the /v1/ingest/<key> HTTP endpoint to
+// points. If DeviceIDPath is set, a child node is created for each device ID
+// and the points are written to the child node, otherwise the points are
+// written to the HTTP ingest node.
+type HTTPIngest struct {
+	ID          string `node:"id"`
+	Parent      string `node:"parent"`
+	Description string `point:"description"`
+	IngestKey   string `point:"ingestKey"`
+	// requests must include this token as a bearer token
+	AuthToken string `point:"authToken"`
+	// if set and AuthToken is blank, requests without a token are accepted
+	AllowAnonymous bool `point:"allowAnonymous"`
+	// comma separated list of <JSONPath>=<point type>[:<point key>]
+	Mappings     string `point:"mappings"`
+	DeviceIDPath string `point:"deviceIDPath"`
+	// maximum number of device nodes to create, httpIngestMaxDevices if 0
+	MaxDevices int `point:"maxDevices"`
+	// if set, messages from devices without a node are rejected
+	RejectNewDevices bool               `point:"rejectNewDevices"`
+	TimePath         string             `point:"timePath"`
+	Disable          bool               `point:"disable"`
+	ErrorCount       int                `point:"errorCount"`
+	ErrorCountReset  bool               `point:"errorCountReset"`
+	Error            string             `point:"error"`
+	Devices          []HTTPIngestDevice `child:"httpIngestDevice"`
+}
+
+// HTTPIngestDevice is created by the HTTP ingest client for each device ID
+type HTTPIngestDevice struct {
+	ID          string `node:"id"`
+	Parent      string `node:"parent"`
+	Description string `point:"description"`
+	DeviceID    string `point:"deviceID"`
+}
+
+// ingestMapping maps the value at a JSONPath to a point
+type ingestMapping struct {
+	path      string
+	pointType string
+	key       string
+}
+
+// parseIngestMappings parses a comma separated list of
+// <JSONPath>=<point type>[:<point key>]
+func parseIngestMappings(s string) ([]ingestMapping, error) {
+	var ret []ingestMapping
+
+	for _, m := range strings.Split(s, ",") {
+		m = strings.TrimSpace(m)
+		if m == "" {
+			continue
+		}
+
+		path, point, ok := strings.Cut(m, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid mapping, expected <JSONPath>=<point type>: %v", m)
+		}
+
+		typ, key, _ := strings.Cut(strings.TrimSpace(point), ":")
+
+		mapping := ingestMapping{
+			path:      strings.TrimSpace(path),
+			pointType: strings.TrimSpace(typ),
+			key:       strings.TrimSpace(key),
+		}
+
+		if mapping.pointType == "" {
+			return nil, fmt.Errorf("mapping point type is blank: %v", m)
+		}
+
+		_, _, err := jsonPath(nil, mapping.path)
+		if err != nil {
+			return nil, err
+		}
+
+		ret = append(ret, mapping)
+	}
+
+	return ret, nil
+}
+
+type ingestRequest struct {
+	msg *nats.Msg
+	req data.IngestRequest
+}
+
+// HTTPIngestClient handles requests for one HTTP ingest endpoint
+type HTTPIngestClient struct {
+	nc            *nats.Conn
+	config        HTTPIngest
+	stop          chan struct{}
+	newPoints     chan NewPoints
+	newEdgePoints chan NewPoints
+	newIngest     chan ingestRequest
+	sub           *nats.Subscription
+	// device ID -> node ID
+	devices map[string]string
+	// parsed from config.Mappings when it changes
+	mappings    []ingestMapping
+	mappingsErr error
+}
+
+// NewHTTPIngestClient constructor
+func NewHTTPIngestClient(nc *nats.Conn, config HTTPIngest) Client {
+	devices := make(map[string]string)
+	for _, d := range config.Devices {
+		devices[d.DeviceID] = d.ID
+	}
+
+	hi := &HTTPIngestClient{
+		nc:            nc,
+		config:        config,
+		stop:          make(chan struct{}),
+		newPoints:     make(chan NewPoints),
+		newEdgePoints: make(chan NewPoints),
+		newIngest:     make(chan ingestRequest),
+		devices:       devices,
+	}
+
+	hi.parseMappings()
+
+	return hi
+}
+
+func (hi *HTTPIngestClient) parseMappings() {
+	hi.mappings, hi.mappingsErr = parseIngestMappings(hi.config.Mappings)
+	if hi.mappingsErr != nil {
+		log.Println("HTTP ingest: ", hi.mappingsErr)
+	}
+}
+
+// Run the main logic for this client and blocks until stopped
+func (hi *HTTPIngestClient) Run() error {
+	hi.subscribe()
+
+done:
+	for {
+		select {
+		case <-hi.stop:
+			break done
+		case r := <-hi.newIngest:
+			res := hi.ingest(r.req)
+			if res.Error != "" {
+				hi.ingestError(res.Error)
+			}
+
+			d, err := json.Marshal(res)
+			if err != nil {
+				log.Println("HTTP ingest: error encoding result: ", err)
+				continue
+			}
+
+			err = r.msg.Respond(d)
+			if err != nil {
+				log.Println("HTTP ingest: error responding: ", err)
+			}
+		case pts := <-hi.newPoints:
+			err := data.MergePoints(pts.ID, pts.Points, &hi.config)
+			if err != nil {
+				log.Println("error merging new points: ", err)
+			}
+
+			for _, p := range pts.Points {
+				switch p.Type {
+				case data.PointTypeIngestKey,
+					data.PointTypeDisable:
+					hi.subscribe()
+				case data.PointTypeMappings:
+					hi.parseMappings()
+				}
+			}
+
+			if hi.config.ErrorCountReset {
+				hi.config.ErrorCount = 0
+				hi.config.ErrorCountReset = false
+
+				points := data.Points{
+					{Type: data.PointTypeErrorCount, Value: 0},
+					{Type: data.PointTypeErrorCountReset, Value: 0},
+				}
+
+				err = SendNodePoints(hi.nc, hi.config.ID, points, false)
+				if err != nil {
+					log.Println("Error resetting HTTP ingest error count: ", err)
+				}
+			}
+		case pts := <-hi.newEdgePoints:
+			err := data.MergeEdgePoints(pts.ID, pts.Parent, pts.Points, &hi.config)
+			if err != nil {
+				log.Println("error merging new points: ", err)
+			}
+		}
+	}
+
+	hi.unsubscribe()
+
+	return nil
+}
+
+// Stop sends a signal to the Run function to exit
+func (hi *HTTPIngestClient) Stop(_ error) {
+	close(hi.stop)
+}
+
+// Points is called by the Manager when new points for this
+// node are received.
+func (hi *HTTPIngestClient) Points(nodeID string, points []data.Point) {
+	hi.newPoints <- NewPoints{nodeID, "", points}
+}
+
+// EdgePoints is called by the Manager when new edge points for this
+// node are received.
+func (hi *HTTPIngestClient) EdgePoints(nodeID, parentID string, points []data.Point) {
+	hi.newEdgePoints <- NewPoints{nodeID, parentID, points}
+}
+
+func (hi *HTTPIngestClient) subscribe() {
+	hi.unsubscribe()
+
+	if hi.config.Disable || hi.config.IngestKey == "" {
+		return
+	}
+
+	var err error
+	hi.sub, err = hi.nc.Subscribe(SubjectIngest(hi.config.IngestKey), hi.handleIngest)
+	if err != nil {
+		log.Println("HTTP ingest: error subscribing: ", err)
+	}
+}
+
+func (hi *HTTPIngestClient) unsubscribe() {
+	if hi.sub != nil {
+		err := hi.sub.Unsubscribe()
+		if err != nil {
+			log.Println("HTTP ingest: error unsubscribing: ", err)
+		}
+		hi.sub = nil
+	}
+}
+
+func (hi *HTTPIngestClient) handleIngest(msg *nats.Msg) {
+	var r ingestRequest
+	r.msg = msg
+
+	err := json.Unmarshal(msg.Data, &r.req)
+	if err != nil {
+		log.Println("HTTP ingest: error decoding request: ", err)
+		return
+	}
+
+	select {
+	case hi.newIngest <- r:
+	case <-hi.stop:
+		d, _ := json.Marshal(data.IngestResult{Status: http.StatusServiceUnavailable,
+			Error: "HTTP ingest client restarting"})
+		err := msg.Respond(d)
+		if err != nil {
+			log.Println("HTTP ingest: error responding: ", err)
+		}
+	}
+}
+
+// ingest writes the points for a request
+func (hi *HTTPIngestClient) ingest(r data.IngestRequest) data.IngestResult {
+	if hi.config.AuthToken == "" {
+		if !hi.config.AllowAnonymous {
+			return data.IngestResult{Status: http.StatusUnauthorized,
+				Error: "no token configured and anonymous requests are not allowed"}
+		}
+	} else if subtle.ConstantTimeCompare([]byte(r.Token), []byte(hi.config.AuthToken)) != 1 {
+		return data.IngestResult{Status: http.StatusUnauthorized, Error: "invalid token"}
+	}
+
+	if hi.mappingsErr != nil {
+		return data.IngestResult{Status: http.StatusInternalServerError,
+			Error: hi.mappingsErr.Error()}
+	}
+
+	var body any
+	err := json.Unmarshal(r.Body, &body)
+	if err != nil {
+		return data.IngestResult{Status: http.StatusBadRequest,
+			Error: "invalid JSON: " + err.Error()}
+	}
+
+	// an array is a batch of messages
+	msgs, ok := body.([]any)
+	if !ok {
+		msgs = []any{body}
+	}
+
+	ret := data.IngestResult{Status: http.StatusOK}
+
+	for _, m := range msgs {
+		count, err := hi.ingestMessage(m, hi.mappings)
+		ret.Points += count
+		if err != nil {
+			ret.Status = http.StatusBadRequest
+			ret.Error = err.Error()
+			break
+		}
+	}
+
+	return ret
+}
+
+func (hi *HTTPIngestClient) ingestMessage(m any, mappings []ingestMapping) (int, error) {
+	ts := time.Now()
+
+	if hi.config.TimePath != "" {
+		v, ok, err := jsonPath(m, hi.config.TimePath)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			ts, err = ingestTime(v)
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	var points data.Points
+
+	for _, mp := range mappings {
+		v, ok, err := jsonPath(m, mp.path)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			// devices may only send some values in each message
+			continue
+		}
+
+		p := data.Point{Type: mp.pointType, Key: mp.key, Time: ts, Origin: hi.config.ID}
+
+		switch v := v.(type) {
+		case float64:
+			p.Value = v
+		case bool:
+			p.Value = data.BoolToFloat(v)
+		case string:
+			f, err := strconv.ParseFloat(v, 64)
+			if err == nil {
+				p.Value = f
+			} else {
+				p.Text = v
+			}
+		default:
+			// null, objects, and arrays are skipped
+			continue
+		}
+
+		points = append(points, p)
+	}
+
+	if len(points) == 0 {
+		return 0, nil
+	}
+
+	nodeID := hi.config.ID
+
+	if hi.config.DeviceIDPath != "" {
+		v, ok, err := jsonPath(m, hi.config.DeviceIDPath)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			return 0, fmt.Errorf("device ID not found at %v", hi.config.DeviceIDPath)
+		}
+
+		nodeID, err = hi.deviceNode(ingestString(v))
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	err := SendNodePoints(hi.nc, nodeID, points, true)
+	if err != nil {
+		return 0, fmt.Errorf("error writing points: %w", err)
+	}
+
+	return len(points), nil
+}
+
+// deviceNode returns the ID of the child node for a device, and creates the
+// node if it does not exist and new devices are allowed
+func (hi *HTTPIngestClient) deviceNode(deviceID string) (string, error) {
+	if deviceID == "" {
+		return "", errors.New("device ID is blank")
+	}
+
+	if id, ok := hi.devices[deviceID]; ok {
+		return id, nil
+	}
+
+	if hi.config.RejectNewDevices {
+		return "", fmt.Errorf("unknown device: %v", deviceID)
+	}
+
+	maxDevices := hi.config.MaxDevices
+	if maxDevices <= 0 {
+		maxDevices = httpIngestMaxDevices
+	}
+
+	if len(hi.devices) >= maxDevices {
+		return "", fmt.Errorf("device limit of %v reached, not creating device: %v",
+			maxDevices, deviceID)
+	}
+
+	d := HTTPIngestDevice{
+		ID:          uuid.New().String(),
+		Parent:      hi.config.ID,
+		Description: deviceID,
+		DeviceID:    deviceID,
+	}
+
+	err := SendNodeType(hi.nc, d, hi.config.ID)
+	if err != nil {
+		return "", fmt.Errorf("error creating device node: %w", err)
+	}
+
+	hi.devices[deviceID] = d.ID
+
+	return d.ID, nil
+}
+
+func (hi *HTTPIngestClient) ingestError(e string) {
+	hi.config.ErrorCount++
+	hi.config.Error = e
+
+	points := data.Points{
+		{Type: data.PointTypeErrorCount, Value: float64(hi.config.ErrorCount)},
+		{Type: data.PointTypeError, Text: e},
+	}
+
+	err := SendNodePoints(hi.nc, hi.config.ID, points, false)
+	if err != nil {
+		log.Println("HTTP ingest: error sending error points: ", err)
+	}
+}
+
+// ingestTime converts a RFC3339 string, or a unix time in seconds or ms, to
+// a time
+func ingestTime(v any) (time.Time, error) {
+	switch v := v.(type) {
+	case string:
+		return time.Parse(time.RFC3339, v)
+	case float64:
+		// anything after 2286 in seconds is assumed to be ms
+		if v > 1e10 {
+			return time.UnixMilli(int64(v)), nil
+		}
+		sec, frac := math.Modf(v)
+		return time.Unix(int64(sec), int64(frac*1e9)), nil
+	default:
+		return time.Time{}, fmt.Errorf("invalid time: %v", v)
+	}
+}
+
+// ingestString converts a JSON value to a string. Numbers such as serial
+// numbers are formatted without an exponent.
+func ingestString(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// SendIngest sends JSON posted to an HTTP ingest endpoint to the HTTP
+// ingest client with the given key
+func SendIngest(nc *nats.Conn, key string, r data.IngestRequest) (data.IngestResult, error) {
+	d, err := json.Marshal(r)
+	if err != nil {
+		return data.IngestResult{}, err
+	}
+
+	msg, err := nc.Request(SubjectIngest(key), d, time.Second*20)
+	if err != nil {
+		return data.IngestResult{}, err
+	}
+
+	var ret data.IngestResult
+	err = json.Unmarshal(msg.Data, &ret)
+	return ret, err
+}
@@ -0,0 +1,291 @@
+package client_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+	"github.com/simpleiot/simpleiot/server"
+)
+
+func TestHTTPIngest(t *testing.T) {
+	nc, root, stop, err := server.TestServer()
+
+	if err != nil {
+		t.Fatal("Error starting test server: ", err)
+	}
+
+	defer stop()
+
+	ingest := client.HTTPIngest{
+		ID:           "ingest-id",
+		Parent:       root.ID,
+		Description:  "weather stations",
+		IngestKey:    "weather",
+		AuthToken:    "secret",
+		Mappings:     "$.temp=temp, $.ch[1]=value:1, $.status=status",
+		DeviceIDPath: "$.serial",
+		TimePath:     "$.ts",
+	}
+
+	err = client.SendNodeType(nc, ingest, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	body := []byte(`[{"serial":1234,"temp":21.5,"ch":[0,"3.5"],"status":"ok","ts":1700000000},
+		{"serial":"5678","temp":19}]`)
+
+	// wait for the client to start
+	var res data.IngestResult
+	start := time.Now()
+	for {
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("ingest client did not start: ", err)
+		}
+
+		res, err = client.SendIngest(nc, "weather", data.IngestRequest{Token: "bad", Body: body})
+		if err == nil {
+			break
+		}
+
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	if res.Status != http.StatusUnauthorized {
+		t.Fatal("expected unauthorized, got: ", res)
+	}
+
+	res, err = client.SendIngest(nc, "weather", data.IngestRequest{Token: "secret", Body: body})
+	if err != nil {
+		t.Fatal("Error sending ingest request: ", err)
+	}
+
+	if res.Status != http.StatusOK || res.Points != 4 {
+		t.Fatal("unexpected result: ", res)
+	}
+
+	devices, err := client.GetNodes(nc, ingest.ID, "all", data.NodeTypeHTTPIngestDevice, false)
+	if err != nil {
+		t.Fatal("Error getting device nodes: ", err)
+	}
+
+	if len(devices) != 2 {
+		t.Fatal("expected 2 device nodes, got: ", len(devices))
+	}
+
+	for _, d := range devices {
+		switch d.Desc() {
+		case "1234":
+			p, _ := d.Points.Find("temp", "")
+			if p.Value != 21.5 || !p.Time.Equal(time.Unix(1700000000, 0)) {
+				t.Error("unexpected temp point: ", p)
+			}
+			p, _ = d.Points.Find(data.PointTypeValue, "1")
+			if p.Value != 3.5 {
+				t.Error("unexpected value point: ", p)
+			}
+			p, _ = d.Points.Find("status", "")
+			if p.Text != "ok" {
+				t.Error("unexpected status point: ", p)
+			}
+		case "5678":
+			p, _ := d.Points.Find("temp", "")
+			if p.Value != 19 {
+				t.Error("unexpected temp point: ", p)
+			}
+		default:
+			t.Error("unexpected device: ", d.Desc())
+		}
+	}
+
+	// the client restarts after device nodes are created, so retry
+	start = time.Now()
+	for {
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("ingest client did not restart: ", err)
+		}
+
+		res, err = client.SendIngest(nc, "weather", data.IngestRequest{Token: "secret",
+			Body: []byte(`{"temp":1}`)})
+		if err == nil {
+			break
+		}
+
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	if res.Status != http.StatusBadRequest {
+		t.Fatal("expected error for missing device ID: ", res)
+	}
+}
+
+func TestHTTPIngestAnonymous(t *testing.T) {
+	nc, root, stop, err := server.TestServer()
+
+	if err != nil {
+		t.Fatal("Error starting test server: ", err)
+	}
+
+	defer stop()
+
+	ingest := client.HTTPIngest{
+		ID:          "ingest-id",
+		Parent:      root.ID,
+		Description: "no token",
+		IngestKey:   "open",
+		Mappings:    "$.temp=temp",
+	}
+
+	err = client.SendNodeType(nc, ingest, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	body := []byte(`{"temp":21.5}`)
+
+	// a node without a token rejects all requests
+	var res data.IngestResult
+	start := time.Now()
+	for {
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("ingest client did not start: ", err)
+		}
+
+		res, err = client.SendIngest(nc, "open", data.IngestRequest{Body: body})
+		if err == nil {
+			break
+		}
+
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	if res.Status != http.StatusUnauthorized {
+		t.Fatal("expected unauthorized, got: ", res)
+	}
+
+	err = client.SendNodePoint(nc, ingest.ID, data.Point{Type: data.PointTypeAllowAnonymous,
+		Value: 1, Origin: "test"}, true)
+	if err != nil {
+		t.Fatal("Error sending point: ", err)
+	}
+
+	start = time.Now()
+	for {
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("anonymous request not accepted: ", res, err)
+		}
+
+		res, err = client.SendIngest(nc, "open", data.IngestRequest{Body: body})
+		if err == nil && res.Status == http.StatusOK {
+			break
+		}
+
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestHTTPIngestDevices(t *testing.T) {
+	nc, root, stop, err := server.TestServer()
+
+	if err != nil {
+		t.Fatal("Error starting test server: ", err)
+	}
+
+	defer stop()
+
+	ingest := client.HTTPIngest{
+		ID:           "ingest-id",
+		Parent:       root.ID,
+		Description:  "limited",
+		IngestKey:    "limited",
+		AuthToken:    "secret",
+		Mappings:     "$.temp=temp",
+		DeviceIDPath: "$.serial",
+		MaxDevices:   1,
+	}
+
+	err = client.SendNodeType(nc, ingest, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	// the client restarts when it starts and after device nodes are
+	// created, so retry until it responds
+	send := func(body string) data.IngestResult {
+		start := time.Now()
+		for {
+			res, err := client.SendIngest(nc, "limited",
+				data.IngestRequest{Token: "secret", Body: []byte(body)})
+			if err == nil {
+				return res
+			}
+
+			if time.Since(start) > 5*time.Second {
+				t.Fatal("ingest client did not respond: ", err)
+			}
+
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+
+	res := send(`{"serial":"a","temp":1}`)
+	if res.Status != http.StatusOK || res.Points != 1 {
+		t.Fatal("unexpected result for first device: ", res)
+	}
+
+	res = send(`{"serial":"b","temp":2}`)
+	if res.Status != http.StatusBadRequest {
+		t.Fatal("expected device over the limit to be rejected: ", res)
+	}
+
+	err = client.SendNodePoints(nc, ingest.ID, data.Points{
+		{Type: data.PointTypeMaxDevices, Value: 2, Origin: "test"},
+		{Type: data.PointTypeRejectNewDevices, Value: 1, Origin: "test"},
+	}, true)
+	if err != nil {
+		t.Fatal("Error sending points: ", err)
+	}
+
+	start := time.Now()
+	for {
+		res = send(`{"serial":"b","temp":2}`)
+		if res.Status == http.StatusBadRequest && res.Error == "unknown device: b" {
+			break
+		}
+
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("expected new device to be rejected: ", res)
+		}
+
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	res = send(`{"serial":"a","temp":3}`)
+	if res.Status != http.StatusOK || res.Points != 1 {
+		t.Fatal("known device should be accepted: ", res)
+	}
+
+	// mappings are parsed again when they change
+	err = client.SendNodePoint(nc, ingest.ID, data.Point{Type: data.PointTypeMappings,
+		Text: "$.temp=temp, $.hum=hum", Origin: "test"}, true)
+	if err != nil {
+		t.Fatal("Error sending point: ", err)
+	}
+
+	start = time.Now()
+	for {
+		res = send(`{"serial":"a","temp":4,"hum":50}`)
+		if res.Status == http.StatusOK && res.Points == 2 {
+			break
+		}
+
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("new mapping not used: ", res)
+		}
+
+		time.Sleep(20 * time.Millisecond)
+	}
+}
@@ -0,0 +1,99 @@
+package client
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// jsonPath returns the value in decoded JSON data (as returned by
+// json.Unmarshal into an any) at path. A subset of JSONPath is supported:
+// the path starts with $ followed by .name, ['name'], or [index] elements,
+// for example $.sensors[0].temp or $['device-id']. Negative indexes count
+// from the end of the array. ok is false if the value does not exist. The
+// whole path is always parsed, so jsonPath(nil, path) can be used to check
+// a path for errors.
+func jsonPath(v any, path string) (ret any, ok bool, err error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, false, fmt.Errorf("JSONPath must start with $: %v", path)
+	}
+
+	ok = true
+	p := path[1:]
+
+	field := func(name string) {
+		m, isMap := v.(map[string]any)
+		if !isMap {
+			ok = false
+			return
+		}
+		v, ok = m[name]
+	}
+
+	for p != "" {
+		switch p[0] {
+		case '.':
+			p = p[1:]
+			end := strings.IndexAny(p, ".[")
+			if end < 0 {
+				end = len(p)
+			}
+			if end == 0 {
+				return nil, false, fmt.Errorf("invalid JSONPath: %v", path)
+			}
+
+			if ok {
+				field(p[:end])
+			}
+			p = p[end:]
+
+		case '[':
+			end := strings.IndexByte(p, ']')
+			if end < 0 {
+				return nil, false, fmt.Errorf("invalid JSONPath: %v", path)
+			}
+			elem := p[1:end]
+			p = p[end+1:]
+
+			if len(elem) >= 2 && (elem[0] == '\'' || elem[0] == '"') &&
+				elem[len(elem)-1] == elem[0] {
+				if ok {
+					field(elem[1 : len(elem)-1])
+				}
+				continue
+			}
+
+			i, err := strconv.Atoi(elem)
+			if err != nil {
+				return nil, false, fmt.Errorf("invalid JSONPath index %v: %v", elem, path)
+			}
+
+			if !ok {
+				continue
+			}
+
+			a, isArray := v.([]any)
+			if !isArray {
+				ok = false
+				continue
+			}
+			if i < 0 {
+				i += len(a)
+			}
+			if i < 0 || i >= len(a) {
+				ok = false
+				continue
+			}
+			v = a[i]
+
+		default:
+			return nil, false, fmt.Errorf("invalid JSONPath: %v", path)
+		}
+	}
+
+	if !ok {
+		return nil, false, nil
+	}
+
+	return v, true, nil
+}
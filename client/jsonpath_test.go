@@ -0,0 +1,45 @@
+package client
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestJSONPath(t *testing.T) {
+	var v any
+	err := json.Unmarshal([]byte(`{"id":"dev1","sensors":[{"temp":21.5},{"temp":22}],
+		"dash-key":{"on":true}}`), &v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path  string
+		exp   any
+		found bool
+		err   bool
+	}{
+		{"$.id", "dev1", true, false},
+		{"$.sensors[1].temp", 22.0, true, false},
+		{"$.sensors[-1].temp", 22.0, true, false},
+		{"$['dash-key'].on", true, true, false},
+		{"$.sensors[2].temp", nil, false, false},
+		{"$.id.foo", nil, false, false},
+		{"$.missing[0]", nil, false, false},
+		{"id", nil, false, true},
+		{"$.sensors[x]", nil, false, true},
+		{"$.missing[x]", nil, false, true},
+		{"$..id", nil, false, true},
+	}
+
+	for _, test := range tests {
+		ret, ok, err := jsonPath(v, test.path)
+		if (err != nil) != test.err {
+			t.Errorf("%v: unexpected error: %v", test.path, err)
+		}
+		if ok != test.found || ret != test.exp {
+			t.Errorf("%v: got %v, %v, expected %v, %v", test.path, ret, ok,
+				test.exp, test.found)
+		}
+	}
+}
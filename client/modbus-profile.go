@@ -0,0 +1,243 @@
+package client
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+//go:embed modbus-profiles/*.yaml
+var modbusProfileFiles embed.FS
+
+// ModbusProfile describes the registers of a Modbus device so that the
+// modbusIo nodes for a device can be created in one step. Profiles are
+// YAML files. The profile key is the file name without the extension.
+type ModbusProfile struct {
+	Name         string `yaml:"name"`
+	Manufacturer string `yaml:"manufacturer"`
+	Model        string `yaml:"model"`
+	Description  string `yaml:"description"`
+	// default byte order for multi-register values
+	ByteOrder string             `yaml:"byteOrder"`
+	Registers []ModbusProfileReg `yaml:"registers"`
+}
+
+// ModbusProfileReg describes one IO in a Modbus device profile. Type, format
+// and byte order use the same values as the modbusIo node points.
+type ModbusProfileReg struct {
+	Description string `yaml:"description"`
+	Type        string `yaml:"type"`
+	Address     int    `yaml:"address"`
+	Format      string `yaml:"format"`
+	ByteOrder   string `yaml:"byteOrder"`
+	RegCount    int    `yaml:"regCount"`
+	BitMask     int    `yaml:"bitMask"`
+	// scale defaults to 1 if not set
+	Scale    *float64 `yaml:"scale"`
+	Offset   float64  `yaml:"offset"`
+	Units    string   `yaml:"units"`
+	ReadOnly bool     `yaml:"readOnly"`
+}
+
+// ParseModbusProfile parses and checks a YAML Modbus device profile
+func ParseModbusProfile(yamlData []byte) (ModbusProfile, error) {
+	var ret ModbusProfile
+	err := yaml.Unmarshal(yamlData, &ret)
+	if err != nil {
+		return ret, err
+	}
+
+	if ret.Name == "" {
+		return ret, errors.New("profile name is required")
+	}
+
+	for _, r := range ret.Registers {
+		if r.Scale != nil && *r.Scale == 0 {
+			return ret, fmt.Errorf("register %v: scale must not be 0", r.Description)
+		}
+
+		switch r.Type {
+		case data.PointValueModbusCoil, data.PointValueModbusDiscreteInput:
+		case data.PointValueModbusInputRegister, data.PointValueModbusHoldingRegister:
+			if r.Format == "" {
+				return ret, fmt.Errorf("register %v: format is required", r.Description)
+			}
+		default:
+			return ret, fmt.Errorf("register %v: invalid type: %v", r.Description, r.Type)
+		}
+	}
+
+	return ret, nil
+}
+
+// LoadModbusProfiles returns the Modbus device profiles built into the binary
+// and the *.yaml profiles in dir. Profiles in dir replace built in profiles
+// with the same key. dir is ignored if it is blank or does not exist.
+func LoadModbusProfiles(dir string) (map[string]ModbusProfile, error) {
+	ret := make(map[string]ModbusProfile)
+
+	embedded, err := fs.Glob(modbusProfileFiles, "modbus-profiles/*.yaml")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range embedded {
+		d, err := modbusProfileFiles.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+
+		p, err := ParseModbusProfile(d)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing profile %v: %w", f, err)
+		}
+
+		ret[strings.TrimSuffix(path.Base(f), ".yaml")] = p
+	}
+
+	if dir == "" {
+		return ret, nil
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.yaml"))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range files {
+		d, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+
+		p, err := ParseModbusProfile(d)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing profile %v: %w", f, err)
+		}
+
+		ret[strings.TrimSuffix(filepath.Base(f), ".yaml")] = p
+	}
+
+	return ret, nil
+}
+
+// Nodes returns the modbusIo nodes for a device using this profile. The
+// node descriptions are prefixed with the model and device ID so that
+// several devices can share a bus.
+func (p ModbusProfile) Nodes(parent string, deviceID int) []data.NodeEdge {
+	prefix := p.Model
+	if prefix == "" {
+		prefix = p.Name
+	}
+
+	var ret []data.NodeEdge
+
+	for _, r := range p.Registers {
+		points := data.Points{
+			{Type: data.PointTypeDescription,
+				Text: fmt.Sprintf("%v-%v %v", prefix, deviceID, r.Description)},
+			{Type: data.PointTypeID, Value: float64(deviceID)},
+			{Type: data.PointTypeAddress, Value: float64(r.Address)},
+			{Type: data.PointTypeModbusIOType, Text: r.Type},
+			{Type: data.PointTypeReadOnly, Value: data.BoolToFloat(r.ReadOnly)},
+		}
+
+		if r.Units != "" {
+			points = append(points, data.Point{Type: data.PointTypeUnits, Text: r.Units})
+		}
+
+		if r.Type == data.PointValueModbusInputRegister ||
+			r.Type == data.PointValueModbusHoldingRegister {
+			scale := 1.0
+			if r.Scale != nil {
+				scale = *r.Scale
+			}
+
+			byteOrder := r.ByteOrder
+			if byteOrder == "" {
+				byteOrder = p.ByteOrder
+			}
+
+			points = append(points,
+				data.Point{Type: data.PointTypeDataFormat, Text: r.Format},
+				data.Point{Type: data.PointTypeScale, Value: scale},
+				data.Point{Type: data.PointTypeOffset, Value: r.Offset},
+			)
+
+			if byteOrder != "" {
+				points = append(points,
+					data.Point{Type: data.PointTypeByteOrder, Text: byteOrder})
+			}
+
+			if r.RegCount != 0 {
+				points = append(points,
+					data.Point{Type: data.PointTypeRegCount, Value: float64(r.RegCount)})
+			}
+
+			if r.BitMask != 0 {
+				points = append(points,
+					data.Point{Type: data.PointTypeBitMask, Value: float64(r.BitMask)})
+			}
+		}
+
+		ret = append(ret, data.NodeEdge{
+			ID:     uuid.New().String(),
+			Type:   data.NodeTypeModbusIO,
+			Parent: parent,
+			Points: points,
+		})
+	}
+
+	return ret
+}
+
+// modbusIOKey identifies the register of a modbusIo node
+type modbusIOKey struct {
+	deviceID int
+	ioType   string
+	address  int
+}
+
+// CreateModbusProfileIOs creates the modbusIo nodes described by a profile
+// under the modbus node parent. Registers that already have an IO node with
+// the same device ID, type, and address are skipped, so applying a profile
+// again does not create duplicates.
+func CreateModbusProfileIOs(nc *nats.Conn, parent string, p ModbusProfile, deviceID int) error {
+	existing, err := GetNodes(nc, parent, "all", data.NodeTypeModbusIO, false)
+	if err != nil && !errors.Is(err, data.ErrDocumentNotFound) {
+		return fmt.Errorf("error getting IO nodes: %w", err)
+	}
+
+	have := make(map[modbusIOKey]bool)
+	for _, n := range existing {
+		id, _ := n.Points.ValueInt(data.PointTypeID, "")
+		ioType, _ := n.Points.Text(data.PointTypeModbusIOType, "")
+		address, _ := n.Points.ValueInt(data.PointTypeAddress, "")
+		have[modbusIOKey{id, ioType, address}] = true
+	}
+
+	// Nodes returns a node for each register in order
+	for i, n := range p.Nodes(parent, deviceID) {
+		r := p.Registers[i]
+		if have[modbusIOKey{deviceID, r.Type, r.Address}] {
+			continue
+		}
+
+		err := SendNode(nc, n, "")
+		if err != nil {
+			return fmt.Errorf("error creating IO node: %w", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,115 @@
+package client_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+	"github.com/simpleiot/simpleiot/server"
+)
+
+func TestModbusProfiles(t *testing.T) {
+	dir := t.TempDir()
+
+	// replaces the built in SDM120 profile
+	sdm120 := `
+name: Test SDM120
+model: SDM120
+registers:
+  - description: Voltage
+    type: modbusInputRegister
+    address: 0x10
+    format: uint16
+    scale: 0.1
+    units: V
+  - description: Relay
+    type: modbusCoil
+    address: 3
+`
+
+	err := os.WriteFile(filepath.Join(dir, "eastron-sdm120.yaml"), []byte(sdm120), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	profiles, err := client.LoadModbusProfiles(dir)
+	if err != nil {
+		t.Fatal("Error loading profiles: ", err)
+	}
+
+	sdm630, ok := profiles["eastron-sdm630"]
+	if !ok {
+		t.Fatal("built in profile not found")
+	}
+
+	last := sdm630.Registers[len(sdm630.Registers)-1]
+	if last.Address != 0x156 || last.Format != data.PointValueFLOAT32 {
+		t.Fatalf("built in profile not parsed correctly: %+v", last)
+	}
+
+	p, ok := profiles["eastron-sdm120"]
+	if !ok || p.Name != "Test SDM120" {
+		t.Fatalf("profile from dir not loaded: %+v", p)
+	}
+
+	_, err = client.ParseModbusProfile([]byte("name: bad\nregisters:\n  - type: modbusInputRegister\n"))
+	if err == nil {
+		t.Fatal("expected error for register without format")
+	}
+
+	_, err = client.ParseModbusProfile([]byte("name: bad\nregisters:\n" +
+		"  - type: modbusInputRegister\n    format: uint16\n    scale: 0\n"))
+	if err == nil {
+		t.Fatal("expected error for register with scale 0")
+	}
+
+	nc, root, stop, err := server.TestServer()
+	if err != nil {
+		t.Fatal("Error starting test server: ", err)
+	}
+
+	defer stop()
+
+	err = client.CreateModbusProfileIOs(nc, root.ID, p, 5)
+	if err != nil {
+		t.Fatal("Error creating IOs: ", err)
+	}
+
+	// IOs that already exist are not created again
+	err = client.CreateModbusProfileIOs(nc, root.ID, p, 5)
+	if err != nil {
+		t.Fatal("Error creating IOs again: ", err)
+	}
+
+	nodes, err := client.GetNodes(nc, root.ID, "all", data.NodeTypeModbusIO, false)
+	if err != nil {
+		t.Fatal("Error getting nodes: ", err)
+	}
+
+	if len(nodes) != 2 {
+		t.Fatalf("expected 2 IO nodes, got %v", len(nodes))
+	}
+
+	for _, n := range nodes {
+		id, _ := n.Points.ValueInt(data.PointTypeID, "")
+		if id != 5 {
+			t.Error("wrong device ID: ", id)
+		}
+
+		ioType, _ := n.Points.Text(data.PointTypeModbusIOType, "")
+		if ioType != data.PointValueModbusInputRegister {
+			continue
+		}
+
+		desc, _ := n.Points.Text(data.PointTypeDescription, "")
+		addr, _ := n.Points.ValueInt(data.PointTypeAddress, "")
+		scale, _ := n.Points.Value(data.PointTypeScale, "")
+		units, _ := n.Points.Text(data.PointTypeUnits, "")
+
+		if desc != "SDM120-5 Voltage" || addr != 0x10 || scale != 0.1 || units != "V" {
+			t.Errorf("wrong IO points: %v", n.Points)
+		}
+	}
+}
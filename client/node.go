@@ -428,6 +428,49 @@ func NodeWatcher[T any](nc *nats.Conn, id, parent string) (get func() T, stop fu
 		}, nil
 }
 
+// nodeTreeMaxDepth limits how deep GetNodeTree walks in case a node is
+// mirrored under one of its own children
+const nodeTreeMaxDepth = 30
+
+// GetNodeTree returns a node and all of its descendants. Deleted nodes are not
+// included.
+func GetNodeTree(nc *nats.Conn, id string) (data.NodeEdgeChildren, error) {
+	nodes, err := GetNodes(nc, "all", id, "", false)
+	if err != nil {
+		return data.NodeEdgeChildren{}, err
+	}
+
+	if len(nodes) < 1 {
+		return data.NodeEdgeChildren{}, data.ErrDocumentNotFound
+	}
+
+	ret := data.NodeEdgeChildren{NodeEdge: nodes[0]}
+	err = getNodeTreeHelper(nc, &ret, 0)
+	return ret, err
+}
+
+func getNodeTreeHelper(nc *nats.Conn, node *data.NodeEdgeChildren, depth int) error {
+	if depth >= nodeTreeMaxDepth {
+		return nil
+	}
+
+	children, err := GetNodes(nc, node.ID, "all", "", false)
+	if err != nil {
+		return fmt.Errorf("Error getting children of %v: %w", node.ID, err)
+	}
+
+	for _, c := range children {
+		nec := data.NodeEdgeChildren{NodeEdge: c}
+		err := getNodeTreeHelper(nc, &nec, depth+1)
+		if err != nil {
+			return err
+		}
+		node.Children = append(node.Children, nec)
+	}
+
+	return nil
+}
+
 // SiotExport is the format used for exporting and importing data (currently YAML)
 type SiotExport struct {
 	Nodes []data.NodeEdgeChildren
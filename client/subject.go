@@ -28,3 +28,33 @@ func SubjectEdgeAllPoints() string {
 func SubjectNodeHRPoints(nodeID string) string {
 	return fmt.Sprintf("phr.%v", nodeID)
 }
+
+// SubjectBatchPoints constructs a NATS subject for a batch of points for
+// multiple nodes. Encoding is BatchEncodingNone or BatchEncodingGzip.
+func SubjectBatchPoints(encoding string) string {
+	return fmt.Sprintf("batch.%v", encoding)
+}
+
+// SubjectSyncHeartbeat constructs a NATS subject that a downstream instance
+// uses to report it is connected. nodeID is the root node of the downstream
+// instance.
+func SubjectSyncHeartbeat(nodeID string) string {
+	return fmt.Sprintf("sync.heartbeat.%v", nodeID)
+}
+
+// SubjectSyncDownstream is used to request a list of downstream instances
+// that sync to this instance
+func SubjectSyncDownstream() string {
+	return "sync.downstream"
+}
+
+// SubjectHistory is used to request historical point data for a node
+func SubjectHistory(nodeID string) string {
+	return fmt.Sprintf("history.%v", nodeID)
+}
+
+// SubjectIngest is used to send data posted to the HTTP ingest endpoint
+// with the given key to the HTTP ingest client
+func SubjectIngest(key string) string {
+	return fmt.Sprintf("ingest.%v", key)
+}
@@ -0,0 +1,277 @@
+package client
+
+import (
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// Priority classes for points sent upstream. Lower values are sent first
+// in a batch.
+const (
+	syncPriorityConfig = iota
+	syncPriorityAlarm
+	syncPriorityTelemetry
+)
+
+// defaultTelemetryPointTypes is used to classify telemetry points if the
+// sync node does not list telemetry point types. Metric points are always
+// considered telemetry.
+const defaultTelemetryPointTypes = "value, temp, voltage, current, power, rx, tx, hrRx, uptime"
+
+var syncAlarmPointTypes = map[string]bool{
+	data.PointTypeActive:  true,
+	data.PointTypeError:   true,
+	data.PointTypeOffline: true,
+}
+
+type syncBatchEntry struct {
+	priority int
+	node     data.NodeEdge
+}
+
+func newTelemetryTypes(config Sync) map[string]bool {
+	if config.TelemetryPointTypes != "" {
+		return splitList(config.TelemetryPointTypes)
+	}
+	return splitList(defaultTelemetryPointTypes)
+}
+
+// pointPriority returns the priority class of a point. Edge points describe
+// the structure of the node tree so are always treated as config.
+func (up *SyncClient) pointPriority(p data.Point, edge bool) int {
+	switch {
+	case edge:
+		return syncPriorityConfig
+	case syncAlarmPointTypes[p.Type]:
+		return syncPriorityAlarm
+	case up.telemetry[p.Type], strings.HasPrefix(p.Type, "metric"):
+		return syncPriorityTelemetry
+	default:
+		return syncPriorityConfig
+	}
+}
+
+// batchAdd adds points to the current batch and starts the batch timer
+// if it is not already running.
+func (up *SyncClient) batchAdd(nodeID, parentID string, points data.Points) {
+	for _, p := range points {
+		prio := up.pointPriority(p, parentID != "")
+
+		idx := -1
+		for i, e := range up.batch {
+			if e.priority == prio && e.node.ID == nodeID && e.node.Parent == parentID {
+				idx = i
+				break
+			}
+		}
+
+		if idx < 0 {
+			up.batch = append(up.batch, syncBatchEntry{
+				priority: prio,
+				node:     data.NodeEdge{ID: nodeID, Parent: parentID},
+			})
+			idx = len(up.batch) - 1
+		}
+
+		if parentID == "" {
+			up.batch[idx].node.Points = append(up.batch[idx].node.Points, p)
+		} else {
+			up.batch[idx].node.EdgePoints = append(up.batch[idx].node.EdgePoints, p)
+		}
+	}
+
+	if up.config.BatchPeriod > 0 && !up.batchTimerRunning {
+		up.batchTimer.Reset(time.Duration(up.config.BatchPeriod) * time.Millisecond)
+		up.batchTimerRunning = true
+	}
+}
+
+// batchFlush sends the current batch upstream with higher priority points
+// first.
+func (up *SyncClient) batchFlush(connected bool) {
+	up.batchTimerRunning = false
+
+	if len(up.batch) <= 0 {
+		return
+	}
+
+	sort.SliceStable(up.batch, func(i, j int) bool {
+		return up.batch[i].priority < up.batch[j].priority
+	})
+
+	nodes := make(data.Nodes, len(up.batch))
+	for i, e := range up.batch {
+		nodes[i] = e.node
+	}
+
+	up.batch = nil
+
+	subject, d, err := EncodeBatchPoints(nodes, up.config.Compress)
+	if err != nil {
+		log.Println("Error encoding sync batch: ", err)
+		return
+	}
+
+	up.publishRemote(connected, subject, d)
+}
+
+// deferPoints queues telemetry points that are held back because the daily
+// byte budget has been used and returns the remaining points. Deferred
+// points are replayed once the budget resets. If there is no queue, they
+// are dropped and the latest values are sent by the catch-up sync.
+func (up *SyncClient) deferPoints(nodeID string, points data.Points) data.Points {
+	if !up.filter.overBudget {
+		return points
+	}
+
+	var ret, deferred data.Points
+	for _, p := range points {
+		if up.filter.deferPoint(p) {
+			deferred = append(deferred, p)
+		} else {
+			ret = append(ret, p)
+		}
+	}
+
+	if len(deferred) <= 0 || up.queue == nil || up.config.Disable {
+		return ret
+	}
+
+	for i := range deferred {
+		if deferred[i].Time.IsZero() {
+			deferred[i].Time = time.Now()
+		}
+	}
+
+	d, err := deferred.ToPb()
+	if err != nil {
+		log.Println("Error encoding deferred sync points: ", err)
+		return ret
+	}
+
+	err = up.queue.push(SubjectNodePoints(nodeID), d)
+	if err != nil {
+		log.Println("Error queuing deferred sync points: ", err)
+		return ret
+	}
+
+	up.updateQueueLen()
+
+	return ret
+}
+
+// checkBudget updates the sync filter when the daily byte budget is used or
+// resets. Telemetry is excluded from sync while over budget so that config
+// and alarm points are still synced.
+func (up *SyncClient) checkBudget() {
+	if up.overBudget() == up.filter.overBudget {
+		return
+	}
+
+	up.setFilter()
+	err := up.scanFilter()
+	if err != nil {
+		log.Println("Sync: error scanning sync filters: ", err)
+	}
+}
+
+// checkBudgetDay resets the daily byte count when the day rolls over
+func (up *SyncClient) checkBudgetDay() {
+	now := time.Now()
+	y1, m1, d1 := now.Date()
+	y2, m2, d2 := up.bytesDay.Date()
+
+	if y1 == y2 && m1 == m2 && d1 == d2 {
+		return
+	}
+
+	up.bytesDay = now
+
+	if up.config.BytesToday != 0 {
+		up.config.BytesToday = 0
+		err := SendNodePoint(up.nc, up.config.ID,
+			data.Point{Type: data.PointTypeBytesToday, Value: 0}, false)
+		if err != nil {
+			log.Println("Error resetting sync bytes today: ", err)
+		}
+	}
+}
+
+// overBudget returns true if the daily byte budget has been used
+func (up *SyncClient) overBudget() bool {
+	if up.config.ByteBudget <= 0 {
+		return false
+	}
+
+	up.checkBudgetDay()
+
+	return up.config.BytesToday >= up.config.ByteBudget
+}
+
+// updateStats reads the byte counters from the upstream connection and
+// publishes bytes sent and received as points on the sync node.
+func (up *SyncClient) updateStats() {
+	up.checkBudgetDay()
+
+	if up.ncRemote == nil {
+		return
+	}
+
+	stats := up.ncRemote.Stats()
+
+	// counters start over with each new connection
+	if stats.OutBytes < up.lastOutBytes {
+		up.lastOutBytes = 0
+	}
+
+	if stats.InBytes < up.lastInBytes {
+		up.lastInBytes = 0
+	}
+
+	tx := int(stats.OutBytes - up.lastOutBytes)
+	rx := int(stats.InBytes - up.lastInBytes)
+
+	up.lastOutBytes = stats.OutBytes
+	up.lastInBytes = stats.InBytes
+
+	if tx == 0 && rx == 0 {
+		return
+	}
+
+	up.config.BytesTx += tx
+	up.config.BytesRx += rx
+	up.config.BytesToday += tx + rx
+
+	points := data.Points{
+		{Type: data.PointTypeBytesTx, Value: float64(up.config.BytesTx)},
+		{Type: data.PointTypeBytesRx, Value: float64(up.config.BytesRx)},
+		{Type: data.PointTypeBytesToday, Value: float64(up.config.BytesToday)},
+	}
+
+	err := SendNodePoints(up.nc, up.config.ID, points, false)
+	if err != nil {
+		log.Println("Error sending sync byte counts: ", err)
+	}
+}
+
+// initBudgetDay determines which day the stored bytesToday count applies to
+func (up *SyncClient) initBudgetDay() {
+	up.bytesDay = time.Now()
+
+	nodes, err := GetNodes(up.nc, up.config.Parent, up.config.ID, "", false)
+	if err != nil || len(nodes) <= 0 {
+		return
+	}
+
+	for _, p := range nodes[0].Points {
+		if p.Type == data.PointTypeBytesToday {
+			up.bytesDay = p.Time
+		}
+	}
+
+	up.checkBudgetDay()
+}
@@ -0,0 +1,200 @@
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// pointsDiffer returns true if two points with the same type and key have
+// different data
+func pointsDiffer(a, b data.Point) bool {
+	return a.Value != b.Value || a.Text != b.Text ||
+		a.Tombstone != b.Tombstone || !bytes.Equal(a.Data, b.Data)
+}
+
+// syncPoint reconciles a point that exists both locally and upstream.
+// Clocks on devices can be wrong, so point times from the two sides are not
+// compared when we know which versions of the point were exchanged with the
+// upstream. If only one side has a version that was never exchanged, that
+// side changed the point and wins. If both sides do, the point was changed
+// independently and we have a conflict, which is resolved using the
+// configured policy and recorded on the sync node. The newest point only
+// wins if we have no history for the point (for instance on the first sync),
+// or with the newestWins policy. If the winning point is older than the other
+// copy, it is re-timestamped so that it is newer than both copies.
+func (up *SyncClient) syncPoint(nodeLocal, nodeUp data.NodeEdge, p, pUp data.Point, edge bool) {
+	if p.Time.Equal(pUp.Time) {
+		return
+	}
+
+	sendUp := func(p data.Point) {
+		up.seen.record(nodeUp.ID, parentKey(nodeUp, edge), p)
+		var err error
+		if edge {
+			err = SendEdgePoint(up.ncRemote, nodeUp.ID, nodeUp.Parent, p, true)
+		} else {
+			err = SendNodePoint(up.ncRemote, nodeUp.ID, p, true)
+		}
+		if err != nil {
+			log.Println("Error syncing point upstream: ", err)
+		}
+	}
+
+	sendLocal := func(p data.Point) {
+		up.seen.record(nodeLocal.ID, parentKey(nodeLocal, edge), p)
+		var err error
+		if edge {
+			err = SendEdgePoint(up.nc, nodeLocal.ID, nodeLocal.Parent, p, true)
+		} else {
+			err = SendNodePoint(up.nc, nodeLocal.ID, p, true)
+		}
+		if err != nil {
+			log.Println("Error syncing point from upstream: ", err)
+		}
+	}
+
+	// restamp returns the winning point with a time that is newer than both
+	// copies, as the store ignores points that are older than what it has
+	restamp := func(win data.Point) data.Point {
+		newest := p.Time
+		if pUp.Time.After(newest) {
+			newest = pUp.Time
+		}
+
+		win.Time = time.Now()
+		if !win.Time.After(newest) {
+			win.Time = newest.Add(time.Millisecond)
+		}
+		return win
+	}
+
+	useLocal := func() {
+		if p.Time.After(pUp.Time) {
+			sendUp(p)
+			return
+		}
+		win := restamp(p)
+		sendUp(win)
+		sendLocal(win)
+	}
+
+	useUp := func() {
+		if pUp.Time.After(p.Time) {
+			sendLocal(pUp)
+			return
+		}
+		win := restamp(pUp)
+		sendUp(win)
+		sendLocal(win)
+	}
+
+	iLocal, known := up.seen.exchangedIndex(nodeLocal.ID, parentKey(nodeLocal, edge), p)
+	iUp, _ := up.seen.exchangedIndex(nodeUp.ID, parentKey(nodeUp, edge), pUp)
+
+	if known {
+		switch {
+		case iLocal < 0 && iUp >= 0:
+			// only changed locally
+			useLocal()
+			return
+		case iUp < 0 && iLocal >= 0:
+			// only changed upstream
+			useUp()
+			return
+		case iLocal >= 0 && iUp >= 0:
+			// both versions were exchanged, the last one wins
+			if iLocal > iUp {
+				useLocal()
+			} else {
+				useUp()
+			}
+			return
+		}
+	}
+
+	conflict := known && pointsDiffer(p, pUp)
+
+	policy := up.config.ConflictPolicy
+	if !conflict || policy == "" || policy == data.PointValueNewestWins {
+		if conflict {
+			winner := "upstream"
+			if p.Time.After(pUp.Time) {
+				winner = "local"
+			}
+			up.recordConflict(nodeLocal.ID, p, pUp, winner)
+		}
+
+		if p.Time.After(pUp.Time) {
+			sendUp(p)
+		} else {
+			sendLocal(pUp)
+		}
+		return
+	}
+
+	var win data.Point
+	var winner string
+
+	switch policy {
+	case data.PointValueCloudWins:
+		win = pUp
+		winner = "upstream"
+	case data.PointValueEdgeWins:
+		win = p
+		winner = "local"
+	default:
+		log.Printf("Sync: %v: unknown conflict policy: %v\n", up.config.Description, policy)
+		return
+	}
+
+	up.recordConflict(nodeLocal.ID, p, pUp, winner)
+
+	win = restamp(win)
+	sendUp(win)
+	sendLocal(win)
+}
+
+// parentKey returns the parent used to track edge points in syncSeen
+func parentKey(node data.NodeEdge, edge bool) string {
+	if edge {
+		return node.Parent
+	}
+	return ""
+}
+
+// recordConflict increments the conflict count and records the details of
+// the conflict in a point on the sync node. The conflict point key is
+// <nodeID>:<point type>:<point key>.
+func (up *SyncClient) recordConflict(nodeID string, p, pUp data.Point, winner string) {
+	log.Printf("Sync: %v: conflict on node %v, point %v:%v, %v wins\n",
+		up.config.Description, nodeID, p.Type, p.Key, winner)
+
+	up.config.ConflictCount++
+
+	points := data.Points{
+		{Type: data.PointTypeConflictCount, Value: float64(up.config.ConflictCount)},
+		{
+			Type: data.PointTypeConflict,
+			Key:  fmt.Sprintf("%v:%v:%v", nodeID, p.Type, p.Key),
+			Text: fmt.Sprintf("local: %v, upstream: %v, winner: %v",
+				conflictDesc(p), conflictDesc(pUp), winner),
+		},
+	}
+
+	err := SendNodePoints(up.nc, up.config.ID, points, false)
+	if err != nil {
+		log.Println("Error recording sync conflict: ", err)
+	}
+}
+
+func conflictDesc(p data.Point) string {
+	v := fmt.Sprintf("%v", p.Value)
+	if p.Text != "" {
+		v = p.Text
+	}
+	return fmt.Sprintf("%v (%v)", v, p.Time.Format(time.RFC3339))
+}
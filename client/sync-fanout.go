@@ -0,0 +1,177 @@
+package client
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// syncSeenHistory is the number of point times remembered for each point
+const syncSeenHistory = 8
+
+// syncSeen tracks the points exchanged with an upstream for each node and
+// edge point. When an instance syncs to several upstreams, points received
+// from one upstream are forwarded to the others. If the upstreams are also
+// connected to each other (for instance a regional server that syncs to HQ),
+// the same point can come back to us by another path. Points that are not
+// newer than what we have already exchanged with this upstream are dropped so
+// they don't circulate forever. The history is also used to tell which side
+// changed a point since it was last exchanged when detecting conflicts, as
+// the clocks on the two sides can't be compared. If the sync client has a
+// queue, the history is also stored in the queue DB so it survives restarts.
+type syncSeen struct {
+	lock   sync.Mutex
+	points map[string][]time.Time
+	queue  *syncQueue
+}
+
+func newSyncSeen() *syncSeen {
+	return &syncSeen{points: make(map[string][]time.Time)}
+}
+
+func syncSeenKey(nodeID, parentID string, p data.Point) string {
+	// the store sets blank keys to "0"
+	key := p.Key
+	if key == "" {
+		key = "0"
+	}
+	return nodeID + ":" + parentID + ":" + p.Type + ":" + key
+}
+
+// setQueue sets the queue used to persist the history and loads the history
+// stored in it. The queue is cleared by passing nil.
+func (s *syncSeen) setQueue(q *syncQueue) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.queue = q
+	if q == nil {
+		return nil
+	}
+
+	stored, err := q.loadSeen()
+	if err != nil {
+		return err
+	}
+
+	for key, times := range stored {
+		if len(s.points[key]) <= 0 {
+			s.points[key] = times
+		}
+	}
+
+	return nil
+}
+
+func (s *syncSeen) recordLocked(key string, t time.Time) {
+	times := append(s.points[key], t)
+	if len(times) > syncSeenHistory {
+		times = times[len(times)-syncSeenHistory:]
+	}
+	s.points[key] = times
+
+	if s.queue != nil {
+		err := s.queue.saveSeen(key, times)
+		if err != nil {
+			log.Println("Sync: error saving exchanged point: ", err)
+		}
+	}
+}
+
+// record notes that a point was exchanged with the upstream
+func (s *syncSeen) record(nodeID, parentID string, p data.Point) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.recordLocked(syncSeenKey(nodeID, parentID, p), p.Time)
+}
+
+// recordNode notes that all points of a node were exchanged with the
+// upstream
+func (s *syncSeen) recordNode(node data.NodeEdge) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, p := range node.Points {
+		s.recordLocked(syncSeenKey(node.ID, "", p), p.Time)
+	}
+	for _, p := range node.EdgePoints {
+		s.recordLocked(syncSeenKey(node.ID, node.Parent, p), p.Time)
+	}
+}
+
+// exchangedIndex returns the position of this version of a point in the
+// history of versions sent to or received from the upstream, or -1 if it
+// was not exchanged. Later versions have a higher index. known is false if
+// we have no history for the point.
+func (s *syncSeen) exchangedIndex(nodeID, parentID string, p data.Point) (index int, known bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	times := s.points[syncSeenKey(nodeID, parentID, p)]
+	for i := len(times) - 1; i >= 0; i-- {
+		if times[i].Equal(p.Time) {
+			return i, true
+		}
+	}
+	return -1, len(times) > 0
+}
+
+// filter returns points that are newer than any point with the same key
+// that has been sent to or received from the upstream, and records them.
+func (s *syncSeen) filter(nodeID, parentID string, points data.Points) data.Points {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var ret data.Points
+	for _, p := range points {
+		if p.Time.IsZero() {
+			p.Time = time.Now()
+		}
+
+		key := syncSeenKey(nodeID, parentID, p)
+		times := s.points[key]
+		if len(times) > 0 && !p.Time.After(times[len(times)-1]) {
+			continue
+		}
+		s.recordLocked(key, p.Time)
+		ret = append(ret, p)
+	}
+	return ret
+}
+
+// sendHeartbeat lets the upstream know this instance is connected
+func (up *SyncClient) sendHeartbeat() {
+	if up.ncRemote == nil {
+		return
+	}
+
+	points := data.Points{
+		{Type: data.PointTypeNodeType, Text: up.rootLocal.Type},
+		{Type: data.PointTypeDescription, Text: up.rootLocal.Desc()},
+		{Type: data.PointTypePeriod, Value: float64(up.config.Period)},
+	}
+
+	d, err := points.ToPb()
+	if err != nil {
+		log.Println("Sync: error encoding heartbeat: ", err)
+		return
+	}
+
+	err = up.ncRemote.Publish(SubjectSyncHeartbeat(up.rootLocal.ID), d)
+	if err != nil {
+		log.Println("Sync: error sending heartbeat: ", err)
+	}
+}
+
+// GetSyncDownstream returns the downstream instances that sync to this
+// instance. The ID of each node is the root node ID of the downstream
+// instance, and the points include the lastSeen time and a connected flag.
+func GetSyncDownstream(nc *nats.Conn) (data.Nodes, error) {
+	nodeMsg, err := nc.Request(SubjectSyncDownstream(), nil, time.Second*20)
+	if err != nil {
+		return nil, err
+	}
+
+	return data.PbDecodeNodesRequest(nodeMsg.Data)
+}
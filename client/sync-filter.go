@@ -0,0 +1,129 @@
+package client
+
+import (
+	"strings"
+
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// syncFilter determines which nodes and points are synchronized between
+// instances. Nodes are excluded by type or by ID (which excludes the
+// entire subtree). Points are excluded by type, or if an include list is
+// configured, only the listed point types are synchronized. Telemetry points
+// are also excluded once the daily byte budget has been used.
+type syncFilter struct {
+	excludeNodeTypes  map[string]bool
+	excludeNodes      map[string]bool
+	excludePointTypes map[string]bool
+	includePointTypes map[string]bool
+	telemetry         map[string]bool
+	overBudget        bool
+}
+
+// splitList splits a comma separated list into a set
+func splitList(list string) map[string]bool {
+	ret := make(map[string]bool)
+	for _, s := range strings.Split(list, ",") {
+		s = strings.TrimSpace(s)
+		if s != "" {
+			ret[s] = true
+		}
+	}
+	return ret
+}
+
+func newSyncFilter(config Sync, overBudget bool) syncFilter {
+	return syncFilter{
+		excludeNodeTypes:  splitList(config.ExcludeNodeTypes),
+		excludeNodes:      splitList(config.ExcludeNodes),
+		excludePointTypes: splitList(config.ExcludePointTypes),
+		includePointTypes: splitList(config.IncludePointTypes),
+		telemetry:         newTelemetryTypes(config),
+		overBudget:        overBudget,
+	}
+}
+
+// active returns true if there are any filter rules configured
+func (f syncFilter) active() bool {
+	return f.overBudget || f.pointRules() ||
+		len(f.excludeNodeTypes) > 0 || len(f.excludeNodes) > 0
+}
+
+// pointRules returns true if point types are filtered by config
+func (f syncFilter) pointRules() bool {
+	return len(f.excludePointTypes) > 0 || len(f.includePointTypes) > 0
+}
+
+// excludeNode returns true if the node (and its subtree) should not be
+// synchronized.
+func (f syncFilter) excludeNode(id, typ string) bool {
+	return f.excludeNodes[id] || f.excludeNodeTypes[typ]
+}
+
+// excludePoint returns true if a point should not be synchronized. Points
+// that define the structure of the tree are never excluded.
+func (f syncFilter) excludePoint(p data.Point) bool {
+	return f.excludeConfig(p) || f.deferPoint(p)
+}
+
+// excludeConfig returns true if a point is excluded by the filter config
+func (f syncFilter) excludeConfig(p data.Point) bool {
+	switch p.Type {
+	case data.PointTypeNodeType, data.PointTypeTombstone:
+		return false
+	}
+
+	if len(f.includePointTypes) > 0 && !f.includePointTypes[p.Type] {
+		return true
+	}
+
+	return f.excludePointTypes[p.Type]
+}
+
+// deferPoint returns true if a point is only excluded because the daily byte
+// budget has been used. These points are queued and sent once the budget
+// resets.
+func (f syncFilter) deferPoint(p data.Point) bool {
+	if !f.overBudget || f.excludeConfig(p) {
+		return false
+	}
+
+	return f.telemetry[p.Type] || strings.HasPrefix(p.Type, "metric")
+}
+
+// filterPoints returns the points that should be synchronized
+func (f syncFilter) filterPoints(points data.Points) data.Points {
+	if !f.overBudget && !f.pointRules() {
+		return points
+	}
+
+	var ret data.Points
+	for _, p := range points {
+		if !f.excludePoint(p) {
+			ret = append(ret, p)
+		}
+	}
+	return ret
+}
+
+// excludedPointsHash returns the hash of points in a node that are excluded.
+// Edge points are only included if edge is true.
+func (f syncFilter) excludedPointsHash(node data.NodeEdge, edge bool) uint32 {
+	var ret uint32
+
+	for _, p := range node.Points {
+		if f.excludePoint(p) {
+			ret ^= p.CRC()
+		}
+	}
+
+	if edge {
+		for _, p := range node.EdgePoints {
+			if f.excludePoint(p) {
+				ret ^= p.CRC()
+			}
+		}
+	}
+
+	return ret
+}
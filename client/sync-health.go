@@ -0,0 +1,128 @@
+package client
+
+import (
+	"log"
+	"time"
+
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// syncHealthPointTypes are point types the sync client publishes on its own
+// node to report the health of the upstream connection.
+var syncHealthPointTypes = map[string]bool{
+	data.PointTypeConnected:      true,
+	data.PointTypeLastSync:       true,
+	data.PointTypeLatency:        true,
+	data.PointTypeHashMismatch:   true,
+	data.PointTypeQueueDepth:     true,
+	data.PointTypeReconnectCount: true,
+}
+
+// syncHealth tracks the last values published so we only send points when
+// something changes.
+type syncHealth struct {
+	connected      bool
+	connectedSent  bool
+	everConnected  bool
+	hashMismatch   int
+	queueDepth     int
+	queueDepthSent bool
+}
+
+func (up *SyncClient) sendHealthPoints(points data.Points) {
+	err := SendNodePoints(up.nc, up.config.ID, points, false)
+	if err != nil {
+		log.Println("Error sending sync health points: ", err)
+	}
+}
+
+// healthConnected is called when the upstream connection state changes
+func (up *SyncClient) healthConnected(connected bool) {
+	var points data.Points
+
+	if connected {
+		if up.health.everConnected {
+			up.config.ReconnectCount++
+			points = append(points, data.Point{Type: data.PointTypeReconnectCount,
+				Value: float64(up.config.ReconnectCount)})
+		}
+		up.health.everConnected = true
+	}
+
+	if !up.health.connectedSent || connected != up.health.connected {
+		points = append(points, data.Point{Type: data.PointTypeConnected,
+			Value: data.BoolToFloat(connected)})
+		up.health.connected = connected
+		up.health.connectedSent = true
+	}
+
+	if len(points) > 0 {
+		up.sendHealthPoints(points)
+	}
+}
+
+// healthQueueDepth publishes the number of messages waiting in the queue
+// if it has changed.
+func (up *SyncClient) healthQueueDepth() {
+	if up.health.queueDepthSent && up.health.queueDepth == up.queueLen {
+		return
+	}
+
+	up.health.queueDepth = up.queueLen
+	up.health.queueDepthSent = true
+
+	up.sendHealthPoints(data.Points{
+		{Type: data.PointTypeQueueDepth, Value: float64(up.queueLen)},
+	})
+}
+
+// healthSync is called after each sync pass. Points for the last sync time,
+// the round trip time to the upstream, and the number of nodes that had to
+// be synced are published.
+func (up *SyncClient) healthSync(syncErr error) {
+	var points data.Points
+
+	if syncErr == nil {
+		now := time.Now()
+		up.config.LastSync = float64(now.UnixNano()) / 1e9
+		points = append(points, data.Point{Time: now, Type: data.PointTypeLastSync,
+			Value: up.config.LastSync})
+	}
+
+	if up.hashMismatch != up.health.hashMismatch {
+		up.health.hashMismatch = up.hashMismatch
+		points = append(points, data.Point{Type: data.PointTypeHashMismatch,
+			Value: float64(up.hashMismatch)})
+	}
+
+	if up.ncRemote != nil {
+		rtt, err := up.ncRemote.RTT()
+		if err == nil {
+			points = append(points, data.Point{Type: data.PointTypeLatency,
+				Value: float64(rtt.Microseconds()) / 1000})
+		}
+	}
+
+	if len(points) > 0 {
+		up.sendHealthPoints(points)
+	}
+
+	up.healthQueueDepth()
+}
+
+// filterHealthPoints removes health points of this sync node when we are
+// disconnected. These are not queued as they are out of date by the time
+// the connection is restored.
+func (up *SyncClient) filterHealthPoints(connected bool, pts NewPoints) data.Points {
+	if connected || pts.ID != up.config.ID {
+		return pts.Points
+	}
+
+	var ret data.Points
+	for _, p := range pts.Points {
+		if !syncHealthPointTypes[p.Type] {
+			ret = append(ret, p)
+		}
+	}
+	return ret
+}
@@ -0,0 +1,786 @@
+package client
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// SyncMqtt is the upstream end of sync connections that go through an MQTT
+// broker. Downstream instances connect to the same broker using a sync node
+// with an mqtt:// or mqtts:// URI.
+type SyncMqtt struct {
+	ID           string `node:"id"`
+	Parent       string `node:"parent"`
+	Description  string `point:"description"`
+	URI          string `point:"uri"`
+	MQTTUser     string `point:"mqttUser"`
+	MQTTPassword string `point:"mqttPassword"`
+	TopicPrefix  string `point:"topicPrefix"`
+	// EdgeTokens lists the downstream instances that may sync through this
+	// node as <root node ID>:<auth token>. Each downstream instance must
+	// send its own token.
+	EdgeTokens []string `point:"edgeToken"`
+	Disable    bool     `point:"disable"`
+}
+
+// how long points sent by a downstream instance are remembered so they are
+// not echoed back to it
+const syncMQTTSentExpire = time.Minute
+
+// max number of nodes to walk when checking if a node is in the subtree
+// of a downstream instance
+const syncMQTTMaxWalk = 100
+
+// max number of requests from downstream instances handled at once
+const syncMQTTMaxRequests = 16
+
+// max number of new nodes (and points per node) held for a downstream
+// instance until the nodes are placed in its subtree
+const syncMQTTMaxPending = 1000
+
+// syncMQTTPending are node points for a node that does not exist yet
+type syncMQTTPending struct {
+	points data.Points
+	time   time.Time
+}
+
+// syncMQTTEdge is the state for a downstream instance
+type syncMQTTEdge struct {
+	sub *nats.Subscription
+	// nodes that are known to be in the downstream subtree
+	nodes map[string]bool
+	// node points for new nodes. New nodes are not in the downstream
+	// subtree until their edge points arrive, so the points are held
+	// until then.
+	pending map[string]*syncMQTTPending
+	// points received from the downstream instance, key is
+	// nodeID.parentID.type.key.time
+	sent      map[string]time.Time
+	lastPrune time.Time
+}
+
+// SyncMQTTClient bridges requests from downstream instances that arrive
+// through an MQTT broker to the local NATS server, and forwards point
+// changes for the downstream nodes back to the downstream instances.
+type SyncMQTTClient struct {
+	nc            *nats.Conn
+	config        SyncMqtt
+	stop          chan struct{}
+	newPoints     chan NewPoints
+	newEdgePoints chan NewPoints
+	mqtt          mqtt.Client
+	// root node ID of this instance
+	rootID string
+	// limits the number of requests in flight
+	requests chan struct{}
+	// the following are accessed from MQTT and NATS handlers
+	lock sync.Mutex
+	// auth tokens, key is the root node ID of the downstream instance
+	tokens map[string]string
+	// key is the root node ID of the downstream instance
+	edges map[string]*syncMQTTEdge
+}
+
+// NewSyncMQTTClient constructor
+func NewSyncMQTTClient(nc *nats.Conn, config SyncMqtt) Client {
+	return &SyncMQTTClient{
+		nc:            nc,
+		config:        config,
+		stop:          make(chan struct{}),
+		newPoints:     make(chan NewPoints),
+		newEdgePoints: make(chan NewPoints),
+		requests:      make(chan struct{}, syncMQTTMaxRequests),
+		edges:         make(map[string]*syncMQTTEdge),
+	}
+}
+
+// Run the main logic for this client and blocks until stopped
+func (sm *SyncMQTTClient) Run() error {
+	root, err := GetRootNode(sm.nc)
+	if err != nil {
+		log.Println("Sync MQTT: error getting root node: ", err)
+	}
+	sm.rootID = root.ID
+
+	sm.connect()
+
+done:
+	for {
+		select {
+		case <-sm.stop:
+			break done
+		case pts := <-sm.newPoints:
+			err := data.MergePoints(pts.ID, pts.Points, &sm.config)
+			if err != nil {
+				log.Println("error merging new points: ", err)
+			}
+
+			for _, p := range pts.Points {
+				switch p.Type {
+				case data.PointTypeURI,
+					data.PointTypeMQTTUser,
+					data.PointTypeMQTTPassword,
+					data.PointTypeTopicPrefix,
+					data.PointTypeDisable:
+					sm.disconnect()
+					sm.connect()
+				case data.PointTypeEdgeToken:
+					sm.setTokens()
+				}
+			}
+		case pts := <-sm.newEdgePoints:
+			err := data.MergeEdgePoints(pts.ID, pts.Parent, pts.Points, &sm.config)
+			if err != nil {
+				log.Println("error merging new points: ", err)
+			}
+		}
+	}
+
+	sm.disconnect()
+
+	return nil
+}
+
+// Stop sends a signal to the Run function to exit
+func (sm *SyncMQTTClient) Stop(_ error) {
+	close(sm.stop)
+}
+
+// Points is called by the Manager when new points for this
+// node are received.
+func (sm *SyncMQTTClient) Points(nodeID string, points []data.Point) {
+	sm.newPoints <- NewPoints{nodeID, "", points}
+}
+
+// EdgePoints is called by the Manager when new edge points for this
+// node are received.
+func (sm *SyncMQTTClient) EdgePoints(nodeID, parentID string, points []data.Point) {
+	sm.newEdgePoints <- NewPoints{nodeID, parentID, points}
+}
+
+// setTokens updates the downstream instance auth tokens. Downstream
+// instances that are no longer listed are dropped.
+func (sm *SyncMQTTClient) setTokens() {
+	tokens := make(map[string]string)
+	for _, e := range sm.config.EdgeTokens {
+		id, token, _ := strings.Cut(e, ":")
+		id = strings.TrimSpace(id)
+		token = strings.TrimSpace(token)
+		if id == "" || token == "" {
+			continue
+		}
+		tokens[id] = token
+	}
+
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+
+	sm.tokens = tokens
+
+	for id, edge := range sm.edges {
+		if _, ok := tokens[id]; ok {
+			continue
+		}
+		if edge.sub != nil {
+			err := edge.sub.Unsubscribe()
+			if err != nil {
+				log.Println("Sync MQTT: error unsubscribing: ", err)
+			}
+		}
+		delete(sm.edges, id)
+	}
+}
+
+// authorized returns true if the token is the auth token of the downstream
+// instance
+func (sm *SyncMQTTClient) authorized(edgeID, token string) bool {
+	sm.lock.Lock()
+	expToken, ok := sm.tokens[edgeID]
+	sm.lock.Unlock()
+
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(expToken)) == 1
+}
+
+func (sm *SyncMQTTClient) connect() {
+	sm.setTokens()
+
+	if sm.config.Disable || sm.config.URI == "" {
+		return
+	}
+
+	prefix := mqttPrefix(sm.config.TopicPrefix)
+
+	sm.mqtt = MQTTConnect(MQTTOptions{
+		URI:      sm.config.URI,
+		User:     sm.config.MQTTUser,
+		Password: sm.config.MQTTPassword,
+		ClientID: "siot-sync-server-" + sm.config.ID,
+		Connected: func(c bool) {
+			if c {
+				log.Printf("Sync MQTT: %v: connected to %v\n",
+					sm.config.Description, sm.config.URI)
+			}
+		},
+		Subscribe: func(c mqtt.Client) {
+			topic := fmt.Sprintf("%v/%v/+/#", prefix, mqttDirUp)
+			t := c.Subscribe(topic, 1, sm.handleMQTT)
+			if t.Wait() && t.Error() != nil {
+				log.Println("Sync MQTT: error subscribing: ", t.Error())
+			}
+		},
+	})
+}
+
+func (sm *SyncMQTTClient) disconnect() {
+	sm.lock.Lock()
+	for id, edge := range sm.edges {
+		if edge.sub != nil {
+			err := edge.sub.Unsubscribe()
+			if err != nil {
+				log.Println("Sync MQTT: error unsubscribing: ", err)
+			}
+		}
+		delete(sm.edges, id)
+	}
+	sm.lock.Unlock()
+
+	if sm.mqtt != nil {
+		sm.mqtt.Disconnect(250)
+		sm.mqtt = nil
+	}
+}
+
+// handleMQTT handles messages from downstream instances
+func (sm *SyncMQTTClient) handleMQTT(c mqtt.Client, m mqtt.Message) {
+	edgeID, subject, err := mqttSubject(sm.config.TopicPrefix, m.Topic())
+	if err != nil {
+		log.Println("Sync MQTT: ", err)
+		return
+	}
+
+	reply, token, d, err := mqttDecodeEnvelope(m.Payload())
+	if err != nil {
+		log.Println("Sync MQTT: ", err)
+		return
+	}
+
+	if !sm.authorized(edgeID, token) {
+		log.Printf("Sync MQTT: invalid auth token from %v\n", edgeID)
+		return
+	}
+
+	subject, d, held := sm.hold(edgeID, subject, d)
+	if held {
+		if reply != "" {
+			// let the downstream instance know the points were received
+			topic := mqttTopic(sm.config.TopicPrefix, mqttDirDown, edgeID, reply)
+			c.Publish(topic, 1, false, mqttEncodeEnvelope("", "", nil))
+		}
+		return
+	}
+
+	if !sm.allowed(edgeID, subject, d) {
+		log.Printf("Sync MQTT: %v is not allowed to send %v\n", edgeID, subject)
+		return
+	}
+
+	sm.release(edgeID, subject, d)
+
+	sm.subscribeDownstream(c, edgeID)
+
+	if reply == "" {
+		sm.recordSent(edgeID, subject, d)
+		err := sm.nc.Publish(subject, d)
+		if err != nil {
+			log.Println("Sync MQTT: error publishing: ", err)
+		}
+		return
+	}
+
+	// don't block the MQTT client while we wait for the response, but
+	// limit the number of requests in flight
+	sm.requests <- struct{}{}
+	go func() {
+		defer func() { <-sm.requests }()
+
+		msg, err := sm.nc.Request(subject, d, 20*time.Second)
+		if err != nil {
+			log.Printf("Sync MQTT: request %v failed: %v\n", subject, err)
+			return
+		}
+
+		topic := mqttTopic(sm.config.TopicPrefix, mqttDirDown, edgeID, reply)
+		c.Publish(topic, 1, false, mqttEncodeEnvelope("", "", msg.Data))
+	}()
+}
+
+// edge returns the state for a downstream instance. sm.lock must be held.
+func (sm *SyncMQTTClient) edge(edgeID string) *syncMQTTEdge {
+	edge, ok := sm.edges[edgeID]
+	if !ok {
+		edge = &syncMQTTEdge{
+			nodes:   make(map[string]bool),
+			pending: make(map[string]*syncMQTTPending),
+			sent:    make(map[string]time.Time),
+		}
+		sm.edges[edgeID] = edge
+	}
+	return edge
+}
+
+// hold holds node points for nodes that do not exist yet until the node is
+// placed in the downstream subtree by its edge points (see release). It
+// returns the rest of the message, and true if the whole message was held.
+func (sm *SyncMQTTClient) hold(edgeID, subject string, d []byte) (string, []byte, bool) {
+	chunks := strings.Split(subject, ".")
+
+	switch {
+	case chunks[0] == "p" && len(chunks) == 2:
+		points, err := data.PbDecodePoints(d)
+		if err != nil || !sm.holdPoints(edgeID, chunks[1], points) {
+			return subject, d, false
+		}
+		return subject, nil, true
+	case chunks[0] == "batch" && len(chunks) == 2:
+		nodes, err := DecodeBatchPointsMsg(&nats.Msg{Subject: subject, Data: d})
+		if err != nil {
+			return subject, d, false
+		}
+
+		// nodes with edge points in the batch are checked by allowed
+		placed := make(map[string]bool)
+		for _, n := range nodes {
+			if len(n.EdgePoints) > 0 {
+				placed[n.ID] = true
+			}
+		}
+
+		var rest data.Nodes
+		for _, n := range nodes {
+			if placed[n.ID] || !sm.holdPoints(edgeID, n.ID, n.Points) {
+				rest = append(rest, n)
+			}
+		}
+
+		if len(rest) == len(nodes) {
+			return subject, d, false
+		}
+
+		if len(rest) == 0 {
+			return subject, nil, true
+		}
+
+		subject, d, err = EncodeBatchPoints(rest, chunks[1] == BatchEncodingGzip)
+		if err != nil {
+			log.Println("Sync MQTT: error encoding batch: ", err)
+			return subject, nil, true
+		}
+		return subject, d, false
+	}
+
+	return subject, d, false
+}
+
+// holdPoints holds node points if the node does not exist yet. It returns
+// true if the points were held.
+func (sm *SyncMQTTClient) holdPoints(edgeID, id string, points data.Points) bool {
+	if id == edgeID {
+		return false
+	}
+
+	sm.lock.Lock()
+	edge := sm.edge(edgeID)
+	known := edge.nodes[id]
+	_, pending := edge.pending[id]
+	sm.lock.Unlock()
+
+	if known || (!pending && sm.nodeExists(id)) {
+		return false
+	}
+
+	now := time.Now()
+
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+
+	for k, p := range edge.pending {
+		if now.Sub(p.time) > syncMQTTSentExpire {
+			delete(edge.pending, k)
+		}
+	}
+
+	p, ok := edge.pending[id]
+	if !ok {
+		if len(edge.pending) >= syncMQTTMaxPending {
+			return false
+		}
+		p = &syncMQTTPending{}
+		edge.pending[id] = p
+	}
+
+	if len(p.points)+len(points) > syncMQTTMaxPending {
+		return false
+	}
+
+	p.points = append(p.points, points...)
+	p.time = now
+
+	return true
+}
+
+// release sends the held points of new nodes that are placed in the
+// downstream subtree by a message before the message is sent.
+func (sm *SyncMQTTClient) release(edgeID, subject string, d []byte) {
+	var ids []string
+
+	chunks := strings.Split(subject, ".")
+
+	switch {
+	case chunks[0] == "p" && len(chunks) == 3:
+		ids = []string{chunks[1]}
+	case chunks[0] == "batch" && len(chunks) == 2:
+		nodes, err := DecodeBatchPointsMsg(&nats.Msg{Subject: subject, Data: d})
+		if err != nil {
+			return
+		}
+		for _, n := range nodes {
+			if len(n.EdgePoints) > 0 {
+				ids = append(ids, n.ID)
+			}
+		}
+	}
+
+	for _, id := range ids {
+		sm.lock.Lock()
+		edge := sm.edge(edgeID)
+		p, ok := edge.pending[id]
+		delete(edge.pending, id)
+		if id != edgeID {
+			edge.nodes[id] = true
+		}
+		sm.lock.Unlock()
+
+		if !ok {
+			continue
+		}
+
+		d, err := p.points.ToPb()
+		if err != nil {
+			log.Println("Sync MQTT: error encoding held points: ", err)
+			continue
+		}
+
+		subject := SubjectNodePoints(id)
+		sm.recordSent(edgeID, subject, d)
+
+		_, err = sm.nc.Request(subject, d, 20*time.Second)
+		if err != nil {
+			log.Printf("Sync MQTT: error sending held points for %v: %v\n", id, err)
+		}
+	}
+}
+
+// allowed returns true if a downstream instance is allowed to send a
+// message on the subject. Only the subjects used by sync are allowed, and
+// they must be for nodes in the subtree of the downstream instance.
+func (sm *SyncMQTTClient) allowed(edgeID, subject string, d []byte) bool {
+	if subject == SubjectSyncHeartbeat(edgeID) {
+		return true
+	}
+
+	chunks := strings.Split(subject, ".")
+
+	switch {
+	case chunks[0] == "p" && len(chunks) == 2:
+		return sm.inSubtree(edgeID, chunks[1])
+	case chunks[0] == "p" && len(chunks) == 3:
+		return sm.edgeAllowed(edgeID, chunks[1], chunks[2], nil)
+	case chunks[0] == "phrup" && len(chunks) == 3:
+		return sm.inSubtree(edgeID, chunks[2])
+	case chunks[0] == "batch" && len(chunks) == 2:
+		nodes, err := DecodeBatchPointsMsg(&nats.Msg{Subject: subject, Data: d})
+		if err != nil {
+			return false
+		}
+		return sm.batchAllowed(edgeID, nodes)
+	case chunks[0] == "nodes" && len(chunks) == 3:
+		parent, id := chunks[1], chunks[2]
+		switch {
+		case parent == "root", id == edgeID:
+			return true
+		case parent == "all":
+			return sm.readable(edgeID, id)
+		default:
+			return sm.readable(edgeID, parent)
+		}
+	}
+
+	return false
+}
+
+// batchAllowed returns true if all nodes in a batch are in the downstream
+// subtree. New nodes may be placed under other new nodes in the same batch.
+func (sm *SyncMQTTClient) batchAllowed(edgeID string, nodes data.Nodes) bool {
+	created := make(map[string]bool)
+	exists := make(map[string]bool)
+
+	for _, n := range nodes {
+		if _, ok := exists[n.ID]; !ok {
+			exists[n.ID] = n.ID == edgeID || sm.nodeExists(n.ID)
+		}
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for _, n := range nodes {
+			if len(n.EdgePoints) <= 0 || exists[n.ID] || created[n.ID] {
+				continue
+			}
+			if created[n.Parent] || sm.inSubtree(edgeID, n.Parent) {
+				created[n.ID] = true
+				changed = true
+			}
+		}
+	}
+
+	for _, n := range nodes {
+		if len(n.Points) > 0 && !created[n.ID] && !sm.inSubtree(edgeID, n.ID) {
+			return false
+		}
+		if len(n.EdgePoints) > 0 && !sm.edgeAllowed(edgeID, n.ID, n.Parent, created) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// edgeAllowed returns true if a downstream instance may send edge points for
+// a node. The downstream root node may only be placed under the root node of
+// this instance or a parent it already has. Other nodes must be in the
+// downstream subtree or be new nodes, and the parent must be in the subtree
+// or be created in the same batch.
+func (sm *SyncMQTTClient) edgeAllowed(edgeID, id, parent string, created map[string]bool) bool {
+	if id == edgeID {
+		return parent == sm.rootID || sm.hasEdge(id, parent)
+	}
+
+	if !created[parent] && !sm.inSubtree(edgeID, parent) {
+		return false
+	}
+
+	return created[id] || sm.inSubtree(edgeID, id) || !sm.nodeExists(id)
+}
+
+// readable returns true if a downstream instance may read a node. Requests
+// for nodes that do not exist return nothing, so are allowed.
+func (sm *SyncMQTTClient) readable(edgeID, id string) bool {
+	return sm.inSubtree(edgeID, id) || !sm.nodeExists(id)
+}
+
+// nodeExists returns true if there is a node with this ID
+func (sm *SyncMQTTClient) nodeExists(id string) bool {
+	nodes, err := GetNodes(sm.nc, "all", id, "", true)
+	if err != nil {
+		// only trust not found errors
+		return err != data.ErrDocumentNotFound
+	}
+	return len(nodes) > 0
+}
+
+// hasEdge returns true if there is an edge between a node and a parent
+func (sm *SyncMQTTClient) hasEdge(id, parent string) bool {
+	nodes, err := GetNodes(sm.nc, parent, id, "", true)
+	return err == nil && len(nodes) > 0
+}
+
+// inSubtree returns true if the node is the downstream root node or a
+// descendant of it. Nodes that do not exist are not in the subtree.
+func (sm *SyncMQTTClient) inSubtree(edgeID, id string) bool {
+	if id == edgeID {
+		return true
+	}
+
+	sm.lock.Lock()
+	known := sm.edge(edgeID).nodes
+	if known[id] {
+		sm.lock.Unlock()
+		return true
+	}
+	sm.lock.Unlock()
+
+	ret := func() bool {
+		ids := []string{id}
+		seen := map[string]bool{id: true}
+
+		for walk := 0; len(ids) > 0 && walk < syncMQTTMaxWalk; walk++ {
+			cur := ids[0]
+			ids = ids[1:]
+
+			ups, err := GetNodes(sm.nc, "all", cur, "", true)
+			if err != nil {
+				if err != data.ErrDocumentNotFound {
+					log.Println("Sync MQTT: error getting node parents: ", err)
+				}
+				return false
+			}
+
+			for _, up := range ups {
+				sm.lock.Lock()
+				found := up.Parent == edgeID || known[up.Parent]
+				sm.lock.Unlock()
+				if found {
+					return true
+				}
+				if !seen[up.Parent] {
+					seen[up.Parent] = true
+					ids = append(ids, up.Parent)
+				}
+			}
+		}
+
+		return false
+	}()
+
+	if ret {
+		sm.lock.Lock()
+		known[id] = true
+		sm.lock.Unlock()
+	}
+
+	return ret
+}
+
+func syncMQTTSentKey(nodeID, parentID string, p data.Point) string {
+	return fmt.Sprintf("%v.%v.%v.%v.%v", nodeID, parentID, p.Type, p.Key,
+		p.Time.UnixNano())
+}
+
+// recordSent remembers points sent by a downstream instance so they are not
+// echoed back to it.
+func (sm *SyncMQTTClient) recordSent(edgeID, subject string, d []byte) {
+	var nodes data.Nodes
+
+	chunks := strings.Split(subject, ".")
+
+	switch {
+	case chunks[0] == "p" && (len(chunks) == 2 || len(chunks) == 3):
+		points, err := data.PbDecodePoints(d)
+		if err != nil {
+			return
+		}
+		n := data.NodeEdge{ID: chunks[1], Points: points}
+		if len(chunks) == 3 {
+			n = data.NodeEdge{ID: chunks[1], Parent: chunks[2], EdgePoints: points}
+		}
+		nodes = data.Nodes{n}
+	case chunks[0] == "batch":
+		var err error
+		nodes, err = DecodeBatchPointsMsg(&nats.Msg{Subject: subject, Data: d})
+		if err != nil {
+			return
+		}
+	default:
+		return
+	}
+
+	now := time.Now()
+
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+
+	edge := sm.edge(edgeID)
+
+	if now.Sub(edge.lastPrune) > syncMQTTSentExpire {
+		for k, t := range edge.sent {
+			if now.Sub(t) > syncMQTTSentExpire {
+				delete(edge.sent, k)
+			}
+		}
+		edge.lastPrune = now
+	}
+
+	for _, n := range nodes {
+		for _, p := range n.Points {
+			edge.sent[syncMQTTSentKey(n.ID, "", p)] = now
+		}
+		for _, p := range n.EdgePoints {
+			edge.sent[syncMQTTSentKey(n.ID, n.Parent, p)] = now
+		}
+	}
+}
+
+// subscribeDownstream forwards point changes for nodes in the downstream
+// instance to the downstream instance. The store rebroadcasts point changes
+// on up.<edgeID>.> for all nodes under the downstream root node. Points that
+// were sent by the downstream instance are not sent back.
+func (sm *SyncMQTTClient) subscribeDownstream(c mqtt.Client, edgeID string) {
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+
+	edge := sm.edge(edgeID)
+
+	if edge.sub != nil {
+		return
+	}
+
+	sub, err := sm.nc.Subscribe("up."+edgeID+".>", func(msg *nats.Msg) {
+		// only node and edge points
+		chunks := strings.Split(msg.Subject, ".")
+		if len(chunks) != 3 && len(chunks) != 4 {
+			return
+		}
+
+		points, err := data.PbDecodePoints(msg.Data)
+		if err != nil {
+			log.Println("Sync MQTT: error decoding downstream points: ", err)
+			return
+		}
+
+		nodeID := chunks[2]
+		parentID := ""
+		if len(chunks) == 4 {
+			parentID = chunks[3]
+		}
+
+		var send data.Points
+		sm.lock.Lock()
+		for _, p := range points {
+			if _, ok := edge.sent[syncMQTTSentKey(nodeID, parentID, p)]; !ok {
+				send = append(send, p)
+			}
+		}
+		sm.lock.Unlock()
+
+		if len(send) <= 0 {
+			return
+		}
+
+		d := msg.Data
+		if len(send) != len(points) {
+			d, err = send.ToPb()
+			if err != nil {
+				log.Println("Sync MQTT: error encoding downstream points: ", err)
+				return
+			}
+		}
+
+		topic := mqttTopic(sm.config.TopicPrefix, mqttDirDown, edgeID, msg.Subject)
+		c.Publish(topic, 1, false, mqttEncodeEnvelope("", "", d))
+	})
+
+	if err != nil {
+		log.Println("Sync MQTT: error subscribing to downstream points: ", err)
+		return
+	}
+
+	edge.sub = sub
+}
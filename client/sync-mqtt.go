@@ -0,0 +1,267 @@
+package client
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+)
+
+// Sync over MQTT
+//
+// NATS subjects are mapped onto MQTT topics as follows:
+//
+//	<prefix>/up/<edgeID>/<subject with . replaced by />
+//	<prefix>/down/<edgeID>/<subject with . replaced by />
+//
+// where edgeID is the root node ID of the downstream instance. Messages sent
+// from the downstream instance use the up topics, and messages sent to the
+// downstream instance use the down topics. MQTT 3.1.1 does not support
+// request/response, so the payload of each message is wrapped in an envelope
+// that contains the NATS reply subject (if any) and the auth token of the
+// downstream instance. Responses are sent to the topic for the reply subject.
+
+const defaultMQTTTopicPrefix = "siot"
+
+const (
+	mqttDirUp   = "up"
+	mqttDirDown = "down"
+)
+
+// isMQTTURI returns true if the URI is for an MQTT broker
+func isMQTTURI(uri string) bool {
+	return strings.HasPrefix(uri, "mqtt://") || strings.HasPrefix(uri, "mqtts://")
+}
+
+func mqttPrefix(prefix string) string {
+	if prefix == "" {
+		return defaultMQTTTopicPrefix
+	}
+	return prefix
+}
+
+// mqttTopic converts a NATS subject to an MQTT topic
+func mqttTopic(prefix, dir, edgeID, subject string) string {
+	return fmt.Sprintf("%v/%v/%v/%v", mqttPrefix(prefix), dir, edgeID,
+		strings.ReplaceAll(subject, ".", "/"))
+}
+
+// mqttSubject converts an MQTT topic to the edge ID and NATS subject
+func mqttSubject(prefix, topic string) (string, string, error) {
+	// topic is <prefix>/<dir>/<edgeID>/<subject>
+	rest := strings.TrimPrefix(topic, mqttPrefix(prefix)+"/")
+	chunks := strings.SplitN(rest, "/", 3)
+	if len(chunks) != 3 || rest == topic {
+		return "", "", fmt.Errorf("Invalid sync topic: %v", topic)
+	}
+
+	return chunks[1], strings.ReplaceAll(chunks[2], "/", "."), nil
+}
+
+// mqttEncodeEnvelope wraps a payload along with the reply subject and auth
+// token
+func mqttEncodeEnvelope(reply, token string, d []byte) []byte {
+	ret := make([]byte, 4+len(reply)+len(token)+len(d))
+	binary.BigEndian.PutUint16(ret, uint16(len(reply)))
+	copy(ret[2:], reply)
+	i := 2 + len(reply)
+	binary.BigEndian.PutUint16(ret[i:], uint16(len(token)))
+	copy(ret[i+2:], token)
+	copy(ret[i+2+len(token):], d)
+	return ret
+}
+
+// mqttDecodeEnvelope returns the reply subject, auth token, and payload
+func mqttDecodeEnvelope(d []byte) (string, string, []byte, error) {
+	if len(d) < 2 {
+		return "", "", nil, errors.New("Sync MQTT envelope too short")
+	}
+
+	l := int(binary.BigEndian.Uint16(d))
+	if len(d) < 4+l {
+		return "", "", nil, errors.New("Sync MQTT envelope reply truncated")
+	}
+
+	reply := string(d[2 : 2+l])
+	d = d[2+l:]
+
+	l = int(binary.BigEndian.Uint16(d))
+	if len(d) < 2+l {
+		return "", "", nil, errors.New("Sync MQTT envelope token truncated")
+	}
+
+	return reply, string(d[2 : 2+l]), d[2+l:], nil
+}
+
+// MQTTOptions are used to connect to an MQTT broker
+type MQTTOptions struct {
+	URI      string
+	User     string
+	Password string
+	ClientID string
+	// Connected is called with true when the connection is established
+	// and false when it is lost
+	Connected func(bool)
+	// Subscribe is called after each connection to set up subscriptions
+	Subscribe func(mqtt.Client)
+}
+
+// MQTTConnect connects to an MQTT broker. The connection is retried in the
+// background, so this returns before the connection is established. Use
+// mqtts:// in the URI for TLS.
+func MQTTConnect(o MQTTOptions) mqtt.Client {
+	opts := mqtt.NewClientOptions()
+	opts.AddBroker(o.URI)
+	opts.SetClientID(o.ClientID)
+	opts.SetUsername(o.User)
+	opts.SetPassword(o.Password)
+	opts.SetCleanSession(true)
+	opts.SetAutoReconnect(true)
+	opts.SetConnectRetry(true)
+	opts.SetConnectRetryInterval(10 * time.Second)
+	opts.SetMaxReconnectInterval(time.Minute)
+	opts.SetOrderMatters(false)
+
+	opts.SetOnConnectHandler(func(c mqtt.Client) {
+		if o.Subscribe != nil {
+			o.Subscribe(c)
+		}
+		if o.Connected != nil {
+			o.Connected(true)
+		}
+	})
+
+	opts.SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+		log.Printf("MQTT connection to %v lost: %v\n", o.URI, err)
+		if o.Connected != nil {
+			o.Connected(false)
+		}
+	})
+
+	c := mqtt.NewClient(opts)
+	c.Connect()
+
+	return c
+}
+
+// syncMQTT bridges the sync client to an upstream through an MQTT broker.
+// The sync client is written to talk to a NATS server, so we give it a
+// connection to a private in-process NATS server and bridge messages between
+// that server and MQTT.
+type syncMQTT struct {
+	server *server.Server
+	// bridge connection to the private server. NoEcho is set so we don't
+	// send messages from MQTT back to MQTT.
+	nc     *nats.Conn
+	mqtt   mqtt.Client
+	prefix string
+	edgeID string
+	token  string
+}
+
+// newSyncMQTT returns the bridge and a connection the sync client can use
+// as the upstream NATS connection.
+func newSyncMQTT(config Sync, edgeID string, connected func(bool)) (*syncMQTT, *nats.Conn, error) {
+	s, err := server.NewServer(&server.Options{DontListen: true, NoSigs: true, NoLog: true})
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error creating sync MQTT server: %v", err)
+	}
+
+	go s.Start()
+
+	if !s.ReadyForConnections(5 * time.Second) {
+		s.Shutdown()
+		return nil, nil, errors.New("Sync MQTT server did not start")
+	}
+
+	sm := &syncMQTT{server: s, prefix: config.TopicPrefix, edgeID: edgeID,
+		token: config.AuthToken}
+
+	sm.nc, err = nats.Connect("", nats.InProcessServer(s), nats.NoEcho())
+	if err != nil {
+		s.Shutdown()
+		return nil, nil, err
+	}
+
+	ncRemote, err := nats.Connect("", nats.InProcessServer(s), nats.NoEcho())
+	if err != nil {
+		sm.nc.Close()
+		s.Shutdown()
+		return nil, nil, err
+	}
+
+	_, err = sm.nc.Subscribe(">", sm.handleLocal)
+	if err != nil {
+		ncRemote.Close()
+		sm.close()
+		return nil, nil, err
+	}
+
+	sm.mqtt = MQTTConnect(MQTTOptions{
+		URI:       config.URI,
+		User:      config.MQTTUser,
+		Password:  config.MQTTPassword,
+		ClientID:  "siot-sync-" + config.ID,
+		Connected: connected,
+		Subscribe: func(c mqtt.Client) {
+			topic := fmt.Sprintf("%v/%v/%v/#", mqttPrefix(sm.prefix), mqttDirDown, edgeID)
+			t := c.Subscribe(topic, 1, sm.handleMQTT)
+			if t.Wait() && t.Error() != nil {
+				log.Println("Sync: error subscribing to MQTT topic: ", t.Error())
+			}
+		},
+	})
+
+	return sm, ncRemote, nil
+}
+
+// handleLocal forwards messages from the sync client to MQTT
+func (sm *syncMQTT) handleLocal(msg *nats.Msg) {
+	topic := mqttTopic(sm.prefix, mqttDirUp, sm.edgeID, msg.Subject)
+	sm.mqtt.Publish(topic, 1, false, mqttEncodeEnvelope(msg.Reply, sm.token, msg.Data))
+}
+
+// handleMQTT forwards messages from the upstream to the sync client
+func (sm *syncMQTT) handleMQTT(_ mqtt.Client, m mqtt.Message) {
+	_, subject, err := mqttSubject(sm.prefix, m.Topic())
+	if err != nil {
+		log.Println("Sync: ", err)
+		return
+	}
+
+	reply, _, d, err := mqttDecodeEnvelope(m.Payload())
+	if err != nil {
+		log.Println("Sync: ", err)
+		return
+	}
+
+	err = sm.nc.PublishMsg(&nats.Msg{Subject: subject, Reply: reply, Data: d})
+	if err != nil {
+		log.Println("Sync: error publishing MQTT message: ", err)
+	}
+
+	// The upstream forwards point changes for our nodes using the
+	// up.<edgeID>.<nodeID>[.<parentID>] subjects. The sync client listens on
+	// the point subjects, so republish them there.
+	chunks := strings.Split(subject, ".")
+	if (len(chunks) == 3 || len(chunks) == 4) && chunks[0] == "up" {
+		err = sm.nc.Publish("p."+strings.Join(chunks[2:], "."), d)
+		if err != nil {
+			log.Println("Sync: error publishing MQTT message: ", err)
+		}
+	}
+}
+
+func (sm *syncMQTT) close() {
+	if sm.mqtt != nil {
+		sm.mqtt.Disconnect(250)
+	}
+	sm.nc.Close()
+	sm.server.Shutdown()
+}
@@ -0,0 +1,222 @@
+package client
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	// tell sql to use sqlite
+	_ "modernc.org/sqlite"
+)
+
+// syncQueue is a persistent FIFO of outbound point messages that could not
+// be sent upstream. It is used by the sync client to store points while
+// the upstream connection is down so they can be replayed in order when
+// the connection is restored. The queue DB also stores the history of
+// points exchanged with the upstream (see syncSeen) so that conflicts are
+// still detected after a restart.
+type syncQueue struct {
+	db       *sql.DB
+	maxCount int
+	maxAge   time.Duration
+}
+
+// syncQueueEntry is a single queued message
+type syncQueueEntry struct {
+	id      int64
+	subject string
+	data    []byte
+}
+
+// newSyncQueue opens (or creates) a queue in the specified file. maxCount
+// and maxAge bound the size of the queue -- the oldest entries are dropped
+// first when either limit is exceeded. A value of 0 disables a limit.
+func newSyncQueue(file string, maxCount int, maxAge time.Duration) (*syncQueue, error) {
+	pragmas := "_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)&_pragma=busy_timeout(8000)"
+
+	db, err := sql.Open("sqlite", fmt.Sprintf("%s?%s", file, pragmas))
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS queue (id INTEGER PRIMARY KEY AUTOINCREMENT,
+				time INT,
+				subject TEXT,
+				data BLOB)`)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("Error creating queue table: %v", err)
+	}
+
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS seen (key TEXT PRIMARY KEY,
+				time INT,
+				times TEXT)`)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("Error creating seen table: %v", err)
+	}
+
+	q := &syncQueue{db: db, maxCount: maxCount, maxAge: maxAge}
+
+	err = q.prune()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return q, nil
+}
+
+// push adds a message to the end of the queue
+func (q *syncQueue) push(subject string, data []byte) error {
+	_, err := q.db.Exec(`INSERT INTO queue(time, subject, data) VALUES(?, ?, ?)`,
+		time.Now().UnixNano(), subject, data)
+	if err != nil {
+		return err
+	}
+
+	return q.prune()
+}
+
+// prune removes entries that exceed the count or age limits
+func (q *syncQueue) prune() error {
+	if q.maxAge > 0 {
+		cutoff := time.Now().Add(-q.maxAge).UnixNano()
+		_, err := q.db.Exec(`DELETE FROM queue WHERE time < ?`, cutoff)
+		if err != nil {
+			return fmt.Errorf("Error pruning queue by age: %v", err)
+		}
+
+		_, err = q.db.Exec(`DELETE FROM seen WHERE time < ?`, cutoff)
+		if err != nil {
+			return fmt.Errorf("Error pruning seen points by age: %v", err)
+		}
+	}
+
+	if q.maxCount > 0 {
+		_, err := q.db.Exec(`DELETE FROM queue WHERE id NOT IN
+			(SELECT id FROM queue ORDER BY id DESC LIMIT ?)`, q.maxCount)
+		if err != nil {
+			return fmt.Errorf("Error pruning queue by count: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// len returns the number of entries in the queue
+func (q *syncQueue) len() (int, error) {
+	var count int
+	err := q.db.QueryRow(`SELECT COUNT(*) FROM queue`).Scan(&count)
+	return count, err
+}
+
+// peek returns up to count of the oldest entries in the queue
+func (q *syncQueue) peek(count int) ([]syncQueueEntry, error) {
+	rows, err := q.db.Query(`SELECT id, subject, data FROM queue ORDER BY id LIMIT ?`, count)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ret []syncQueueEntry
+
+	for rows.Next() {
+		var e syncQueueEntry
+		err := rows.Scan(&e.id, &e.subject, &e.data)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, e)
+	}
+
+	return ret, rows.Err()
+}
+
+// remove deletes an entry from the queue
+func (q *syncQueue) remove(id int64) error {
+	_, err := q.db.Exec(`DELETE FROM queue WHERE id = ?`, id)
+	return err
+}
+
+// replay sends all queued entries in order. Entries are only removed after
+// send returns successfully so if replay is interrupted, the remaining
+// entries are sent the next time replay is called. The number of entries
+// sent is returned.
+func (q *syncQueue) replay(send func(subject string, data []byte) error) (int, error) {
+	sent := 0
+
+	for {
+		entries, err := q.peek(100)
+		if err != nil {
+			return sent, err
+		}
+
+		if len(entries) == 0 {
+			return sent, nil
+		}
+
+		for _, e := range entries {
+			err := send(e.subject, e.data)
+			if err != nil {
+				return sent, err
+			}
+
+			err = q.remove(e.id)
+			if err != nil {
+				return sent, err
+			}
+
+			sent++
+		}
+	}
+}
+
+// saveSeen stores the times of the versions of a point exchanged with the
+// upstream
+func (q *syncQueue) saveSeen(key string, times []time.Time) error {
+	t := make([]string, len(times))
+	for i := range times {
+		t[i] = strconv.FormatInt(times[i].UnixNano(), 10)
+	}
+
+	_, err := q.db.Exec(`INSERT INTO seen(key, time, times) VALUES(?, ?, ?)
+		ON CONFLICT(key) DO UPDATE SET time = excluded.time, times = excluded.times`,
+		key, time.Now().UnixNano(), strings.Join(t, ","))
+	return err
+}
+
+// loadSeen returns the exchanged point history stored by saveSeen
+func (q *syncQueue) loadSeen() (map[string][]time.Time, error) {
+	rows, err := q.db.Query(`SELECT key, times FROM seen`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ret := make(map[string][]time.Time)
+
+	for rows.Next() {
+		var key, times string
+		err := rows.Scan(&key, &times)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, t := range strings.Split(times, ",") {
+			ns, err := strconv.ParseInt(t, 10, 64)
+			if err != nil {
+				continue
+			}
+			ret[key] = append(ret[key], time.Unix(0, ns))
+		}
+	}
+
+	return ret, rows.Err()
+}
+
+func (q *syncQueue) close() error {
+	return q.db.Close()
+}
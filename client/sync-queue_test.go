@@ -0,0 +1,240 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/simpleiot/simpleiot/data"
+)
+
+func TestSyncQueue(t *testing.T) {
+	file := "test-sync-queue.sqlite"
+	defer os.Remove(file)
+
+	q, err := newSyncQueue(file, 5, time.Hour)
+	if err != nil {
+		t.Fatal("Error opening queue: ", err)
+	}
+
+	for i := 0; i < 8; i++ {
+		err := q.push(fmt.Sprintf("p.%v", i), []byte{byte(i)})
+		if err != nil {
+			t.Fatal("Error pushing to queue: ", err)
+		}
+	}
+
+	l, err := q.len()
+	if err != nil {
+		t.Fatal("Error getting queue len: ", err)
+	}
+
+	if l != 5 {
+		t.Fatal("Expected queue to be limited to 5 entries, got: ", l)
+	}
+
+	// interrupt the replay part way through
+	var subjects []string
+	errSend := errors.New("send failed")
+
+	sent, err := q.replay(func(subject string, _ []byte) error {
+		if len(subjects) >= 2 {
+			return errSend
+		}
+		subjects = append(subjects, subject)
+		return nil
+	})
+
+	if err != errSend {
+		t.Fatal("Expected send error, got: ", err)
+	}
+
+	if sent != 2 {
+		t.Fatal("Expected 2 entries sent, got: ", sent)
+	}
+
+	// reopen the queue to make sure the remaining entries persist
+	err = q.close()
+	if err != nil {
+		t.Fatal("Error closing queue: ", err)
+	}
+
+	q, err = newSyncQueue(file, 5, time.Hour)
+	if err != nil {
+		t.Fatal("Error re-opening queue: ", err)
+	}
+	defer q.close()
+
+	sent, err = q.replay(func(subject string, _ []byte) error {
+		subjects = append(subjects, subject)
+		return nil
+	})
+
+	if err != nil {
+		t.Fatal("Error replaying queue: ", err)
+	}
+
+	if sent != 3 {
+		t.Fatal("Expected 3 entries sent, got: ", sent)
+	}
+
+	exp := []string{"p.3", "p.4", "p.5", "p.6", "p.7"}
+
+	if fmt.Sprint(subjects) != fmt.Sprint(exp) {
+		t.Fatalf("Replay order is wrong, exp: %v, got: %v", exp, subjects)
+	}
+
+	l, _ = q.len()
+	if l != 0 {
+		t.Fatal("Queue not empty after replay")
+	}
+}
+
+func TestSyncQueueMaxAge(t *testing.T) {
+	file := "test-sync-queue-age.sqlite"
+	defer os.Remove(file)
+
+	q, err := newSyncQueue(file, 0, 50*time.Millisecond)
+	if err != nil {
+		t.Fatal("Error opening queue: ", err)
+	}
+	defer q.close()
+
+	err = q.push("p.old", nil)
+	if err != nil {
+		t.Fatal("Error pushing to queue: ", err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	err = q.push("p.new", nil)
+	if err != nil {
+		t.Fatal("Error pushing to queue: ", err)
+	}
+
+	entries, err := q.peek(10)
+	if err != nil {
+		t.Fatal("Error reading queue: ", err)
+	}
+
+	if len(entries) != 1 || entries[0].subject != "p.new" {
+		t.Fatal("Old entries not pruned: ", entries)
+	}
+}
+
+func TestSyncQueueDefaultLimits(t *testing.T) {
+	file := "test-sync-queue-default.sqlite"
+	defer os.Remove(file)
+
+	up := &SyncClient{config: Sync{QueueFile: file}}
+	up.openQueue()
+	if up.queue == nil {
+		t.Fatal("queue not opened")
+	}
+	defer up.queue.close()
+
+	if up.queue.maxCount != syncQueueDefaultMaxCount ||
+		up.queue.maxAge != syncQueueDefaultMaxAge*time.Hour {
+		t.Fatal("queue is not bounded by default: ", up.queue.maxCount,
+			up.queue.maxAge)
+	}
+}
+
+func TestSyncQueueDeferTelemetry(t *testing.T) {
+	file := "test-sync-queue-defer.sqlite"
+	defer os.Remove(file)
+
+	config := Sync{QueueFile: file, ExcludePointTypes: "temp"}
+	up := &SyncClient{config: config, filter: newSyncFilter(config, true)}
+	up.openQueue()
+	if up.queue == nil {
+		t.Fatal("queue not opened")
+	}
+	defer up.queue.close()
+
+	points := data.Points{
+		{Type: data.PointTypeValue, Value: 1},
+		{Type: data.PointTypeDescription, Text: "config"},
+		{Type: data.PointTypeActive, Value: 1},
+		{Type: data.PointTypeTemperature, Value: 20},
+	}
+
+	ret := up.deferPoints("node1", points)
+
+	// config and alarm points are sent, excluded points are left to the
+	// filter
+	if len(ret) != 3 {
+		t.Fatal("expected 3 points to be sent, got: ", ret)
+	}
+
+	for _, p := range ret {
+		if p.Type == data.PointTypeValue {
+			t.Fatal("telemetry point was not deferred")
+		}
+	}
+
+	if up.queueLen != 1 {
+		t.Fatal("expected deferred points in the queue, got: ", up.queueLen)
+	}
+
+	var subject string
+	var deferred data.Points
+	_, err := up.queue.replay(func(s string, d []byte) error {
+		var err error
+		subject = s
+		deferred, err = data.PbDecodePoints(d)
+		return err
+	})
+	if err != nil {
+		t.Fatal("Error replaying queue: ", err)
+	}
+
+	if subject != SubjectNodePoints("node1") || len(deferred) != 1 ||
+		deferred[0].Type != data.PointTypeValue {
+		t.Fatal("wrong deferred points: ", subject, deferred)
+	}
+}
+
+func TestSyncSeenPersist(t *testing.T) {
+	file := "test-sync-seen.sqlite"
+	defer os.Remove(file)
+
+	q, err := newSyncQueue(file, 0, time.Hour)
+	if err != nil {
+		t.Fatal("Error opening queue: ", err)
+	}
+
+	seen := newSyncSeen()
+	err = seen.setQueue(q)
+	if err != nil {
+		t.Fatal("Error setting seen queue: ", err)
+	}
+
+	p := data.Point{Type: data.PointTypeValue, Value: 1, Time: time.Now()}
+	seen.record("node1", "", p)
+
+	err = q.close()
+	if err != nil {
+		t.Fatal("Error closing queue: ", err)
+	}
+
+	// simulate a restart
+	q, err = newSyncQueue(file, 0, time.Hour)
+	if err != nil {
+		t.Fatal("Error opening queue: ", err)
+	}
+	defer q.close()
+
+	seen = newSyncSeen()
+	err = seen.setQueue(q)
+	if err != nil {
+		t.Fatal("Error setting seen queue: ", err)
+	}
+
+	index, known := seen.exchangedIndex("node1", "", p)
+	if !known || index != 0 {
+		t.Fatal("exchanged point history not restored: ", index, known)
+	}
+}
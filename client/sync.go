@@ -4,6 +4,8 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/nats-io/nats.go"
@@ -12,17 +14,53 @@ import (
 
 // Sync represents an sync node config
 type Sync struct {
-	ID             string `node:"id"`
-	Parent         string `node:"parent"`
-	Description    string `point:"description"`
-	URI            string `point:"uri"`
-	AuthToken      string `point:"authToken"`
+	ID          string `node:"id"`
+	Parent      string `node:"parent"`
+	Description string `point:"description"`
+	URI         string `point:"uri"`
+	AuthToken   string `point:"authToken"`
+	// the following are used if URI is mqtt:// or mqtts://
+	MQTTUser       string `point:"mqttUser"`
+	MQTTPassword   string `point:"mqttPassword"`
+	TopicPrefix    string `point:"topicPrefix"`
 	Period         int    `point:"period"`
 	Disable        bool   `point:"disable"`
 	SyncCount      int    `point:"syncCount"`
 	SyncCountReset bool   `point:"syncCountReset"`
+	QueueFile      string `point:"queueFile"`
+	QueueMaxCount  int    `point:"queueMaxCount"`
+	QueueMaxAge    int    `point:"queueMaxAge"`
+	// the following are comma separated lists
+	ExcludeNodeTypes  string `point:"excludeNodeTypes"`
+	ExcludeNodes      string `point:"excludeNodes"`
+	ExcludePointTypes string `point:"excludePointTypes"`
+	IncludePointTypes string `point:"includePointTypes"`
+	SyncHighRate      bool   `point:"syncHighRate"`
+	// batch period in ms
+	BatchPeriod         int     `point:"batchPeriod"`
+	Compress            bool    `point:"compress"`
+	ByteBudget          int     `point:"byteBudget"`
+	TelemetryPointTypes string  `point:"telemetryPointTypes"`
+	BytesTx             int     `point:"bytesTx"`
+	BytesTxReset        bool    `point:"bytesTxReset"`
+	BytesRx             int     `point:"bytesRx"`
+	BytesRxReset        bool    `point:"bytesRxReset"`
+	BytesToday          int     `point:"bytesToday"`
+	ReconnectCount      int     `point:"reconnectCount"`
+	ReconnectCountReset bool    `point:"reconnectCountReset"`
+	LastSync            float64 `point:"lastSync"`
+	ConflictPolicy      string  `point:"conflictPolicy"`
+	ConflictCount       int     `point:"conflictCount"`
+	ConflictCountReset  bool    `point:"conflictCountReset"`
 }
 
+// default limits of the sync queue, used if the limits are not set on the
+// sync node so the queue can't fill the disk of the downstream device
+const (
+	syncQueueDefaultMaxCount = 100000
+	syncQueueDefaultMaxAge   = 7 * 24 // hours
+)
+
 type newEdge struct {
 	parent string
 	id     string
@@ -46,6 +84,43 @@ type SyncClient struct {
 	chConnected         chan bool
 	initialSub          bool
 	chNewEdge           chan newEdge
+	queue               *syncQueue
+	queueLen            int
+	// filter is read in NATS subscription callbacks, so it is only replaced
+	// while holding filterLock
+	filter     syncFilter
+	filterLock sync.RWMutex
+	// set when the local tree or excluded data changes, so the excluded
+	// nodes and hashes are scanned again on the next sync
+	filterDirty bool
+	// key is node ID, value is true if node is excluded from sync
+	nodeExcluded map[string]bool
+	// key is node ID (and parent), value is the hash of all data in the
+	// local subtree that is excluded from sync
+	excludedHash map[string]uint32
+	// key is node ID (and parent), value is the hash of all data in the
+	// upstream subtree that is excluded from sync
+	remoteExcludedHash map[string]syncExcludedHash
+	// node points received for nodes we don't know about yet. These are
+	// held until we see the edge points so we know the node type.
+	pendingPoints map[string]data.Points
+	subLocalHR    *nats.Subscription
+	chLocalHR     chan *nats.Msg
+	// bandwidth management
+	telemetry         map[string]bool
+	batch             []syncBatchEntry
+	batchTimer        *time.Timer
+	batchTimerRunning bool
+	bytesDay          time.Time
+	lastInBytes       uint64
+	lastOutBytes      uint64
+	// connection health
+	health       syncHealth
+	hashMismatch int
+	// points exchanged with this upstream
+	seen *syncSeen
+	// bridge used when syncing through an MQTT broker
+	mqtt *syncMQTT
 }
 
 // NewSyncClient constructor
@@ -60,6 +135,14 @@ func NewSyncClient(nc *nats.Conn, config Sync) Client {
 		subRemoteNodePoints: make(map[string]*nats.Subscription),
 		subRemoteEdgePoints: make(map[string]*nats.Subscription),
 		chNewEdge:           make(chan newEdge),
+		filter:              newSyncFilter(config, false),
+		nodeExcluded:        make(map[string]bool),
+		excludedHash:        make(map[string]uint32),
+		remoteExcludedHash:  make(map[string]syncExcludedHash),
+		pendingPoints:       make(map[string]data.Points),
+		chLocalHR:           make(chan *nats.Msg),
+		telemetry:           newTelemetryTypes(config),
+		seen:                newSyncSeen(),
 	}
 }
 
@@ -150,19 +233,39 @@ func (up *SyncClient) Run() error {
 
 	checkPeriod()
 
+	up.openQueue()
+
+	up.initBudgetDay()
+	up.checkBudget()
+
+	up.batchTimer = time.NewTimer(time.Hour)
+	up.batchTimer.Stop()
+
 	syncTicker := time.NewTicker(time.Second * 10)
 	syncTicker.Stop()
 
 	connectTimer := time.NewTimer(time.Millisecond * 10)
 
+	// queue depth is reported while we are disconnected
+	healthTicker := time.NewTicker(time.Duration(up.config.Period) * time.Second)
+
 	up.rootLocal, err = GetRootNode(up.nc)
 	if err != nil {
 		return fmt.Errorf("Error getting root node: %v", err)
 	}
 
+	err = up.scanFilter()
+	if err != nil {
+		log.Println("Sync: error scanning sync filters: ", err)
+	}
+
+	up.subscribeLocalHR()
+
 	connected := false
 	up.initialSub = false
 
+	up.healthConnected(false)
+
 done:
 	for {
 		select {
@@ -177,20 +280,48 @@ done:
 				connectTimer.Reset(30 * time.Second)
 			}
 		case <-syncTicker.C:
+			up.checkBudget()
+
+			// queued points are held until the daily budget resets
+			if !up.filter.overBudget {
+				// retry any queued points that did not make it upstream
+				up.replayQueue()
+			}
+
 			err := up.syncNode("root", up.rootLocal.ID)
 			if err != nil {
 				log.Println("Error syncing: ", err)
 			}
 
+			up.healthSync(err)
+			up.sendHeartbeat()
+
+			up.updateStats()
+
+		case <-healthTicker.C:
+			if !connected {
+				up.healthQueueDepth()
+			}
+
 		case conn := <-up.chConnected:
 			connected = conn
+			up.healthConnected(conn)
 			if conn {
 				syncTicker.Reset(time.Duration(up.config.Period) * time.Second)
+				// replay points that were queued while we were disconnected
+				// before syncing so that history upstream is in order
+				if !up.filter.overBudget {
+					up.replayQueue()
+				}
+
 				err := up.syncNode("root", up.rootLocal.ID)
 				if err != nil {
 					log.Println("Error syncing: ", err)
 				}
 
+				up.healthSync(err)
+				up.sendHeartbeat()
+
 				if !up.initialSub {
 					// set up initial subscriptions to remote nodes
 					err = up.subscribeRemoteNode(up.rootLocal.Parent, up.rootLocal.ID)
@@ -207,18 +338,14 @@ done:
 				up.rootRemote = data.NodeEdge{}
 			}
 		case pts := <-chLocalNodePoints:
-			if connected {
-				err = SendNodePoints(up.ncRemote, pts.ID, pts.Points, false)
-				if err != nil {
-					log.Println("Error sending node points to remote system: ", err)
-				}
-			}
+			up.forwardNodePoints(connected, pts)
 		case pts := <-chLocalEdgePoints:
+			up.forwardEdgePoints(connected, pts)
+		case <-up.batchTimer.C:
+			up.batchFlush(connected)
+		case msg := <-up.chLocalHR:
 			if connected {
-				err = SendEdgePoints(up.ncRemote, pts.ID, pts.Parent, pts.Points, false)
-				if err != nil {
-					log.Println("Error sending edge points to remote system: ", err)
-				}
+				up.forwardHRPoints(msg)
 			}
 		case pts := <-up.newPoints:
 			err := data.MergePoints(pts.ID, pts.Points, &up.config)
@@ -230,16 +357,52 @@ done:
 				switch p.Type {
 				case data.PointTypeURI,
 					data.PointTypeAuthToken,
+					data.PointTypeMQTTUser,
+					data.PointTypeMQTTPassword,
+					data.PointTypeTopicPrefix,
 					data.PointTypeDisable:
 					// we need to restart the sync connection
 					up.disconnect()
 					connectTimer.Reset(10 * time.Millisecond)
 				case data.PointTypePeriod:
 					checkPeriod()
+					healthTicker.Reset(time.Duration(up.config.Period) * time.Second)
 					if connected {
 						syncTicker.Reset(time.Duration(up.config.Period) *
 							time.Second)
 					}
+				case data.PointTypeQueueFile,
+					data.PointTypeQueueMaxCount,
+					data.PointTypeQueueMaxAge:
+					up.openQueue()
+				case data.PointTypeExcludeNodeTypes,
+					data.PointTypeExcludeNodes,
+					data.PointTypeExcludePointTypes,
+					data.PointTypeIncludePointTypes:
+					// subscriptions depend on the filter, so restart the
+					// sync connection
+					up.disconnect()
+					up.setFilter()
+					err := up.scanFilter()
+					if err != nil {
+						log.Println("Sync: error scanning sync filters: ", err)
+					}
+					connectTimer.Reset(10 * time.Millisecond)
+				case data.PointTypeSyncHighRate:
+					up.subscribeLocalHR()
+				case data.PointTypeTelemetryPointTypes:
+					up.telemetry = newTelemetryTypes(up.config)
+					if up.filter.overBudget {
+						up.setFilter()
+						err := up.scanFilter()
+						if err != nil {
+							log.Println("Sync: error scanning sync filters: ", err)
+						}
+					}
+				case data.PointTypeByteBudget:
+					up.checkBudget()
+				case data.PointTypeBatchPeriod, data.PointTypeCompress:
+					up.batchFlush(connected)
 				}
 			}
 
@@ -258,6 +421,66 @@ done:
 				}
 			}
 
+			if up.config.ReconnectCountReset {
+				up.config.ReconnectCount = 0
+				up.config.ReconnectCountReset = false
+
+				points := data.Points{
+					{Type: data.PointTypeReconnectCount, Value: 0},
+					{Type: data.PointTypeReconnectCountReset, Value: 0},
+				}
+
+				err = SendPoints(up.nc, SubjectNodePoints(up.config.ID), points, false)
+				if err != nil {
+					log.Println("Error resetting sync reconnect count: ", err)
+				}
+			}
+
+			if up.config.ConflictCountReset {
+				up.config.ConflictCount = 0
+				up.config.ConflictCountReset = false
+
+				points := data.Points{
+					{Type: data.PointTypeConflictCount, Value: 0},
+					{Type: data.PointTypeConflictCountReset, Value: 0},
+				}
+
+				err = SendPoints(up.nc, SubjectNodePoints(up.config.ID), points, false)
+				if err != nil {
+					log.Println("Error resetting sync conflict count: ", err)
+				}
+			}
+
+			if up.config.BytesTxReset {
+				up.config.BytesTx = 0
+				up.config.BytesTxReset = false
+
+				points := data.Points{
+					{Type: data.PointTypeBytesTx, Value: 0},
+					{Type: data.PointTypeBytesTxReset, Value: 0},
+				}
+
+				err = SendPoints(up.nc, SubjectNodePoints(up.config.ID), points, false)
+				if err != nil {
+					log.Println("Error resetting sync bytes tx: ", err)
+				}
+			}
+
+			if up.config.BytesRxReset {
+				up.config.BytesRx = 0
+				up.config.BytesRxReset = false
+
+				points := data.Points{
+					{Type: data.PointTypeBytesRx, Value: 0},
+					{Type: data.PointTypeBytesRxReset, Value: 0},
+				}
+
+				err = SendPoints(up.nc, SubjectNodePoints(up.config.ID), points, false)
+				if err != nil {
+					log.Println("Error resetting sync bytes rx: ", err)
+				}
+			}
+
 		case pts := <-up.newEdgePoints:
 			err := data.MergeEdgePoints(pts.ID, pts.Parent, pts.Points, &up.config)
 			if err != nil {
@@ -298,6 +521,9 @@ done:
 					if n.Type == "" {
 						goto fetchAgain
 					}
+					if up.remoteExcluded(n) {
+						continue
+					}
 					err := up.sendNodesLocal(n)
 					if err != nil {
 						log.Println("Error chNewEdge sendNodesLocal: ", err)
@@ -313,6 +539,8 @@ done:
 	}
 
 	// clean up
+	healthTicker.Stop()
+
 	err = subLocalNodePoints.Unsubscribe()
 	if err != nil {
 		log.Println("Error unsubscribing node points from local bus: ", err)
@@ -323,9 +551,23 @@ done:
 		log.Println("Error unsubscribing edge points from local bus: ", err)
 	}
 
+	up.config.SyncHighRate = false
+	up.subscribeLocalHR()
+
+	// queue anything left in the batch
+	up.batchFlush(false)
+
 	up.disconnect()
 	up.ncLocal.Close()
 
+	if up.queue != nil {
+		_ = up.seen.setQueue(nil)
+		err = up.queue.close()
+		if err != nil {
+			log.Println("Error closing sync queue: ", err)
+		}
+	}
+
 	return nil
 }
 
@@ -374,7 +616,28 @@ func (up *SyncClient) connect() error {
 		},
 	}
 
+	up.lastInBytes = 0
+	up.lastOutBytes = 0
+
 	var err error
+
+	if isMQTTURI(up.config.URI) {
+		up.mqtt, up.ncRemote, err = newSyncMQTT(up.config, up.rootLocal.ID, func(c bool) {
+			if c {
+				log.Printf("Sync: %v: MQTT Connected: %v\n",
+					up.config.Description, up.config.URI)
+			} else {
+				log.Printf("Sync: %v: MQTT Disconnected\n", up.config.Description)
+			}
+			up.chConnected <- c
+		})
+		if err != nil {
+			return fmt.Errorf("Error setting up MQTT sync: %v", err)
+		}
+
+		return nil
+	}
+
 	up.ncRemote, err = EdgeConnect(opts)
 
 	if err != nil {
@@ -384,6 +647,462 @@ func (up *SyncClient) connect() error {
 	return nil
 }
 
+// openQueue (re)opens the persistent queue used to buffer points while
+// the upstream connection is down. If no queue file is configured, points
+// generated while disconnected are not buffered.
+func (up *SyncClient) openQueue() {
+	if up.queue != nil {
+		if up.seen != nil {
+			_ = up.seen.setQueue(nil)
+		}
+		err := up.queue.close()
+		if err != nil {
+			log.Println("Error closing sync queue: ", err)
+		}
+		up.queue = nil
+		up.queueLen = 0
+	}
+
+	if up.config.QueueFile == "" {
+		return
+	}
+
+	maxCount := up.config.QueueMaxCount
+	if maxCount <= 0 {
+		maxCount = syncQueueDefaultMaxCount
+	}
+
+	maxAge := up.config.QueueMaxAge
+	if maxAge <= 0 {
+		maxAge = syncQueueDefaultMaxAge
+	}
+
+	var err error
+	up.queue, err = newSyncQueue(up.config.QueueFile, maxCount,
+		time.Duration(maxAge)*time.Hour)
+	if err != nil {
+		log.Printf("Sync: %v: error opening queue: %v\n", up.config.Description, err)
+		return
+	}
+
+	// exchanged point history is kept in the queue DB
+	if up.seen != nil {
+		err = up.seen.setQueue(up.queue)
+		if err != nil {
+			log.Printf("Sync: %v: error loading exchanged points: %v\n",
+				up.config.Description, err)
+		}
+	}
+
+	up.updateQueueLen()
+}
+
+func (up *SyncClient) updateQueueLen() {
+	if up.queue == nil {
+		up.queueLen = 0
+		return
+	}
+
+	var err error
+	up.queueLen, err = up.queue.len()
+	if err != nil {
+		log.Println("Error getting sync queue length: ", err)
+	}
+}
+
+// sendPointsRemote sends node points (parentID = "") or edge points upstream.
+// Points may be batched.
+func (up *SyncClient) sendPointsRemote(connected bool, nodeID, parentID string, points data.Points) {
+	// make sure points are timestamped when they are generated and not when
+	// they are sent
+	for i := range points {
+		if points[i].Time.IsZero() {
+			points[i].Time = time.Now()
+		}
+	}
+
+	if up.config.BatchPeriod > 0 || up.config.Compress {
+		up.batchAdd(nodeID, parentID, points)
+		if up.config.BatchPeriod <= 0 {
+			up.batchFlush(connected)
+		}
+		return
+	}
+
+	d, err := points.ToPb()
+	if err != nil {
+		log.Println("Error encoding sync points: ", err)
+		return
+	}
+
+	subject := SubjectNodePoints(nodeID)
+	if parentID != "" {
+		subject = SubjectEdgePoints(nodeID, parentID)
+	}
+
+	up.publishRemote(connected, subject, d)
+}
+
+// publishRemote sends a message upstream. If we are not connected, the send
+// fails, or there are still older messages in the queue, the message is added
+// to the queue so it can be replayed in order later. While over the daily
+// byte budget, the queue holds deferred telemetry, so other points are sent
+// ahead of it.
+func (up *SyncClient) publishRemote(connected bool, subject string, d []byte) {
+	if connected && (up.queueLen == 0 || up.filter.overBudget) {
+		err := up.ncRemote.Publish(subject, d)
+		if err == nil {
+			return
+		}
+		log.Println("Error sending points to remote system: ", err)
+	}
+
+	if up.queue == nil || up.config.Disable {
+		return
+	}
+
+	err := up.queue.push(subject, d)
+	if err != nil {
+		log.Println("Error queuing sync points: ", err)
+		return
+	}
+
+	up.updateQueueLen()
+}
+
+// forwardNodePoints sends local node points upstream, applying sync filters
+func (up *SyncClient) forwardNodePoints(connected bool, pts NewPoints) {
+	pts.Points = up.filterHealthPoints(connected, pts)
+	if len(pts.Points) <= 0 {
+		return
+	}
+
+	if up.filter.active() {
+		excluded, known := up.nodeExcluded[pts.ID]
+		if !known {
+			// this is likely a new node. Node points are sent before edge
+			// points, so hold on to these until we know the node type.
+			up.pendingPoints[pts.ID] = append(up.pendingPoints[pts.ID], pts.Points...)
+			return
+		}
+
+		if excluded {
+			up.filterDirty = true
+			return
+		}
+
+		count := len(pts.Points)
+		pts.Points = up.filter.filterPoints(up.deferPoints(pts.ID, pts.Points))
+		if len(pts.Points) != count {
+			// excluded data changed
+			up.filterDirty = true
+		}
+		if len(pts.Points) <= 0 {
+			return
+		}
+	}
+
+	if connected {
+		pts.Points = up.seen.filter(pts.ID, "", pts.Points)
+		if len(pts.Points) <= 0 {
+			return
+		}
+	}
+
+	up.sendPointsRemote(connected, pts.ID, "", pts.Points)
+}
+
+// forwardEdgePoints sends local edge points upstream, applying sync filters
+func (up *SyncClient) forwardEdgePoints(connected bool, pts NewPoints) {
+	if up.filter.active() {
+		// the tree changed
+		up.filterDirty = true
+
+		excluded, known := up.nodeExcluded[pts.ID]
+		if !known {
+			typ := ""
+			for _, p := range pts.Points {
+				if p.Type == data.PointTypeNodeType {
+					typ = p.Text
+				}
+			}
+			excluded = up.nodeExcluded[pts.Parent] || up.filter.excludeNode(pts.ID, typ)
+			up.nodeExcluded[pts.ID] = excluded
+		}
+
+		pending := up.pendingPoints[pts.ID]
+		delete(up.pendingPoints, pts.ID)
+
+		if excluded {
+			return
+		}
+
+		pending = up.filter.filterPoints(up.deferPoints(pts.ID, pending))
+		if connected {
+			pending = up.seen.filter(pts.ID, "", pending)
+		}
+		if len(pending) > 0 {
+			up.sendPointsRemote(connected, pts.ID, "", pending)
+		}
+
+		pts.Points = up.filter.filterPoints(pts.Points)
+		if len(pts.Points) <= 0 {
+			return
+		}
+	}
+
+	if connected {
+		pts.Points = up.seen.filter(pts.ID, pts.Parent, pts.Points)
+		if len(pts.Points) <= 0 {
+			return
+		}
+	}
+
+	up.sendPointsRemote(connected, pts.ID, pts.Parent, pts.Points)
+}
+
+// subscribeLocalHR subscribes to or unsubscribes from local high rate points
+// depending on the SyncHighRate setting.
+func (up *SyncClient) subscribeLocalHR() {
+	if up.config.SyncHighRate && up.subLocalHR == nil {
+		var err error
+		up.subLocalHR, err = up.ncLocal.Subscribe("phrup.>", func(msg *nats.Msg) {
+			up.chLocalHR <- msg
+		})
+		if err != nil {
+			log.Println("Sync: error subscribing to high rate points: ", err)
+		}
+	} else if !up.config.SyncHighRate && up.subLocalHR != nil {
+		err := up.subLocalHR.Unsubscribe()
+		if err != nil {
+			log.Println("Sync: error unsubscribing from high rate points: ", err)
+		}
+		up.subLocalHR = nil
+	}
+}
+
+// forwardHRPoints sends high rate points upstream. High rate points are not
+// queued or synced as they are not stored.
+func (up *SyncClient) forwardHRPoints(msg *nats.Msg) {
+	// subject is phrup.<parent>.<id>
+	chunks := strings.Split(msg.Subject, ".")
+	if len(chunks) != 3 {
+		return
+	}
+
+	if up.nodeExcluded[chunks[2]] {
+		return
+	}
+
+	err := up.ncRemote.Publish(msg.Subject, msg.Data)
+	if err != nil {
+		log.Println("Sync: error sending high rate points upstream: ", err)
+	}
+}
+
+// setFilter replaces the sync filter after the filter config changes. The
+// cached upstream excluded hashes depend on the filter, so they are cleared.
+func (up *SyncClient) setFilter() {
+	up.filterLock.Lock()
+	up.filter = newSyncFilter(up.config, up.overBudget())
+	up.filterLock.Unlock()
+
+	up.remoteExcludedHash = make(map[string]syncExcludedHash)
+}
+
+// getFilter returns the sync filter. This must be used to access the filter
+// outside of the Run goroutine.
+func (up *SyncClient) getFilter() syncFilter {
+	up.filterLock.RLock()
+	defer up.filterLock.RUnlock()
+	return up.filter
+}
+
+// scanFilter walks the local node tree and records which nodes are excluded
+// from sync, and the hash of the excluded data in each subtree. The latter is
+// used to back excluded data out of node hashes when comparing with the
+// upstream.
+func (up *SyncClient) scanFilter() error {
+	up.nodeExcluded = make(map[string]bool)
+	up.excludedHash = make(map[string]uint32)
+	up.filterDirty = false
+
+	if !up.filter.active() {
+		return nil
+	}
+
+	_, err := up.scanFilterHelper(up.rootLocal, false)
+	if err != nil {
+		// try again on the next sync
+		up.filterDirty = true
+		return err
+	}
+
+	// cached upstream hashes are only kept for nodes that still exist.
+	// Entries for nodes whose hash has changed are replaced when the node
+	// is synced.
+	for key := range up.remoteExcludedHash {
+		if _, ok := up.excludedHash[key]; !ok {
+			delete(up.remoteExcludedHash, key)
+		}
+	}
+
+	return nil
+}
+
+func (up *SyncClient) scanFilterHelper(node data.NodeEdge, parentExcluded bool) (uint32, error) {
+	root := node.ID == up.rootLocal.ID
+	excluded := !root && (parentExcluded || up.filter.excludeNode(node.ID, node.Type))
+	up.nodeExcluded[node.ID] = excluded
+
+	var ret uint32
+	if excluded {
+		ret = node.Hash
+	} else {
+		ret = up.filter.excludedPointsHash(node, !root)
+	}
+
+	children, err := GetNodes(up.ncLocal, node.ID, "all", "", true)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, c := range children {
+		h, err := up.scanFilterHelper(c, excluded)
+		if err != nil {
+			return 0, err
+		}
+		if !excluded {
+			ret ^= h
+		}
+	}
+
+	up.excludedHash[up.filterKey(node)] = ret
+
+	return ret, nil
+}
+
+func (up *SyncClient) filterKey(node data.NodeEdge) string {
+	if node.ID == up.rootLocal.ID {
+		return node.ID
+	}
+	return mapKey(node)
+}
+
+// localHash returns the hash of a local node with excluded data backed out
+func (up *SyncClient) localHash(node data.NodeEdge) uint32 {
+	return node.Hash ^ up.excludedHash[up.filterKey(node)]
+}
+
+// syncExcludedHash is the hash of the excluded data in an upstream subtree.
+// It is valid as long as the upstream node hash has not changed.
+type syncExcludedHash struct {
+	hash     uint32
+	excluded uint32
+}
+
+// remoteHash returns the hash of an upstream node with excluded data backed
+// out. The upstream subtree is walked to find excluded data in descendants,
+// and the result is cached until the upstream node hash changes.
+func (up *SyncClient) remoteHash(node data.NodeEdge) uint32 {
+	if !up.filter.active() {
+		return node.Hash
+	}
+
+	excluded, err := up.remoteFilterHelper(node, up.remoteExcluded(node))
+	if err != nil {
+		log.Println("Sync: error getting excluded data upstream: ", err)
+		return node.Hash ^ up.filter.excludedPointsHash(node, node.ID != up.rootLocal.ID)
+	}
+
+	return node.Hash ^ excluded
+}
+
+func (up *SyncClient) remoteFilterHelper(node data.NodeEdge, excluded bool) (uint32, error) {
+	key := up.filterKey(node)
+	if c, ok := up.remoteExcludedHash[key]; ok && c.hash == node.Hash {
+		return c.excluded, nil
+	}
+
+	var ret uint32
+	if excluded {
+		ret = node.Hash
+	} else {
+		ret = up.filter.excludedPointsHash(node, node.ID != up.rootLocal.ID)
+
+		children, err := GetNodes(up.ncRemote, node.ID, "all", "", true)
+		if err != nil {
+			return 0, err
+		}
+
+		for _, c := range children {
+			h, err := up.remoteFilterHelper(c,
+				up.filter.excludeNode(c.ID, c.Type))
+			if err != nil {
+				return 0, err
+			}
+			ret ^= h
+		}
+	}
+
+	up.remoteExcludedHash[key] = syncExcludedHash{hash: node.Hash, excluded: ret}
+
+	return ret, nil
+}
+
+// remoteExcluded returns true if a node from the upstream should not be synced.
+func (up *SyncClient) remoteExcluded(node data.NodeEdge) bool {
+	if !up.filter.active() || node.ID == up.rootLocal.ID {
+		return false
+	}
+
+	excluded, known := up.nodeExcluded[node.ID]
+	if known {
+		return excluded
+	}
+
+	excluded = up.nodeExcluded[node.Parent] || up.filter.excludeNode(node.ID, node.Type)
+	if excluded {
+		up.nodeExcluded[node.ID] = true
+	}
+
+	return excluded
+}
+
+// replayQueue sends queued points upstream in the order they were queued.
+func (up *SyncClient) replayQueue() {
+	if up.queue == nil || up.queueLen == 0 || up.ncRemote == nil {
+		return
+	}
+
+	sent, err := up.queue.replay(func(subject string, d []byte) error {
+		msg, err := up.ncRemote.Request(subject, d, time.Second*5)
+		if err != nil {
+			return err
+		}
+
+		if len(msg.Data) > 0 {
+			// the upstream rejected the points, so there is no use
+			// in sending them again
+			log.Printf("Sync: %v: upstream rejected queued points: %v\n",
+				up.config.Description, string(msg.Data))
+		}
+
+		return nil
+	})
+
+	if sent > 0 {
+		log.Printf("Sync: %v: sent %v queued messages upstream\n",
+			up.config.Description, sent)
+	}
+
+	if err != nil {
+		log.Printf("Sync: %v: error replaying queue: %v\n", up.config.Description, err)
+	}
+
+	up.updateQueueLen()
+}
+
 func (up *SyncClient) subscribeRemoteNodePoints(id string) error {
 	if _, ok := up.subRemoteNodePoints[id]; !ok {
 		var err error
@@ -394,6 +1113,11 @@ func (up *SyncClient) subscribeRemoteNodePoints(id string) error {
 				return
 			}
 
+			points = up.seen.filter(nodeID, "", up.getFilter().filterPoints(points))
+			if len(points) <= 0 {
+				return
+			}
+
 			err = SendNodePoints(up.ncLocal, nodeID, points, false)
 			if err != nil {
 				log.Println("Error sending node points to remote system: ", err)
@@ -420,6 +1144,11 @@ func (up *SyncClient) subscribeRemoteEdgePoints(parent, id string) error {
 					return
 				}
 
+				points = up.seen.filter(nodeID, parentID, up.getFilter().filterPoints(points))
+				if len(points) <= 0 {
+					return
+				}
+
 				err = SendEdgePoints(up.ncLocal, nodeID, parentID, points, false)
 				if err != nil {
 					log.Println("Error sending edge points to remote system: ", err)
@@ -434,6 +1163,10 @@ func (up *SyncClient) subscribeRemoteEdgePoints(parent, id string) error {
 }
 
 func (up *SyncClient) subscribeRemoteNode(parent, id string) error {
+	if up.nodeExcluded[id] {
+		return nil
+	}
+
 	err := up.subscribeRemoteNodePoints(id)
 	if err != nil {
 		return err
@@ -451,6 +1184,10 @@ func (up *SyncClient) subscribeRemoteNode(parent, id string) error {
 	}
 
 	for _, c := range children {
+		if up.nodeExcluded[c.ID] {
+			continue
+		}
+
 		err := up.subscribeRemoteNode(c.Parent, c.ID)
 		if err != nil {
 			return err
@@ -491,21 +1228,35 @@ func (up *SyncClient) disconnect() {
 		up.ncRemote = nil
 		up.rootRemote = data.NodeEdge{}
 	}
+
+	if up.mqtt != nil {
+		up.mqtt.close()
+		up.mqtt = nil
+	}
 }
 
 // sendNodesRemote is used to send node and children over nats
 // from one NATS server to another. Typically from the current instance
 // to an upstream.
 func (up *SyncClient) sendNodesRemote(node data.NodeEdge) error {
+	if node.ID != up.rootLocal.ID && up.nodeExcluded[node.ID] {
+		return nil
+	}
+
 	if node.Parent == "root" {
 		node.Parent = up.rootRemote.ID
 	}
 
+	node.Points = up.filter.filterPoints(node.Points)
+	node.EdgePoints = up.filter.filterPoints(node.EdgePoints)
+
 	err := SendNode(up.ncRemote, node, up.config.ID)
 	if err != nil {
 		return err
 	}
 
+	up.seen.recordNode(node)
+
 	// process child nodes
 	childNodes, err := GetNodes(up.nc, node.ID, "all", "", false)
 	if err != nil {
@@ -527,11 +1278,20 @@ func (up *SyncClient) sendNodesRemote(node data.NodeEdge) error {
 // from one NATS server to another. Typically from the current instance
 // to an upstream.
 func (up *SyncClient) sendNodesLocal(node data.NodeEdge) error {
+	if up.remoteExcluded(node) {
+		return nil
+	}
+
+	node.Points = up.filter.filterPoints(node.Points)
+	node.EdgePoints = up.filter.filterPoints(node.EdgePoints)
+
 	err := SendNode(up.ncLocal, node, up.config.ID)
 	if err != nil {
 		return err
 	}
 
+	up.seen.recordNode(node)
+
 	// process child nodes
 	childNodes, err := GetNodes(up.nc, node.ID, "all", "", false)
 	if err != nil {
@@ -551,6 +1311,21 @@ func (up *SyncClient) sendNodesLocal(node data.NodeEdge) error {
 
 func (up *SyncClient) syncNode(parent, id string) error {
 	var err error
+
+	if id == up.rootLocal.ID {
+		// refresh excluded nodes and hashes if the tree has changed. This
+		// is also done after a sync that found mismatched hashes in case
+		// a change was missed.
+		if up.filterDirty || up.hashMismatch > 0 {
+			err = up.scanFilter()
+			if err != nil {
+				return fmt.Errorf("Error scanning sync filters: %v", err)
+			}
+		}
+
+		up.hashMismatch = 0
+	}
+
 	if up.rootRemote.ID == "" {
 		up.rootRemote, err = GetRootNode(up.ncRemote)
 		if err != nil {
@@ -637,6 +1412,7 @@ func (up *SyncClient) syncNode(parent, id string) error {
 	}
 
 	if !nodeFound {
+		up.hashMismatch++
 		log.Printf("Sync node %v does not exist, sending\n", nodeLocal.Desc())
 		err := up.sendNodesRemote(nodeLocal)
 		if err != nil {
@@ -664,11 +1440,13 @@ func (up *SyncClient) syncNode(parent, id string) error {
 		}
 	}
 
-	if nodeUp.Hash == nodeLocal.Hash {
+	if up.remoteHash(nodeUp) == up.localHash(nodeLocal) {
 		// we're good!
 		return nil
 	}
 
+	up.hashMismatch++
+
 	// only increment count once during sync
 	if nodeLocal.ID == up.rootLocal.ID {
 		up.config.SyncCount++
@@ -692,28 +1470,21 @@ func (up *SyncClient) syncNode(parent, id string) error {
 	upstreamProcessed := make(map[int]bool)
 
 	for _, p := range nodeLocal.Points {
+		if up.filter.excludePoint(p) {
+			continue
+		}
+
 		found := false
 		for i, pUp := range nodeUp.Points {
 			if p.IsMatch(pUp.Type, pUp.Key) {
 				found = true
 				upstreamProcessed[i] = true
-				if p.Time.After(pUp.Time) {
-					// need to send point upstream
-					err := SendNodePoint(up.ncRemote, nodeUp.ID, p, true)
-					if err != nil {
-						log.Println("Error syncing point upstream: ", err)
-					}
-				} else if p.Time.Before(pUp.Time) {
-					// need to update point locally
-					err := SendNodePoint(up.nc, nodeLocal.ID, pUp, true)
-					if err != nil {
-						log.Println("Error syncing point from upstream: ", err)
-					}
-				}
+				up.syncPoint(nodeLocal, nodeUp, p, pUp, false)
 			}
 		}
 
 		if !found {
+			up.seen.record(nodeUp.ID, "", p)
 			err := SendNodePoint(up.ncRemote, nodeUp.ID, p, true)
 			if err != nil {
 				log.Println("Error sending point: ", err)
@@ -723,7 +1494,12 @@ func (up *SyncClient) syncNode(parent, id string) error {
 
 	// check for any points that do not exist locally
 	for i, pUp := range nodeUp.Points {
+		if up.filter.excludePoint(pUp) {
+			continue
+		}
+
 		if _, ok := upstreamProcessed[i]; !ok {
+			up.seen.record(nodeLocal.ID, "", pUp)
 			err := SendNodePoint(up.nc, nodeLocal.ID, pUp, true)
 			if err != nil {
 				log.Println("Error syncing point from upstream: ", err)
@@ -738,28 +1514,21 @@ func (up *SyncClient) syncNode(parent, id string) error {
 	// only check edge points if we are not the root node
 	if nodeLocal.ID != up.rootLocal.ID {
 		for _, p := range nodeLocal.EdgePoints {
+			if up.filter.excludePoint(p) {
+				continue
+			}
+
 			found := false
 			for i, pUp := range nodeUp.EdgePoints {
 				if p.IsMatch(pUp.Type, pUp.Key) {
 					found = true
 					upstreamProcessed[i] = true
-					if p.Time.After(pUp.Time) {
-						// need to send point upstream
-						err := SendEdgePoint(up.ncRemote, nodeUp.ID, nodeUp.Parent, p, true)
-						if err != nil {
-							log.Println("Error syncing point upstream: ", err)
-						}
-					} else if p.Time.Before(pUp.Time) {
-						// need to update point locally
-						err := SendEdgePoint(up.nc, nodeLocal.ID, nodeLocal.Parent, pUp, true)
-						if err != nil {
-							log.Println("Error syncing point from upstream: ", err)
-						}
-					}
+					up.syncPoint(nodeLocal, nodeUp, p, pUp, true)
 				}
 			}
 
 			if !found {
+				up.seen.record(nodeUp.ID, nodeUp.Parent, p)
 				err := SendEdgePoint(up.ncRemote, nodeUp.ID, nodeUp.Parent, p, true)
 				if err != nil {
 					log.Println("Error sending point: ", err)
@@ -769,7 +1538,12 @@ func (up *SyncClient) syncNode(parent, id string) error {
 
 		// check for any points that do not exist locally
 		for i, pUp := range nodeUp.EdgePoints {
+			if up.filter.excludePoint(pUp) {
+				continue
+			}
+
 			if _, ok := upstreamProcessed[i]; !ok {
+				up.seen.record(nodeLocal.ID, nodeLocal.Parent, pUp)
 				err := SendEdgePoint(up.nc, nodeLocal.ID, nodeLocal.Parent, pUp, true)
 				if err != nil {
 					log.Println("Error syncing edge point from upstream: ", err)
@@ -794,12 +1568,16 @@ func (up *SyncClient) syncNode(parent, id string) error {
 	upChildProcessed := make(map[int]bool)
 
 	for _, child := range children {
+		excluded := up.nodeExcluded[child.ID]
 		found := false
 		for i, upChild := range upChildren {
 			if child.ID == upChild.ID {
 				found = true
 				upChildProcessed[i] = true
-				if child.Hash != upChild.Hash {
+				if excluded {
+					break
+				}
+				if up.localHash(child) != up.remoteHash(upChild) {
 					err := up.syncNode(nodeLocal.ID, child.ID)
 					if err != nil {
 						fmt.Println("Error syncing node: ", err)
@@ -808,7 +1586,7 @@ func (up *SyncClient) syncNode(parent, id string) error {
 			}
 		}
 
-		if !found {
+		if !found && !excluded {
 			// need to send node upstream
 			err := up.sendNodesRemote(child)
 			if err != nil {
@@ -824,6 +1602,9 @@ func (up *SyncClient) syncNode(parent, id string) error {
 
 	for i, upChild := range upChildren {
 		if _, ok := upChildProcessed[i]; !ok {
+			if up.remoteExcluded(upChild) {
+				continue
+			}
 			err := up.sendNodesLocal(upChild)
 			if err != nil {
 				log.Println("Error getting node from upstream: ", err)
@@ -2,9 +2,13 @@ package client_test
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	natsserver "github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
 	"github.com/simpleiot/simpleiot/client"
 	"github.com/simpleiot/simpleiot/data"
 	"github.com/simpleiot/simpleiot/server"
@@ -294,3 +298,1096 @@ func TestSyncDeleteUpstream(t *testing.T) {
 		time.Sleep(time.Millisecond * 10)
 	}
 }
+
+func TestSyncFilter(t *testing.T) {
+	// Start up a SIOT test servers for this test
+	ncU, _, stopU, err := server.TestServer("2")
+
+	if err != nil {
+		t.Fatal("Error starting upstream test server: ", err)
+	}
+
+	defer stopU()
+
+	ncD, rootD, stopD, err := server.TestServer()
+
+	if err != nil {
+		t.Fatal("Error starting upstream test server: ", err)
+	}
+
+	defer stopD()
+
+	// create an excluded node before sync starts
+	varD := client.Variable{ID: "varDown", Parent: rootD.ID, Description: "varDown"}
+	err = client.SendNodeType(ncD, varD, "test")
+	if err != nil {
+		t.Fatal("Error sending var: ", err)
+	}
+
+	err = client.SendNodePoint(ncD, rootD.ID, data.Point{Type: data.PointTypeLog, Text: "debug msg"}, true)
+	if err != nil {
+		t.Fatal("error sending node point: ", err)
+	}
+
+	// a subtree that is synced, and does not change
+	group := data.NodeEdge{ID: "group1", Type: data.NodeTypeGroup, Parent: rootD.ID,
+		Points: data.Points{{Type: data.PointTypeDescription, Text: "group1"}}}
+	err = client.SendNode(ncD, group, "test")
+	if err != nil {
+		t.Fatal("Error sending group: ", err)
+	}
+
+	groupVar := client.Variable{ID: "varGroup", Parent: group.ID, Description: "varGroup"}
+	err = client.SendNodeType(ncD, groupVar, "test")
+	if err != nil {
+		t.Fatal("Error sending var: ", err)
+	}
+
+	fmt.Println("**** create sync node")
+	sync := client.Sync{
+		ID:                "sync-id",
+		Parent:            rootD.ID,
+		Description:       "sync to up",
+		URI:               server.TestServerOptions2.NatsServer,
+		Period:            1,
+		ExcludeNodeTypes:  "variable",
+		ExcludePointTypes: "log",
+	}
+
+	err = client.SendNodeType(ncD, sync, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	// make sure device node gets sync'd upstream
+	start := time.Now()
+	for {
+		if time.Since(start) > 500*time.Millisecond {
+			t.Fatal("device node not synced")
+		}
+
+		nodes, err := client.GetNodes(ncU, "all", rootD.ID, "", false)
+		if err != nil {
+			continue
+		}
+
+		if len(nodes) > 0 {
+			break
+		}
+
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	fmt.Println("**** create excluded node down")
+	varD2 := client.Variable{ID: "varDown2", Parent: rootD.ID, Description: "varDown2"}
+	err = client.SendNodeType(ncD, varD2, "test")
+	if err != nil {
+		t.Fatal("Error sending var: ", err)
+	}
+
+	err = client.SendNodePoint(ncD, rootD.ID, data.Point{Type: data.PointTypeDescription, Text: "set down"}, true)
+	if err != nil {
+		t.Fatal("error sending node point: ", err)
+	}
+
+	start = time.Now()
+	for {
+		if time.Since(start) > 500*time.Millisecond {
+			t.Fatal("description not propagated upstream")
+		}
+
+		nodes, err := client.GetNodesType[client.Device](ncU, "all", rootD.ID)
+		if err != nil {
+			continue
+		}
+
+		if len(nodes) > 0 {
+			if nodes[0].Description == "set down" {
+				break
+			}
+		}
+
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	// wait for a few sync periods
+	time.Sleep(2500 * time.Millisecond)
+
+	for _, id := range []string{varD.ID, varD2.ID} {
+		nodes, err := client.GetNodes(ncU, "all", id, "", false)
+		if err != nil && err != data.ErrDocumentNotFound {
+			t.Fatal("Error getting nodes: ", err)
+		}
+
+		if len(nodes) > 0 {
+			t.Fatal("excluded node was synced: ", id)
+		}
+	}
+
+	nodes, err := client.GetNodes(ncU, "all", rootD.ID, "", false)
+	if err != nil || len(nodes) < 1 {
+		t.Fatal("Error getting device node upstream: ", err)
+	}
+
+	for _, p := range nodes[0].Points {
+		if p.Type == data.PointTypeLog {
+			t.Fatal("excluded point type was synced")
+		}
+	}
+
+	// the excluded data should not cause the hashes to mismatch
+	syncs, err := client.GetNodesType[client.Sync](ncD, rootD.ID, sync.ID)
+	if err != nil || len(syncs) < 1 {
+		t.Fatal("Error getting sync node: ", err)
+	}
+
+	count := syncs[0].SyncCount
+
+	time.Sleep(2500 * time.Millisecond)
+
+	syncs, err = client.GetNodesType[client.Sync](ncD, rootD.ID, sync.ID)
+	if err != nil || len(syncs) < 1 {
+		t.Fatal("Error getting sync node: ", err)
+	}
+
+	if syncs[0].SyncCount != count {
+		t.Fatalf("hash mismatch with filters, sync count went from %v to %v",
+			count, syncs[0].SyncCount)
+	}
+
+	// unchanged subtrees upstream should not be walked again to find
+	// excluded data
+	reqs := make(chan string, 1000)
+	sub, err := ncU.Subscribe("nodes.>", func(msg *nats.Msg) {
+		reqs <- msg.Subject
+	})
+	if err != nil {
+		t.Fatal("Error subscribing to node requests: ", err)
+	}
+
+	time.Sleep(2500 * time.Millisecond)
+
+	err = sub.Unsubscribe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	close(reqs)
+	for r := range reqs {
+		if r == "nodes."+group.ID+".all" {
+			t.Fatal("unchanged subtree walked upstream: ", r)
+		}
+	}
+}
+
+func TestSyncFilterGrandchild(t *testing.T) {
+	// Start up a SIOT test servers for this test
+	ncU, _, stopU, err := server.TestServer("2")
+
+	if err != nil {
+		t.Fatal("Error starting upstream test server: ", err)
+	}
+
+	defer stopU()
+
+	ncD, rootD, stopD, err := server.TestServer()
+
+	if err != nil {
+		t.Fatal("Error starting upstream test server: ", err)
+	}
+
+	defer stopD()
+
+	groups := []data.NodeEdge{
+		{ID: "groupA", Type: data.NodeTypeGroup, Parent: rootD.ID},
+		{ID: "groupB", Type: data.NodeTypeGroup, Parent: "groupA"},
+	}
+
+	for _, g := range groups {
+		err = client.SendNode(ncD, g, "test")
+		if err != nil {
+			t.Fatal("Error sending group: ", err)
+		}
+	}
+
+	sync := client.Sync{
+		ID:                "sync-id",
+		Parent:            rootD.ID,
+		Description:       "sync to up",
+		URI:               server.TestServerOptions2.NatsServer,
+		Period:            1,
+		ExcludePointTypes: "log",
+	}
+
+	err = client.SendNodeType(ncD, sync, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	// make sure the grandchild gets sync'd upstream
+	start := time.Now()
+	for {
+		if time.Since(start) > 2*time.Second {
+			t.Fatal("grandchild node not synced")
+		}
+
+		nodes, err := client.GetNodes(ncU, "groupA", "groupB", "", false)
+		if err == nil && len(nodes) > 0 {
+			break
+		}
+
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	// an excluded point on a grandchild upstream should not cause the
+	// hashes to mismatch
+	err = client.SendNodePoint(ncU, "groupB",
+		data.Point{Type: data.PointTypeLog, Text: "upstream msg"}, true)
+	if err != nil {
+		t.Fatal("error sending node point: ", err)
+	}
+
+	time.Sleep(2500 * time.Millisecond)
+
+	syncs, err := client.GetNodesType[client.Sync](ncD, rootD.ID, sync.ID)
+	if err != nil || len(syncs) < 1 {
+		t.Fatal("Error getting sync node: ", err)
+	}
+
+	count := syncs[0].SyncCount
+
+	time.Sleep(2500 * time.Millisecond)
+
+	syncs, err = client.GetNodesType[client.Sync](ncD, rootD.ID, sync.ID)
+	if err != nil || len(syncs) < 1 {
+		t.Fatal("Error getting sync node: ", err)
+	}
+
+	if syncs[0].SyncCount != count {
+		t.Fatalf("hash mismatch with excluded grandchild point, sync count went from %v to %v",
+			count, syncs[0].SyncCount)
+	}
+}
+
+func TestSyncBatchCompress(t *testing.T) {
+	// Start up a SIOT test servers for this test
+	ncU, _, stopU, err := server.TestServer("2")
+
+	if err != nil {
+		t.Fatal("Error starting upstream test server: ", err)
+	}
+
+	defer stopU()
+
+	ncD, rootD, stopD, err := server.TestServer()
+
+	if err != nil {
+		t.Fatal("Error starting upstream test server: ", err)
+	}
+
+	defer stopD()
+
+	fmt.Println("**** create sync node")
+	sync := client.Sync{
+		ID:          "sync-id",
+		Parent:      rootD.ID,
+		Description: "sync to up",
+		URI:         server.TestServerOptions2.NatsServer,
+		BatchPeriod: 50,
+		Compress:    true,
+	}
+
+	err = client.SendNodeType(ncD, sync, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	// make sure device node gets sync'd upstream
+	start := time.Now()
+	for {
+		if time.Since(start) > 500*time.Millisecond {
+			t.Fatal("device node not synced")
+		}
+
+		nodes, err := client.GetNodes(ncU, "all", rootD.ID, "", false)
+		if err != nil {
+			continue
+		}
+
+		if len(nodes) > 0 {
+			break
+		}
+
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	fmt.Println("**** create node down")
+	varD := client.Variable{ID: "varDown", Parent: rootD.ID, Description: "varDown"}
+	err = client.SendNodeType(ncD, varD, "test")
+	if err != nil {
+		t.Fatal("Error sending var: ", err)
+	}
+
+	for i := 1; i <= 5; i++ {
+		err = client.SendNodePoint(ncD, varD.ID, data.Point{Type: data.PointTypeValue, Value: float64(i)}, true)
+		if err != nil {
+			t.Fatal("error sending node point: ", err)
+		}
+	}
+
+	start = time.Now()
+	for {
+		if time.Since(start) > 500*time.Millisecond {
+			t.Fatal("var value not propagated upstream")
+		}
+
+		nodes, err := client.GetNodesType[client.Variable](ncU, rootD.ID, varD.ID)
+		if err != nil {
+			continue
+		}
+
+		if len(nodes) > 0 && nodes[0].Value == 5 {
+			break
+		}
+
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
+func TestSyncHealth(t *testing.T) {
+	// Start up a SIOT test servers for this test
+	_, _, stopU, err := server.TestServer("2")
+
+	if err != nil {
+		t.Fatal("Error starting upstream test server: ", err)
+	}
+
+	defer stopU()
+
+	ncD, rootD, stopD, err := server.TestServer()
+
+	if err != nil {
+		t.Fatal("Error starting upstream test server: ", err)
+	}
+
+	defer stopD()
+
+	sync := client.Sync{
+		ID:          "sync-id",
+		Parent:      rootD.ID,
+		Description: "sync to up",
+		URI:         server.TestServerOptions2.NatsServer,
+		Period:      1,
+	}
+
+	err = client.SendNodeType(ncD, sync, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	// wait for the sync client to report a successful sync
+	start := time.Now()
+	for {
+		if time.Since(start) > 3*time.Second {
+			t.Fatal("sync health points not published")
+		}
+
+		time.Sleep(time.Millisecond * 50)
+
+		nodes, err := client.GetNodes(ncD, rootD.ID, sync.ID, "", false)
+		if err != nil || len(nodes) < 1 {
+			continue
+		}
+
+		var connected, lastSync float64
+		latency := false
+
+		for _, p := range nodes[0].Points {
+			switch p.Type {
+			case data.PointTypeConnected:
+				connected = p.Value
+			case data.PointTypeLastSync:
+				lastSync = p.Value
+			case data.PointTypeLatency:
+				latency = true
+			}
+		}
+
+		if connected == 1 && lastSync > 0 && latency {
+			break
+		}
+	}
+}
+
+func TestSyncMultipleUpstreams(t *testing.T) {
+	ncU2, _, stopU2, err := server.TestServer("2")
+	if err != nil {
+		t.Fatal("Error starting upstream test server: ", err)
+	}
+
+	defer stopU2()
+
+	ncU3, _, stopU3, err := server.TestServer("3")
+	if err != nil {
+		t.Fatal("Error starting upstream test server: ", err)
+	}
+
+	defer stopU3()
+
+	ncD, rootD, stopD, err := server.TestServer()
+	if err != nil {
+		t.Fatal("Error starting test server: ", err)
+	}
+
+	defer stopD()
+
+	syncs := []client.Sync{
+		{
+			ID:          "sync-2",
+			Parent:      rootD.ID,
+			Description: "sync to up 2",
+			URI:         server.TestServerOptions2.NatsServer,
+			Period:      1,
+		},
+		{
+			ID:          "sync-3",
+			Parent:      rootD.ID,
+			Description: "sync to up 3",
+			URI:         server.TestServerOptions3.NatsServer,
+			Period:      1,
+		},
+	}
+
+	for _, s := range syncs {
+		err = client.SendNodeType(ncD, s, "test")
+		if err != nil {
+			t.Fatal("Error sending node: ", err)
+		}
+	}
+
+	varD := client.Variable{ID: "varDown", Parent: rootD.ID, Description: "varDown"}
+	err = client.SendNodeType(ncD, varD, "test")
+	if err != nil {
+		t.Fatal("Error sending var: ", err)
+	}
+
+	waitValue := func(nc *nats.Conn, desc string, value float64) {
+		start := time.Now()
+		for {
+			if time.Since(start) > 3*time.Second {
+				t.Fatalf("value %v not synced to %v", value, desc)
+			}
+
+			nodes, err := client.GetNodesType[client.Variable](nc, rootD.ID, varD.ID)
+			if err == nil && len(nodes) > 0 && nodes[0].Value == value {
+				return
+			}
+
+			time.Sleep(time.Millisecond * 20)
+		}
+	}
+
+	err = client.SendNodePoint(ncD, varD.ID, data.Point{Type: data.PointTypeValue, Value: 10}, true)
+	if err != nil {
+		t.Fatal("error sending node point: ", err)
+	}
+
+	waitValue(ncU2, "up 2", 10)
+	waitValue(ncU3, "up 3", 10)
+
+	// a change on one upstream is fanned out to the other through the edge
+	err = client.SendNodePoint(ncU2, varD.ID, data.Point{Type: data.PointTypeValue, Value: 20}, true)
+	if err != nil {
+		t.Fatal("error sending node point: ", err)
+	}
+
+	waitValue(ncD, "down", 20)
+	waitValue(ncU3, "up 3", 20)
+
+	// each upstream should list the edge as a connected downstream instance
+	for _, nc := range []*nats.Conn{ncU2, ncU3} {
+		start := time.Now()
+		for {
+			if time.Since(start) > 3*time.Second {
+				t.Fatal("downstream instance not reported")
+			}
+
+			nodes, err := client.GetSyncDownstream(nc)
+			if err != nil {
+				t.Fatal("Error getting downstream instances: ", err)
+			}
+
+			connected := false
+			if len(nodes) == 1 && nodes[0].ID == rootD.ID {
+				for _, p := range nodes[0].Points {
+					if p.Type == data.PointTypeConnected && p.Value == 1 {
+						connected = true
+					}
+				}
+			}
+
+			if connected {
+				break
+			}
+
+			time.Sleep(time.Millisecond * 50)
+		}
+	}
+}
+
+func TestSyncConflict(t *testing.T) {
+	ncU, _, stopU, err := server.TestServer("2")
+	if err != nil {
+		t.Fatal("Error starting upstream test server: ", err)
+	}
+
+	defer stopU()
+
+	ncD, rootD, stopD, err := server.TestServer()
+	if err != nil {
+		t.Fatal("Error starting test server: ", err)
+	}
+
+	defer stopD()
+
+	sync := client.Sync{
+		ID:             "sync-id",
+		Parent:         rootD.ID,
+		Description:    "sync to up",
+		URI:            server.TestServerOptions2.NatsServer,
+		Period:         1,
+		ConflictPolicy: data.PointValueCloudWins,
+	}
+
+	err = client.SendNodeType(ncD, sync, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	varD := client.Variable{ID: "varDown", Parent: rootD.ID, Description: "varDown"}
+	err = client.SendNodeType(ncD, varD, "test")
+	if err != nil {
+		t.Fatal("Error sending var: ", err)
+	}
+
+	getSync := func() client.Sync {
+		syncs, err := client.GetNodesType[client.Sync](ncD, rootD.ID, sync.ID)
+		if err != nil || len(syncs) < 1 {
+			return client.Sync{}
+		}
+		return syncs[0]
+	}
+
+	// wait for the first sync to complete
+	start := time.Now()
+	for {
+		if time.Since(start) > 3*time.Second {
+			t.Fatal("initial sync did not complete")
+		}
+
+		nodes, err := client.GetNodesType[client.Variable](ncU, rootD.ID, varD.ID)
+		if err == nil && len(nodes) > 0 && getSync().LastSync > 0 {
+			break
+		}
+
+		time.Sleep(time.Millisecond * 20)
+	}
+
+	// take the sync offline and change the variable on both sides. The edge
+	// clock is an hour fast.
+	err = client.SendNodePoint(ncD, sync.ID, data.Point{Type: data.PointTypeDisable, Value: 1, Origin: "test"}, true)
+	if err != nil {
+		t.Fatal("Error disabling sync: ", err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	err = client.SendNodePoint(ncD, varD.ID, data.Point{Time: time.Now().Add(time.Hour),
+		Type: data.PointTypeValue, Value: 1}, true)
+	if err != nil {
+		t.Fatal("error sending node point: ", err)
+	}
+
+	err = client.SendNodePoint(ncU, varD.ID, data.Point{Type: data.PointTypeValue, Value: 2}, true)
+	if err != nil {
+		t.Fatal("error sending node point: ", err)
+	}
+
+	err = client.SendNodePoint(ncD, sync.ID, data.Point{Type: data.PointTypeDisable, Value: 0, Origin: "test"}, true)
+	if err != nil {
+		t.Fatal("Error enabling sync: ", err)
+	}
+
+	// the upstream value should win on both sides
+	start = time.Now()
+	for {
+		if time.Since(start) > 3*time.Second {
+			t.Fatal("conflict not resolved")
+		}
+
+		time.Sleep(time.Millisecond * 50)
+
+		down, err := client.GetNodesType[client.Variable](ncD, rootD.ID, varD.ID)
+		if err != nil || len(down) < 1 || down[0].Value != 2 {
+			continue
+		}
+
+		up, err := client.GetNodesType[client.Variable](ncU, rootD.ID, varD.ID)
+		if err != nil || len(up) < 1 || up[0].Value != 2 {
+			continue
+		}
+
+		if getSync().ConflictCount == 1 {
+			break
+		}
+	}
+}
+
+func TestSyncSkewedClock(t *testing.T) {
+	ncU, _, stopU, err := server.TestServer("2")
+	if err != nil {
+		t.Fatal("Error starting upstream test server: ", err)
+	}
+
+	defer stopU()
+
+	ncD, rootD, stopD, err := server.TestServer()
+	if err != nil {
+		t.Fatal("Error starting test server: ", err)
+	}
+
+	defer stopD()
+
+	sync := client.Sync{
+		ID:             "sync-id",
+		Parent:         rootD.ID,
+		Description:    "sync to up",
+		URI:            server.TestServerOptions2.NatsServer,
+		Period:         1,
+		ConflictPolicy: data.PointValueCloudWins,
+	}
+
+	err = client.SendNodeType(ncD, sync, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	varD := client.Variable{ID: "varDown", Parent: rootD.ID, Description: "varDown"}
+	err = client.SendNodeType(ncD, varD, "test")
+	if err != nil {
+		t.Fatal("Error sending var: ", err)
+	}
+
+	getSync := func() client.Sync {
+		syncs, err := client.GetNodesType[client.Sync](ncD, rootD.ID, sync.ID)
+		if err != nil || len(syncs) < 1 {
+			return client.Sync{}
+		}
+		return syncs[0]
+	}
+
+	getValues := func() (float64, float64, bool) {
+		down, err := client.GetNodesType[client.Variable](ncD, rootD.ID, varD.ID)
+		if err != nil || len(down) < 1 {
+			return 0, 0, false
+		}
+
+		up, err := client.GetNodesType[client.Variable](ncU, rootD.ID, varD.ID)
+		if err != nil || len(up) < 1 {
+			return 0, 0, false
+		}
+
+		return down[0].Value, up[0].Value, true
+	}
+
+	err = client.SendNodePoint(ncD, varD.ID, data.Point{Type: data.PointTypeValue, Value: 1}, true)
+	if err != nil {
+		t.Fatal("error sending node point: ", err)
+	}
+
+	start := time.Now()
+	for {
+		if time.Since(start) > 3*time.Second {
+			t.Fatal("initial sync did not complete")
+		}
+
+		down, up, ok := getValues()
+		if ok && down == 1 && up == 1 && getSync().LastSync > 0 {
+			break
+		}
+
+		time.Sleep(time.Millisecond * 20)
+	}
+
+	// take the sync offline and change the variable on both sides. The edge
+	// clock is an hour fast, so the last sync time recorded by the edge and
+	// the edge point are in the future.
+	err = client.SendNodePoint(ncD, sync.ID, data.Point{Type: data.PointTypeDisable, Value: 1, Origin: "test"}, true)
+	if err != nil {
+		t.Fatal("Error disabling sync: ", err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	fast := time.Now().Add(time.Hour)
+
+	err = client.SendNodePoint(ncD, sync.ID, data.Point{Time: fast, Type: data.PointTypeLastSync,
+		Value: float64(fast.UnixNano()) / 1e9, Origin: "test"}, true)
+	if err != nil {
+		t.Fatal("Error sending last sync: ", err)
+	}
+
+	err = client.SendNodePoint(ncD, varD.ID, data.Point{Time: fast.Add(time.Second),
+		Type: data.PointTypeValue, Value: 3}, true)
+	if err != nil {
+		t.Fatal("error sending node point: ", err)
+	}
+
+	err = client.SendNodePoint(ncU, varD.ID, data.Point{Type: data.PointTypeValue, Value: 2}, true)
+	if err != nil {
+		t.Fatal("error sending node point: ", err)
+	}
+
+	err = client.SendNodePoint(ncD, sync.ID, data.Point{Type: data.PointTypeDisable, Value: 0, Origin: "test"}, true)
+	if err != nil {
+		t.Fatal("Error enabling sync: ", err)
+	}
+
+	// the upstream value should win on both sides
+	start = time.Now()
+	for {
+		if time.Since(start) > 3*time.Second {
+			down, up, _ := getValues()
+			t.Fatalf("conflict not resolved, down: %v, up: %v, conflicts: %v",
+				down, up, getSync().ConflictCount)
+		}
+
+		time.Sleep(time.Millisecond * 50)
+
+		down, up, ok := getValues()
+		if ok && down == 2 && up == 2 && getSync().ConflictCount == 1 {
+			break
+		}
+	}
+}
+
+func TestSyncMQTT(t *testing.T) {
+	// use a NATS server with MQTT enabled as the MQTT broker
+	broker, err := natsserver.NewServer(&natsserver.Options{
+		ServerName: "mqtt-broker",
+		Port:       -1,
+		JetStream:  true,
+		StoreDir:   t.TempDir(),
+		NoSigs:     true,
+		NoLog:      true,
+		MQTT:       natsserver.MQTTOpts{Host: "localhost", Port: 8930},
+	})
+	if err != nil {
+		t.Fatal("Error creating MQTT broker: ", err)
+	}
+
+	go broker.Start()
+	defer broker.Shutdown()
+
+	if !broker.ReadyForConnections(5 * time.Second) {
+		t.Fatal("MQTT broker did not start")
+	}
+
+	ncU, _, stopU, err := server.TestServer("2")
+	if err != nil {
+		t.Fatal("Error starting upstream test server: ", err)
+	}
+
+	defer stopU()
+
+	ncD, rootD, stopD, err := server.TestServer()
+	if err != nil {
+		t.Fatal("Error starting test server: ", err)
+	}
+
+	defer stopD()
+
+	rootU, err := client.GetRootNode(ncU)
+	if err != nil {
+		t.Fatal("Error getting upstream root: ", err)
+	}
+
+	syncMqtt := client.SyncMqtt{
+		ID:          "sync-mqtt-id",
+		Parent:      rootU.ID,
+		Description: "sync from edge",
+		URI:         "mqtt://localhost:8930",
+		EdgeTokens:  []string{rootD.ID + ":edge-token"},
+	}
+
+	err = client.SendNodeType(ncU, syncMqtt, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	sync := client.Sync{
+		ID:          "sync-id",
+		Parent:      rootD.ID,
+		Description: "sync to up",
+		URI:         "mqtt://localhost:8930",
+		AuthToken:   "edge-token",
+		Period:      1,
+	}
+
+	err = client.SendNodeType(ncD, sync, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	fmt.Println("**** create node down")
+	varD := client.Variable{ID: "varDown", Parent: rootD.ID, Description: "varDown"}
+	err = client.SendNodeType(ncD, varD, "test")
+	if err != nil {
+		t.Fatal("Error sending var: ", err)
+	}
+
+	start := time.Now()
+	for {
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("var not propagated upstream")
+		}
+
+		nodes, err := client.GetNodesType[client.Variable](ncU, rootD.ID, varD.ID)
+		if err == nil && len(nodes) > 0 {
+			break
+		}
+
+		time.Sleep(time.Millisecond * 20)
+	}
+
+	fmt.Println("**** update value up")
+	err = client.SendNodePoint(ncU, varD.ID, data.Point{Type: data.PointTypeValue, Value: 5}, true)
+	if err != nil {
+		t.Fatal("error sending node point: ", err)
+	}
+
+	start = time.Now()
+	for {
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("value not propagated downstream")
+		}
+
+		nodes, err := client.GetNodesType[client.Variable](ncD, rootD.ID, varD.ID)
+		if err == nil && len(nodes) > 0 && nodes[0].Value == 5 {
+			break
+		}
+
+		time.Sleep(time.Millisecond * 20)
+	}
+
+	fmt.Println("**** update value down")
+	err = client.SendNodePoint(ncD, varD.ID, data.Point{Type: data.PointTypeValue, Value: 7}, true)
+	if err != nil {
+		t.Fatal("error sending node point: ", err)
+	}
+
+	start = time.Now()
+	for {
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("value not propagated upstream")
+		}
+
+		nodes, err := client.GetNodesType[client.Variable](ncU, rootD.ID, varD.ID)
+		if err == nil && len(nodes) > 0 && nodes[0].Value == 7 {
+			break
+		}
+
+		time.Sleep(time.Millisecond * 20)
+	}
+}
+
+func TestSyncMQTTAuth(t *testing.T) {
+	broker, err := natsserver.NewServer(&natsserver.Options{
+		ServerName: "mqtt-broker-auth",
+		Port:       -1,
+		JetStream:  true,
+		StoreDir:   t.TempDir(),
+		NoSigs:     true,
+		NoLog:      true,
+		MQTT:       natsserver.MQTTOpts{Host: "localhost", Port: 8931},
+	})
+	if err != nil {
+		t.Fatal("Error creating MQTT broker: ", err)
+	}
+
+	go broker.Start()
+	defer broker.Shutdown()
+
+	if !broker.ReadyForConnections(5 * time.Second) {
+		t.Fatal("MQTT broker did not start")
+	}
+
+	ncU, rootU, stopU, err := server.TestServer("2")
+	if err != nil {
+		t.Fatal("Error starting upstream test server: ", err)
+	}
+
+	defer stopU()
+
+	syncMqtt := client.SyncMqtt{
+		ID:          "sync-mqtt-id",
+		Parent:      rootU.ID,
+		Description: "sync from edge",
+		URI:         "mqtt://localhost:8931",
+		EdgeTokens:  []string{"edge-root:secret", "edge2:secret2"},
+	}
+
+	err = client.SendNodeType(ncU, syncMqtt, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	// a node for the edge and a node outside of the edge subtree
+	edge := client.Variable{ID: "edge-root", Parent: rootU.ID, Description: "edge"}
+	other := client.Variable{ID: "other", Parent: rootU.ID, Description: "other"}
+
+	for _, v := range []client.Variable{edge, other} {
+		err = client.SendNodeType(ncU, v, "test")
+		if err != nil {
+			t.Fatal("Error sending var: ", err)
+		}
+	}
+
+	// fake edge instance
+	chDown := make(chan data.Points, 20)
+	connected := make(chan bool, 5)
+
+	m := client.MQTTConnect(client.MQTTOptions{
+		URI:       "mqtt://localhost:8931",
+		ClientID:  "fake-edge",
+		Connected: func(c bool) { connected <- c },
+		Subscribe: func(c mqtt.Client) {
+			c.Subscribe("siot/down/edge-root/#", 1, func(_ mqtt.Client, msg mqtt.Message) {
+				// skip empty reply and token
+				pts, err := data.PbDecodePoints(msg.Payload()[4:])
+				if err == nil {
+					chDown <- pts
+				}
+			}).Wait()
+		},
+	})
+
+	defer m.Disconnect(250)
+
+	select {
+	case <-connected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("fake edge did not connect")
+	}
+
+	// give the sync MQTT server time to connect
+	time.Sleep(500 * time.Millisecond)
+
+	publish := func(edgeID, subject, token string, pts data.Points) {
+		d, err := pts.ToPb()
+		if err != nil {
+			t.Fatal("Error encoding points: ", err)
+		}
+		env := append([]byte{0, 0, 0, byte(len(token))}, token...)
+		topic := "siot/up/" + edgeID + "/" + strings.ReplaceAll(subject, ".", "/")
+		m.Publish(topic, 1, false, append(env, d...)).Wait()
+	}
+
+	send := func(id, token string, value float64) {
+		publish("edge-root", "p."+id, token,
+			data.Points{{Time: time.Now(), Type: data.PointTypeValue, Value: value}})
+	}
+
+	getValue := func(id string) float64 {
+		nodes, err := client.GetNodesType[client.Variable](ncU, "all", id)
+		if err != nil || len(nodes) < 1 {
+			t.Fatal("Error getting node: ", err)
+		}
+		return nodes[0].Value
+	}
+
+	send("edge-root", "wrong", 1)
+	send("other", "secret", 2)
+	// the token of another edge can't be used to claim a different edge ID
+	publish("other", "p.other", "secret",
+		data.Points{{Time: time.Now(), Type: data.PointTypeValue, Value: 2}})
+	publish("edge2", "p.other", "secret",
+		data.Points{{Time: time.Now(), Type: data.PointTypeValue, Value: 2}})
+	// the edge can't attach its root to a node outside its subtree
+	publish("edge-root", "p.edge-root.other", "secret",
+		data.Points{{Time: time.Now(), Type: data.PointTypeTombstone}})
+	// new nodes can only be created in the edge subtree
+	newNode := func(id, parent string) {
+		publish("edge-root", "p."+id, "secret", data.Points{
+			{Time: time.Now(), Type: data.PointTypeValue, Value: 8},
+			{Time: time.Now(), Type: data.PointTypeDescription, Text: id},
+		})
+		publish("edge-root", "p."+id+"."+parent, "secret", data.Points{
+			{Time: time.Now(), Type: data.PointTypeTombstone},
+			{Time: time.Now(), Type: data.PointTypeNodeType, Text: data.NodeTypeVariable},
+		})
+	}
+	newNode("new-out", "other")
+	newNode("new-in", "edge-root")
+	send("edge-root", "secret", 3)
+
+	start := time.Now()
+	for getValue("edge-root") != 3 {
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("value from edge not written")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	if v := getValue("other"); v != 0 {
+		t.Fatal("edge wrote node outside its subtree: ", v)
+	}
+
+	start = time.Now()
+	for {
+		nodes, err := client.GetNodesType[client.Variable](ncU, "edge-root", "new-in")
+		if err == nil && len(nodes) > 0 && nodes[0].Value == 8 {
+			break
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("new node in edge subtree not created: ", nodes, err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	nodes, err := client.GetNodes(ncU, "all", "new-out", "", true)
+	if err == nil && len(nodes) > 0 {
+		t.Fatal("edge created a node outside its subtree")
+	}
+
+	nodes, err = client.GetNodes(ncU, "other", "edge-root", "", true)
+	if err == nil && len(nodes) > 0 {
+		t.Fatal("edge attached its root outside its subtree")
+	}
+
+	// points from the edge must not be echoed back down, but upstream
+	// changes must be sent down
+	err = client.SendNodePoint(ncU, "edge-root", data.Point{Type: data.PointTypeValue, Value: 4}, true)
+	if err != nil {
+		t.Fatal("Error sending point: ", err)
+	}
+
+	for {
+		select {
+		case pts := <-chDown:
+			for _, p := range pts {
+				if p.Type != data.PointTypeValue {
+					continue
+				}
+				if p.Value == 3 {
+					t.Fatal("edge point echoed back down")
+				}
+				if p.Value == 4 {
+					return
+				}
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("upstream point not sent down")
+		}
+	}
+}
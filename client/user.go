@@ -2,11 +2,11 @@ package client
 
 // User represents a user node
 type User struct {
-	ID        string `node:"id"`
-	Parent    string `node:"parent"`
-	FirstName string `point:"firstName"`
-	LastName  string `point:"lastName"`
-	Phone     string `point:"phone"`
-	Email     string `point:"email"`
-	Pass      string `point:"pass"`
+	ID        string `node:"id" json:"id"`
+	Parent    string `node:"parent" json:"parent"`
+	FirstName string `point:"firstName" json:"firstName"`
+	LastName  string `point:"lastName" json:"lastName"`
+	Phone     string `point:"phone" json:"phone"`
+	Email     string `point:"email" json:"email"`
+	Pass      string `point:"pass" json:"pass,omitempty"`
 }
@@ -14,7 +14,7 @@ import (
 // decoder
 type NodeEdgeChildren struct {
 	NodeEdge `yaml:",inline"`
-	Children []NodeEdgeChildren `yaml:",omitempty"`
+	Children []NodeEdgeChildren `json:"children,omitempty" yaml:",omitempty"`
 }
 
 func (ne NodeEdgeChildren) String() string {
@@ -0,0 +1,71 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// HistoryQuery is used to request historical point data for a node from the
+// time-series database.
+type HistoryQuery struct {
+	// Type and Key of the points to query. If Key is blank, points with
+	// any key are returned.
+	Type string `json:"type"`
+	Key  string `json:"key,omitempty"`
+	// Start and Stop of the time range. Stop defaults to now.
+	Start time.Time `json:"start"`
+	Stop  time.Time `json:"stop,omitempty"`
+	// AggregateWindow is a duration (for example 5m). If set, points are
+	// aggregated in windows of this length using the Aggregate function.
+	AggregateWindow string `json:"aggregateWindow,omitempty"`
+	// Aggregate is one of mean (default), min, max, sum, count, first,
+	// last, or median.
+	Aggregate string `json:"aggregate,omitempty"`
+}
+
+// HistoryAggregates are the valid values for HistoryQuery.Aggregate
+var HistoryAggregates = []string{"mean", "min", "max", "sum", "count", "first", "last", "median"}
+
+// Validate checks a history query for errors
+func (q HistoryQuery) Validate() error {
+	if q.Type == "" {
+		return errors.New("history query type is required")
+	}
+
+	if q.Start.IsZero() {
+		return errors.New("history query start is required")
+	}
+
+	if !q.Stop.IsZero() && !q.Stop.After(q.Start) {
+		return errors.New("history query stop must be after start")
+	}
+
+	if q.AggregateWindow != "" {
+		d, err := time.ParseDuration(q.AggregateWindow)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("invalid history aggregate window: %v", q.AggregateWindow)
+		}
+	}
+
+	if q.Aggregate != "" {
+		found := false
+		for _, a := range HistoryAggregates {
+			if a == q.Aggregate {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("invalid history aggregate: %v", q.Aggregate)
+		}
+	}
+
+	return nil
+}
+
+// HistoryResult is the response to a HistoryQuery
+type HistoryResult struct {
+	Points Points `json:"points"`
+	Error  string `json:"error,omitempty"`
+}
@@ -0,0 +1,19 @@
+package data
+
+// IngestRequest is sent by the HTTP API to the HTTP ingest client that
+// handles the endpoint key.
+type IngestRequest struct {
+	// Token is the bearer token sent with the HTTP request
+	Token string `json:"token,omitempty"`
+	// Body is the JSON payload posted to the endpoint
+	Body []byte `json:"body"`
+}
+
+// IngestResult is returned by the HTTP ingest client
+type IngestResult struct {
+	// Status is the HTTP status code for the response
+	Status int `json:"status"`
+	// Points is the number of points that were written
+	Points int    `json:"points"`
+	Error  string `json:"error,omitempty"`
+}
@@ -88,6 +88,13 @@ const (
 	PointTypeClientServer = "clientServer"
 	PointValueClient      = "client"
 	PointValueServer      = "server"
+	// a gateway forwards Modbus TCP requests to devices on an RTU bus
+	PointValueGateway = "gateway"
+
+	// TCP port a gateway listens on, and the time in ms a request can wait
+	// for the RTU device to respond (including time in the request queue)
+	PointTypeGatewayPort    = "gatewayPort"
+	PointTypeGatewayTimeout = "gatewayTimeout"
 
 	PointTypePort   = "port"
 	PointTypeBaud   = "baud"
@@ -96,9 +103,46 @@ const (
 	PointTypeProtocol = "protocol"
 	PointValueRTU     = "RTU"
 	PointValueTCP     = "TCP"
+	// Modbus ASCII over a serial port
+	PointValueProtocolASCII = "ASCII"
+	// RTU frames over a TCP connection, as used by serial device servers
+	PointValueRTUOverTCP = "RTUoverTCP"
+	// Modbus TCP packets in UDP datagrams
+	PointValueUDP = "UDP"
+
+	// client mode polling combines IOs on the same device into block reads.
+	// max gap is the number of unused registers (or bits) that can be read
+	// to join two IOs, and max count is the max registers (or bits) in one
+	// read.
+	PointTypePollMaxGap   = "pollMaxGap"
+	PointTypePollMaxCount = "pollMaxCount"
+
+	// device profiles are used to create the IO nodes for a device. The
+	// available profiles are listed in modbusProfiles points keyed by the
+	// profile key.
+	PointTypeModbusProfiles      = "modbusProfiles"
+	PointTypeModbusProfile       = "modbusProfile"
+	PointTypeModbusProfileID     = "modbusProfileId"
+	PointTypeModbusProfileCreate = "modbusProfileCreate"
+
+	// a client mode bus scan probes a range of device IDs at each of the
+	// scan baud rates (comma separated). A scanResult point keyed by
+	// device ID is sent for each device that responds. The value is the
+	// baud rate and the text is the exception, if any.
+	PointTypeScanStart   = "scanStart"
+	PointTypeScanIDStart = "scanIdStart"
+	PointTypeScanIDEnd   = "scanIdEnd"
+	PointTypeScanAddress = "scanAddress"
+	PointTypeScanIOType  = "scanIoType"
+	PointTypeScanBauds   = "scanBauds"
+	PointTypeScanStatus  = "scanStatus"
+	PointTypeScanResult  = "scanResult"
 
 	NodeTypeModbusIO = "modbusIo"
 
+	// in server mode, IOs with ID 0 are served on unit 0 instead of the bus ID
+	PointTypeUnitZero = "unitZero"
+
 	PointTypeModbusIOType           = "modbusIoType"
 	PointValueModbusDiscreteInput   = "modbusDiscreteInput"
 	PointValueModbusCoil            = "modbusCoil"
@@ -111,6 +155,27 @@ const (
 	PointValueUINT32    = "uint32"
 	PointValueINT32     = "int32"
 	PointValueFLOAT32   = "float32"
+	PointValueUINT64    = "uint64"
+	PointValueINT64     = "int64"
+	PointValueFLOAT64   = "float64"
+	// binary coded decimal, 4 digits per register
+	PointValueBCD = "bcd"
+	// ASCII string, 2 characters per register. The string is written to
+	// the text field of the value point.
+	PointValueASCII = "ascii"
+	// bits selected by the bit mask in a register
+	PointValueBitField = "bitField"
+
+	// number of registers for BCD and ASCII data formats
+	PointTypeRegCount = "regCount"
+	PointTypeBitMask  = "bitMask"
+
+	// byte order of multi-register values. A is the most significant byte.
+	PointTypeByteOrder = "byteOrder"
+	PointValueABCD     = "ABCD"
+	PointValueCDAB     = "CDAB"
+	PointValueBADC     = "BADC"
+	PointValueDCBA     = "DCBA"
 
 	NodeTypeOneWire   = "oneWire"
 	NodeTypeOneWireIO = "oneWireIO"
@@ -124,6 +189,40 @@ const (
 	PointTypeBucket = "bucket"
 	PointTypeOrg    = "org"
 
+	// db node types
+	PointValueInflux     = "influx"
+	PointValueTimescale  = "timescale"
+	PointValuePrometheus = "prometheus"
+
+	PointTypeTagDescription = "tagDescription"
+	PointTypeTagNodeType    = "tagNodeType"
+	PointTypeTagPath        = "tagPath"
+	// custom tag on a node. The key is the tag name.
+	PointTypeTag = "tag"
+
+	PointTypeBufferFile           = "bufferFile"
+	PointTypeBufferMaxCount       = "bufferMaxCount"
+	PointTypeBufferMaxAge         = "bufferMaxAge"
+	PointTypeBufferDepth          = "bufferDepth"
+	PointTypeWriteErrorCount      = "writeErrorCount"
+	PointTypeWriteErrorCountReset = "writeErrorCountReset"
+
+	// HTTP ingest nodes map JSON posted to /v1/ingest/<key> to points
+	NodeTypeHTTPIngest        = "httpIngest"
+	NodeTypeHTTPIngestDevice  = "httpIngestDevice"
+	PointTypeIngestKey        = "ingestKey"
+	PointTypeMappings         = "mappings"
+	PointTypeDeviceIDPath     = "deviceIDPath"
+	PointTypeMaxDevices       = "maxDevices"
+	PointTypeRejectNewDevices = "rejectNewDevices"
+	PointTypeTimePath         = "timePath"
+	PointTypeAllowAnonymous   = "allowAnonymous"
+
+	// exporter nodes select points for the HTTP /metrics endpoint
+	NodeTypeExporter          = "exporter"
+	PointTypeExportNodes      = "exportNodes"
+	PointTypeExportPointTypes = "exportPointTypes"
+
 	// a rule node describes a rule that may run on the system
 	NodeTypeRule = "rule"
 
@@ -197,6 +296,48 @@ const (
 
 	NodeTypeSync = "sync"
 
+	PointTypeQueueFile     = "queueFile"
+	PointTypeQueueMaxCount = "queueMaxCount"
+	PointTypeQueueMaxAge   = "queueMaxAge"
+
+	PointTypeExcludeNodeTypes  = "excludeNodeTypes"
+	PointTypeExcludeNodes      = "excludeNodes"
+	PointTypeExcludePointTypes = "excludePointTypes"
+	PointTypeIncludePointTypes = "includePointTypes"
+	PointTypeSyncHighRate      = "syncHighRate"
+
+	PointTypeCompress            = "compress"
+	PointTypeByteBudget          = "byteBudget"
+	PointTypeTelemetryPointTypes = "telemetryPointTypes"
+	PointTypeBytesTx             = "bytesTx"
+	PointTypeBytesTxReset        = "bytesTxReset"
+	PointTypeBytesRx             = "bytesRx"
+	PointTypeBytesRxReset        = "bytesRxReset"
+	PointTypeBytesToday          = "bytesToday"
+
+	PointTypeLastSync            = "lastSync"
+	PointTypeLatency             = "latency"
+	PointTypeHashMismatch        = "hashMismatch"
+	PointTypeQueueDepth          = "queueDepth"
+	PointTypeReconnectCount      = "reconnectCount"
+	PointTypeReconnectCountReset = "reconnectCountReset"
+	PointTypeLastSeen            = "lastSeen"
+
+	PointTypeConflictPolicy     = "conflictPolicy"
+	PointValueNewestWins        = "newestWins"
+	PointValueCloudWins         = "cloudWins"
+	PointValueEdgeWins          = "edgeWins"
+	PointTypeConflict           = "conflict"
+	PointTypeConflictCount      = "conflictCount"
+	PointTypeConflictCountReset = "conflictCountReset"
+
+	PointTypeMQTTUser     = "mqttUser"
+	PointTypeMQTTPassword = "mqttPassword"
+	PointTypeTopicPrefix  = "topicPrefix"
+	PointTypeEdgeToken    = "edgeToken"
+
+	NodeTypeSyncMqtt = "syncMqtt"
+
 	PointTypeMetricNatsCycleNodePoint          = "metricNatsCycleNodePoint"
 	PointTypeMetricNatsCycleNodeEdgePoint      = "metricNatsCycleNodeEdgePoint"
 	PointTypeMetricNatsCycleNode               = "metricNatsCycleNode"
@@ -17,8 +17,11 @@ module Api.Node exposing
     , typeCondition
     , typeDb
     , typeDevice
+    , typeExporter
     , typeFile
     , typeGroup
+    , typeHttpIngest
+    , typeHttpIngestDevice
     , typeMetrics
     , typeModbus
     , typeModbusIO
@@ -35,6 +38,7 @@ module Api.Node exposing
     , typeShellyIO
     , typeSignalGenerator
     , typeSync
+    , typeSyncMqtt
     , typeUser
     , typeVariable
     )
@@ -89,6 +93,21 @@ typeMsgService =
     "msgService"
 
 
+typeExporter : String
+typeExporter =
+    "exporter"
+
+
+typeHttpIngest : String
+typeHttpIngest =
+    "httpIngest"
+
+
+typeHttpIngestDevice : String
+typeHttpIngestDevice =
+    "httpIngestDevice"
+
+
 typeDb : String
 typeDb =
     "db"
@@ -144,6 +163,11 @@ typeSync =
     "sync"
 
 
+typeSyncMqtt : String
+typeSyncMqtt =
+    "syncMqtt"
+
+
 typeSignalGenerator : String
 typeSignalGenerator =
     "signalGenerator"
@@ -94,6 +94,24 @@ module Api.Point exposing
     , typePointKey
     , typePointType
     , typePollPeriod
+    , typePollMaxGap
+    , typePollMaxCount
+    , typeModbusProfiles
+    , typeModbusProfile
+    , typeModbusProfileId
+    , typeModbusProfileCreate
+    , typeScanStart
+    , typeScanIdStart
+    , typeScanIdEnd
+    , typeScanAddress
+    , typeScanIoType
+    , typeScanBauds
+    , typeScanStatus
+    , typeScanResult
+    , typeRegCount
+    , typeUnitZero
+    , typeBitMask
+    , typeByteOrder
     , typePort
     , typeProtocol
     , typeRate
@@ -128,15 +146,79 @@ module Api.Point exposing
     , typeVersionHW
     , typeVersionOS
     , typeWeekday
+    , typeQueueFile
+    , typeQueueMaxCount
+    , typeQueueMaxAge
+    , typeExcludeNodeTypes
+    , typeExcludeNodes
+    , typeExcludePointTypes
+    , typeIncludePointTypes
+    , typeExportNodes
+    , typeExportPointTypes
+    , typeIngestKey
+    , typeMappings
+    , typeDeviceIDPath
+    , typeMaxDevices
+    , typeRejectNewDevices
+    , typeTimePath
+    , typeAllowAnonymous
+    , typeSyncHighRate
+    , typeCompress
+    , typeByteBudget
+    , typeTelemetryPointTypes
+    , typeBytesTx
+    , typeBytesTxReset
+    , typeBytesRx
+    , typeBytesRxReset
+    , typeBytesToday
+    , typeLastSync
+    , typeLatency
+    , typeHashMismatch
+    , typeQueueDepth
+    , typeReconnectCount
+    , typeReconnectCountReset
+    , typeConflictPolicy
+    , valueNewestWins
+    , valueCloudWins
+    , valueEdgeWins
+    , typeConflict
+    , typeConflictCount
+    , typeConflictCountReset
+    , typeMQTTUser
+    , typeMQTTPassword
+    , typeTopicPrefix
+    , typeEdgeToken
+    , valueInflux
+    , valueTimescale
+    , valuePrometheus
+    , typeTagDescription
+    , typeTagNodeType
+    , typeTagPath
+    , typeTag
+    , typeBufferFile
+    , typeBufferMaxCount
+    , typeBufferMaxAge
+    , typeBufferDepth
+    , typeWriteErrorCount
+    , typeWriteErrorCountReset
     , updatePoints
     , valueApp
     , valueClient
     , valueContains
     , valueEqual
     , valueFLOAT32
+    , valueFLOAT64
+    , valueBCD
+    , valueASCII
+    , valueBitField
+    , valueABCD
+    , valueCDAB
+    , valueBADC
+    , valueDCBA
     , valueGreaterThan
     , valueINT16
     , valueINT32
+    , valueINT64
     , valueLessThan
     , valueModbusCoil
     , valueModbusDiscreteInput
@@ -152,13 +234,20 @@ module Api.Point exposing
     , valueRTU
     , valueSchedule
     , valueServer
+    , valueGateway
+    , typeGatewayPort
+    , typeGatewayTimeout
     , valueSetValue
     , valueSystem
     , valueTCP
+    , valueProtocolASCII
+    , valueRTUOverTCP
+    , valueUDP
     , valueText
     , valueTwilio
     , valueUINT16
     , valueUINT32
+    , valueUINT64
     , valueSine
     , valueSquare
     , valueTriangle
@@ -450,6 +539,21 @@ valueTCP =
     "TCP"
 
 
+valueProtocolASCII : String
+valueProtocolASCII =
+    "ASCII"
+
+
+valueRTUOverTCP : String
+valueRTUOverTCP =
+    "RTUoverTCP"
+
+
+valueUDP : String
+valueUDP =
+    "UDP"
+
+
 typeModbusIOType : String
 typeModbusIOType =
     "modbusIoType"
@@ -490,6 +594,76 @@ typePollPeriod =
     "pollPeriod"
 
 
+typePollMaxGap : String
+typePollMaxGap =
+    "pollMaxGap"
+
+
+typePollMaxCount : String
+typePollMaxCount =
+    "pollMaxCount"
+
+
+typeModbusProfiles : String
+typeModbusProfiles =
+    "modbusProfiles"
+
+
+typeModbusProfile : String
+typeModbusProfile =
+    "modbusProfile"
+
+
+typeModbusProfileId : String
+typeModbusProfileId =
+    "modbusProfileId"
+
+
+typeModbusProfileCreate : String
+typeModbusProfileCreate =
+    "modbusProfileCreate"
+
+
+typeScanStart : String
+typeScanStart =
+    "scanStart"
+
+
+typeScanIdStart : String
+typeScanIdStart =
+    "scanIdStart"
+
+
+typeScanIdEnd : String
+typeScanIdEnd =
+    "scanIdEnd"
+
+
+typeScanAddress : String
+typeScanAddress =
+    "scanAddress"
+
+
+typeScanIoType : String
+typeScanIoType =
+    "scanIoType"
+
+
+typeScanBauds : String
+typeScanBauds =
+    "scanBauds"
+
+
+typeScanStatus : String
+typeScanStatus =
+    "scanStatus"
+
+
+typeScanResult : String
+typeScanResult =
+    "scanResult"
+
+
 valueUINT16 : String
 valueUINT16 =
     "uint16"
@@ -515,6 +689,76 @@ valueFLOAT32 =
     "float32"
 
 
+valueUINT64 : String
+valueUINT64 =
+    "uint64"
+
+
+valueINT64 : String
+valueINT64 =
+    "int64"
+
+
+valueFLOAT64 : String
+valueFLOAT64 =
+    "float64"
+
+
+valueBCD : String
+valueBCD =
+    "bcd"
+
+
+valueASCII : String
+valueASCII =
+    "ascii"
+
+
+valueBitField : String
+valueBitField =
+    "bitField"
+
+
+typeRegCount : String
+typeRegCount =
+    "regCount"
+
+
+typeUnitZero : String
+typeUnitZero =
+    "unitZero"
+
+
+typeBitMask : String
+typeBitMask =
+    "bitMask"
+
+
+typeByteOrder : String
+typeByteOrder =
+    "byteOrder"
+
+
+valueABCD : String
+valueABCD =
+    "ABCD"
+
+
+valueCDAB : String
+valueCDAB =
+    "CDAB"
+
+
+valueBADC : String
+valueBADC =
+    "BADC"
+
+
+valueDCBA : String
+valueDCBA =
+    "DCBA"
+
+
 typeClientServer : String
 typeClientServer =
     "clientServer"
@@ -530,6 +774,21 @@ valueServer =
     "server"
 
 
+valueGateway : String
+valueGateway =
+    "gateway"
+
+
+typeGatewayPort : String
+typeGatewayPort =
+    "gatewayPort"
+
+
+typeGatewayTimeout : String
+typeGatewayTimeout =
+    "gatewayTimeout"
+
+
 typeURI : String
 typeURI =
     "uri"
@@ -899,6 +1158,281 @@ typeSyncParent =
     "syncParent"
 
 
+typeQueueFile : String
+typeQueueFile =
+    "queueFile"
+
+
+typeQueueMaxCount : String
+typeQueueMaxCount =
+    "queueMaxCount"
+
+
+typeQueueMaxAge : String
+typeQueueMaxAge =
+    "queueMaxAge"
+
+
+typeExcludeNodeTypes : String
+typeExcludeNodeTypes =
+    "excludeNodeTypes"
+
+
+typeExcludeNodes : String
+typeExcludeNodes =
+    "excludeNodes"
+
+
+typeExcludePointTypes : String
+typeExcludePointTypes =
+    "excludePointTypes"
+
+
+typeExportNodes : String
+typeExportNodes =
+    "exportNodes"
+
+
+typeExportPointTypes : String
+typeExportPointTypes =
+    "exportPointTypes"
+
+
+typeIngestKey : String
+typeIngestKey =
+    "ingestKey"
+
+
+typeMappings : String
+typeMappings =
+    "mappings"
+
+
+typeDeviceIDPath : String
+typeDeviceIDPath =
+    "deviceIDPath"
+
+
+typeMaxDevices : String
+typeMaxDevices =
+    "maxDevices"
+
+
+typeRejectNewDevices : String
+typeRejectNewDevices =
+    "rejectNewDevices"
+
+
+typeTimePath : String
+typeTimePath =
+    "timePath"
+
+
+typeAllowAnonymous : String
+typeAllowAnonymous =
+    "allowAnonymous"
+
+
+typeIncludePointTypes : String
+typeIncludePointTypes =
+    "includePointTypes"
+
+
+typeSyncHighRate : String
+typeSyncHighRate =
+    "syncHighRate"
+
+
+typeCompress : String
+typeCompress =
+    "compress"
+
+
+typeByteBudget : String
+typeByteBudget =
+    "byteBudget"
+
+
+typeTelemetryPointTypes : String
+typeTelemetryPointTypes =
+    "telemetryPointTypes"
+
+
+typeBytesTx : String
+typeBytesTx =
+    "bytesTx"
+
+
+typeBytesTxReset : String
+typeBytesTxReset =
+    "bytesTxReset"
+
+
+typeBytesRx : String
+typeBytesRx =
+    "bytesRx"
+
+
+typeBytesRxReset : String
+typeBytesRxReset =
+    "bytesRxReset"
+
+
+typeBytesToday : String
+typeBytesToday =
+    "bytesToday"
+
+
+typeLastSync : String
+typeLastSync =
+    "lastSync"
+
+
+typeLatency : String
+typeLatency =
+    "latency"
+
+
+typeHashMismatch : String
+typeHashMismatch =
+    "hashMismatch"
+
+
+typeQueueDepth : String
+typeQueueDepth =
+    "queueDepth"
+
+
+typeReconnectCount : String
+typeReconnectCount =
+    "reconnectCount"
+
+
+typeReconnectCountReset : String
+typeReconnectCountReset =
+    "reconnectCountReset"
+
+
+typeConflictPolicy : String
+typeConflictPolicy =
+    "conflictPolicy"
+
+
+valueNewestWins : String
+valueNewestWins =
+    "newestWins"
+
+
+valueCloudWins : String
+valueCloudWins =
+    "cloudWins"
+
+
+valueEdgeWins : String
+valueEdgeWins =
+    "edgeWins"
+
+
+typeConflict : String
+typeConflict =
+    "conflict"
+
+
+typeConflictCount : String
+typeConflictCount =
+    "conflictCount"
+
+
+typeConflictCountReset : String
+typeConflictCountReset =
+    "conflictCountReset"
+
+
+typeMQTTUser : String
+typeMQTTUser =
+    "mqttUser"
+
+
+typeMQTTPassword : String
+typeMQTTPassword =
+    "mqttPassword"
+
+
+typeTopicPrefix : String
+typeTopicPrefix =
+    "topicPrefix"
+
+
+typeEdgeToken : String
+typeEdgeToken =
+    "edgeToken"
+
+
+valueInflux : String
+valueInflux =
+    "influx"
+
+
+valueTimescale : String
+valueTimescale =
+    "timescale"
+
+
+valuePrometheus : String
+valuePrometheus =
+    "prometheus"
+
+
+typeTagDescription : String
+typeTagDescription =
+    "tagDescription"
+
+
+typeTagNodeType : String
+typeTagNodeType =
+    "tagNodeType"
+
+
+typeTagPath : String
+typeTagPath =
+    "tagPath"
+
+
+typeTag : String
+typeTag =
+    "tag"
+
+
+typeBufferFile : String
+typeBufferFile =
+    "bufferFile"
+
+
+typeBufferMaxCount : String
+typeBufferMaxCount =
+    "bufferMaxCount"
+
+
+typeBufferMaxAge : String
+typeBufferMaxAge =
+    "bufferMaxAge"
+
+
+typeBufferDepth : String
+typeBufferDepth =
+    "bufferDepth"
+
+
+typeWriteErrorCount : String
+typeWriteErrorCount =
+    "writeErrorCount"
+
+
+typeWriteErrorCountReset : String
+typeWriteErrorCountReset =
+    "writeErrorCountReset"
+
+
 
 -- Point should match data/Point.go
 
@@ -0,0 +1,75 @@
+module Components.NodeHttpIngest exposing (view)
+
+import Api.Point as Point
+import Components.NodeOptions exposing (NodeOptions, oToInputO)
+import Element exposing (..)
+import Element.Border as Border
+import UI.Icon as Icon
+import UI.NodeInputs as NodeInputs
+import UI.Style exposing (colors)
+import UI.ViewIf exposing (viewIf)
+
+
+view : NodeOptions msg -> Element msg
+view o =
+    let
+        disabled =
+            Point.getBool o.node.points Point.typeDisable ""
+
+        key =
+            Point.getText o.node.points Point.typeIngestKey ""
+    in
+    column
+        [ width fill
+        , Border.widthEach { top = 2, bottom = 0, left = 0, right = 0 }
+        , Border.color colors.black
+        , spacing 6
+        ]
+    <|
+        wrappedRow [ spacing 10 ]
+            [ Icon.download
+            , text <|
+                Point.getText o.node.points Point.typeDescription ""
+            , viewIf disabled <| text "(disabled)"
+            ]
+            :: (if o.expDetail then
+                    let
+                        labelWidth =
+                            150
+
+                        opts =
+                            oToInputO o labelWidth
+
+                        textInput =
+                            NodeInputs.nodeTextInput opts "0"
+
+                        counterWithReset =
+                            NodeInputs.nodeCounterWithReset opts "0"
+
+                        numberInput =
+                            NodeInputs.nodeNumberInput opts "0"
+
+                        checkboxInput =
+                            NodeInputs.nodeCheckboxInput opts "0"
+
+                        ingestError =
+                            Point.getText o.node.points Point.typeError ""
+                    in
+                    [ textInput Point.typeDescription "Description" ""
+                    , textInput Point.typeIngestKey "Ingest key" "weather"
+                    , viewIf (key /= "") <| text <| "Endpoint: POST /v1/ingest/" ++ key
+                    , textInput Point.typeAuthToken "Bearer token" ""
+                    , checkboxInput Point.typeAllowAnonymous "Allow requests without token"
+                    , textInput Point.typeMappings "Mappings" "$.temp=temp, $.ch[0]=value:0"
+                    , textInput Point.typeDeviceIDPath "Device ID path" "blank to write to this node"
+                    , numberInput Point.typeMaxDevices "Max devices (0 for 100)"
+                    , checkboxInput Point.typeRejectNewDevices "Reject new devices"
+                    , textInput Point.typeTimePath "Time path" "blank for time received"
+                    , checkboxInput Point.typeDisable "Disable"
+                    , counterWithReset Point.typeErrorCount Point.typeErrorCountReset "Error count"
+                    , viewIf (ingestError /= "") <| text <| "Last error: " ++ ingestError
+                    ]
+
+                else
+                    []
+               )
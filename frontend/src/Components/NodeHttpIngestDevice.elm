@@ -0,0 +1,73 @@
+module Components.NodeHttpIngestDevice exposing (view)
+
+import Api.Point as Point
+import Components.NodeOptions exposing (NodeOptions, oToInputO)
+import Element exposing (..)
+import Element.Border as Border
+import Element.Font as Font
+import Time
+import UI.Icon as Icon
+import UI.NodeInputs as NodeInputs
+import UI.Style exposing (colors)
+import Utils.Iso8601 as Iso8601
+
+
+view : NodeOptions msg -> Element msg
+view o =
+    column
+        [ width fill
+        , Border.widthEach { top = 2, bottom = 0, left = 0, right = 0 }
+        , Border.color colors.black
+        , spacing 6
+        ]
+    <|
+        wrappedRow [ spacing 10 ]
+            [ Icon.device
+            , text <|
+                Point.getText o.node.points Point.typeDescription ""
+            ]
+            :: (if o.expDetail then
+                    let
+                        opts =
+                            oToInputO o 100
+
+                        textInput =
+                            NodeInputs.nodeTextInput opts "0"
+                    in
+                    [ textInput Point.typeDescription "Description" ""
+                    , textInput Point.typeDeviceID "Device ID" ""
+                    , viewPoints o.zone <| Point.filterSpecialPoints <| List.sortWith Point.sort o.node.points
+                    ]
+
+                else
+                    []
+               )
+
+
+viewPoints : Time.Zone -> List Point.Point -> Element msg
+viewPoints z pts =
+    table [ padding 7 ]
+        { data = pts
+        , columns =
+            let
+                cell =
+                    el [ paddingXY 15 5, Border.width 1 ]
+            in
+            [ { header = cell <| el [ Font.bold, centerX ] <| text "Time"
+              , width = fill
+              , view = \p -> cell <| text <| Iso8601.toString Iso8601.Second z p.time
+              }
+            , { header = cell <| el [ Font.bold, centerX ] <| text "Type"
+              , width = fill
+              , view = \p -> cell <| text p.typ
+              }
+            , { header = cell <| el [ Font.bold, centerX ] <| text "Key"
+              , width = fill
+              , view = \p -> cell <| text p.key
+              }
+            , { header = cell <| el [ Font.bold, centerX ] <| text "Value"
+              , width = fill
+              , view = \p -> cell <| el [ alignRight ] <| text (Point.renderPoint2 p).value
+              }
+            ]
+        }
@@ -1,11 +1,13 @@
 module Components.NodeModbus exposing (view)
 
+import Api.Node as Node exposing (NodeView)
 import Api.Point as Point
 import Components.NodeOptions exposing (NodeOptions, oToInputO)
 import Element exposing (..)
 import Element.Border as Border
+import List.Extra
 import UI.Icon as Icon
-import UI.NodeInputs as NodeInputs
+import UI.NodeInputs as NodeInputs exposing (NodeInputOptions)
 import UI.Style exposing (colors)
 import UI.ViewIf exposing (viewIf)
 
@@ -57,43 +59,97 @@ view o =
 
                         protocol =
                             Point.getText o.node.points Point.typeProtocol ""
+
+                        isSerial =
+                            protocol == Point.valueRTU || protocol == Point.valueProtocolASCII
+
+                        isNetwork =
+                            protocol == Point.valueTCP || protocol == Point.valueUDP
+
+                        profiles =
+                            o.node.points
+                                |> List.filter
+                                    (\p ->
+                                        p.typ == Point.typeModbusProfiles && p.tombstone == 0
+                                    )
+                                |> List.map (\p -> ( p.key, p.text ))
+                                |> List.sortBy Tuple.second
                     in
                     [ textInput Point.typeDescription "Description" ""
                     , optionInput Point.typeClientServer
                         "Client/Server"
                         [ ( Point.valueClient, "client" )
                         , ( Point.valueServer, "server" )
+                        , ( Point.valueGateway, "TCP to RTU gateway" )
                         ]
                     , optionInput Point.typeProtocol
                         "Protocol"
                         [ ( Point.valueRTU, "RTU" )
                         , ( Point.valueTCP, "TCP" )
+                        , ( Point.valueProtocolASCII, "ASCII" )
+                        , ( Point.valueRTUOverTCP, "RTU over TCP" )
+                        , ( Point.valueUDP, "UDP" )
                         ]
-                    , viewIf
-                        (protocol == Point.valueRTU)
-                      <|
+                    , viewIf isSerial <|
                         textInput Point.typePort "Port" "/dev/ttyUSB0"
                     , viewIf
-                        (protocol
-                            == Point.valueTCP
+                        (isNetwork
                             && clientServer
                             == Point.valueServer
                         )
                       <|
                         textInput Point.typePort "Port" "502"
                     , viewIf
-                        (protocol
-                            == Point.valueTCP
+                        ((isNetwork
                             && clientServer
                             == Point.valueClient
+                         )
+                            || protocol
+                            == Point.valueRTUOverTCP
                         )
                       <|
                         textInput Point.typeURI "URI" "192.168.1.201:502"
-                    , viewIf (protocol == Point.valueRTU) <| textInput Point.typeBaud "Baud" "9600"
+                    , viewIf isSerial <| textInput Point.typeBaud "Baud" "9600"
+                    , viewIf (clientServer == Point.valueGateway) <|
+                        textInput Point.typeGatewayPort "Gateway TCP port" "502"
+                    , viewIf (clientServer == Point.valueGateway) <|
+                        numberInput Point.typeGatewayTimeout "Gateway timeout (ms)"
                     , viewIf (clientServer == Point.valueServer) <|
                         numberInput Point.typeID "Device ID"
                     , viewIf (clientServer == Point.valueClient) <|
                         numberInput Point.typePollPeriod "Poll period (ms)"
+                    , viewIf (clientServer == Point.valueClient) <|
+                        numberInput Point.typePollMaxGap "Max poll gap (regs)"
+                    , viewIf (clientServer == Point.valueClient) <|
+                        numberInput Point.typePollMaxCount "Max regs per poll (0 for max)"
+                    , viewIf (clientServer == Point.valueClient) <|
+                        viewDevicePollLimits opts o.children
+                    , viewIf (List.length profiles > 0) <|
+                        optionInput Point.typeModbusProfile "Device profile" profiles
+                    , viewIf (List.length profiles > 0) <|
+                        numberInput Point.typeModbusProfileId "Profile device ID"
+                    , viewIf (List.length profiles > 0) <|
+                        checkboxInput Point.typeModbusProfileCreate "Create profile IOs"
+                    , viewIf (clientServer == Point.valueClient) <|
+                        numberInput Point.typeScanIdStart "Scan start ID"
+                    , viewIf (clientServer == Point.valueClient) <|
+                        numberInput Point.typeScanIdEnd "Scan end ID"
+                    , viewIf (clientServer == Point.valueClient) <|
+                        optionInput Point.typeScanIoType
+                            "Scan IO type"
+                            [ ( Point.valueModbusHoldingRegister, "holding register" )
+                            , ( Point.valueModbusInputRegister, "input register" )
+                            , ( Point.valueModbusCoil, "coil" )
+                            , ( Point.valueModbusDiscreteInput, "discrete input" )
+                            ]
+                    , viewIf (clientServer == Point.valueClient) <|
+                        numberInput Point.typeScanAddress "Scan address"
+                    , viewIf (clientServer == Point.valueClient && isSerial) <|
+                        textInput Point.typeScanBauds "Scan bauds" "9600,19200,38400"
+                    , viewIf (clientServer == Point.valueClient) <|
+                        checkboxInput Point.typeScanStart "Scan bus"
+                    , viewIf (clientServer == Point.valueClient) <|
+                        viewScanResults o.node.points
                     , numberInput Point.typeDebug "Debug level (0-9)"
                     , checkboxInput Point.typeDisable "Disable"
                     , counterWithReset Point.typeErrorCount Point.typeErrorCountReset "Error Count"
@@ -104,3 +160,72 @@ view o =
                 else
                     []
                )
+
+
+viewDevicePollLimits : NodeInputOptions msg -> List NodeView -> Element msg
+viewDevicePollLimits opts children =
+    let
+        -- poll limits are keyed by device ID, key "0" is the bus default
+        deviceIDs =
+            children
+                |> List.map .node
+                |> List.filter (\n -> n.typ == Node.typeModbusIO)
+                |> List.map (\n -> round <| Point.getValue n.points Point.typeID "")
+                |> List.filter (\id -> id > 0)
+                |> List.Extra.unique
+                |> List.sort
+
+        deviceInputs id =
+            let
+                key =
+                    String.fromInt id
+            in
+            [ NodeInputs.nodeNumberInput opts key Point.typePollMaxGap <|
+                "Device "
+                    ++ key
+                    ++ " max poll gap"
+            , NodeInputs.nodeNumberInput opts key Point.typePollMaxCount <|
+                "Device "
+                    ++ key
+                    ++ " max regs per poll"
+            ]
+    in
+    viewIf (List.length deviceIDs > 0) <|
+        column [ spacing 6 ] <|
+            List.concatMap deviceInputs deviceIDs
+
+
+viewScanResults : List Point.Point -> Element msg
+viewScanResults points =
+    let
+        status =
+            Point.getText points Point.typeScanStatus ""
+
+        results =
+            points
+                |> List.filter
+                    (\p ->
+                        p.typ == Point.typeScanResult && p.tombstone == 0
+                    )
+                |> List.sortBy (\p -> String.toInt p.key |> Maybe.withDefault 0)
+
+        resultText p =
+            "ID "
+                ++ p.key
+                ++ (if p.value > 0 then
+                        ", " ++ String.fromFloat p.value ++ " baud"
+
+                    else
+                        ""
+                   )
+                ++ (if p.text /= "" then
+                        ", exception: " ++ p.text
+
+                    else
+                        ""
+                   )
+    in
+    viewIf (status /= "" || List.length results > 0) <|
+        column [ spacing 6, paddingEach { top = 0, bottom = 0, right = 0, left = 20 } ] <|
+            text ("Scan: " ++ status)
+                :: List.map (\p -> text (resultText p)) results
@@ -27,6 +27,14 @@ view o =
                 Nothing ->
                     False
 
+        isServer =
+            case o.parent of
+                Just p ->
+                    Point.getText p.points Point.typeClientServer "" == Point.valueServer
+
+                Nothing ->
+                    False
+
         isWrite =
             modbusIOType
                 == Point.valueModbusHoldingRegister
@@ -48,8 +56,25 @@ view o =
         isReadOnly =
             Point.getValue o.node.points Point.typeReadOnly "" == 1
 
+        dataFormat =
+            Point.getText o.node.points Point.typeDataFormat ""
+
+        isASCII =
+            isRegister && dataFormat == Point.valueASCII
+
+        cmdPending =
+            if isASCII then
+                Point.getText o.node.points Point.typeValueSet "" /= ""
+                    && Point.getText o.node.points Point.typeValueSet "" /= valueText
+
+            else
+                value /= valueSet
+
         valueText =
-            if isRegister then
+            if isASCII then
+                Point.getText o.node.points Point.typeValue ""
+
+            else if isRegister then
                 String.fromFloat (Round.roundNum 2 value)
 
             else if value == 0 then
@@ -97,7 +122,7 @@ view o =
                                 ""
                            )
             , text <|
-                if isClient && isWrite && not isReadOnly && value /= valueSet then
+                if isClient && isWrite && not isReadOnly && cmdPending then
                     " (cmd pending)"
 
                 else
@@ -132,6 +157,9 @@ view o =
                     in
                     [ textInput Point.typeDescription "Description" ""
                     , viewIf isClient <| numberInput Point.typeID "ID"
+                    , viewIf isServer <| numberInput Point.typeID "ID (0 for bus ID)"
+                    , viewIf (isServer && Point.getValue o.node.points Point.typeID "" == 0) <|
+                        checkboxInput Point.typeUnitZero "Use unit 0, not the bus ID"
                     , numberInput Point.typeAddress "Address"
                     , optionInput Point.typeModbusIOType
                         "IO type"
@@ -156,7 +184,25 @@ view o =
                             , ( Point.valueUINT32, "UINT32" )
                             , ( Point.valueINT32, "INT32" )
                             , ( Point.valueFLOAT32, "FLOAT32" )
+                            , ( Point.valueUINT64, "UINT64" )
+                            , ( Point.valueINT64, "INT64" )
+                            , ( Point.valueFLOAT64, "FLOAT64" )
+                            , ( Point.valueBCD, "BCD" )
+                            , ( Point.valueASCII, "ASCII" )
+                            , ( Point.valueBitField, "Bit field" )
+                            ]
+                    , viewIf (isRegister && dataFormat /= Point.valueBitField) <|
+                        optionInput Point.typeByteOrder
+                            "Byte order"
+                            [ ( Point.valueABCD, "ABCD (big endian)" )
+                            , ( Point.valueCDAB, "CDAB (word swap)" )
+                            , ( Point.valueBADC, "BADC (byte swap)" )
+                            , ( Point.valueDCBA, "DCBA (little endian)" )
                             ]
+                    , viewIf (isRegister && (dataFormat == Point.valueBCD || dataFormat == Point.valueASCII)) <|
+                        numberInput Point.typeRegCount "Register count"
+                    , viewIf (isRegister && dataFormat == Point.valueBitField) <|
+                        numberInput Point.typeBitMask "Bit mask (decimal)"
 
                     -- This can get a little confusing, but client sets the following:
                     --   * coil
@@ -172,9 +218,19 @@ view o =
                             && modbusIOType
                             == Point.valueModbusHoldingRegister
                             && not isReadOnly
+                            && not isASCII
                         )
                       <|
                         numberInput Point.typeValueSet "Value"
+                    , viewIf
+                        (isClient
+                            && modbusIOType
+                            == Point.valueModbusHoldingRegister
+                            && not isReadOnly
+                            && isASCII
+                        )
+                      <|
+                        textInput Point.typeValueSet "Value" ""
                     , viewIf
                         (isClient
                             && modbusIOType
@@ -7,7 +7,9 @@ import Element.Border as Border
 import UI.Icon as Icon
 import UI.NodeInputs as NodeInputs
 import UI.Style exposing (colors)
+import Time
 import UI.ViewIf exposing (viewIf)
+import Utils.Iso8601 as Iso8601
 
 
 view : NodeOptions msg -> Element msg
@@ -45,13 +47,64 @@ view o =
 
                         counterWithReset =
                             NodeInputs.nodeCounterWithReset opts "0"
+
+                        optionInput =
+                            NodeInputs.nodeOptionInput opts "0"
+
+                        lastSyncValue =
+                            Point.getValue o.node.points Point.typeLastSync ""
+
+                        lastSync =
+                            if lastSyncValue == 0 then
+                                "never"
+
+                            else
+                                Iso8601.toDateTimeString o.zone (Time.millisToPosix (round (lastSyncValue * 1000)))
                     in
                     [ textInput Point.typeDescription "Description" ""
-                    , textInput Point.typeURI "URI" "nats://myserver:4222, ws://myserver"
+                    , textInput Point.typeURI "URI" "nats://myserver:4222, ws://myserver, mqtt://broker:1883"
                     , textInput Point.typeAuthToken "Auth Token" ""
+                    , textInput Point.typeMQTTUser "MQTT user" ""
+                    , textInput Point.typeMQTTPassword "MQTT password" ""
+                    , textInput Point.typeTopicPrefix "MQTT topic prefix" "siot"
                     , textNumber Point.typePeriod "Sync Period (s)"
                     , checkboxInput Point.typeDisable "Disable"
                     , counterWithReset Point.typeSyncCount Point.typeSyncCountReset "Sync Count"
+                    , textInput Point.typeQueueFile "Queue file" "/var/lib/siot/sync-queue.sqlite"
+                    , textNumber Point.typeQueueMaxCount "Queue max messages (0 for 100000)"
+                    , textNumber Point.typeQueueMaxAge "Queue max age (hours, 0 for 168)"
+                    , textInput Point.typeExcludeNodeTypes "Exclude node types" "metrics, serialDev"
+                    , textInput Point.typeExcludeNodes "Exclude node IDs" ""
+                    , textInput Point.typeExcludePointTypes "Exclude point types" "log"
+                    , textInput Point.typeIncludePointTypes "Only sync point types" ""
+                    , checkboxInput Point.typeSyncHighRate "Sync high rate points"
+                    , textNumber Point.typeBatchPeriod "Batch period (ms)"
+                    , checkboxInput Point.typeCompress "Compress"
+                    , textNumber Point.typeByteBudget "Daily byte budget"
+                    , textInput Point.typeTelemetryPointTypes "Telemetry point types" "value, temp"
+                    , counterWithReset Point.typeBytesTx Point.typeBytesTxReset "Bytes sent"
+                    , counterWithReset Point.typeBytesRx Point.typeBytesRxReset "Bytes received"
+                    , text <| "Bytes today: " ++ String.fromFloat (Point.getValue o.node.points Point.typeBytesToday "0")
+                    , optionInput Point.typeConflictPolicy
+                        "Conflict policy"
+                        [ ( Point.valueNewestWins, "newest wins" )
+                        , ( Point.valueCloudWins, "cloud wins" )
+                        , ( Point.valueEdgeWins, "edge wins" )
+                        ]
+                    , counterWithReset Point.typeConflictCount Point.typeConflictCountReset "Conflict count"
+                    , counterWithReset Point.typeReconnectCount Point.typeReconnectCountReset "Reconnect count"
+                    , text <|
+                        "Connected: "
+                            ++ (if Point.getBool o.node.points Point.typeConnected "" then
+                                    "yes"
+
+                                else
+                                    "no"
+                               )
+                    , text <| "Last sync: " ++ lastSync
+                    , text <| "Latency (ms): " ++ String.fromFloat (Point.getValue o.node.points Point.typeLatency "")
+                    , text <| "Nodes out of sync: " ++ String.fromFloat (Point.getValue o.node.points Point.typeHashMismatch "")
+                    , text <| "Queue depth: " ++ String.fromFloat (Point.getValue o.node.points Point.typeQueueDepth "")
                     ]
 
                 else
@@ -11,8 +11,11 @@ import Components.NodeCanBus as NodeCanBus
 import Components.NodeCondition as NodeCondition
 import Components.NodeDb as NodeDb
 import Components.NodeDevice as NodeDevice
+import Components.NodeExporter as NodeExporter
 import Components.NodeFile as File
 import Components.NodeGroup as NodeGroup
+import Components.NodeHttpIngest as NodeHttpIngest
+import Components.NodeHttpIngestDevice as NodeHttpIngestDevice
 import Components.NodeMessageService as NodeMessageService
 import Components.NodeMetrics as NodeMetrics
 import Components.NodeModbus as NodeModbus
@@ -31,6 +34,7 @@ import Components.NodeShelly as NodeShelly
 import Components.NodeShellyIO as NodeShellyIO
 import Components.NodeSignalGenerator as SignalGenerator
 import Components.NodeSync as NodeSync
+import Components.NodeSyncMqtt as NodeSyncMqtt
 import Components.NodeUser as NodeUser
 import Components.NodeVariable as NodeVariable
 import Dict
@@ -1198,6 +1202,9 @@ shouldDisplay typ =
         "sync" ->
             True
 
+        "syncMqtt" ->
+            True
+
         "oneWire" ->
             True
 
@@ -1207,6 +1214,9 @@ shouldDisplay typ =
         "db" ->
             True
 
+        "exporter" ->
+            True
+
         "particle" ->
             True
 
@@ -1231,6 +1241,12 @@ shouldDisplay typ =
         "ntp" ->
             True
 
+        "httpIngest" ->
+            True
+
+        "httpIngestDevice" ->
+            True
+
         _ ->
             False
 
@@ -1294,9 +1310,21 @@ viewNode model parent node children depth =
                 "sync" ->
                     NodeSync.view
 
+                "syncMqtt" ->
+                    NodeSyncMqtt.view
+
                 "db" ->
                     NodeDb.view
 
+                "exporter" ->
+                    NodeExporter.view
+
+                "httpIngest" ->
+                    NodeHttpIngest.view
+
+                "httpIngestDevice" ->
+                    NodeHttpIngestDevice.view
+
                 "particle" ->
                     NodeParticle.view
 
@@ -1520,6 +1548,21 @@ nodeDescMsgService =
     row [] [ Icon.send, text "Messaging Service" ]
 
 
+nodeDescExporter : Element Msg
+nodeDescExporter =
+    row [] [ Icon.barChart, text "Metrics exporter" ]
+
+
+nodeDescHttpIngest : Element Msg
+nodeDescHttpIngest =
+    row [] [ Icon.download, text "HTTP ingest" ]
+
+
+nodeDescHttpIngestDevice : Element Msg
+nodeDescHttpIngestDevice =
+    row [] [ Icon.device, text "HTTP ingest device" ]
+
+
 nodeDescDb : Element Msg
 nodeDescDb =
     row [] [ Icon.database, text "Database" ]
@@ -1555,6 +1598,11 @@ nodeDescSync =
     row [] [ Icon.sync, text "sync" ]
 
 
+nodeDescSyncMqtt : Element Msg
+nodeDescSyncMqtt =
+    row [] [ Icon.sync, text "MQTT sync server" ]
+
+
 nodeDescCondition : Element Msg
 nodeDescCondition =
     row [] [ Icon.check, text "Condition" ]
@@ -1609,12 +1657,15 @@ viewAddNode parent add =
                     , Input.option Node.typeCanBus nodeDescCanBus
                     , Input.option Node.typeMsgService nodeDescMsgService
                     , Input.option Node.typeDb nodeDescDb
+                    , Input.option Node.typeExporter nodeDescExporter
+                    , Input.option Node.typeHttpIngest nodeDescHttpIngest
                     , Input.option Node.typeParticle nodeDescParticle
                     , Input.option Node.typeShelly nodeDescShelly
                     , Input.option Node.typeVariable nodeDescVariable
                     , Input.option Node.typeSignalGenerator nodeDescSignalGenerator
                     , Input.option Node.typeFile nodeDescFile
                     , Input.option Node.typeSync nodeDescSync
+                    , Input.option Node.typeSyncMqtt nodeDescSyncMqtt
                     , Input.option Node.typeMetrics nodeDescMetrics
                     ]
 
@@ -1630,6 +1681,8 @@ viewAddNode parent add =
                             , Input.option Node.typeCanBus nodeDescCanBus
                             , Input.option Node.typeMsgService nodeDescMsgService
                             , Input.option Node.typeDb nodeDescDb
+                            , Input.option Node.typeExporter nodeDescExporter
+                            , Input.option Node.typeHttpIngest nodeDescHttpIngest
                             , Input.option Node.typeParticle nodeDescParticle
                             , Input.option Node.typeShelly nodeDescShelly
                             , Input.option Node.typeVariable nodeDescVariable
@@ -1643,6 +1696,12 @@ viewAddNode parent add =
                     ++ (if parent.node.typ == Node.typeModbus then
                             [ Input.option Node.typeModbusIO nodeDescModbusIO ]
 
+                        else
+                            []
+                       )
+                    ++ (if parent.node.typ == Node.typeHttpIngest then
+                            [ Input.option Node.typeHttpIngestDevice nodeDescHttpIngestDevice ]
+
                         else
                             []
                        )
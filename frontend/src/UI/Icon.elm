@@ -11,6 +11,7 @@ module UI.Icon exposing
     , cloudOff
     , database
     , device
+    , download
     , file
     , io
     , list
@@ -252,6 +253,11 @@ barChart =
     icon FeatherIcons.barChart2
 
 
+download : Element msg
+download =
+    icon FeatherIcons.download
+
+
 file : Element msg
 file =
     icon FeatherIcons.file
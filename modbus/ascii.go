@@ -2,10 +2,13 @@ package modbus
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
+	"strings"
+	"time"
 )
 
 const (
@@ -36,6 +39,128 @@ func (m *Modbus) Read() ([]byte, error) {
 	return m.bufRead.ReadBytes(0xA)
 }
 
+// ErrLRC is returned when the LRC of an ASCII frame is not correct
+var ErrLRC = errors.New("LRC check failed")
+
+// ErrInterCharTimeout is returned when the time between characters in an
+// ASCII frame is longer than the inter-character timeout
+var ErrInterCharTimeout = errors.New("inter-character timeout")
+
+// ASCII defines a Modbus ASCII connection
+type ASCII struct {
+	port             io.ReadWriteCloser
+	interCharTimeout time.Duration
+}
+
+// NewASCII creates a new ASCII transport. Reads from port should time out
+// (return io.EOF) if no data is received, and return data as it arrives,
+// for example a respreader with a short chunk timeout. The Modbus spec
+// allows up to 1s between characters in a frame, but this can be reduced
+// with interCharTimeout to detect broken frames sooner.
+func NewASCII(port io.ReadWriteCloser, interCharTimeout time.Duration) *ASCII {
+	return &ASCII{
+		port:             port,
+		interCharTimeout: interCharTimeout,
+	}
+}
+
+// Read reads one ASCII frame, starting with ':' and ending with CR LF.
+// Anything received before the start character is discarded.
+func (a *ASCII) Read(p []byte) (int, error) {
+	var frame []byte
+	buf := make([]byte, asciiMaxSize)
+	lastRx := time.Now()
+
+	for {
+		cnt, err := a.port.Read(buf)
+
+		if len(frame) > 0 && time.Since(lastRx) > a.interCharTimeout {
+			return 0, ErrInterCharTimeout
+		}
+
+		if cnt > 0 {
+			lastRx = time.Now()
+			frame = append(frame, buf[:cnt]...)
+
+			start := bytes.IndexByte(frame, asciiStart)
+			if start < 0 {
+				frame = frame[:0]
+			} else {
+				frame = frame[start:]
+			}
+
+			if bytes.HasSuffix(frame, []byte(asciiEnd)) {
+				if len(frame) > len(p) {
+					return 0, errors.New("buffer too small for ASCII frame")
+				}
+				return copy(p, frame), nil
+			}
+
+			if len(frame) > asciiMaxSize {
+				return 0, errors.New("ASCII frame is too long")
+			}
+		}
+
+		if err != nil && (err != io.EOF || len(frame) == 0) {
+			return 0, err
+		}
+	}
+}
+
+func (a *ASCII) Write(p []byte) (int, error) {
+	return a.port.Write(p)
+}
+
+// Close closes the serial port
+func (a *ASCII) Close() error {
+	return a.port.Close()
+}
+
+// Encode encodes an ASCII frame
+func (a *ASCII) Encode(id byte, pdu PDU) ([]byte, error) {
+	adu := make([]byte, 0, len(pdu.Data)+3)
+	adu = append(adu, id, byte(pdu.FunctionCode))
+	adu = append(adu, pdu.Data...)
+	adu = append(adu, asciiLRC(adu))
+
+	ret := make([]byte, 0, 1+2*len(adu)+2)
+	ret = append(ret, asciiStart)
+	ret = append(ret, strings.ToUpper(hex.EncodeToString(adu))...)
+	ret = append(ret, asciiEnd...)
+
+	if len(ret) > asciiMaxSize {
+		return nil, errors.New("ASCII frame is too long")
+	}
+
+	return ret, nil
+}
+
+// Decode decodes an ASCII frame
+func (a *ASCII) Decode(packet []byte) (byte, PDU, error) {
+	adu, err := DecodeASCIIPDU(packet)
+	if err != nil {
+		return 0, PDU{}, err
+	}
+
+	return adu.Address, PDU{FunctionCode: adu.FunctionCode, Data: adu.Data}, nil
+}
+
+// Type returns TransportType
+func (a *ASCII) Type() TransportType {
+	return TransportTypeASCII
+}
+
+// asciiLRC returns the longitudinal redundancy check of the binary frame
+// data, which is the two's complement of the sum of the bytes
+func asciiLRC(data []byte) byte {
+	var sum byte
+	for _, b := range data {
+		sum += b
+	}
+
+	return -sum
+}
+
 // ASCIIADU is a modbus protocol data unit
 type ASCIIADU struct {
 	Address      byte
@@ -199,7 +324,7 @@ func DecodeASCIIPDU(data []byte) (ret ASCIIADU, err error) {
 	}
 
 	if !ret.CheckLRC() {
-		err = errors.New("LRC check failed")
+		err = ErrLRC
 	}
 
 	return
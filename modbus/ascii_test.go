@@ -5,6 +5,10 @@ import (
 	"fmt"
 	"reflect"
 	"testing"
+	"time"
+
+	"github.com/simpleiot/simpleiot/respreader"
+	"github.com/simpleiot/simpleiot/test"
 )
 
 // the below data is Modbus ASCII
@@ -222,3 +226,110 @@ func TestASCIIDecode3(t *testing.T) {
 	}
 
 }
+
+func TestASCIIEncode(t *testing.T) {
+	a := NewASCII(nil, time.Second)
+
+	packet, err := a.Encode(3, ReadHoldingRegs(0, 6))
+	if err != nil {
+		t.Fatal("error encoding: ", err)
+	}
+
+	if !bytes.Equal(packet, testData1) {
+		t.Fatalf("wrong packet, got %q, expected %q", packet, testData1)
+	}
+
+	id, pdu, err := a.Decode(testData2)
+	if err != nil {
+		t.Fatal("error decoding: ", err)
+	}
+
+	regs, err := pdu.RespReadRegs()
+	if err != nil {
+		t.Fatal("error decoding regs: ", err)
+	}
+
+	if id != 3 || len(regs) != 6 {
+		t.Fatalf("wrong response, id: %v, regs: %v", id, regs)
+	}
+
+	bad := bytes.Replace(testData1, []byte("F4"), []byte("F5"), 1)
+	_, _, err = a.Decode(bad)
+	if err != ErrLRC {
+		t.Fatal("expected LRC error, got: ", err)
+	}
+}
+
+func TestASCIIEndToEnd(t *testing.T) {
+	a, b := test.NewIoSim()
+
+	regs := &Regs{}
+	regs.AddReg(2, 1)
+	err := regs.WriteReg(2, 0x1234)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	portA := respreader.NewReadWriteCloser(a, time.Second*2, 5*time.Millisecond)
+	server := NewServer(1, NewASCII(portA, time.Second), regs, 0)
+	go server.Listen(func(err error) {
+		t.Log("modbus server listen error: ", err)
+	}, func() {}, func() {})
+	defer server.Close()
+
+	portB := respreader.NewReadWriteCloser(b, time.Second, 5*time.Millisecond)
+	client := NewClient(NewASCII(portB, time.Second), 0)
+
+	hr, err := client.ReadHoldingRegs(1, 2, 1)
+	if err != nil {
+		t.Fatal("read holding regs returned err: ", err)
+	}
+
+	if len(hr) != 1 || hr[0] != 0x1234 {
+		t.Fatal("wrong value: ", hr)
+	}
+
+	err = client.WriteMultipleRegs(1, 2, []uint16{0x5678})
+	if err != nil {
+		t.Fatal("write multiple regs returned err: ", err)
+	}
+
+	v, _ := regs.ReadReg(2)
+	if v != 0x5678 {
+		t.Fatalf("reg not written, got 0x%x", v)
+	}
+}
+
+func TestASCIIInterCharTimeout(t *testing.T) {
+	a, b := test.NewIoSim()
+
+	portB := respreader.NewReadWriteCloser(b, time.Second, 5*time.Millisecond)
+	transport := NewASCII(portB, 50*time.Millisecond)
+
+	go func() {
+		// noise before the start char is ignored, then the frame is
+		// broken by a long gap
+		_, _ = a.Write([]byte("xx:0103"))
+		time.Sleep(200 * time.Millisecond)
+		_, _ = a.Write([]byte("00020001F9\r\n"))
+	}()
+
+	buf := make([]byte, 100)
+	_, err := transport.Read(buf)
+	if err != ErrInterCharTimeout {
+		t.Fatal("expected inter-character timeout, got: ", err)
+	}
+
+	go func() {
+		_, _ = a.Write([]byte("xx:010300020001F9\r\n"))
+	}()
+
+	cnt, err := transport.Read(buf)
+	if err != nil {
+		t.Fatal("read error: ", err)
+	}
+
+	if string(buf[:cnt]) != ":010300020001F9\r\n" {
+		t.Fatalf("wrong frame: %q", buf[:cnt])
+	}
+}
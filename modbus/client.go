@@ -56,8 +56,7 @@ func (c *Client) ReadCoils(id byte, coil, count uint16) ([]bool, error) {
 		return ret, err
 	}
 
-	// FIXME, what is max modbus packet size?
-	buf := make([]byte, 200)
+	buf := make([]byte, maxADUSize)
 	cnt, err := c.transport.Read(buf)
 	if err != nil {
 		return ret, err
@@ -78,7 +77,11 @@ func (c *Client) ReadCoils(id byte, coil, count uint16) ([]bool, error) {
 		fmt.Printf("Modbus client Readcoils ID:0x%x resp:%v\n", id, resp)
 	}
 
-	return resp.RespReadBits()
+	if resp.FunctionCode == req.FunctionCode|0x80 {
+		return ret, resp.RespException()
+	}
+
+	return resp.respReadBitCount(int(count))
 }
 
 // WriteSingleCoil is used to read modbus coils
@@ -101,8 +104,7 @@ func (c *Client) WriteSingleCoil(id byte, coil uint16, v bool) error {
 		return err
 	}
 
-	// FIXME, what is max modbus packet size?
-	buf := make([]byte, 200)
+	buf := make([]byte, maxADUSize)
 	cnt, err := c.transport.Read(buf)
 	if err != nil {
 		return err
@@ -123,6 +125,10 @@ func (c *Client) WriteSingleCoil(id byte, coil uint16, v bool) error {
 		fmt.Printf("Modbus client WriteSingleCoil ID:0x%x resp:%v\n", id, resp)
 	}
 
+	if resp.FunctionCode == req.FunctionCode|0x80 {
+		return resp.RespException()
+	}
+
 	if resp.FunctionCode != req.FunctionCode {
 		return errors.New("resp contains wrong function code")
 	}
@@ -155,8 +161,7 @@ func (c *Client) ReadDiscreteInputs(id byte, input, count uint16) ([]bool, error
 		return ret, err
 	}
 
-	// FIXME, what is max modbus packet size?
-	buf := make([]byte, 200)
+	buf := make([]byte, maxADUSize)
 	cnt, err := c.transport.Read(buf)
 	if err != nil {
 		return ret, err
@@ -177,11 +182,15 @@ func (c *Client) ReadDiscreteInputs(id byte, input, count uint16) ([]bool, error
 		fmt.Printf("Modbus client ReadDiscreteInputs ID:0x%x resp:%v\n", id, resp)
 	}
 
+	if resp.FunctionCode == req.FunctionCode|0x80 {
+		return []bool{}, resp.RespException()
+	}
+
 	if resp.FunctionCode != req.FunctionCode {
 		return []bool{}, errors.New("resp contains wrong function code")
 	}
 
-	return resp.RespReadBits()
+	return resp.respReadBitCount(int(count))
 }
 
 // ReadHoldingRegs is used to read modbus coils
@@ -205,8 +214,7 @@ func (c *Client) ReadHoldingRegs(id byte, reg, count uint16) ([]uint16, error) {
 		return ret, err
 	}
 
-	// FIXME, what is max modbus packet size?
-	buf := make([]byte, 200)
+	buf := make([]byte, maxADUSize)
 	cnt, err := c.transport.Read(buf)
 	if err != nil {
 		return ret, err
@@ -227,6 +235,10 @@ func (c *Client) ReadHoldingRegs(id byte, reg, count uint16) ([]uint16, error) {
 		fmt.Printf("Modbus client ReadHoldingRegs ID:0x%x resp:%v\n", id, resp)
 	}
 
+	if resp.FunctionCode == req.FunctionCode|0x80 {
+		return []uint16{}, resp.RespException()
+	}
+
 	if resp.FunctionCode != req.FunctionCode {
 		return []uint16{}, errors.New("resp contains wrong function code")
 	}
@@ -255,8 +267,7 @@ func (c *Client) ReadInputRegs(id byte, reg, count uint16) ([]uint16, error) {
 		return ret, err
 	}
 
-	// FIXME, what is max modbus packet size?
-	buf := make([]byte, 200)
+	buf := make([]byte, maxADUSize)
 	cnt, err := c.transport.Read(buf)
 	if err != nil {
 		return ret, err
@@ -277,6 +288,10 @@ func (c *Client) ReadInputRegs(id byte, reg, count uint16) ([]uint16, error) {
 		fmt.Printf("Modbus client ReadInputRegs ID:0x%x resp:%v\n", id, resp)
 	}
 
+	if resp.FunctionCode == req.FunctionCode|0x80 {
+		return []uint16{}, resp.RespException()
+	}
+
 	if resp.FunctionCode != req.FunctionCode {
 		return []uint16{}, errors.New("resp contains wrong function code")
 	}
@@ -304,8 +319,7 @@ func (c *Client) WriteSingleReg(id byte, reg, value uint16) error {
 		return err
 	}
 
-	// FIXME, what is max modbus packet size?
-	buf := make([]byte, 200)
+	buf := make([]byte, maxADUSize)
 	cnt, err := c.transport.Read(buf)
 	if err != nil {
 		return err
@@ -326,6 +340,10 @@ func (c *Client) WriteSingleReg(id byte, reg, value uint16) error {
 		fmt.Printf("Modbus client WriteSingleReg ID:0x%x resp:%v\n", id, resp)
 	}
 
+	if resp.FunctionCode == req.FunctionCode|0x80 {
+		return resp.RespException()
+	}
+
 	if resp.FunctionCode != req.FunctionCode {
 		return errors.New("resp contains wrong function code")
 	}
@@ -336,3 +354,142 @@ func (c *Client) WriteSingleReg(id byte, reg, value uint16) error {
 
 	return nil
 }
+
+// WriteMultipleCoils writes multiple coils starting at coil
+func (c *Client) WriteMultipleCoils(id byte, coil uint16, values []bool) error {
+	if len(values) < 1 || len(values) > 1968 {
+		return fmt.Errorf("invalid coil count: %v", len(values))
+	}
+
+	req := WriteMultipleCoils(coil, values)
+	resp, err := c.request("WriteMultipleCoils", id, req)
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(req.Data[:4], resp.Data) {
+		return errors.New("Did not get the correct response data")
+	}
+
+	return nil
+}
+
+// WriteMultipleRegs writes multiple holding registers in one transaction.
+// This should be used for values that span more than one register so all
+// registers are updated at once.
+func (c *Client) WriteMultipleRegs(id byte, reg uint16, values []uint16) error {
+	if len(values) < 1 || len(values) > 123 {
+		return fmt.Errorf("invalid register count: %v", len(values))
+	}
+
+	req := WriteMultipleRegs(reg, values)
+	resp, err := c.request("WriteMultipleRegs", id, req)
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(req.Data[:4], resp.Data) {
+		return errors.New("Did not get the correct response data")
+	}
+
+	return nil
+}
+
+// MaskWriteReg modifies bits in a holding register. The new register value
+// is (current AND andMask) OR (orMask AND (NOT andMask)).
+func (c *Client) MaskWriteReg(id byte, reg, andMask, orMask uint16) error {
+	req := MaskWriteReg(reg, andMask, orMask)
+	resp, err := c.request("MaskWriteReg", id, req)
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(req.Data, resp.Data) {
+		return errors.New("Did not get the correct response data")
+	}
+
+	return nil
+}
+
+// ReadWriteMultipleRegs writes holding registers and then reads holding
+// registers in one transaction
+func (c *Client) ReadWriteMultipleRegs(id byte, readReg, readCount, writeReg uint16,
+	values []uint16) ([]uint16, error) {
+	if readCount < 1 || readCount > 125 {
+		return []uint16{}, fmt.Errorf("invalid read register count: %v", readCount)
+	}
+
+	if len(values) < 1 || len(values) > 121 {
+		return []uint16{}, fmt.Errorf("invalid write register count: %v", len(values))
+	}
+
+	req := ReadWriteMultipleRegs(readReg, readCount, writeReg, values)
+	resp, err := c.request("ReadWriteMultipleRegs", id, req)
+	if err != nil {
+		return []uint16{}, err
+	}
+
+	return resp.RespReadRegs()
+}
+
+// ReadFIFOQueue reads the values in a FIFO queue
+func (c *Client) ReadFIFOQueue(id byte, reg uint16) ([]uint16, error) {
+	resp, err := c.request("ReadFIFOQueue", id, ReadFIFOQueue(reg))
+	if err != nil {
+		return []uint16{}, err
+	}
+
+	return resp.RespReadFIFOQueue()
+}
+
+// request sends a request to a server and returns the response. Exception
+// responses are returned as an ExceptionCode error.
+func (c *Client) request(name string, id byte, req PDU) (PDU, error) {
+	if c.debug >= 1 {
+		fmt.Printf("Modbus client %v ID:0x%x req:%v\n", name, id, req)
+	}
+	packet, err := c.transport.Encode(id, req)
+	if err != nil {
+		return PDU{}, err
+	}
+
+	if c.debug >= 9 {
+		fmt.Printf("Modbus client %v tx: %v\n", name, test.HexDump(packet))
+	}
+
+	_, err = c.transport.Write(packet)
+	if err != nil {
+		return PDU{}, err
+	}
+
+	buf := make([]byte, maxADUSize)
+	cnt, err := c.transport.Read(buf)
+	if err != nil {
+		return PDU{}, err
+	}
+
+	buf = buf[:cnt]
+
+	if c.debug >= 9 {
+		fmt.Printf("Modbus client %v rx: %v\n", name, test.HexDump(buf))
+	}
+
+	_, resp, err := c.transport.Decode(buf)
+	if err != nil {
+		return PDU{}, err
+	}
+
+	if c.debug >= 1 {
+		fmt.Printf("Modbus client %v ID:0x%x resp:%v\n", name, id, resp)
+	}
+
+	if resp.FunctionCode == req.FunctionCode|0x80 {
+		return PDU{}, resp.RespException()
+	}
+
+	if resp.FunctionCode != req.FunctionCode {
+		return PDU{}, errors.New("resp contains wrong function code")
+	}
+
+	return resp, nil
+}
@@ -2,7 +2,10 @@ package modbus
 
 import (
 	"encoding/binary"
+	"fmt"
 	"math"
+	"math/bits"
+	"strings"
 )
 
 // PutUint16Array creates a sequence of uint16 data.
@@ -156,3 +159,180 @@ func Float32ToRegs(in []float32) []uint16 {
 
 	return ret
 }
+
+// RegsToUint64 converts modbus regs to uint64 values
+func RegsToUint64(in []uint16) []uint64 {
+	count := len(in) / 4
+	ret := make([]uint64, count)
+	for i := range ret {
+		ret[i] = binary.BigEndian.Uint64(PutUint16Array(in[i*4 : i*4+4]...))
+	}
+
+	return ret
+}
+
+// Uint64ToRegs converts uint64 values to modbus regs
+func Uint64ToRegs(in []uint64) []uint16 {
+	ret := make([]uint16, 0, len(in)*4)
+	for _, v := range in {
+		buf := make([]byte, 8)
+		binary.BigEndian.PutUint64(buf, v)
+		ret = append(ret, Uint16Array(buf)...)
+	}
+
+	return ret
+}
+
+// RegsToInt64 converts modbus regs to int64 values
+func RegsToInt64(in []uint16) []int64 {
+	u := RegsToUint64(in)
+	ret := make([]int64, len(u))
+	for i, v := range u {
+		ret[i] = int64(v)
+	}
+
+	return ret
+}
+
+// Int64ToRegs converts int64 values to modbus regs
+func Int64ToRegs(in []int64) []uint16 {
+	u := make([]uint64, len(in))
+	for i, v := range in {
+		u[i] = uint64(v)
+	}
+
+	return Uint64ToRegs(u)
+}
+
+// RegsToFloat64 converts modbus regs to float64 values
+func RegsToFloat64(in []uint16) []float64 {
+	u := RegsToUint64(in)
+	ret := make([]float64, len(u))
+	for i, v := range u {
+		ret[i] = math.Float64frombits(v)
+	}
+
+	return ret
+}
+
+// Float64ToRegs converts float64 values to modbus regs
+func Float64ToRegs(in []float64) []uint16 {
+	u := make([]uint64, len(in))
+	for i, v := range in {
+		u[i] = math.Float64bits(v)
+	}
+
+	return Uint64ToRegs(u)
+}
+
+// ByteOrder describes how the bytes of a multi-register value are ordered
+// on the wire. A is the most significant byte. Most devices use ABCD (big
+// endian), but CDAB (word swapped) is also common.
+type ByteOrder string
+
+// define valid byte orders
+const (
+	ByteOrderABCD ByteOrder = "ABCD"
+	ByteOrderCDAB ByteOrder = "CDAB"
+	ByteOrderBADC ByteOrder = "BADC"
+	ByteOrderDCBA ByteOrder = "DCBA"
+)
+
+// ReorderRegs converts regs between the byte order used by a device and
+// ABCD (big endian) order. Each value is regsPerValue registers. For CDAB
+// and DCBA the order of the registers in each value is reversed, and for
+// BADC and DCBA the bytes in each register are swapped. As these operations
+// are their own inverse, this function is used for both reads and writes.
+func ReorderRegs(in []uint16, regsPerValue int, order ByteOrder) []uint16 {
+	ret := make([]uint16, len(in))
+	copy(ret, in)
+
+	if regsPerValue < 1 {
+		regsPerValue = 1
+	}
+
+	if order == ByteOrderCDAB || order == ByteOrderDCBA {
+		for start := 0; start+regsPerValue <= len(ret); start += regsPerValue {
+			for i, j := start, start+regsPerValue-1; i < j; i, j = i+1, j-1 {
+				ret[i], ret[j] = ret[j], ret[i]
+			}
+		}
+	}
+
+	if order == ByteOrderBADC || order == ByteOrderDCBA {
+		for i, v := range ret {
+			ret[i] = v<<8 | v>>8
+		}
+	}
+
+	return ret
+}
+
+// RegsToBCD converts modbus regs that contain binary coded decimal digits
+// (4 digits per register, most significant first) to a value. An error is
+// returned if a digit is not valid.
+func RegsToBCD(in []uint16) (uint64, error) {
+	var ret uint64
+	for _, r := range in {
+		for shift := 12; shift >= 0; shift -= 4 {
+			digit := (r >> shift) & 0xf
+			if digit > 9 {
+				return 0, fmt.Errorf("invalid BCD digit in reg: 0x%04x", r)
+			}
+			ret = ret*10 + uint64(digit)
+		}
+	}
+
+	return ret, nil
+}
+
+// BCDToRegs converts a value to count modbus regs of binary coded decimal
+// digits. An error is returned if the value does not fit in count regs.
+func BCDToRegs(v uint64, count int) ([]uint16, error) {
+	ret := make([]uint16, count)
+	for i := count - 1; i >= 0; i-- {
+		for shift := 0; shift < 16; shift += 4 {
+			ret[i] |= uint16(v%10) << shift
+			v /= 10
+		}
+	}
+
+	if v != 0 {
+		return nil, fmt.Errorf("value too large for %v BCD regs", count)
+	}
+
+	return ret, nil
+}
+
+// RegsToString converts modbus regs that contain ASCII characters (2 per
+// register, first character in the high byte) to a string. Trailing NUL and
+// space characters are removed.
+func RegsToString(in []uint16) string {
+	return strings.TrimRight(string(PutUint16Array(in...)), "\x00 ")
+}
+
+// StringToRegs converts a string to count modbus regs of ASCII characters.
+// The string is truncated or padded with NUL characters to fit.
+func StringToRegs(s string, count int) []uint16 {
+	buf := make([]byte, count*2)
+	copy(buf, s)
+	return Uint16Array(buf)
+}
+
+// RegToBitField extracts the bits selected by mask from a register. The
+// result is shifted so the lowest bit of the mask is bit 0.
+func RegToBitField(reg, mask uint16) uint16 {
+	if mask == 0 {
+		return 0
+	}
+	return (reg & mask) >> bits.TrailingZeros16(mask)
+}
+
+// BitFieldToReg sets the bits selected by mask in a register to v and
+// returns the new register value.
+func BitFieldToReg(reg, mask, v uint16) uint16 {
+	if mask == 0 {
+		return reg
+	}
+	return (reg &^ mask) | ((v << bits.TrailingZeros16(mask)) & mask)
+}
@@ -49,3 +49,118 @@ func TestRegsToFloat32SwapWords(t *testing.T) {
 		t.Error("Failed: ", exp, f)
 	}
 }
+
+func TestInt64(t *testing.T) {
+	v := int64(-4123456234567)
+
+	regs := Int64ToRegs([]int64{v})
+
+	v2 := RegsToInt64(regs)
+
+	if v != v2[0] {
+		t.Error("Failed: ", v, v2[0])
+	}
+}
+
+func TestFloat64(t *testing.T) {
+	v := 2124.23e100
+
+	regs := Float64ToRegs([]float64{v})
+
+	v2 := RegsToFloat64(regs)
+
+	if v != v2[0] {
+		t.Error("Failed: ", v, v2[0])
+	}
+}
+
+func TestReorderRegs(t *testing.T) {
+	// 0.01 as float32 is 0x3c23d70a
+	tests := []struct {
+		order ByteOrder
+		in    []uint16
+	}{
+		{ByteOrderABCD, []uint16{0x3c23, 0xd70a}},
+		{ByteOrderCDAB, []uint16{0xd70a, 0x3c23}},
+		{ByteOrderBADC, []uint16{0x233c, 0x0ad7}},
+		{ByteOrderDCBA, []uint16{0x0ad7, 0x233c}},
+	}
+
+	for _, test := range tests {
+		regs := ReorderRegs(test.in, 2, test.order)
+		f := RegsToFloat32(regs)
+		if f[0] != 0.01 {
+			t.Errorf("%v: got %v", test.order, f[0])
+		}
+
+		back := ReorderRegs(regs, 2, test.order)
+		if back[0] != test.in[0] || back[1] != test.in[1] {
+			t.Errorf("%v: reorder is not reversible: %x", test.order, back)
+		}
+	}
+
+	regs := ReorderRegs(Uint64ToRegs([]uint64{0x0102030405060708}), 4, ByteOrderCDAB)
+	exp := []uint16{0x0708, 0x0506, 0x0304, 0x0102}
+	for i := range exp {
+		if regs[i] != exp[i] {
+			t.Fatalf("64-bit CDAB: got %x, expected %x", regs, exp)
+		}
+	}
+}
+
+func TestBCD(t *testing.T) {
+	v, err := RegsToBCD([]uint16{0x0012, 0x3456})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v != 123456 {
+		t.Error("wrong BCD value: ", v)
+	}
+
+	regs, err := BCDToRegs(v, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if regs[0] != 0x0012 || regs[1] != 0x3456 {
+		t.Errorf("wrong BCD regs: %x", regs)
+	}
+
+	_, err = RegsToBCD([]uint16{0x00a1})
+	if err == nil {
+		t.Error("expected error for invalid digit")
+	}
+
+	_, err = BCDToRegs(12345, 1)
+	if err == nil {
+		t.Error("expected error for value too large")
+	}
+}
+
+func TestString(t *testing.T) {
+	regs := StringToRegs("SIOT1", 4)
+
+	if len(regs) != 4 || regs[0] != 0x5349 || regs[2] != 0x3100 {
+		t.Errorf("wrong string regs: %x", regs)
+	}
+
+	s := RegsToString(regs)
+	if s != "SIOT1" {
+		t.Errorf("wrong string: %q", s)
+	}
+}
+
+func TestBitField(t *testing.T) {
+	if v := RegToBitField(0xabcd, 0x0f00); v != 0xb {
+		t.Errorf("wrong bit field: %x", v)
+	}
+
+	if v := BitFieldToReg(0xabcd, 0x0f00, 0x3); v != 0xa3cd {
+		t.Errorf("wrong reg: %x", v)
+	}
+
+	if v := BitFieldToReg(0xabcd, 0x0f00, 0x13); v != 0xa3cd {
+		t.Errorf("bits outside the mask should be ignored: %x", v)
+	}
+}
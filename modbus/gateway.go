@@ -0,0 +1,376 @@
+package modbus
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/simpleiot/simpleiot/test"
+)
+
+// gatewayQueueSize is the max number of requests waiting for the RTU bus.
+// When the queue is full, requests get a server device busy exception.
+const gatewayQueueSize = 32
+
+// gatewayBroadcastDelay is the time devices are given to process a broadcast
+// request before the next request is sent on the bus
+const gatewayBroadcastDelay = 100 * time.Millisecond
+
+// gatewayRequest is a request from a TCP client waiting for the RTU bus.
+// resp is nil for broadcast requests as there is no response.
+type gatewayRequest struct {
+	id     byte
+	req    PDU
+	queued time.Time
+	resp   chan PDU
+}
+
+// Gateway accepts Modbus TCP connections and forwards requests to devices
+// on an RTU (or ASCII) bus using the unit ID of the request. Requests from all
+// connections are queued and sent on the bus one at a time. If the device
+// does not respond within the timeout (including time waiting in the queue),
+// the TCP client gets a gateway target failed to respond exception.
+type Gateway struct {
+	// config
+	maxClients int
+	rtu        Transport
+	timeout    time.Duration
+	debug      int
+
+	// state
+	listener net.Listener
+	queue    chan gatewayRequest
+	chDone   chan struct{}
+	conns    []net.Conn
+	lock     sync.Mutex
+	stopped  bool
+}
+
+// NewGateway starts listening for Modbus TCP connections on port. rtu is
+// the transport for the RTU bus, and must return an entire packet for each
+// Read().
+func NewGateway(maxClients int, port string, rtu Transport, timeout time.Duration,
+	debug int) (*Gateway, error) {
+	listener, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Gateway{
+		maxClients: maxClients,
+		rtu:        rtu,
+		timeout:    timeout,
+		debug:      debug,
+		listener:   listener,
+		queue:      make(chan gatewayRequest, gatewayQueueSize),
+		chDone:     make(chan struct{}),
+	}, nil
+}
+
+// Listen accepts TCP connections and forwards requests to the RTU bus. This
+// function does not return until the gateway is closed. changesCallback is
+// not used as the gateway does not have any registers, but is included so
+// the Gateway can be used in place of a Server.
+func (g *Gateway) Listen(errorCallback func(error), _ func(), done func()) {
+	go g.runBus(errorCallback)
+
+	for {
+		sock, err := g.listener.Accept()
+		if err != nil {
+			g.lock.Lock()
+			stopped := g.stopped
+			g.lock.Unlock()
+			if stopped {
+				if g.debug > 0 {
+					log.Println("Modbus gateway, stopping listen")
+				}
+				done()
+				return
+			}
+			log.Println("Modbus gateway: failed to accept connection: ", err)
+			continue
+		}
+
+		if g.debug > 0 {
+			log.Println("New Modbus gateway connection")
+		}
+
+		g.lock.Lock()
+		if len(g.conns) < g.maxClients {
+			g.conns = append(g.conns, sock)
+			go g.handleConn(sock, errorCallback)
+		} else {
+			log.Println("Modbus gateway: warning reached max conn")
+			sock.Close()
+		}
+		g.lock.Unlock()
+	}
+}
+
+// Close stops the gateway and closes all connections and the RTU bus
+func (g *Gateway) Close() error {
+	if g.debug > 0 {
+		log.Println("Modbus gateway closing ...")
+	}
+
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	if g.stopped {
+		return nil
+	}
+
+	g.stopped = true
+	close(g.chDone)
+
+	var retErr error
+
+	for _, c := range g.conns {
+		err := c.Close()
+		if err != nil {
+			retErr = err
+		}
+	}
+
+	err := g.listener.Close()
+	if err != nil {
+		retErr = err
+	}
+
+	err = g.rtu.Close()
+	if err != nil {
+		retErr = err
+	}
+
+	return retErr
+}
+
+func (g *Gateway) removeConn(sock net.Conn) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	for i := range g.conns {
+		if g.conns[i] == sock {
+			g.conns[i] = g.conns[len(g.conns)-1]
+			g.conns = g.conns[:len(g.conns)-1]
+			break
+		}
+	}
+}
+
+// handleConn processes requests from one TCP client
+func (g *Gateway) handleConn(sock net.Conn, errorCallback func(error)) {
+	defer g.removeConn(sock)
+	defer sock.Close()
+
+	transport := NewTCP(sock, 500*time.Millisecond, TransportServer)
+
+	for {
+		buf := make([]byte, 260)
+		cnt, err := transport.Read(buf)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				// connection is idle
+				continue
+			}
+
+			if err != io.EOF {
+				errorCallback(err)
+			} else if g.debug > 0 {
+				log.Println("Modbus gateway client disconnected")
+			}
+			return
+		}
+
+		if g.debug >= 9 {
+			fmt.Println("Modbus gateway TCP rx: ", test.HexDump(buf[:cnt]))
+		}
+
+		id, req, err := transport.Decode(buf[:cnt])
+		if err != nil {
+			errorCallback(err)
+			continue
+		}
+
+		r := gatewayRequest{id: id, req: req, queued: time.Now()}
+		if id != 0 {
+			r.resp = make(chan PDU, 1)
+		}
+
+		var resp PDU
+
+		select {
+		case g.queue <- r:
+			if r.resp == nil {
+				// no response for broadcast requests
+				continue
+			}
+
+			select {
+			case resp = <-r.resp:
+			case <-time.After(g.timeout):
+				resp = req.exception(ExcGatewayTargetFailedToRespond)
+			}
+		default:
+			if r.resp == nil {
+				continue
+			}
+			resp = req.exception(ExcServerDeviceBusy)
+		}
+
+		packet, err := transport.Encode(id, resp)
+		if err != nil {
+			errorCallback(err)
+			continue
+		}
+
+		if g.debug >= 9 {
+			fmt.Println("Modbus gateway TCP tx: ", test.HexDump(packet))
+		}
+
+		_, err = transport.Write(packet)
+		if err != nil {
+			errorCallback(err)
+			return
+		}
+	}
+}
+
+// runBus sends queued requests on the RTU bus
+func (g *Gateway) runBus(errorCallback func(error)) {
+	for {
+		select {
+		case <-g.chDone:
+			return
+		case r := <-g.queue:
+			if r.resp != nil && time.Since(r.queued) > g.timeout {
+				// TCP client has already timed out
+				continue
+			}
+
+			resp, err := g.forward(r)
+			if err != nil {
+				errorCallback(err)
+				resp = r.req.exception(ExcGatewayTargetFailedToRespond)
+			}
+
+			if r.resp != nil {
+				r.resp <- resp
+			}
+		}
+	}
+}
+
+// forward sends a request on the RTU bus and returns the response
+func (g *Gateway) forward(r gatewayRequest) (PDU, error) {
+	if g.debug >= 2 {
+		fmt.Printf("Modbus gateway ID:0x%x req:%v\n", r.id, r.req)
+	}
+
+	packet, err := g.rtu.Encode(r.id, r.req)
+	if err != nil {
+		return PDU{}, err
+	}
+
+	if g.debug >= 9 {
+		fmt.Println("Modbus gateway RTU tx: ", test.HexDump(packet))
+	}
+
+	_, err = g.rtu.Write(packet)
+	if err != nil {
+		return PDU{}, err
+	}
+
+	if r.resp == nil {
+		time.Sleep(gatewayBroadcastDelay)
+		return PDU{}, nil
+	}
+
+	// A response to an earlier request that timed out may arrive after
+	// this request is sent, so frames that don't match the request are
+	// skipped until the timeout.
+	start := time.Now()
+	buf := make([]byte, maxADUSize)
+
+	for time.Since(start) < g.timeout {
+		cnt, err := g.rtu.Read(buf)
+		if err == io.EOF || (err == nil && cnt <= 0) {
+			return PDU{}, fmt.Errorf("no response from device ID %v", r.id)
+		}
+
+		if err != nil {
+			return PDU{}, err
+		}
+
+		if g.debug >= 9 {
+			fmt.Println("Modbus gateway RTU rx: ", test.HexDump(buf[:cnt]))
+		}
+
+		id, resp, err := g.rtu.Decode(buf[:cnt])
+		if err != nil {
+			return PDU{}, err
+		}
+
+		if id != r.id || !gatewayRespMatches(r.req, resp) {
+			if g.debug > 0 {
+				log.Printf("Modbus gateway: skipping response from ID %v that does not "+
+					"match request to ID %v: %v\n", id, r.id, resp)
+			}
+			continue
+		}
+
+		if g.debug >= 2 {
+			fmt.Printf("Modbus gateway ID:0x%x resp:%v\n", r.id, resp)
+		}
+
+		return resp, nil
+	}
+
+	return PDU{}, fmt.Errorf("no matching response from device ID %v", r.id)
+}
+
+// gatewayRespMatches returns true if the function code and byte count or
+// echoed data of resp match req. Responses for function codes that are not
+// known are assumed to match.
+func gatewayRespMatches(req, resp PDU) bool {
+	if resp.FunctionCode == req.FunctionCode|0x80 {
+		return len(resp.Data) == 1
+	}
+
+	if resp.FunctionCode != req.FunctionCode {
+		return false
+	}
+
+	switch req.FunctionCode {
+	case FuncCodeReadCoils, FuncCodeReadDiscreteInputs:
+		if len(req.Data) < 4 || len(resp.Data) < 1 {
+			return false
+		}
+		count := int(binary.BigEndian.Uint16(req.Data[2:4]))
+		return int(resp.Data[0]) == (count+7)/8 && len(resp.Data) == 1+int(resp.Data[0])
+	case FuncCodeReadHoldingRegisters, FuncCodeReadInputRegisters,
+		FuncCodeReadWriteMultipleRegisters:
+		// the read quantity is the second word of all these requests
+		if len(req.Data) < 4 || len(resp.Data) < 1 {
+			return false
+		}
+		count := int(binary.BigEndian.Uint16(req.Data[2:4]))
+		return int(resp.Data[0]) == count*2 && len(resp.Data) == 1+int(resp.Data[0])
+	case FuncCodeWriteSingleCoil, FuncCodeWriteSingleRegister, FuncCodeMaskWriteRegister:
+		return bytes.Equal(req.Data, resp.Data)
+	case FuncCodeWriteMultipleCoils, FuncCodeWriteMultipleRegisters:
+		// address and quantity are echoed
+		return len(req.Data) >= 4 && bytes.Equal(req.Data[:4], resp.Data)
+	case FuncCodeReadFIFOQueue:
+		return len(resp.Data) >= 2 &&
+			int(binary.BigEndian.Uint16(resp.Data[0:2])) == len(resp.Data)-2
+	}
+
+	return true
+}
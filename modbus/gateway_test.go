@@ -0,0 +1,159 @@
+package modbus
+
+import (
+	"log"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/simpleiot/simpleiot/respreader"
+	"github.com/simpleiot/simpleiot/test"
+)
+
+func TestGateway(t *testing.T) {
+	a, b := test.NewIoSim()
+
+	// RTU device behind the gateway
+	regs := &Regs{}
+	regs.AddReg(2, 1)
+	err := regs.WriteReg(2, 0x1234)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	portA := respreader.NewReadWriteCloser(a, time.Second*2, 5*time.Millisecond)
+	server := NewServer(7, NewRTU(portA), regs, 0)
+	go server.Listen(func(err error) {
+		log.Println("modbus server listen error: ", err)
+	}, func() {}, func() {})
+	defer server.Close()
+
+	portB := respreader.NewReadWriteCloser(b, 100*time.Millisecond, 5*time.Millisecond)
+	gw, err := NewGateway(2, "15502", NewRTU(portB), 500*time.Millisecond, 0)
+	if err != nil {
+		t.Fatal("Error starting gateway: ", err)
+	}
+
+	go gw.Listen(func(err error) {
+		log.Println("modbus gateway error: ", err)
+	}, func() {}, func() {})
+	defer gw.Close()
+
+	sock, err := net.DialTimeout("tcp", "localhost:15502", time.Second)
+	if err != nil {
+		t.Fatal("Error connecting to gateway: ", err)
+	}
+
+	c := NewClient(NewTCP(sock, time.Second, TransportClient), 0)
+	defer c.Close()
+
+	hr, err := c.ReadHoldingRegs(7, 2, 1)
+	if err != nil {
+		t.Fatal("Error reading through gateway: ", err)
+	}
+
+	if len(hr) != 1 || hr[0] != 0x1234 {
+		t.Fatal("wrong value read: ", hr)
+	}
+
+	err = c.WriteSingleReg(7, 2, 0x5678)
+	if err != nil {
+		t.Fatal("Error writing through gateway: ", err)
+	}
+
+	v, _ := regs.ReadReg(2)
+	if v != 0x5678 {
+		t.Fatalf("reg not written, got 0x%x", v)
+	}
+
+	// exceptions from the device are passed through
+	_, err = c.ReadHoldingRegs(7, 10, 1)
+	if err != ExcIllegalAddress {
+		t.Fatal("expected illegal address exception, got: ", err)
+	}
+
+	_, err = c.ReadHoldingRegs(8, 2, 1)
+	if err != ExcGatewayTargetFailedToRespond {
+		t.Fatal("expected target failed to respond exception, got: ", err)
+	}
+
+	// the gateway should still work after a device fails to respond
+	_, err = c.ReadHoldingRegs(7, 2, 1)
+	if err != nil {
+		t.Fatal("Error reading after timeout: ", err)
+	}
+}
+
+func TestGatewayLateResponse(t *testing.T) {
+	a, b := test.NewIoSim()
+
+	// slow device that answers the first request after the gateway has
+	// timed out, just before it answers the second request
+	portA := respreader.NewReadWriteCloser(a, time.Second*2, 5*time.Millisecond)
+	rtuA := NewRTU(portA)
+	go func() {
+		buf := make([]byte, maxADUSize)
+		var late PDU
+		for i := 0; i < 2; i++ {
+			cnt, err := rtuA.Read(buf)
+			if err != nil || cnt <= 0 {
+				return
+			}
+
+			_, req, err := rtuA.Decode(buf[:cnt])
+			if err != nil {
+				log.Println("device decode error: ", err)
+				return
+			}
+
+			if i == 0 {
+				late = PDU{FunctionCode: req.FunctionCode, Data: []byte{2, 0x11, 0x11}}
+				continue
+			}
+
+			for _, resp := range []PDU{late,
+				{FunctionCode: req.FunctionCode, Data: []byte{4, 0x12, 0x34, 0x56, 0x78}}} {
+				packet, _ := rtuA.Encode(7, resp)
+				_, err = rtuA.Write(packet)
+				if err != nil {
+					return
+				}
+				time.Sleep(20 * time.Millisecond)
+			}
+		}
+	}()
+	defer portA.Close()
+
+	portB := respreader.NewReadWriteCloser(b, 100*time.Millisecond, 5*time.Millisecond)
+	gw, err := NewGateway(2, "15503", NewRTU(portB), 500*time.Millisecond, 0)
+	if err != nil {
+		t.Fatal("Error starting gateway: ", err)
+	}
+
+	go gw.Listen(func(err error) {
+		log.Println("modbus gateway error: ", err)
+	}, func() {}, func() {})
+	defer gw.Close()
+
+	sock, err := net.DialTimeout("tcp", "localhost:15503", time.Second)
+	if err != nil {
+		t.Fatal("Error connecting to gateway: ", err)
+	}
+
+	c := NewClient(NewTCP(sock, time.Second, TransportClient), 0)
+	defer c.Close()
+
+	_, err = c.ReadHoldingRegs(7, 2, 1)
+	if err != ExcGatewayTargetFailedToRespond {
+		t.Fatal("expected target failed to respond exception, got: ", err)
+	}
+
+	hr, err := c.ReadHoldingRegs(7, 2, 2)
+	if err != nil {
+		t.Fatal("Error reading through gateway: ", err)
+	}
+
+	if len(hr) != 2 || hr[0] != 0x1234 || hr[1] != 0x5678 {
+		t.Fatalf("late response used for the next request: %x", hr)
+	}
+}
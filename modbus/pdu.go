@@ -21,14 +21,36 @@ func (p PDU) String() string {
 
 // handleError translates an error into a PDU, if possible.
 func (p *PDU) handleError(err error) (bool, PDU, error) {
-	if err, ok := err.(ExceptionCode); ok {
-		resp := PDU{}
-		resp.FunctionCode = p.FunctionCode | 0x80
-		resp.Data = []byte{byte(err)}
-		return false, resp, nil
-	}
-	// TODO: Wrap the underlying error?
-	return p.handleError(ExcServerDeviceFailure)
+	return false, p.exception(err), nil
+}
+
+// exception returns an exception response PDU for an error. Errors that are
+// not an ExceptionCode are returned as a server device failure.
+func (p *PDU) exception(err error) PDU {
+	exc, ok := err.(ExceptionCode)
+	if !ok {
+		// TODO: Wrap the underlying error?
+		exc = ExcServerDeviceFailure
+	}
+
+	return PDU{
+		FunctionCode: p.FunctionCode | 0x80,
+		Data:         []byte{byte(exc)},
+	}
+}
+
+// RespException returns the exception code if this is an exception
+// response, otherwise nil.
+func (p *PDU) RespException() error {
+	if p.FunctionCode&0x80 == 0 {
+		return nil
+	}
+
+	if len(p.Data) < 1 {
+		return errors.New("exception response is missing exception code")
+	}
+
+	return ExceptionCode(p.Data[0])
 }
 
 // ProcessRequest a modbus request. Registers are read and written
@@ -153,6 +175,83 @@ func (p *PDU) ProcessRequest(regs RegProvider) (bool, PDU, error) {
 		binary.BigEndian.PutUint16(resp.Data[2:4], quantity)
 		regsChanged = true
 
+	case FuncCodeMaskWriteRegister:
+		address := binary.BigEndian.Uint16(p.Data[:2])
+		andMask := binary.BigEndian.Uint16(p.Data[2:4])
+		orMask := binary.BigEndian.Uint16(p.Data[4:6])
+
+		v, err := regs.ReadReg(int(address))
+		if err != nil {
+			return p.handleError(err)
+		}
+
+		v = (v & andMask) | (orMask & ^andMask)
+
+		err = regs.WriteReg(int(address), v)
+		if err != nil {
+			return p.handleError(err)
+		}
+
+		resp = *p
+		regsChanged = true
+
+	case FuncCodeReadWriteMultipleRegisters:
+		readAddress := binary.BigEndian.Uint16(p.Data[:2])
+		readCount := binary.BigEndian.Uint16(p.Data[2:4])
+		writeAddress := binary.BigEndian.Uint16(p.Data[4:6])
+		writeCount := binary.BigEndian.Uint16(p.Data[6:8])
+
+		if readCount < 1 || readCount > 125 || writeCount < 1 || writeCount > 121 ||
+			len(p.Data) != 9+int(writeCount)*2 {
+			return p.handleError(ExcIllegalValue)
+		}
+
+		// the write is performed before the read
+		for i := 0; i < int(writeCount); i++ {
+			value := binary.BigEndian.Uint16(p.Data[9+i*2 : 9+i*2+2])
+			if err := regs.WriteReg(int(writeAddress)+i, value); err != nil {
+				return p.handleError(err)
+			}
+		}
+		regsChanged = true
+
+		resp.Data = make([]byte, 1+2*readCount)
+		resp.Data[0] = uint8(readCount * 2)
+		for i := 0; i < int(readCount); i++ {
+			v, err := regs.ReadReg(int(readAddress) + i)
+			if err != nil {
+				return regsChanged, p.exception(err), nil
+			}
+
+			binary.BigEndian.PutUint16(resp.Data[1+i*2:], v)
+		}
+
+	case FuncCodeReadFIFOQueue:
+		// the register at the FIFO pointer address contains the
+		// number of values in the queue, which follow it
+		address := binary.BigEndian.Uint16(p.Data[:2])
+
+		count, err := regs.ReadReg(int(address))
+		if err != nil {
+			return p.handleError(err)
+		}
+
+		if count > 31 {
+			return p.handleError(ExcIllegalValue)
+		}
+
+		resp.Data = make([]byte, 4+2*count)
+		binary.BigEndian.PutUint16(resp.Data[0:], 2+2*count)
+		binary.BigEndian.PutUint16(resp.Data[2:], count)
+		for i := 0; i < int(count); i++ {
+			v, err := regs.ReadReg(int(address) + 1 + i)
+			if err != nil {
+				return p.handleError(err)
+			}
+
+			binary.BigEndian.PutUint16(resp.Data[4+i*2:], v)
+		}
+
 	default:
 		return p.handleError(ExcIllegalFunction)
 	}
@@ -190,6 +289,29 @@ func (p *PDU) RespReadBits() ([]bool, error) {
 	return ret, nil
 }
 
+// respReadBitCount reads count coils or discrete inputs from a
+// response PDU. The response only contains the byte count, so the
+// number of bits requested must be provided.
+func (p *PDU) respReadBitCount(count int) ([]bool, error) {
+	switch p.FunctionCode {
+	case FuncCodeReadCoils, FuncCodeReadDiscreteInputs:
+		// ok
+	default:
+		return []bool{}, errors.New("invalid function code to read bits")
+	}
+
+	if len(p.Data) < 1+(count+7)/8 {
+		return []bool{}, errors.New("not enough data")
+	}
+
+	ret := make([]bool, count)
+	for i := range ret {
+		ret[i] = (p.Data[1+i/8]>>(i%8))&0x1 == 0x1
+	}
+
+	return ret, nil
+}
+
 // RespReadRegs reads register values from a
 // response PDU.
 func (p *PDU) RespReadRegs() ([]uint16, error) {
@@ -197,7 +319,8 @@ func (p *PDU) RespReadRegs() ([]uint16, error) {
 		return []uint16{}, errors.New("not enough data")
 	}
 	switch p.FunctionCode {
-	case FuncCodeReadHoldingRegisters, FuncCodeReadInputRegisters:
+	case FuncCodeReadHoldingRegisters, FuncCodeReadInputRegisters,
+		FuncCodeReadWriteMultipleRegisters:
 		// ok
 	default:
 		return []uint16{}, errors.New("invalid function code to read regs")
@@ -218,6 +341,26 @@ func (p *PDU) RespReadRegs() ([]uint16, error) {
 	return ret, nil
 }
 
+// RespReadFIFOQueue reads the FIFO queue values from a
+// response PDU.
+func (p *PDU) RespReadFIFOQueue() ([]uint16, error) {
+	if p.FunctionCode != FuncCodeReadFIFOQueue {
+		return []uint16{}, errors.New("invalid function code to read FIFO queue")
+	}
+
+	if len(p.Data) < 4 {
+		return []uint16{}, errors.New("not enough data")
+	}
+
+	count := binary.BigEndian.Uint16(p.Data[2:4])
+
+	if len(p.Data) < 4+int(count)*2 {
+		return []uint16{}, errors.New("RespReadFIFOQueue not enough data")
+	}
+
+	return Uint16Array(p.Data[4 : 4+int(count)*2]), nil
+}
+
 // Add address units below are the packet address, typically drop
 // first digit from register and subtract 1
 
@@ -273,3 +416,64 @@ func ReadInputRegs(address uint16, count uint16) PDU {
 		Data:         PutUint16Array(address, count),
 	}
 }
+
+// WriteMultipleCoils creates a PDU to write multiple coils
+func WriteMultipleCoils(address uint16, values []bool) PDU {
+	bytes := (len(values) + 7) / 8
+	data := make([]byte, 5+bytes)
+	binary.BigEndian.PutUint16(data[0:], address)
+	binary.BigEndian.PutUint16(data[2:], uint16(len(values)))
+	data[4] = byte(bytes)
+	for i, v := range values {
+		if v {
+			data[5+i/8] |= 1 << (i % 8)
+		}
+	}
+
+	return PDU{
+		FunctionCode: FuncCodeWriteMultipleCoils,
+		Data:         data,
+	}
+}
+
+// WriteMultipleRegs creates a PDU to write multiple holding regs
+func WriteMultipleRegs(address uint16, values []uint16) PDU {
+	data := append(PutUint16Array(address, uint16(len(values))),
+		byte(len(values)*2))
+	data = append(data, PutUint16Array(values...)...)
+
+	return PDU{
+		FunctionCode: FuncCodeWriteMultipleRegisters,
+		Data:         data,
+	}
+}
+
+// MaskWriteReg creates a PDU to modify a holding reg. The
+// new reg value is (current AND andMask) OR (orMask AND (NOT andMask)).
+func MaskWriteReg(address, andMask, orMask uint16) PDU {
+	return PDU{
+		FunctionCode: FuncCodeMaskWriteRegister,
+		Data:         PutUint16Array(address, andMask, orMask),
+	}
+}
+
+// ReadWriteMultipleRegs creates a PDU that writes holding regs and then
+// reads holding regs in one transaction
+func ReadWriteMultipleRegs(readAddress, readCount, writeAddress uint16, values []uint16) PDU {
+	data := append(PutUint16Array(readAddress, readCount, writeAddress,
+		uint16(len(values))), byte(len(values)*2))
+	data = append(data, PutUint16Array(values...)...)
+
+	return PDU{
+		FunctionCode: FuncCodeReadWriteMultipleRegisters,
+		Data:         data,
+	}
+}
+
+// ReadFIFOQueue creates a PDU to read a FIFO queue
+func ReadFIFOQueue(address uint16) PDU {
+	return PDU{
+		FunctionCode: FuncCodeReadFIFOQueue,
+		Data:         PutUint16Array(address),
+	}
+}
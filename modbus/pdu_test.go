@@ -149,6 +149,15 @@ func TestProcessRequest(t *testing.T) {
 		{"WriteMultipleRegisters/missing", []byte{0x10, 0, 7, 0, 2, 4, 9, 10, 11, 12}, []byte{0x90, 2}},
 		{"WriteMultipleRegisters/wronglen", []byte{0x10, 0, 7, 0, 2, 4, 9, 10}, []byte{0x90, 3}},
 		{"WriteMultipleRegisters/readback", []byte{3, 0, 8, 0, 2}, []byte{3, 4, 0, 8, 10, 15}},
+		{"MaskWriteRegister/present", []byte{22, 0, 8, 0, 0xF2, 0, 0x25}, []byte{22, 0, 8, 0, 0xF2, 0, 0x25}},
+		{"MaskWriteRegister/missing", []byte{22, 0, 7, 0, 0xF2, 0, 0x25}, []byte{0x96, 2}},
+		{"MaskWriteRegister/readback", []byte{3, 0, 8, 0, 1}, []byte{3, 2, 0, 5}},
+		{"ReadWriteMultipleRegisters/present", []byte{23, 0, 8, 0, 2, 0, 9, 0, 1, 2, 0x12, 0x34}, []byte{23, 4, 0, 5, 0x12, 0x34}},
+		{"ReadWriteMultipleRegisters/missing", []byte{23, 0, 8, 0, 2, 0, 7, 0, 1, 2, 0x12, 0x34}, []byte{0x97, 2}},
+		{"ReadWriteMultipleRegisters/wronglen", []byte{23, 0, 8, 0, 2, 0, 9, 0, 2, 4, 0, 1}, []byte{0x97, 3}},
+		{"ReadFIFOQueue/count", []byte{6, 0, 8, 0, 1}, []byte{6, 0, 8, 0, 1}},
+		{"ReadFIFOQueue/present", []byte{24, 0, 8}, []byte{24, 0, 4, 0, 1, 0x12, 0x34}},
+		{"ReadFIFOQueue/missing", []byte{24, 0, 7}, []byte{0x98, 2}},
 	} {
 		t.Run(test.name, func(t *testing.T) {
 			pdu := &PDU{
@@ -54,6 +54,21 @@ func (r *Regs) AddReg(address int, count int) {
 	}
 }
 
+// RemoveReg removes count registers starting at address. Requests for
+// removed registers return an illegal address exception.
+func (r *Regs) RemoveReg(address int, count int) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	regs := r.regs[:0]
+	for _, reg := range r.regs {
+		if int(reg.Address) < address || int(reg.Address) >= address+count {
+			regs = append(regs, reg)
+		}
+	}
+	r.regs = regs
+}
+
 func (r *Regs) readReg(address int) (uint16, error) {
 	for _, reg := range r.regs {
 		if reg.Address == uint16(address) {
@@ -253,3 +268,35 @@ func (r *Regs) WriteRegFloat32(address int, value float32) error {
 
 	return nil
 }
+
+// ReadRegs reads count consecutive registers
+func (r *Regs) ReadRegs(address int, count int) ([]uint16, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	ret := make([]uint16, count)
+	for i := range ret {
+		var err error
+		ret[i], err = r.readReg(address + i)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return ret, nil
+}
+
+// WriteRegs writes consecutive registers
+func (r *Regs) WriteRegs(address int, values []uint16) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for i, v := range values {
+		err := r.writeReg(address+i, v)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -2,6 +2,7 @@ package modbus
 
 import (
 	"log"
+	"net"
 	"testing"
 	"time"
 
@@ -83,3 +84,115 @@ func TestRtuEndToEnd(t *testing.T) {
 		t.Fatalf("read holding reg returned wrong value: 0x%x", hr[0])
 	}
 }
+
+func TestRtuEndToEndWriteMultiple(t *testing.T) {
+	id := byte(1)
+
+	a, b := test.NewIoSim()
+
+	portA := respreader.NewReadWriteCloser(a, time.Second*2,
+		5*time.Millisecond)
+	regs := &Regs{}
+	regs.AddReg(2, 4)
+	regs.AddCoil(128)
+	slave := NewServer(id, NewRTU(portA), regs, 9)
+
+	go slave.Listen(func(err error) {
+		log.Println("modbus server listen error: ", err)
+	}, func() {}, func() {})
+
+	portB := respreader.NewReadWriteCloser(b, time.Second*2,
+		5*time.Millisecond)
+	master := NewClient(NewRTU(portB), 9)
+
+	err := master.WriteMultipleRegs(id, 2, Float32ToRegs([]float32{12.5}))
+	if err != nil {
+		t.Fatal("write multiple regs returned err: ", err)
+	}
+
+	v, err := regs.ReadRegFloat32(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v != 12.5 {
+		t.Fatal("wrong float value: ", v)
+	}
+
+	err = master.WriteMultipleCoils(id, 128, []bool{true, false, true})
+	if err != nil {
+		t.Fatal("write multiple coils returned err: ", err)
+	}
+
+	coils, err := master.ReadCoils(id, 128, 3)
+	if err != nil {
+		t.Fatal("read coils returned err: ", err)
+	}
+
+	if len(coils) != 3 || !coils[0] || coils[1] || !coils[2] {
+		t.Fatal("wrong coil values: ", coils)
+	}
+
+	err = master.MaskWriteReg(id, 4, 0xff00, 0x0012)
+	if err != nil {
+		t.Fatal("mask write reg returned err: ", err)
+	}
+
+	read, err := master.ReadWriteMultipleRegs(id, 4, 2, 5, []uint16{0x5678})
+	if err != nil {
+		t.Fatal("read/write multiple regs returned err: ", err)
+	}
+
+	if len(read) != 2 || read[0] != 0x0012 || read[1] != 0x5678 {
+		t.Fatalf("read/write multiple regs returned wrong values: %x", read)
+	}
+
+	_, err = master.ReadWriteMultipleRegs(id, 4, 2, 20, []uint16{1})
+	if err != ExcIllegalAddress {
+		t.Fatal("expected illegal address exception, got: ", err)
+	}
+}
+
+func TestRtuOverTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	regs := &Regs{}
+	regs.AddCoil(5)
+	err = regs.WriteCoil(5, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		sock, err := listener.Accept()
+		if err != nil {
+			return
+		}
+
+		// the device server side of the connection
+		server := NewServer(3, NewRTUOverTCP(sock, 2*time.Second,
+			5*time.Millisecond), regs, 0)
+		server.Listen(func(error) {}, func() {}, func() {})
+	}()
+
+	sock, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := NewClient(NewRTUOverTCP(sock, time.Second, 5*time.Millisecond), 0)
+	defer client.Close()
+
+	coils, err := client.ReadCoils(3, 5, 1)
+	if err != nil {
+		t.Fatal("read coils returned err: ", err)
+	}
+
+	if len(coils) != 1 || !coils[0] {
+		t.Fatalf("wrong coil value: %v", coils)
+	}
+}
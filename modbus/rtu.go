@@ -4,6 +4,10 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
+	"net"
+	"time"
+
+	"github.com/simpleiot/simpleiot/respreader"
 )
 
 // RtuADU defines an ADU for RTU packets
@@ -25,6 +29,15 @@ func NewRTU(port io.ReadWriteCloser) *RTU {
 	}
 }
 
+// NewRTUOverTCP creates an RTU transport that sends RTU frames over a TCP
+// connection, as used by serial device servers. RTU frames are not
+// delimited, so respreader is used to detect the end of a frame: timeout is
+// the max time to wait for a response, and chunkTimeout is the gap that
+// ends a frame.
+func NewRTUOverTCP(sock net.Conn, timeout, chunkTimeout time.Duration) *RTU {
+	return NewRTU(respreader.NewReadWriteCloser(sock, timeout, chunkTimeout))
+}
+
 func (r *RTU) Read(p []byte) (int, error) {
 	return r.port.Read(p)
 }
@@ -4,18 +4,73 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"sync"
 	"time"
 
 	"github.com/simpleiot/simpleiot/test"
 )
 
+// serverUnits holds the registers for each unit ID a server responds to.
+// The units of a TCPServer are shared by all connections.
+type serverUnits struct {
+	lock sync.RWMutex
+	regs map[byte]*Regs
+}
+
+func newServerUnits(id byte, regs *Regs) *serverUnits {
+	return &serverUnits{regs: map[byte]*Regs{id: regs}}
+}
+
+func (u *serverUnits) add(id byte, regs *Regs) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	u.regs[id] = regs
+}
+
+func (u *serverUnits) remove(id byte) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	delete(u.regs, id)
+}
+
+func (u *serverUnits) get(id byte) *Regs {
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+	return u.regs[id]
+}
+
+func (u *serverUnits) all() []*Regs {
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+	ret := make([]*Regs, 0, len(u.regs))
+	for _, r := range u.regs {
+		ret = append(ret, r)
+	}
+	return ret
+}
+
+// isBroadcastWrite returns true if a function code can be broadcast to all
+// devices (unit ID 0)
+func isBroadcastWrite(fc FunctionCode) bool {
+	switch fc {
+	case FuncCodeWriteSingleCoil, FuncCodeWriteMultipleCoils,
+		FuncCodeWriteSingleRegister, FuncCodeWriteMultipleRegisters,
+		FuncCodeMaskWriteRegister:
+		return true
+	}
+	return false
+}
+
 // Server defines a server (slave)
-// Current Server only supports Modbus RTU,
-// but could be expanded to do ASCII and TCP.
+// Server is used with the RTU, ASCII, and UDP transports,
+// TCPServer creates a Server for each TCP connection.
+// A server can respond to several unit IDs, each with its own registers,
+// which is useful for simulating a bus with several devices. On serial
+// transports, write requests to the broadcast ID 0 are applied to all units
+// and are not answered.
 type Server struct {
-	id        byte
 	transport Transport
-	regs      *Regs
+	units     *serverUnits
 	chDone    chan bool
 	debug     int
 }
@@ -23,17 +78,31 @@ type Server struct {
 // NewServer creates a new server instance
 // port must return an entire packet for each Read().
 // github.com/simpleiot/simpleiot/respreader is a good
-// way to do this.
+// way to do this. Additional unit IDs can be added with AddID.
 func NewServer(id byte, transport Transport, regs *Regs, debug int) *Server {
+	return newServer(transport, newServerUnits(id, regs), debug)
+}
+
+func newServer(transport Transport, units *serverUnits, debug int) *Server {
 	return &Server{
-		id:        id,
 		transport: transport,
-		regs:      regs,
+		units:     units,
 		chDone:    make(chan bool),
 		debug:     debug,
 	}
 }
 
+// AddID adds a unit ID to the server, or replaces the registers for an
+// existing ID. This can be called while the server is listening.
+func (s *Server) AddID(id byte, regs *Regs) {
+	s.units.add(id, regs)
+}
+
+// RemoveID removes a unit ID from the server
+func (s *Server) RemoveID(id byte) {
+	s.units.remove(id)
+}
+
 // Close stops the listening channel
 func (s *Server) Close() error {
 	s.transport.Close()
@@ -58,12 +127,14 @@ func (s *Server) Listen(errorCallback func(error),
 			return
 		default:
 		}
-		buf := make([]byte, 200)
+		buf := make([]byte, maxADUSize)
 		cnt, err := s.transport.Read(buf)
 		if err != nil {
-			if err != io.EOF && s.transport.Type() == TransportTypeRTU {
-				// only print errors for RTU for now as we get timeout
-				// errors with TCP
+			if err != io.EOF && s.transport.Type() != TransportTypeTCP &&
+				s.transport.Type() != TransportTypeUDP {
+				// only print errors for serial transports for now as we get timeout
+				// errors with TCP, and a closed socket error when a UDP
+				// server is closed
 				log.Println("Error reading modbus port: ", err)
 			}
 
@@ -100,7 +171,13 @@ func (s *Server) Listen(errorCallback func(error),
 			continue
 		}
 
-		if id != s.id {
+		if s.isBroadcast(id) {
+			s.broadcast(req, errorCallback, changesCallback)
+			continue
+		}
+
+		regs := s.units.get(id)
+		if regs == nil {
 			// packet is not for this device
 			// for RTU this is normal as the devices are all listening
 			// on one bus.
@@ -111,10 +188,10 @@ func (s *Server) Listen(errorCallback func(error),
 		}
 
 		if s.debug >= 2 {
-			fmt.Println("Modbus server req: ", req)
+			fmt.Printf("Modbus server ID:0x%x req: %v\n", id, req)
 		}
 
-		regsChanged, resp, err := req.ProcessRequest(s.regs)
+		regsChanged, resp, err := req.ProcessRequest(regs)
 		if regsChanged {
 			changesCallback()
 		}
@@ -128,7 +205,7 @@ func (s *Server) Listen(errorCallback func(error),
 			fmt.Println("Modbus server resp: ", resp)
 		}
 
-		respRtu, err := s.transport.Encode(s.id, resp)
+		respRtu, err := s.transport.Encode(id, resp)
 		if err != nil {
 			errorCallback(err)
 			continue
@@ -145,3 +222,44 @@ func (s *Server) Listen(errorCallback func(error),
 		}
 	}
 }
+
+// isBroadcast returns true if a request to id is a broadcast. ID 0 is only
+// the broadcast ID on serial buses, TCP and UDP devices often use it as a
+// normal unit ID. A server with unit 0 also answers requests to it.
+func (s *Server) isBroadcast(id byte) bool {
+	switch s.transport.Type() {
+	case TransportTypeRTU, TransportTypeASCII:
+		return id == 0 && s.units.get(0) == nil
+	default:
+		return false
+	}
+}
+
+// broadcast applies a broadcast write request to all units. There is no
+// response to broadcast requests.
+func (s *Server) broadcast(req PDU, errorCallback func(error), changesCallback func()) {
+	if !isBroadcastWrite(req.FunctionCode) {
+		if s.debug >= 2 {
+			fmt.Println("Modbus server ignoring broadcast req: ", req)
+		}
+		return
+	}
+
+	if s.debug >= 2 {
+		fmt.Println("Modbus server broadcast req: ", req)
+	}
+
+	changed := false
+
+	for _, regs := range s.units.all() {
+		regsChanged, _, err := req.ProcessRequest(regs)
+		if err != nil {
+			errorCallback(err)
+		}
+		changed = changed || regsChanged
+	}
+
+	if changed {
+		changesCallback()
+	}
+}
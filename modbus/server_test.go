@@ -0,0 +1,124 @@
+package modbus
+
+import (
+	"testing"
+	"time"
+
+	"github.com/simpleiot/simpleiot/respreader"
+	"github.com/simpleiot/simpleiot/test"
+)
+
+func TestServerMultipleIDs(t *testing.T) {
+	a, b := test.NewIoSim()
+
+	regs1 := &Regs{}
+	regs1.AddReg(10, 1)
+	_ = regs1.WriteReg(10, 1)
+
+	regs2 := &Regs{}
+	regs2.AddReg(10, 1)
+	_ = regs2.WriteReg(10, 2)
+
+	portA := respreader.NewReadWriteCloser(a, time.Second*2, 5*time.Millisecond)
+	server := NewServer(1, NewRTU(portA), regs1, 0)
+	server.AddID(2, regs2)
+
+	changes := make(chan bool, 10)
+	go server.Listen(func(error) {}, func() { changes <- true }, func() {})
+	defer server.Close()
+
+	portB := respreader.NewReadWriteCloser(b, 100*time.Millisecond, 5*time.Millisecond)
+	transportB := NewRTU(portB)
+	client := NewClient(transportB, 0)
+
+	for id, exp := range map[byte]uint16{1: 1, 2: 2} {
+		hr, err := client.ReadHoldingRegs(id, 10, 1)
+		if err != nil {
+			t.Fatalf("ID %v: read holding regs returned err: %v", id, err)
+		}
+		if hr[0] != exp {
+			t.Errorf("ID %v: expected %v, got %v", id, exp, hr[0])
+		}
+	}
+
+	// broadcast writes go to all units and are not answered
+	packet, err := transportB.Encode(0, WriteSingleReg(10, 0x55))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = transportB.Write(packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-changes:
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for broadcast write")
+	}
+
+	for _, regs := range []*Regs{regs1, regs2} {
+		v, _ := regs.ReadReg(10)
+		if v != 0x55 {
+			t.Errorf("broadcast not written, got 0x%x", v)
+		}
+	}
+
+	server.RemoveID(2)
+
+	_, err = client.ReadHoldingRegs(2, 10, 1)
+	if err == nil {
+		t.Fatal("expected error reading removed ID")
+	}
+}
+
+func TestServerUnitZero(t *testing.T) {
+	regs := &Regs{}
+	regs.AddReg(10, 1)
+	_ = regs.WriteReg(10, 3)
+
+	// ID 0 is not a broadcast on UDP and TCP
+	server, err := NewUDPServer(0, "15504", regs, 0)
+	if err != nil {
+		t.Fatal("Error starting UDP server: ", err)
+	}
+
+	go server.Listen(func(error) {}, func() {}, func() {})
+	defer server.Close()
+
+	transport, err := NewUDPClient("localhost:15504", 500*time.Millisecond)
+	if err != nil {
+		t.Fatal("Error opening UDP client: ", err)
+	}
+
+	client := NewClient(transport, 0)
+	defer client.Close()
+
+	hr, err := client.ReadHoldingRegs(0, 10, 1)
+	if err != nil {
+		t.Fatal("UDP read holding regs returned err: ", err)
+	}
+	if hr[0] != 3 {
+		t.Errorf("UDP: expected 3, got %v", hr[0])
+	}
+
+	// a serial server with unit 0 answers requests to it
+	a, b := test.NewIoSim()
+
+	portA := respreader.NewReadWriteCloser(a, time.Second*2, 5*time.Millisecond)
+	rtuServer := NewServer(0, NewRTU(portA), regs, 0)
+	go rtuServer.Listen(func(error) {}, func() {}, func() {})
+	defer rtuServer.Close()
+
+	portB := respreader.NewReadWriteCloser(b, 100*time.Millisecond, 5*time.Millisecond)
+	rtuClient := NewClient(NewRTU(portB), 0)
+
+	hr, err = rtuClient.ReadHoldingRegs(0, 10, 1)
+	if err != nil {
+		t.Fatal("RTU read holding regs returned err: ", err)
+	}
+	if hr[0] != 3 {
+		t.Errorf("RTU: expected 3, got %v", hr[0])
+	}
+}
@@ -117,10 +117,9 @@ func (t *TCP) Type() TransportType {
 // on the port.
 type TCPServer struct {
 	// config
-	id         int
 	maxClients int
 	port       string
-	regs       *Regs
+	units      *serverUnits
 	debug      int
 
 	// state
@@ -130,7 +129,8 @@ type TCPServer struct {
 	stopped  bool
 }
 
-// NewTCPServer starts a new TCP modbus server
+// NewTCPServer starts a new TCP modbus server. Additional unit IDs can be
+// added with AddID.
 func NewTCPServer(id, maxClients int, port string, regs *Regs, debug int) (*TCPServer, error) {
 	listener, err := net.Listen("tcp", ":"+port)
 	if err != nil {
@@ -138,10 +138,9 @@ func NewTCPServer(id, maxClients int, port string, regs *Regs, debug int) (*TCPS
 	}
 
 	return &TCPServer{
-		id:         id,
 		maxClients: maxClients,
 		port:       port,
-		regs:       regs,
+		units:      newServerUnits(byte(id), regs),
 		listener:   listener,
 		debug:      debug,
 	}, nil
@@ -174,7 +173,7 @@ func (ts *TCPServer) Listen(errorCallback func(error),
 		ts.lock.Lock()
 		if len(ts.servers) < ts.maxClients {
 			transport := NewTCP(sock, 500*time.Millisecond, TransportServer)
-			server := NewServer(byte(ts.id), transport, ts.regs, ts.debug)
+			server := newServer(transport, ts.units, ts.debug)
 			ts.servers = append(ts.servers, server)
 			go server.Listen(errorCallback,
 				changesCallback, func() {
@@ -196,6 +195,17 @@ func (ts *TCPServer) Listen(errorCallback func(error),
 	}
 }
 
+// AddID adds a unit ID to the server, or replaces the registers for an
+// existing ID. The ID is available on all connections.
+func (ts *TCPServer) AddID(id byte, regs *Regs) {
+	ts.units.add(id, regs)
+}
+
+// RemoveID removes a unit ID from the server
+func (ts *TCPServer) RemoveID(id byte) {
+	ts.units.remove(id)
+}
+
 // Close stops the server and closes all connections
 func (ts *TCPServer) Close() error {
 	if ts.debug > 0 {
@@ -9,10 +9,16 @@ type TransportType string
 
 // define valid transport types
 const (
-	TransportTypeTCP TransportType = "tcp"
-	TransportTypeRTU TransportType = "rtu"
+	TransportTypeTCP   TransportType = "tcp"
+	TransportTypeRTU   TransportType = "rtu"
+	TransportTypeASCII TransportType = "ascii"
+	TransportTypeUDP   TransportType = "udp"
 )
 
+// maxADUSize is the max size of a packet for all transports. RTU packets are
+// up to 256 bytes, TCP up to 260, and ASCII frames up to 513 characters.
+const maxADUSize = asciiMaxSize
+
 // TransportClientServer defines if transport is being used for a client or server
 type TransportClientServer string
 
@@ -0,0 +1,117 @@
+package modbus
+
+import (
+	"errors"
+	"net"
+	"time"
+)
+
+// UDP defines a Modbus UDP connection. Packets use the same MBAP header as
+// Modbus TCP, and each datagram contains one packet.
+type UDP struct {
+	conn net.PacketConn
+	// for clients, the address of the server. For servers, the address
+	// of the client that sent the last request.
+	addr         net.Addr
+	timeout      time.Duration
+	clientServer TransportClientServer
+	// MBAP encoding is the same as TCP
+	mbap *TCP
+}
+
+// NewUDP creates a new UDP transport. For clients, addr is the address of
+// the server, and packets from other addresses are ignored. For servers,
+// addr is not used, and responses are sent to the address of the last
+// request. If timeout is 0, reads do not time out.
+func NewUDP(conn net.PacketConn, addr net.Addr, timeout time.Duration,
+	clientServer TransportClientServer) *UDP {
+	return &UDP{
+		conn:         conn,
+		addr:         addr,
+		timeout:      timeout,
+		clientServer: clientServer,
+		mbap:         NewTCP(nil, timeout, clientServer),
+	}
+}
+
+func (u *UDP) Read(p []byte) (int, error) {
+	var deadline time.Time
+	if u.timeout > 0 {
+		deadline = time.Now().Add(u.timeout)
+	}
+
+	err := u.conn.SetReadDeadline(deadline)
+	if err != nil {
+		return 0, err
+	}
+
+	for {
+		cnt, addr, err := u.conn.ReadFrom(p)
+		if err != nil {
+			return cnt, err
+		}
+
+		if u.clientServer == TransportServer {
+			u.addr = addr
+			return cnt, nil
+		}
+
+		if addr.String() == u.addr.String() {
+			return cnt, nil
+		}
+	}
+}
+
+func (u *UDP) Write(p []byte) (int, error) {
+	if u.addr == nil {
+		return 0, errors.New("UDP address is not set")
+	}
+
+	return u.conn.WriteTo(p, u.addr)
+}
+
+// Close closes the UDP connection
+func (u *UDP) Close() error {
+	return u.conn.Close()
+}
+
+// Encode encodes a UDP packet
+func (u *UDP) Encode(id byte, pdu PDU) ([]byte, error) {
+	return u.mbap.Encode(id, pdu)
+}
+
+// Decode decodes a UDP packet
+func (u *UDP) Decode(packet []byte) (byte, PDU, error) {
+	return u.mbap.Decode(packet)
+}
+
+// Type returns TransportType
+func (u *UDP) Type() TransportType {
+	return TransportTypeUDP
+}
+
+// NewUDPClient creates a UDP transport for a client that sends requests
+// to the server at address (host:port)
+func NewUDPClient(address string, timeout time.Duration) (*UDP, error) {
+	addr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.ListenPacket("udp", ":0")
+	if err != nil {
+		return nil, err
+	}
+
+	return NewUDP(conn, addr, timeout, TransportClient), nil
+}
+
+// NewUDPServer creates a server that responds to Modbus UDP requests on port
+func NewUDPServer(id byte, port string, regs *Regs, debug int) (*Server, error) {
+	conn, err := net.ListenPacket("udp", ":"+port)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewServer(id, NewUDP(conn, nil, 0, TransportServer), regs, debug), nil
+}
@@ -0,0 +1,58 @@
+package modbus
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUDPEndToEnd(t *testing.T) {
+	regs := &Regs{}
+	regs.AddReg(2, 1)
+	err := regs.WriteReg(2, 0x1234)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server, err := NewUDPServer(1, "15503", regs, 0)
+	if err != nil {
+		t.Fatal("Error starting UDP server: ", err)
+	}
+
+	go server.Listen(func(err error) {
+		t.Log("modbus server listen error: ", err)
+	}, func() {}, func() {})
+	defer server.Close()
+
+	transport, err := NewUDPClient("localhost:15503", 500*time.Millisecond)
+	if err != nil {
+		t.Fatal("Error opening UDP client: ", err)
+	}
+
+	client := NewClient(transport, 0)
+	defer client.Close()
+
+	hr, err := client.ReadHoldingRegs(1, 2, 1)
+	if err != nil {
+		t.Fatal("read holding regs returned err: ", err)
+	}
+
+	if len(hr) != 1 || hr[0] != 0x1234 {
+		t.Fatalf("wrong holding reg value: %v", hr)
+	}
+
+	err = client.WriteSingleReg(1, 2, 0x5678)
+	if err != nil {
+		t.Fatal("write single reg returned err: ", err)
+	}
+
+	v, _ := regs.ReadReg(2)
+	if v != 0x5678 {
+		t.Fatalf("reg not written, got 0x%x", v)
+	}
+
+	// requests for other IDs are ignored so the client times out
+	_, err = client.ReadHoldingRegs(2, 2, 1)
+	if err == nil {
+		t.Fatal("expected error for wrong device ID")
+	}
+}
@@ -0,0 +1,324 @@
+package node_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+	"github.com/simpleiot/simpleiot/modbus"
+	"github.com/simpleiot/simpleiot/server"
+)
+
+// readModbusReg reads an input register from the UDP server until it has
+// the expected value
+func readModbusReg(port string, address int, exp uint16) error {
+	var err error
+	var regs []uint16
+
+	start := time.Now()
+
+	for time.Since(start) < 5*time.Second {
+		var transport *modbus.UDP
+		transport, err = modbus.NewUDPClient("localhost:"+port, 100*time.Millisecond)
+		if err != nil {
+			return err
+		}
+
+		c := modbus.NewClient(transport, 0)
+		regs, err = c.ReadInputRegs(1, uint16(address), 1)
+		c.Close()
+
+		if err == nil && len(regs) == 1 && regs[0] == exp {
+			return nil
+		}
+
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	return fmt.Errorf("expected reg %v to be %v, got %v, err: %v", address,
+		exp, regs, err)
+}
+
+func TestModbusClientConfigChanges(t *testing.T) {
+	nc, root, stop, err := server.TestServer()
+	if err != nil {
+		t.Fatal("Error starting test server: ", err)
+	}
+
+	defer stop()
+
+	bus := data.NodeEdge{
+		ID:     "ID-modbus",
+		Type:   data.NodeTypeModbus,
+		Parent: root.ID,
+		Points: data.Points{
+			{Type: data.PointTypeClientServer, Text: data.PointValueServer},
+			{Type: data.PointTypeProtocol, Text: data.PointValueUDP},
+			{Type: data.PointTypePort, Text: "15510"},
+			{Type: data.PointTypeID, Value: 1},
+		},
+	}
+
+	err = client.SendNode(nc, bus, "test")
+	if err != nil {
+		t.Fatal("Error sending bus node: ", err)
+	}
+
+	io := data.NodeEdge{
+		ID:     "ID-modbusIo",
+		Type:   data.NodeTypeModbusIO,
+		Parent: bus.ID,
+		Points: data.Points{
+			{Type: data.PointTypeModbusIOType, Text: data.PointValueModbusInputRegister},
+			{Type: data.PointTypeDataFormat, Text: data.PointValueUINT16},
+			{Type: data.PointTypeAddress, Value: 10},
+			{Type: data.PointTypeScale, Value: 1},
+			{Type: data.PointTypeValue, Value: 5},
+		},
+	}
+
+	err = client.SendNode(nc, io, "test")
+	if err != nil {
+		t.Fatal("Error sending IO node: ", err)
+	}
+
+	if err := readModbusReg("15510", 10, 5); err != nil {
+		t.Fatal("Initial read: ", err)
+	}
+
+	// IO config changes are applied while the bus is running
+	err = client.SendNodePoints(nc, io.ID, data.Points{
+		{Type: data.PointTypeAddress, Value: 11, Origin: "test"},
+	}, true)
+	if err != nil {
+		t.Fatal("Error sending IO points: ", err)
+	}
+
+	if err := readModbusReg("15510", 11, 5); err != nil {
+		t.Fatal("After address change: ", err)
+	}
+
+	err = client.SendNodePoints(nc, io.ID, data.Points{
+		{Type: data.PointTypeValue, Value: 7, Origin: "test"},
+	}, true)
+	if err != nil {
+		t.Fatal("Error sending IO points: ", err)
+	}
+
+	if err := readModbusReg("15510", 11, 7); err != nil {
+		t.Fatal("After value change: ", err)
+	}
+
+	// bus config changes re-open the port
+	err = client.SendNodePoints(nc, bus.ID, data.Points{
+		{Type: data.PointTypePort, Text: "15511", Origin: "test"},
+	}, true)
+	if err != nil {
+		t.Fatal("Error sending bus points: ", err)
+	}
+
+	if err := readModbusReg("15511", 11, 7); err != nil {
+		t.Fatal("After port change: ", err)
+	}
+}
+
+// waitIOValue waits for an IO node to have the expected value
+func waitIOValue(nc *nats.Conn, id string, exp float64) error {
+	var value float64
+
+	start := time.Now()
+
+	for time.Since(start) < 5*time.Second {
+		nodes, err := client.GetNodes(nc, "all", id, "", false)
+		if err != nil {
+			return err
+		}
+
+		if len(nodes) > 0 {
+			value, _ = nodes[0].Points.Value(data.PointTypeValue, "0")
+			if value == exp {
+				return nil
+			}
+		}
+
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	return fmt.Errorf("expected %v value to be %v, got %v", id, exp, value)
+}
+
+func TestModbusClientBlockFallback(t *testing.T) {
+	nc, root, stop, err := server.TestServer()
+	if err != nil {
+		t.Fatal("Error starting test server: ", err)
+	}
+
+	defer stop()
+
+	// the device does not have reg 1, so a block read of 0-2 fails
+	regs := &modbus.Regs{}
+	regs.AddReg(0, 1)
+	regs.AddReg(2, 1)
+	_ = regs.WriteReg(0, 3)
+	_ = regs.WriteReg(2, 4)
+
+	serv, err := modbus.NewUDPServer(1, "15512", regs, 0)
+	if err != nil {
+		t.Fatal("Error starting modbus server: ", err)
+	}
+
+	go serv.Listen(func(err error) {
+		t.Log("modbus server listen error: ", err)
+	}, func() {}, func() {})
+	defer serv.Close()
+
+	bus := data.NodeEdge{
+		ID:     "ID-modbus",
+		Type:   data.NodeTypeModbus,
+		Parent: root.ID,
+		Points: data.Points{
+			{Type: data.PointTypeClientServer, Text: data.PointValueClient},
+			{Type: data.PointTypeProtocol, Text: data.PointValueUDP},
+			{Type: data.PointTypeURI, Text: "localhost:15512"},
+			{Type: data.PointTypePollPeriod, Value: 100},
+			{Type: data.PointTypePollMaxGap, Value: 1},
+		},
+	}
+
+	for i, address := range []int{0, 2} {
+		value, _ := regs.ReadReg(address)
+
+		io := data.NodeEdge{
+			ID:     fmt.Sprintf("ID-modbusIo%v", i),
+			Type:   data.NodeTypeModbusIO,
+			Parent: bus.ID,
+			Points: data.Points{
+				{Type: data.PointTypeID, Value: 1},
+				{Type: data.PointTypeModbusIOType, Text: data.PointValueModbusHoldingRegister},
+				{Type: data.PointTypeDataFormat, Text: data.PointValueUINT16},
+				{Type: data.PointTypeAddress, Value: float64(address)},
+				{Type: data.PointTypeScale, Value: 1},
+				{Type: data.PointTypeValueSet, Value: float64(value)},
+			},
+		}
+
+		err = client.SendNode(nc, io, "test")
+		if err != nil {
+			t.Fatal("Error sending IO node: ", err)
+		}
+	}
+
+	// the IOs are created first so they are loaded when the bus client starts
+	err = client.SendNode(nc, bus, "test")
+	if err != nil {
+		t.Fatal("Error sending bus node: ", err)
+	}
+
+	if err := waitIOValue(nc, "ID-modbusIo0", 3); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := waitIOValue(nc, "ID-modbusIo1", 4); err != nil {
+		t.Fatal(err)
+	}
+
+	// values are still written when the IOs are polled one at a time
+	err = client.SendNodePoints(nc, "ID-modbusIo1", data.Points{
+		{Type: data.PointTypeValueSet, Value: 9, Origin: "test"},
+	}, true)
+	if err != nil {
+		t.Fatal("Error sending IO points: ", err)
+	}
+
+	if err := waitIOValue(nc, "ID-modbusIo1", 9); err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := regs.ReadReg(2)
+	if err != nil || v != 9 {
+		t.Fatal("reg 2 was not written: ", v, err)
+	}
+}
+
+func TestModbusClientWriteASCII(t *testing.T) {
+	nc, root, stop, err := server.TestServer()
+	if err != nil {
+		t.Fatal("Error starting test server: ", err)
+	}
+
+	defer stop()
+
+	regs := &modbus.Regs{}
+	regs.AddReg(0, 3)
+	_ = regs.WriteReg(0, 'A'<<8|'B')
+
+	serv, err := modbus.NewUDPServer(1, "15513", regs, 0)
+	if err != nil {
+		t.Fatal("Error starting modbus server: ", err)
+	}
+
+	go serv.Listen(func(err error) {
+		t.Log("modbus server listen error: ", err)
+	}, func() {}, func() {})
+	defer serv.Close()
+
+	bus := data.NodeEdge{
+		ID:     "ID-modbus",
+		Type:   data.NodeTypeModbus,
+		Parent: root.ID,
+		Points: data.Points{
+			{Type: data.PointTypeClientServer, Text: data.PointValueClient},
+			{Type: data.PointTypeProtocol, Text: data.PointValueUDP},
+			{Type: data.PointTypeURI, Text: "localhost:15513"},
+			{Type: data.PointTypePollPeriod, Value: 100},
+		},
+	}
+
+	io := data.NodeEdge{
+		ID:     "ID-modbusIo",
+		Type:   data.NodeTypeModbusIO,
+		Parent: bus.ID,
+		Points: data.Points{
+			{Type: data.PointTypeID, Value: 1},
+			{Type: data.PointTypeModbusIOType, Text: data.PointValueModbusHoldingRegister},
+			{Type: data.PointTypeDataFormat, Text: data.PointValueASCII},
+			{Type: data.PointTypeRegCount, Value: 3},
+			{Type: data.PointTypeAddress, Value: 0},
+			{Type: data.PointTypeValueSet, Text: "hello"},
+		},
+	}
+
+	err = client.SendNode(nc, io, "test")
+	if err != nil {
+		t.Fatal("Error sending IO node: ", err)
+	}
+
+	// the IO is created first so it is loaded when the bus client starts
+	err = client.SendNode(nc, bus, "test")
+	if err != nil {
+		t.Fatal("Error sending bus node: ", err)
+	}
+
+	var text string
+	start := time.Now()
+
+	for time.Since(start) < 5*time.Second {
+		var v []uint16
+		for a := 0; a < 3; a++ {
+			r, _ := regs.ReadReg(a)
+			v = append(v, r)
+		}
+
+		text = modbus.RegsToString(v)
+		if text == "hello" {
+			return
+		}
+
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	t.Fatalf("expected regs to be %q, got %q", "hello", text)
+}
@@ -0,0 +1,149 @@
+package node
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+
+	"github.com/simpleiot/simpleiot/data"
+	"github.com/simpleiot/simpleiot/modbus"
+)
+
+// formatRegCount returns the number of registers used by a register IO
+func (io *ModbusIo) formatRegCount() int {
+	switch io.DataFormat {
+	case data.PointValueUINT16, data.PointValueINT16, data.PointValueBitField:
+		return 1
+	case data.PointValueUINT32, data.PointValueINT32,
+		data.PointValueFLOAT32:
+		return 2
+	case data.PointValueUINT64, data.PointValueINT64,
+		data.PointValueFLOAT64:
+		return 4
+	case data.PointValueBCD, data.PointValueASCII:
+		if io.RegCount > 0 {
+			return io.RegCount
+		}
+		return 1
+	default:
+		log.Println("formatRegCount, unknown data type: ", io.DataFormat)
+		// be conservative
+		return 2
+	}
+}
+
+// reorder converts regs between the IO byte order and ABCD order. Bit
+// fields are not reordered as the mask applies to the register value.
+func (io *ModbusIo) reorder(regs []uint16) []uint16 {
+	if io.DataFormat == data.PointValueBitField {
+		return regs
+	}
+	return modbus.ReorderRegs(regs, len(regs), modbus.ByteOrder(io.ByteOrder))
+}
+
+// regsToValue converts the registers for an IO to a scaled value. ASCII
+// values are returned as text.
+func (io *ModbusIo) regsToValue(regs []uint16) (float64, string, error) {
+	count := io.formatRegCount()
+	if len(regs) < count {
+		return 0, "", errors.New("Did not receive enough data")
+	}
+
+	regs = io.reorder(regs[:count])
+
+	var v float64
+
+	switch io.DataFormat {
+	case data.PointValueUINT16:
+		v = float64(regs[0])
+	case data.PointValueINT16:
+		v = float64(int16(regs[0]))
+	case data.PointValueUINT32:
+		v = float64(modbus.RegsToUint32(regs)[0])
+	case data.PointValueINT32:
+		v = float64(modbus.RegsToInt32(regs)[0])
+	case data.PointValueFLOAT32:
+		v = float64(modbus.RegsToFloat32(regs)[0])
+	case data.PointValueUINT64:
+		v = float64(modbus.RegsToUint64(regs)[0])
+	case data.PointValueINT64:
+		v = float64(modbus.RegsToInt64(regs)[0])
+	case data.PointValueFLOAT64:
+		v = modbus.RegsToFloat64(regs)[0]
+	case data.PointValueBCD:
+		bcd, err := modbus.RegsToBCD(regs)
+		if err != nil {
+			return 0, "", err
+		}
+		v = float64(bcd)
+	case data.PointValueASCII:
+		return 0, modbus.RegsToString(regs), nil
+	case data.PointValueBitField:
+		v = float64(modbus.RegToBitField(regs[0], io.BitMask))
+	default:
+		return 0, "", fmt.Errorf("unhandled data type: %v",
+			io.DataFormat)
+	}
+
+	return v*io.Scale + io.Offset, "", nil
+}
+
+// valueSetText returns the text value set of an ASCII IO as it is read back
+// from the device after it is written
+func (io *ModbusIo) valueSetText() string {
+	return modbus.RegsToString(modbus.StringToRegs(io.ValueSetText,
+		io.formatRegCount()))
+}
+
+// valueToRegs converts a scaled value (or text for ASCII IOs) to the
+// registers for an IO. For bit fields, a single register that contains the
+// field value in the mask bits is returned.
+func (io *ModbusIo) valueToRegs(value float64, text string) ([]uint16, error) {
+	if io.DataFormat == data.PointValueASCII {
+		return io.reorder(modbus.StringToRegs(text, io.formatRegCount())), nil
+	}
+
+	unscaled := (value - io.Offset) / io.Scale
+
+	// integer formats are rounded so scaling errors don't truncate
+	// 12.3/0.1 to 122
+	rounded := math.Round(unscaled)
+
+	var regs []uint16
+
+	switch io.DataFormat {
+	case data.PointValueUINT16:
+		regs = []uint16{uint16(rounded)}
+	case data.PointValueINT16:
+		regs = []uint16{uint16(int16(rounded))}
+	case data.PointValueUINT32:
+		regs = modbus.Uint32ToRegs([]uint32{uint32(rounded)})
+	case data.PointValueINT32:
+		regs = modbus.Int32ToRegs([]int32{int32(rounded)})
+	case data.PointValueFLOAT32:
+		regs = modbus.Float32ToRegs([]float32{float32(unscaled)})
+	case data.PointValueUINT64:
+		regs = modbus.Uint64ToRegs([]uint64{uint64(rounded)})
+	case data.PointValueINT64:
+		regs = modbus.Int64ToRegs([]int64{int64(rounded)})
+	case data.PointValueFLOAT64:
+		regs = modbus.Float64ToRegs([]float64{unscaled})
+	case data.PointValueBCD:
+		if rounded < 0 {
+			return nil, fmt.Errorf("BCD value can't be negative: %v", rounded)
+		}
+		var err error
+		regs, err = modbus.BCDToRegs(uint64(rounded), io.formatRegCount())
+		if err != nil {
+			return nil, err
+		}
+	case data.PointValueBitField:
+		regs = []uint16{modbus.BitFieldToReg(0, io.BitMask, uint16(rounded))}
+	default:
+		return nil, fmt.Errorf("unhandled data type: %v",
+			io.DataFormat)
+	}
+
+	return io.reorder(regs), nil
+}
@@ -0,0 +1,68 @@
+package node
+
+import (
+	"testing"
+
+	"github.com/simpleiot/simpleiot/data"
+)
+
+func TestModbusFormats(t *testing.T) {
+	tests := []struct {
+		io    ModbusIo
+		value float64
+		text  string
+		regs  []uint16
+	}{
+		{ModbusIo{DataFormat: data.PointValueINT16, Scale: 0.1},
+			-12.3, "", []uint16{0xff85}},
+		{ModbusIo{DataFormat: data.PointValueUINT32, Scale: 1},
+			0x12345678, "", []uint16{0x1234, 0x5678}},
+		{ModbusIo{DataFormat: data.PointValueUINT32, Scale: 1,
+			ByteOrder: data.PointValueCDAB}, 0x12345678, "", []uint16{0x5678, 0x1234}},
+		{ModbusIo{DataFormat: data.PointValueFLOAT32, Scale: 1,
+			ByteOrder: data.PointValueDCBA}, 0.5, "", []uint16{0x0000, 0x003f}},
+		{ModbusIo{DataFormat: data.PointValueINT64, Scale: 1},
+			-2, "", []uint16{0xffff, 0xffff, 0xffff, 0xfffe}},
+		{ModbusIo{DataFormat: data.PointValueFLOAT64, Scale: 1,
+			ByteOrder: data.PointValueBADC}, 1, "", []uint16{0xf03f, 0, 0, 0}},
+		{ModbusIo{DataFormat: data.PointValueBCD, Scale: 1,
+			RegCount: 2}, 123456, "", []uint16{0x0012, 0x3456}},
+		{ModbusIo{DataFormat: data.PointValueASCII, RegCount: 3},
+			0, "SIOT", []uint16{0x5349, 0x4f54, 0}},
+		{ModbusIo{DataFormat: data.PointValueBitField, Scale: 1,
+			BitMask: 0x00f0}, 5, "", []uint16{0x0050}},
+	}
+
+	for _, test := range tests {
+		regs, err := test.io.valueToRegs(test.value, test.text)
+		if err != nil {
+			t.Errorf("%v: valueToRegs error: %v", test.io.DataFormat, err)
+			continue
+		}
+
+		if len(regs) != len(test.regs) {
+			t.Errorf("%v: expected regs %x, got %x", test.io.DataFormat,
+				test.regs, regs)
+			continue
+		}
+
+		for i := range regs {
+			if regs[i] != test.regs[i] {
+				t.Errorf("%v: expected regs %x, got %x", test.io.DataFormat,
+					test.regs, regs)
+				break
+			}
+		}
+
+		v, text, err := test.io.regsToValue(regs)
+		if err != nil {
+			t.Errorf("%v: regsToValue error: %v", test.io.DataFormat, err)
+			continue
+		}
+
+		if v != test.value || text != test.text {
+			t.Errorf("%v: expected %v %q, got %v %q", test.io.DataFormat,
+				test.value, test.text, v, text)
+		}
+	}
+}
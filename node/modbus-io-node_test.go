@@ -0,0 +1,31 @@
+package node
+
+import (
+	"testing"
+
+	"github.com/simpleiot/simpleiot/data"
+)
+
+func TestModbusIoCheck(t *testing.T) {
+	hr := data.PointValueModbusHoldingRegister
+
+	tests := []struct {
+		name string
+		io   ModbusIo
+		ok   bool
+	}{
+		{"coil", ModbusIo{ModbusIOType: data.PointValueModbusCoil}, true},
+		{"no type", ModbusIo{}, false},
+		{"no format", ModbusIo{ModbusIOType: hr, Scale: 1}, false},
+		{"no scale", ModbusIo{ModbusIOType: hr, DataFormat: data.PointValueUINT16}, false},
+		{"scale", ModbusIo{ModbusIOType: hr, DataFormat: data.PointValueUINT16, Scale: 0.1}, true},
+		{"ascii", ModbusIo{ModbusIOType: hr, DataFormat: data.PointValueASCII}, true},
+	}
+
+	for _, test := range tests {
+		err := test.io.check()
+		if (err == nil) != test.ok {
+			t.Errorf("%v: expected ok %v, got err: %v", test.name, test.ok, err)
+		}
+	}
+}
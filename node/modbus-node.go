@@ -4,105 +4,167 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
+	"time"
 
 	"github.com/simpleiot/simpleiot/data"
 )
 
-// ModbusNode is the node data from the database
-type ModbusNode struct {
-	nodeID             string
-	busType            string
-	protocol           string
-	uri                string
-	id                 int // only used for server
-	portName           string
-	debugLevel         int
-	baud               int
-	pollPeriod         int
-	disable            bool
-	errorCount         int
-	errorCountCRC      int
-	errorCountEOF      int
-	errorCountReset    bool
-	errorCountCRCReset bool
-	errorCountEOFReset bool
+// Modbus describes a modbus bus node. The IOs on the bus are modbusIo child
+// nodes.
+type Modbus struct {
+	ID                 string             `node:"id"`
+	Parent             string             `node:"parent"`
+	Description        string             `point:"description"`
+	ClientServer       string             `point:"clientServer"`
+	Protocol           string             `point:"protocol"`
+	URI                string             `point:"uri"`
+	Port               string             `point:"port"`
+	Baud               string             `point:"baud"`
+	DeviceID           int                `point:"id"` // only used for server
+	Debug              int                `point:"debug"`
+	PollPeriod         int                `point:"pollPeriod"`
+	PollMaxGap         map[string]int     `point:"pollMaxGap"`
+	PollMaxCount       map[string]int     `point:"pollMaxCount"`
+	GatewayPort        string             `point:"gatewayPort"`
+	GatewayTimeout     int                `point:"gatewayTimeout"`
+	Disable            bool               `point:"disable"`
+	ErrorCount         int                `point:"errorCount"`
+	ErrorCountCRC      int                `point:"errorCountCRC"`
+	ErrorCountEOF      int                `point:"errorCountEOF"`
+	ErrorCountReset    bool               `point:"errorCountReset"`
+	ErrorCountCRCReset bool               `point:"errorCountCRCReset"`
+	ErrorCountEOFReset bool               `point:"errorCountEOFReset"`
+	Profiles           map[string]string  `point:"modbusProfiles"`
+	Profile            string             `point:"modbusProfile"`
+	ProfileID          int                `point:"modbusProfileId"`
+	ProfileCreate      bool               `point:"modbusProfileCreate"`
+	ScanStart          bool               `point:"scanStart"`
+	ScanIDStart        int                `point:"scanIdStart"`
+	ScanIDEnd          int                `point:"scanIdEnd"`
+	ScanAddress        int                `point:"scanAddress"`
+	ScanIOType         string             `point:"scanIoType"`
+	ScanBauds          string             `point:"scanBauds"`
+	ScanResults        map[string]float64 `point:"scanResult"`
+	IOs                []ModbusIo         `child:"modbusIo"`
 }
 
-// NewModbusNode converts a node to ModbusNode data structure
-func NewModbusNode(node data.NodeEdge) (*ModbusNode, error) {
-	ret := ModbusNode{
-		nodeID: node.ID,
-	}
-
-	var ok bool
+// pollLimits returns the max gap and max count used to read IOs on a device
+// in blocks. The limits are keyed by device ID, and key "0" is the default
+// for devices that do not have their own limits.
+func (m *Modbus) pollLimits(id int) (maxGap, maxCount int) {
+	key := strconv.Itoa(id)
 
-	ret.busType, ok = node.Points.Text(data.PointTypeClientServer, "")
+	maxGap, ok := m.PollMaxGap[key]
 	if !ok {
-		return nil, errors.New("Must define modbus client/server")
+		maxGap = m.PollMaxGap["0"]
 	}
 
-	ret.protocol, ok = node.Points.Text(data.PointTypeProtocol, "")
+	maxCount, ok = m.PollMaxCount[key]
 	if !ok {
-		return nil, errors.New("Must define modbus protocol")
+		maxCount = m.PollMaxCount["0"]
 	}
 
-	if ret.protocol == data.PointValueRTU {
-		ret.portName, ok = node.Points.Text(data.PointTypePort, "")
-		if !ok {
-			return nil, errors.New("Must define modbus port name")
-		}
+	return maxGap, maxCount
+}
+
+// check returns an error if the bus config is not complete
+func (m *Modbus) check() error {
+	switch m.ClientServer {
+	case data.PointValueClient, data.PointValueServer, data.PointValueGateway:
+	case "":
+		return errors.New("Must define modbus client/server")
+	default:
+		return fmt.Errorf("Invalid bus type: %v", m.ClientServer)
+	}
+
+	if m.Protocol == "" {
+		return errors.New("Must define modbus protocol")
+	}
 
-		baud, ok := node.Points.Text(data.PointTypeBaud, "")
-		if !ok {
-			return nil, errors.New("Must define modbus baud")
+	if m.isSerial() {
+		if m.Port == "" {
+			return errors.New("Must define modbus port name")
 		}
 
-		var err error
-		ret.baud, err = strconv.Atoi(baud)
+		if m.Baud == "" {
+			return errors.New("Must define modbus baud")
+		}
 
+		_, err := strconv.Atoi(m.Baud)
 		if err != nil {
-			return nil, fmt.Errorf("Invalid baud: %v", baud)
+			return fmt.Errorf("Invalid baud: %v", m.Baud)
 		}
 	}
 
-	if ret.protocol == data.PointValueTCP {
-		switch ret.busType {
+	switch m.Protocol {
+	case data.PointValueTCP, data.PointValueUDP:
+		switch m.ClientServer {
 		case data.PointValueClient:
-			ret.uri, ok = node.Points.Text(data.PointTypeURI, "")
-			if !ok {
-				return nil, errors.New("Must define modbus URI")
+			if m.URI == "" {
+				return errors.New("Must define modbus URI")
 			}
 		case data.PointValueServer:
-			ret.portName, ok = node.Points.Text(data.PointTypePort, "")
-			if !ok {
-				return nil, errors.New("Must define modbus port name")
+			if m.Port == "" {
+				return errors.New("Must define modbus port name")
 			}
 		default:
-			return nil, fmt.Errorf("Invalid bus type: %v", ret.busType)
+			return fmt.Errorf("Invalid bus type: %v", m.ClientServer)
+		}
+	case data.PointValueRTUOverTCP:
+		if m.ClientServer == data.PointValueServer {
+			return errors.New("Modbus RTU over TCP is not supported in server mode")
+		}
+
+		if m.URI == "" {
+			return errors.New("Must define modbus URI")
 		}
 	}
 
-	ret.pollPeriod, ok = node.Points.ValueInt(data.PointTypePollPeriod, "")
-	if ret.busType == data.PointValueClient && !ok {
-		return nil, errors.New("Must define modbus polling period for client devices")
+	if m.ClientServer == data.PointValueGateway &&
+		!m.isSerial() && m.Protocol != data.PointValueRTUOverTCP {
+		return errors.New("Modbus gateway must use RTU, ASCII, or RTU over TCP protocol")
 	}
 
-	ret.debugLevel, _ = node.Points.ValueInt(data.PointTypeDebug, "")
-	ret.disable, _ = node.Points.ValueBool(data.PointTypeDisable, "")
-	ret.errorCount, _ = node.Points.ValueInt(data.PointTypeErrorCount, "")
-	ret.errorCountCRC, _ = node.Points.ValueInt(data.PointTypeErrorCountCRC, "")
-	ret.errorCountEOF, _ = node.Points.ValueInt(data.PointTypeErrorCountEOF, "")
-	ret.errorCountReset, _ = node.Points.ValueBool(data.PointTypeErrorCountReset, "")
-	ret.errorCountCRCReset, _ = node.Points.ValueBool(data.PointTypeErrorCountCRCReset, "")
-	ret.errorCountEOFReset, _ = node.Points.ValueBool(data.PointTypeErrorCountEOFReset, "")
-
-	if ret.busType == data.PointValueServer {
-		var ok bool
-		ret.id, ok = node.Points.ValueInt(data.PointTypeID, "")
-		if !ok {
-			return nil, errors.New("Must define modbus ID for server bus")
-		}
+	if m.ClientServer == data.PointValueClient && m.PollPeriod <= 0 {
+		return errors.New("Must define modbus polling period for client devices")
 	}
 
-	return &ret, nil
+	return nil
+}
+
+// isSerial returns true if the bus uses a serial port
+func (m *Modbus) isSerial() bool {
+	return m.Protocol == data.PointValueRTU || m.Protocol == data.PointValueProtocolASCII
+}
+
+// baudRate returns the serial port baud rate, or 0 if it is not set
+func (m *Modbus) baudRate() int {
+	baud, _ := strconv.Atoi(m.Baud)
+	return baud
+}
+
+// gatewayListenPort returns the TCP port the gateway listens on
+func (m *Modbus) gatewayListenPort() string {
+	if m.GatewayPort == "" {
+		return "502"
+	}
+	return m.GatewayPort
+}
+
+// gatewayRespTimeout returns the max time the gateway waits for a response
+func (m *Modbus) gatewayRespTimeout() time.Duration {
+	if m.GatewayTimeout <= 0 {
+		return time.Second
+	}
+	return time.Duration(m.GatewayTimeout) * time.Millisecond
+}
+
+// findIO returns the IO with the node ID, or nil if it is not found
+func (m *Modbus) findIO(id string) *ModbusIo {
+	for i := range m.IOs {
+		if m.IOs[i].ID == id {
+			return &m.IOs[i]
+		}
+	}
+	return nil
 }
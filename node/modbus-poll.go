@@ -0,0 +1,255 @@
+package node
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// max number of registers or bits that can be read in one request
+const (
+	modbusMaxReadRegs = 125
+	modbusMaxReadBits = 2000
+)
+
+// modbusBlock is a group of IOs on one device that are read with a single
+// request
+type modbusBlock struct {
+	id      int
+	ioType  string
+	address int
+	count   int
+	ios     []*ModbusIo
+}
+
+func isModbusBitIO(ioType string) bool {
+	return ioType == data.PointValueModbusCoil ||
+		ioType == data.PointValueModbusDiscreteInput
+}
+
+// ioRegCount returns the number of registers or bits used by an IO
+func ioRegCount(io *ModbusIo) int {
+	if isModbusBitIO(io.ModbusIOType) {
+		return 1
+	}
+	return io.formatRegCount()
+}
+
+// modbusBlocks groups IOs into the fewest block reads. IOs are read in the
+// same block if they have the same device ID and IO type, there are no more
+// than maxGap unused registers (or bits) between them, and the block is no
+// larger than maxCount registers (or bits). limits returns maxGap and
+// maxCount for a device ID. If maxCount is 0, the protocol max is used.
+func modbusBlocks(ios []*ModbusIo, limits func(id int) (maxGap, maxCount int)) []modbusBlock {
+	sorted := make([]*ModbusIo, len(ios))
+	copy(sorted, ios)
+
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.DeviceID != b.DeviceID {
+			return a.DeviceID < b.DeviceID
+		}
+		if a.ModbusIOType != b.ModbusIOType {
+			return a.ModbusIOType < b.ModbusIOType
+		}
+		if a.Address != b.Address {
+			return a.Address < b.Address
+		}
+		return a.ID < b.ID
+	})
+
+	var ret []modbusBlock
+
+	for _, io := range sorted {
+		n := io
+		maxGap, maxCount := limits(n.DeviceID)
+
+		limit := modbusMaxReadRegs
+		if isModbusBitIO(n.ModbusIOType) {
+			limit = modbusMaxReadBits
+		}
+		if maxCount > 0 && maxCount < limit {
+			limit = maxCount
+		}
+
+		count := ioRegCount(n)
+
+		if len(ret) > 0 {
+			blk := &ret[len(ret)-1]
+			end := blk.address + blk.count
+			newEnd := end
+			if n.Address+count > newEnd {
+				newEnd = n.Address + count
+			}
+
+			if blk.id == n.DeviceID && blk.ioType == n.ModbusIOType &&
+				n.Address <= end+maxGap && newEnd-blk.address <= limit {
+				blk.count = newEnd - blk.address
+				blk.ios = append(blk.ios, io)
+				continue
+			}
+		}
+
+		ret = append(ret, modbusBlock{
+			id:      n.DeviceID,
+			ioType:  n.ModbusIOType,
+			address: n.Address,
+			count:   count,
+			ios:     []*ModbusIo{io},
+		})
+	}
+
+	return ret
+}
+
+// ReadBusBlock reads all IOs in a block from the bus with one request and
+// updates the IO values. This should only be called from client.
+func (b *ModbusClient) ReadBusBlock(blk modbusBlock) error {
+	switch blk.ioType {
+	case data.PointValueModbusCoil, data.PointValueModbusDiscreteInput:
+		readFunc := b.client.ReadCoils
+		if blk.ioType == data.PointValueModbusDiscreteInput {
+			readFunc = b.client.ReadDiscreteInputs
+		}
+
+		bits, err := readFunc(byte(blk.id), uint16(blk.address), uint16(blk.count))
+		if err != nil {
+			return err
+		}
+		if len(bits) < blk.count {
+			return errors.New("Did not receive enough data")
+		}
+
+		for _, io := range blk.ios {
+			err := b.updateIOValue(io, data.BoolToFloat(bits[io.Address-blk.address]), "")
+			if err != nil {
+				return err
+			}
+		}
+
+	case data.PointValueModbusHoldingRegister, data.PointValueModbusInputRegister:
+		readFunc := b.client.ReadHoldingRegs
+		if blk.ioType == data.PointValueModbusInputRegister {
+			readFunc = b.client.ReadInputRegs
+		}
+
+		regs, err := readFunc(byte(blk.id), uint16(blk.address), uint16(blk.count))
+		if err != nil {
+			return err
+		}
+		if len(regs) < blk.count {
+			return errors.New("Did not receive enough data")
+		}
+
+		for _, io := range blk.ios {
+			start := io.Address - blk.address
+			v, text, err := io.regsToValue(regs[start : start+ioRegCount(io)])
+			if err != nil {
+				// a config error in one IO should not stop the others
+				err := b.LogError(io, err)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+
+			err = b.updateIOValue(io, v, text)
+			if err != nil {
+				return err
+			}
+		}
+
+	default:
+		return fmt.Errorf("ReadBusBlock: unsupported modbus IO type: %v", blk.ioType)
+	}
+
+	return nil
+}
+
+// pollClientIOs reads all enabled IOs on a client bus in blocks, and then
+// writes any IOs with a pending value set. If a block read fails, the IOs in
+// the block are polled one at a time.
+func (b *ModbusClient) pollClientIOs() {
+	if b.client == nil {
+		return
+	}
+
+	var ios []*ModbusIo
+	for _, io := range b.ios() {
+		if !io.Disable {
+			ios = append(ios, io)
+		}
+	}
+
+	for _, blk := range modbusBlocks(ios, b.config.pollLimits) {
+		err := b.ReadBusBlock(blk)
+		if err != nil {
+			if len(blk.ios) > 1 {
+				// some devices reject a read that covers registers that are
+				// not used, so read each IO on its own
+				if b.config.Debug >= 1 {
+					log.Printf("Modbus %v: block read of device %v, %v %v-%v failed, polling IOs one at a time: %v\n",
+						b.config.Port, blk.id, blk.ioType, blk.address,
+						blk.address+blk.count-1, err)
+				}
+				b.pollSingleIOs(blk.ios)
+			} else {
+				err := b.LogBlockError(blk, err)
+				if err != nil {
+					log.Println("Error logging modbus error: ", err)
+				}
+			}
+		} else {
+			for _, io := range blk.ios {
+				err := b.WriteClientIO(io)
+				if err != nil {
+					err := b.LogError(io, err)
+					if err != nil {
+						log.Println("Error logging modbus error: ", err)
+					}
+				}
+			}
+		}
+
+		// the port is closed on some errors
+		if b.client == nil {
+			return
+		}
+	}
+}
+
+// pollSingleIOs reads and writes each IO with its own requests. If the
+// device does not answer, the rest of the IOs are skipped so that a missing
+// device does not hold up the bus for a timeout on every IO.
+func (b *ModbusClient) pollSingleIOs(ios []*ModbusIo) {
+	for i, io := range ios {
+		err := b.ClientIO(io)
+		if err != nil {
+			noResponse := modbusNoResponse(err)
+			errType := modbusErrorToPointType(err)
+
+			err := b.LogError(io, err)
+			if err != nil {
+				log.Println("Error logging modbus error: ", err)
+			}
+
+			if noResponse {
+				for _, skip := range ios[i+1:] {
+					err := b.logIOError(skip, errType)
+					if err != nil {
+						log.Println("Error logging modbus error: ", err)
+					}
+				}
+				return
+			}
+		}
+
+		// the port is closed on some errors
+		if b.client == nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package node
+
+import (
+	"testing"
+
+	"github.com/simpleiot/simpleiot/data"
+)
+
+func TestModbusBlocks(t *testing.T) {
+	newIO := func(nodeID string, id int, ioType, dataType string, address int) *ModbusIo {
+		return &ModbusIo{
+			ID:           nodeID,
+			DeviceID:     id,
+			ModbusIOType: ioType,
+			DataFormat:   dataType,
+			Address:      address,
+		}
+	}
+
+	hr := data.PointValueModbusHoldingRegister
+	ir := data.PointValueModbusInputRegister
+	coil := data.PointValueModbusCoil
+
+	ios := []*ModbusIo{
+		newIO("a", 1, hr, data.PointValueUINT16, 0),
+		newIO("b", 1, hr, data.PointValueFLOAT32, 1),
+		newIO("c", 1, hr, data.PointValueUINT16, 5),
+		newIO("d", 1, ir, data.PointValueUINT16, 3),
+		newIO("e", 2, hr, data.PointValueUINT16, 2),
+		newIO("f", 1, coil, "", 10),
+		newIO("g", 1, coil, "", 12),
+		newIO("h", 1, hr, data.PointValueINT32, 100),
+		newIO("i", 2, hr, data.PointValueUINT16, 4),
+	}
+
+	type exp struct {
+		id      int
+		ioType  string
+		address int
+		count   int
+		ios     int
+	}
+
+	tests := []struct {
+		name     string
+		maxGap   map[string]int
+		maxCount map[string]int
+		exp      []exp
+	}{
+		{"contiguous", nil, nil, []exp{
+			{1, coil, 10, 1, 1},
+			{1, coil, 12, 1, 1},
+			{1, hr, 0, 3, 2},
+			{1, hr, 5, 1, 1},
+			{1, hr, 100, 2, 1},
+			{1, ir, 3, 1, 1},
+			{2, hr, 2, 1, 1},
+			{2, hr, 4, 1, 1},
+		}},
+		{"gap", map[string]int{"0": 2}, nil, []exp{
+			{1, coil, 10, 3, 2},
+			{1, hr, 0, 6, 3},
+			{1, hr, 100, 2, 1},
+			{1, ir, 3, 1, 1},
+			{2, hr, 2, 3, 2},
+		}},
+		{"max count", map[string]int{"0": 2}, map[string]int{"0": 3}, []exp{
+			{1, coil, 10, 3, 2},
+			{1, hr, 0, 3, 2},
+			{1, hr, 5, 1, 1},
+			{1, hr, 100, 2, 1},
+			{1, ir, 3, 1, 1},
+			{2, hr, 2, 3, 2},
+		}},
+		{"per device", map[string]int{"0": 2, "2": 0}, map[string]int{"1": 3}, []exp{
+			{1, coil, 10, 3, 2},
+			{1, hr, 0, 3, 2},
+			{1, hr, 5, 1, 1},
+			{1, hr, 100, 2, 1},
+			{1, ir, 3, 1, 1},
+			{2, hr, 2, 1, 1},
+			{2, hr, 4, 1, 1},
+		}},
+	}
+
+	for _, test := range tests {
+		m := Modbus{PollMaxGap: test.maxGap, PollMaxCount: test.maxCount}
+		blocks := modbusBlocks(ios, m.pollLimits)
+		if len(blocks) != len(test.exp) {
+			t.Errorf("%v: expected %v blocks, got %v", test.name, len(test.exp),
+				len(blocks))
+			continue
+		}
+
+		for i, b := range blocks {
+			e := test.exp[i]
+			if b.id != e.id || b.ioType != e.ioType || b.address != e.address ||
+				b.count != e.count || len(b.ios) != e.ios {
+				t.Errorf("%v: block %v, expected %+v, got %v %v %v %v %v", test.name,
+					i, e, b.id, b.ioType, b.address, b.count, len(b.ios))
+			}
+		}
+	}
+}
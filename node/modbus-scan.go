@@ -0,0 +1,249 @@
+package node
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+	"github.com/simpleiot/simpleiot/modbus"
+)
+
+// modbusScanResult is a device ID that responded to a scan. exc is set if
+// the device responded with an exception.
+type modbusScanResult struct {
+	id  int
+	exc error
+}
+
+// modbusProbe reads one coil, input, or register from a device. found is
+// true if the device responded, even if it responded with an exception.
+func modbusProbe(c *modbus.Client, ioType string, id, address int) (found bool, exc error) {
+	var err error
+
+	switch ioType {
+	case data.PointValueModbusCoil:
+		_, err = c.ReadCoils(byte(id), uint16(address), 1)
+	case data.PointValueModbusDiscreteInput:
+		_, err = c.ReadDiscreteInputs(byte(id), uint16(address), 1)
+	case data.PointValueModbusInputRegister:
+		_, err = c.ReadInputRegs(byte(id), uint16(address), 1)
+	default:
+		_, err = c.ReadHoldingRegs(byte(id), uint16(address), 1)
+	}
+
+	if err == nil {
+		return true, nil
+	}
+
+	var e modbus.ExceptionCode
+	if errors.As(err, &e) {
+		return true, e
+	}
+
+	return false, nil
+}
+
+// modbusScanIDs probes the device IDs from idStart to idEnd and returns the
+// devices that responded. IDs in skip are not probed. progress is called
+// before each ID is probed. The scan stops early if cancel is closed.
+func modbusScanIDs(c *modbus.Client, ioType string, address, idStart, idEnd int,
+	skip map[int]bool, cancel <-chan struct{}, progress func(id int)) []modbusScanResult {
+	var ret []modbusScanResult
+
+	for id := idStart; id <= idEnd; id++ {
+		select {
+		case <-cancel:
+			return ret
+		default:
+		}
+
+		if skip[id] {
+			continue
+		}
+
+		if progress != nil {
+			progress(id)
+		}
+
+		found, exc := modbusProbe(c, ioType, id, address)
+		if found {
+			ret = append(ret, modbusScanResult{id: id, exc: exc})
+		}
+	}
+
+	return ret
+}
+
+// modbusScanBauds returns the baud rates to scan
+func modbusScanBauds(config *Modbus) ([]int, error) {
+	if !config.isSerial() {
+		// baud is not used
+		return []int{0}, nil
+	}
+
+	if strings.TrimSpace(config.ScanBauds) == "" {
+		return []int{config.baudRate()}, nil
+	}
+
+	var ret []int
+	for _, b := range strings.Split(config.ScanBauds, ",") {
+		baud, err := strconv.Atoi(strings.TrimSpace(b))
+		if err != nil || baud <= 0 {
+			return nil, fmt.Errorf("invalid scan baud: %v", b)
+		}
+		ret = append(ret, baud)
+	}
+
+	return ret, nil
+}
+
+// StartScan starts a bus scan. Polling is stopped and the port is closed
+// until the scan is finished, as the scan opens the port for each baud rate.
+// Results from the previous scan are deleted.
+func (b *ModbusClient) StartScan() {
+	if b.scanning {
+		return
+	}
+
+	b.ClosePort()
+
+	var points data.Points
+	for key := range b.config.ScanResults {
+		points = append(points, data.Point{
+			Type:      data.PointTypeScanResult,
+			Key:       key,
+			Tombstone: 1,
+		})
+		delete(b.config.ScanResults, key)
+	}
+
+	if len(points) > 0 {
+		err := client.SendNodePoints(b.nc, b.config.ID, points, true)
+		if err != nil {
+			log.Println("Error clearing scan results: ", err)
+		}
+	}
+
+	b.scanning = true
+	b.scanCancel = make(chan struct{})
+	// the scan goroutine gets a copy so config changes don't race
+	config := b.config
+	go b.scan(&config, b.scanCancel)
+}
+
+// StopScan cancels a running scan. The scan may still be using the port
+// until the results are received on chScanDone.
+func (b *ModbusClient) StopScan() {
+	if b.scanCancel != nil {
+		close(b.scanCancel)
+		b.scanCancel = nil
+	}
+}
+
+// scan runs a bus scan. Each baud rate is scanned in turn, and devices that
+// responded are not probed again at later baud rates. Intended to be run
+// as a goroutine. The scan result points are sent on chScanDone when done.
+func (b *ModbusClient) scan(config *Modbus, cancel <-chan struct{}) {
+	var scanResults data.Points
+
+	defer func() {
+		b.chScanDone <- scanResults
+	}()
+
+	status := func(s string) {
+		p := data.Point{Type: data.PointTypeScanStatus, Text: s}
+		err := client.SendNodePoint(b.nc, config.ID, p, true)
+		if err != nil {
+			log.Println("Error sending scan status: ", err)
+		}
+	}
+
+	bauds, err := modbusScanBauds(config)
+	if err != nil {
+		status(err.Error())
+		return
+	}
+
+	idStart := config.ScanIDStart
+	if idStart < 1 {
+		idStart = 1
+	}
+
+	idEnd := config.ScanIDEnd
+	if idEnd < 1 || idEnd > 247 {
+		idEnd = 247
+	}
+
+	found := make(map[int]bool)
+
+	for _, baud := range bauds {
+		select {
+		case <-cancel:
+			status(fmt.Sprintf("scan canceled, found %v devices", len(found)))
+			return
+		default:
+		}
+
+		transport, serialPort, err := openClientTransport(config, baud)
+		if err != nil {
+			status(fmt.Sprintf("error opening port: %v", err))
+			return
+		}
+
+		c := modbus.NewClient(transport, config.Debug)
+
+		baudDesc := ""
+		if baud != 0 {
+			baudDesc = fmt.Sprintf("%v baud, ", baud)
+		}
+
+		results := modbusScanIDs(c, config.ScanIOType, config.ScanAddress,
+			idStart, idEnd, found, cancel, func(id int) {
+				if id == idStart || id%16 == 0 {
+					status(fmt.Sprintf("scanning %vID %v", baudDesc, id))
+				}
+			})
+
+		err = c.Close()
+		if err != nil {
+			log.Println("Error closing scan port: ", err)
+		}
+
+		if serialPort != nil {
+			// give the OS time to release the port before it is opened again
+			time.Sleep(100 * time.Millisecond)
+		}
+
+		var points data.Points
+
+		for _, r := range results {
+			found[r.id] = true
+			p := data.Point{
+				Type:  data.PointTypeScanResult,
+				Key:   strconv.Itoa(r.id),
+				Value: float64(baud),
+			}
+
+			if r.exc != nil {
+				p.Text = r.exc.Error()
+			}
+
+			points = append(points, p)
+		}
+
+		if len(points) > 0 {
+			err := client.SendNodePoints(b.nc, config.ID, points, true)
+			if err != nil {
+				log.Println("Error sending scan results: ", err)
+			}
+			scanResults = append(scanResults, points...)
+		}
+	}
+
+	status(fmt.Sprintf("scan done, found %v devices", len(found)))
+}
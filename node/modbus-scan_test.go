@@ -0,0 +1,75 @@
+package node
+
+import (
+	"testing"
+	"time"
+
+	"github.com/simpleiot/simpleiot/data"
+	"github.com/simpleiot/simpleiot/modbus"
+	"github.com/simpleiot/simpleiot/respreader"
+	"github.com/simpleiot/simpleiot/test"
+)
+
+func TestModbusScanIDs(t *testing.T) {
+	a, b := test.NewIoSim()
+
+	regs := &modbus.Regs{}
+	regs.AddReg(0, 1)
+
+	portA := respreader.NewReadWriteCloser(a, time.Second*2, 5*time.Millisecond)
+	server := modbus.NewServer(3, modbus.NewRTU(portA), regs, 0)
+	go server.Listen(func(error) {}, func() {}, func() {})
+	defer server.Close()
+
+	portB := respreader.NewReadWriteCloser(b, 50*time.Millisecond, 5*time.Millisecond)
+	c := modbus.NewClient(modbus.NewRTU(portB), 0)
+
+	var probed []int
+	progress := func(id int) { probed = append(probed, id) }
+
+	hr := data.PointValueModbusHoldingRegister
+
+	results := modbusScanIDs(c, hr, 0, 1, 5, map[int]bool{2: true}, nil, progress)
+	if len(results) != 1 || results[0].id != 3 || results[0].exc != nil {
+		t.Fatalf("wrong scan results: %+v", results)
+	}
+
+	if len(probed) != 4 {
+		t.Errorf("skipped ID was probed: %v", probed)
+	}
+
+	// the device responds with an exception for an address it does not have
+	results = modbusScanIDs(c, hr, 10, 3, 4, nil, nil, nil)
+	if len(results) != 1 || results[0].id != 3 ||
+		results[0].exc != modbus.ExcIllegalAddress {
+		t.Fatalf("wrong scan results for exception: %+v", results)
+	}
+
+	cancel := make(chan struct{})
+	close(cancel)
+	results = modbusScanIDs(c, hr, 0, 1, 5, nil, cancel, nil)
+	if len(results) != 0 {
+		t.Fatalf("canceled scan returned results: %+v", results)
+	}
+}
+
+func TestModbusScanBauds(t *testing.T) {
+	bus := &Modbus{Protocol: data.PointValueRTU, Baud: "9600"}
+
+	bauds, err := modbusScanBauds(bus)
+	if err != nil || len(bauds) != 1 || bauds[0] != 9600 {
+		t.Fatalf("wrong default bauds: %v, %v", bauds, err)
+	}
+
+	bus.ScanBauds = "9600, 19200,115200"
+	bauds, err = modbusScanBauds(bus)
+	if err != nil || len(bauds) != 3 || bauds[2] != 115200 {
+		t.Fatalf("wrong bauds: %v, %v", bauds, err)
+	}
+
+	bus.ScanBauds = "9600,fast"
+	_, err = modbusScanBauds(bus)
+	if err == nil {
+		t.Fatal("expected error for invalid baud")
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"io"
 	"log"
 	"net"
+	"os"
 	"syscall"
 	"time"
 
@@ -17,140 +18,193 @@ import (
 	"go.bug.st/serial"
 )
 
-type pointWID struct {
-	id    string
-	point data.Point
-}
-
 type server interface {
 	Close() error
 	Listen(func(error), func(), func())
 }
 
-// Modbus describes a modbus bus
-type Modbus struct {
-	// node data should only be changed through NATS, so that it is only changed in one place
-	node    data.NodeEdge
-	busNode *ModbusNode
-	ios     map[string]*ModbusIO
+// unitServer is a server that can respond to several unit IDs
+type unitServer interface {
+	AddID(id byte, regs *modbus.Regs)
+	RemoveID(id byte)
+}
+
+// serverReg is a range of server registers of a unit. Coils are stored in
+// the register that contains the coil bit.
+type serverReg struct {
+	unit    int
+	address int
+	count   int
+}
+
+// ModbusClient is a SIOT client that runs a modbus bus
+type ModbusClient struct {
+	nc     *nats.Conn
+	config Modbus
+	// directory with device profiles in addition to the built in ones
+	profileDir string
 
 	// data associated with running the bus
-	nc           *nats.Conn
-	sub          *nats.Subscription
-	regs         *modbus.Regs
+	regs         map[int]*modbus.Regs // server registers for each unit ID
+	ioRegs       map[string]serverReg // server registers added for each IO ID
 	client       *modbus.Client
 	server       server
 	serialPort   serial.Port
 	ioErrorCount int
-
-	chDone      chan bool
-	chPoint     chan pointWID
-	chRegChange chan bool
+	// the port is used by the scan goroutine while scanning is set
+	scanning   bool
+	scanCancel chan struct{}
+
+	stop          chan struct{}
+	newPoints     chan client.NewPoints
+	newEdgePoints chan client.NewPoints
+	chRegChange   chan bool
+	chScanDone    chan data.Points
 }
 
-// NewModbus creates a new bus from a node
-func NewModbus(nc *nats.Conn, node data.NodeEdge) (*Modbus, error) {
-	bus := &Modbus{
-		nc:          nc,
-		node:        node,
-		ios:         make(map[string]*ModbusIO),
-		chDone:      make(chan bool),
-		chPoint:     make(chan pointWID),
-		chRegChange: make(chan bool),
+// NewModbusClient creates a new modbus client. Device profiles are loaded
+// from profileDir in addition to the profiles built into the binary.
+func NewModbusClient(nc *nats.Conn, config Modbus, profileDir string) client.Client {
+	return &ModbusClient{
+		nc:            nc,
+		config:        config,
+		profileDir:    profileDir,
+		stop:          make(chan struct{}),
+		newPoints:     make(chan client.NewPoints),
+		newEdgePoints: make(chan client.NewPoints),
+		chRegChange:   make(chan bool),
+		// buffered so the scan goroutine can exit after the bus is stopped
+		chScanDone: make(chan data.Points, 1),
 	}
+}
 
-	modbusNode, err := NewModbusNode(node)
-	if err != nil {
-		return nil, err
-	}
+// Stop sends a signal to the Run function to exit
+func (b *ModbusClient) Stop(_ error) {
+	close(b.stop)
+}
 
-	bus.busNode = modbusNode
+// Points is called by the Manager when new points for the bus or IO nodes
+// are received
+func (b *ModbusClient) Points(nodeID string, points []data.Point) {
+	b.newPoints <- client.NewPoints{ID: nodeID, Points: points}
+}
 
-	// closure is required so we don't get races accessing bus.busNode
-	func(id string) {
-		bus.sub, err = nc.Subscribe("p."+bus.busNode.nodeID, func(msg *nats.Msg) {
-			points, err := data.PbDecodePoints(msg.Data)
-			if err != nil {
-				// FIXME, send over channel
-				log.Println("Error decoding node data: ", err)
-				return
-			}
+// EdgePoints is called by the Manager when new edge points for the bus or
+// IO nodes are received
+func (b *ModbusClient) EdgePoints(nodeID, parentID string, points []data.Point) {
+	b.newEdgePoints <- client.NewPoints{ID: nodeID, Parent: parentID, Points: points}
+}
 
-			for _, p := range points {
-				bus.chPoint <- pointWID{id, p}
-			}
-		})
-	}(bus.busNode.nodeID)
+// ios returns the IOs that have a complete config
+func (b *ModbusClient) ios() []*ModbusIo {
+	ret := make([]*ModbusIo, 0, len(b.config.IOs))
+	for i := range b.config.IOs {
+		if b.config.IOs[i].check() == nil {
+			ret = append(ret, &b.config.IOs[i])
+		}
+	}
+	return ret
+}
 
-	if err != nil {
-		return nil, err
+// unitID returns the server unit ID for an IO. IOs without an ID use the
+// bus ID unless UnitZero is set.
+func (b *ModbusClient) unitID(io *ModbusIo) int {
+	if io.DeviceID == 0 && !io.UnitZero {
+		return b.config.DeviceID
+	}
+	return io.DeviceID
+}
+
+// serverRegs returns the server registers for the unit ID of an IO. Units
+// are added to the server the first time an IO uses them.
+func (b *ModbusClient) serverRegs(io *ModbusIo) *modbus.Regs {
+	if b.regs == nil {
+		b.regs = make(map[int]*modbus.Regs)
 	}
 
-	go bus.Run()
+	id := b.unitID(io)
+	regs, ok := b.regs[id]
+	if !ok {
+		regs = &modbus.Regs{}
+		b.regs[id] = regs
+		if s, ok := b.server.(unitServer); ok {
+			s.AddID(byte(id), regs)
+		}
+	}
 
-	return bus, nil
+	return regs
 }
 
-// Stop stops the bus and resets various fields
-func (b *Modbus) Stop() {
-	if b.sub != nil {
-		err := b.sub.Unsubscribe()
-		if err != nil {
-			log.Println("Error unsubscribing from bus: ", err)
+// removeUnusedUnits removes unit IDs from the server that no longer have
+// any IOs. The bus ID is always kept.
+func (b *ModbusClient) removeUnusedUnits() {
+	used := map[int]bool{b.config.DeviceID: true}
+	for _, io := range b.ios() {
+		used[b.unitID(io)] = true
+	}
+
+	for id := range b.regs {
+		if used[id] {
+			continue
+		}
+
+		delete(b.regs, id)
+		if s, ok := b.server.(unitServer); ok {
+			s.RemoveID(byte(id))
 		}
 	}
-	for _, io := range b.ios {
-		io.Stop()
+}
+
+// serverReg returns the server registers used by an IO
+func (b *ModbusClient) serverReg(io *ModbusIo) serverReg {
+	switch io.ModbusIOType {
+	case data.PointValueModbusCoil, data.PointValueModbusDiscreteInput:
+		return serverReg{unit: b.unitID(io), address: io.Address / 16, count: 1}
+	default:
+		return serverReg{unit: b.unitID(io), address: io.Address,
+			count: io.formatRegCount()}
 	}
-	b.chDone <- true
 }
 
-// CheckIOs goes through ios on the bus and handles any config changes
-func (b *Modbus) CheckIOs() error {
-	nodes, err := client.GetNodes(b.nc, b.busNode.nodeID, "all", data.NodeTypeModbusIO, false)
-	if err != nil {
-		return err
+// updateServerReg records the registers used by an IO. If the IO used
+// other registers before, the old registers that no other IO uses are
+// removed from the server.
+func (b *ModbusClient) updateServerReg(io *ModbusIo) {
+	if b.ioRegs == nil {
+		b.ioRegs = make(map[string]serverReg)
 	}
 
-	found := make(map[string]bool)
+	reg := b.serverReg(io)
+	old, ok := b.ioRegs[io.ID]
+	b.ioRegs[io.ID] = reg
+	if !ok || old == reg {
+		return
+	}
 
-	for _, node := range nodes {
-		found[node.ID] = true
-		_, ok := b.ios[node.ID]
-		if !ok {
-			// add ios
-			var err error
-			ioNode, err := NewModbusIONode(b.busNode.busType, &node)
-			if err != nil {
-				log.Println("Error with IO node: ", err)
-				continue
-			}
-			io, err := NewModbusIO(b.nc, ioNode, b.chPoint)
-			if err != nil {
-				log.Println("Error creating new modbus IO: ", err)
-				continue
-			}
-			b.ios[node.ID] = io
-			b.InitRegs(io.ioNode)
-		}
+	regs, ok := b.regs[old.unit]
+	if !ok {
+		return
 	}
 
-	// remove ios that have been deleted
-	for id, io := range b.ios {
-		_, ok := found[id]
-		if !ok {
-			// io was deleted so close and clear it
-			log.Println("modbus io removed: ", io.ioNode.description)
-			io.Stop()
-			delete(b.ios, id)
+	for address := old.address; address < old.address+old.count; address++ {
+		if !b.regUsed(old.unit, address) {
+			regs.RemoveReg(address, 1)
 		}
 	}
+}
 
-	return nil
+// regUsed returns true if any IO uses the server register
+func (b *ModbusClient) regUsed(unit, address int) bool {
+	for _, r := range b.ioRegs {
+		if r.unit == unit && address >= r.address && address < r.address+r.count {
+			return true
+		}
+	}
+	return false
 }
 
 // SendPoint sends a point over nats
-func (b *Modbus) SendPoint(nodeID, pointType string, value float64) error {
+func (b *ModbusClient) SendPoint(nodeID, pointType string, value float64) error {
 	// send the point
 	p := data.Point{
 		Time:  time.Now(),
@@ -161,136 +215,133 @@ func (b *Modbus) SendPoint(nodeID, pointType string, value float64) error {
 	return client.SendNodePoint(b.nc, nodeID, p, true)
 }
 
-// WriteBusHoldingReg used to write register values to bus
-// should only be used by client
-func (b *Modbus) WriteBusHoldingReg(io *ModbusIONode) error {
-	unscaledValue := (io.valueSet - io.offset) / io.scale
-	switch io.modbusDataType {
-	case data.PointValueUINT16, data.PointValueINT16:
-		err := b.client.WriteSingleReg(byte(io.id),
-			uint16(io.address), uint16(unscaledValue))
-		if err != nil {
-			return err
-		}
-	case data.PointValueUINT32:
-		regs := modbus.Uint32ToRegs([]uint32{uint32(unscaledValue)})
-		err := b.client.WriteSingleReg(byte(io.id),
-			uint16(io.address), regs[0])
-		if err != nil {
-			return err
-		}
+// SendProfiles sends a modbusProfiles point for each available device
+// profile, keyed by the profile key, so they can be selected in the UI.
+// Profiles that are no longer available are deleted.
+func (b *ModbusClient) SendProfiles() error {
+	profiles, err := client.LoadModbusProfiles(b.profileDir)
+	if err != nil {
+		return err
+	}
 
-		err = b.client.WriteSingleReg(byte(io.id),
-			uint16(io.address+1), regs[1])
-		if err != nil {
-			return err
-		}
+	var points data.Points
 
-	case data.PointValueINT32:
-		regs := modbus.Int32ToRegs([]int32{int32(unscaledValue)})
-		err := b.client.WriteSingleReg(byte(io.id),
-			uint16(io.address), regs[0])
-		if err != nil {
-			return err
+	for key, p := range profiles {
+		if cur, ok := b.config.Profiles[key]; !ok || cur != p.Name {
+			points = append(points, data.Point{
+				Type: data.PointTypeModbusProfiles,
+				Key:  key,
+				Text: p.Name,
+			})
 		}
+	}
 
-		err = b.client.WriteSingleReg(byte(io.id),
-			uint16(io.address+1), regs[1])
-		if err != nil {
-			return err
+	for key := range b.config.Profiles {
+		if _, ok := profiles[key]; !ok {
+			points = append(points, data.Point{
+				Type:      data.PointTypeModbusProfiles,
+				Key:       key,
+				Tombstone: 1,
+			})
 		}
+	}
 
-	case data.PointValueFLOAT32:
-		regs := modbus.Float32ToRegs([]float32{float32(unscaledValue)})
-		err := b.client.WriteSingleReg(byte(io.id),
-			uint16(io.address), regs[0])
-		if err != nil {
-			return err
-		}
+	// points sent to the bus node are not echoed back to the client, so
+	// keep the config in sync
+	err = data.MergePoints(b.config.ID, points, &b.config)
+	if err != nil {
+		return err
+	}
 
-		err = b.client.WriteSingleReg(byte(io.id),
-			uint16(io.address+1), regs[1])
-		if err != nil {
-			return err
-		}
+	if len(points) == 0 {
+		return nil
+	}
 
-	default:
-		return fmt.Errorf("unhandled data type: %v",
-			io.modbusDataType)
+	return client.SendNodePoints(b.nc, b.config.ID, points, true)
+}
 
+// CreateProfileIOs creates the IO nodes of the selected device profile for
+// the selected device ID
+func (b *ModbusClient) CreateProfileIOs() error {
+	profiles, err := client.LoadModbusProfiles(b.profileDir)
+	if err != nil {
+		return err
 	}
 
-	return nil
+	p, ok := profiles[b.config.Profile]
+	if !ok {
+		return fmt.Errorf("device profile not found: %v", b.config.Profile)
+	}
+
+	if b.config.ProfileID < 1 || b.config.ProfileID > 247 {
+		return fmt.Errorf("invalid device ID: %v", b.config.ProfileID)
+	}
+
+	log.Printf("modbus: creating IOs for profile %v, device ID %v\n",
+		p.Name, b.config.ProfileID)
+
+	return client.CreateModbusProfileIOs(b.nc, b.config.ID, p,
+		b.config.ProfileID)
+}
+
+// WriteBusHoldingReg used to write register values to bus
+// should only be used by client. Multi-register values are written with one
+// write multiple registers request so all registers are updated at once.
+// Bit fields are written with a mask write request so other bits in the
+// register are not changed. ASCII values are written from the text of the
+// value set point.
+func (b *ModbusClient) WriteBusHoldingReg(io *ModbusIo) error {
+	regs, err := io.valueToRegs(io.ValueSet, io.ValueSetText)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case io.DataFormat == data.PointValueBitField:
+		return b.client.MaskWriteReg(byte(io.DeviceID), uint16(io.Address),
+			^io.BitMask, regs[0])
+	case len(regs) == 1:
+		return b.client.WriteSingleReg(byte(io.DeviceID), uint16(io.Address), regs[0])
+	default:
+		return b.client.WriteMultipleRegs(byte(io.DeviceID), uint16(io.Address), regs)
+	}
 }
 
 // ReadBusReg reads an io value from a reg from bus
-// this function modifies io.value
-func (b *Modbus) ReadBusReg(io *ModbusIO) error {
+// this function modifies io.Value
+func (b *ModbusClient) ReadBusReg(io *ModbusIo) error {
 	readFunc := b.client.ReadHoldingRegs
-	switch io.ioNode.modbusIOType {
+	switch io.ModbusIOType {
 	case data.PointValueModbusHoldingRegister:
 	case data.PointValueModbusInputRegister:
 		readFunc = b.client.ReadInputRegs
 	default:
 		return fmt.Errorf("ReadBusReg: unsupported modbus IO type: %v",
-			io.ioNode.modbusIOType)
+			io.ModbusIOType)
+	}
+	regs, err := readFunc(byte(io.DeviceID), uint16(io.Address),
+		uint16(io.formatRegCount()))
+	if err != nil {
+		return err
 	}
-	var valueUnscaled float64
-	switch io.ioNode.modbusDataType {
-	case data.PointValueUINT16, data.PointValueINT16:
-		regs, err := readFunc(byte(io.ioNode.id), uint16(io.ioNode.address), 1)
-		if err != nil {
-			return err
-		}
-		if len(regs) < 1 {
-			return errors.New("Did not receive enough data")
-		}
-		valueUnscaled = float64(regs[0])
-
-	case data.PointValueUINT32:
-		regs, err := readFunc(byte(io.ioNode.id), uint16(io.ioNode.address), 2)
-		if err != nil {
-			return err
-		}
-		if len(regs) < 2 {
-			return errors.New("Did not receive enough data")
-		}
-		v := modbus.RegsToUint32(regs)
-
-		valueUnscaled = float64(v[0])
-
-	case data.PointValueINT32:
-		regs, err := readFunc(byte(io.ioNode.id), uint16(io.ioNode.address), 2)
-		if err != nil {
-			return err
-		}
-		if len(regs) < 2 {
-			return errors.New("Did not receive enough data")
-		}
-		v := modbus.RegsToInt32(regs)
-
-		valueUnscaled = float64(v[0])
-
-	case data.PointValueFLOAT32:
-		regs, err := readFunc(byte(io.ioNode.id), uint16(io.ioNode.address), 2)
-		if err != nil {
-			return err
-		}
-		if len(regs) < 2 {
-			return errors.New("Did not receive enough data")
-		}
-		valueUnscaled = float64(modbus.RegsToFloat32(regs)[0])
 
-	default:
-		return fmt.Errorf("unhandled data type: %v",
-			io.ioNode.modbusDataType)
+	value, text, err := io.regsToValue(regs)
+	if err != nil {
+		return err
 	}
 
-	value := valueUnscaled*io.ioNode.scale + io.ioNode.offset
+	return b.updateIOValue(io, value, text)
+}
 
-	if value != io.ioNode.value || time.Since(io.lastSent) > time.Minute*10 {
-		io.ioNode.value = value
-		err := b.SendPoint(io.ioNode.nodeID, data.PointTypeValue, value)
+// updateIOValue sends the value read from the bus for an IO if it has
+// changed, or has not been sent for a while. text is only used for ASCII
+// values.
+func (b *ModbusClient) updateIOValue(io *ModbusIo, value float64, text string) error {
+	if value != io.Value || text != io.ValueText ||
+		time.Since(io.lastSent) > time.Minute*10 {
+		io.Value = value
+		io.ValueText = text
+		err := b.sendIOValue(io, value, text)
 		if err != nil {
 			return err
 		}
@@ -300,19 +351,31 @@ func (b *Modbus) ReadBusReg(io *ModbusIO) error {
 	return nil
 }
 
+// sendIOValue sends the value point for an IO
+func (b *ModbusClient) sendIOValue(io *ModbusIo, value float64, text string) error {
+	p := data.Point{
+		Time:  time.Now(),
+		Type:  data.PointTypeValue,
+		Value: value,
+		Text:  text,
+	}
+
+	return client.SendNodePoint(b.nc, io.ID, p, true)
+}
+
 // ReadBusBit is used to read coil of discrete input values from bus
-// this function modifies io.value. This should only be called from client.
-func (b *Modbus) ReadBusBit(io *ModbusIO) error {
+// this function modifies io.Value. This should only be called from client.
+func (b *ModbusClient) ReadBusBit(io *ModbusIo) error {
 	readFunc := b.client.ReadCoils
-	switch io.ioNode.modbusIOType {
+	switch io.ModbusIOType {
 	case data.PointValueModbusCoil:
 	case data.PointValueModbusDiscreteInput:
 		readFunc = b.client.ReadDiscreteInputs
 	default:
 		return fmt.Errorf("ReadBusBit: unhandled modbusIOType: %v",
-			io.ioNode.modbusIOType)
+			io.ModbusIOType)
 	}
-	bits, err := readFunc(byte(io.ioNode.id), uint16(io.ioNode.address), 1)
+	bits, err := readFunc(byte(io.DeviceID), uint16(io.Address), 1)
 	if err != nil {
 		return err
 	}
@@ -320,112 +383,112 @@ func (b *Modbus) ReadBusBit(io *ModbusIO) error {
 		return errors.New("Did not receive enough data")
 	}
 
-	value := data.BoolToFloat(bits[0])
-
-	if value != io.ioNode.value || time.Since(io.lastSent) > time.Minute*10 {
-		io.ioNode.value = value
-		err := b.SendPoint(io.ioNode.nodeID, data.PointTypeValue, value)
-		if err != nil {
-			return err
-		}
-
-		io.lastSent = time.Now()
-	}
-
-	io.ioNode.value = value
-
-	return nil
+	return b.updateIOValue(io, data.BoolToFloat(bits[0]), "")
 }
 
 // ClientIO processes an IO on a client bus
-func (b *Modbus) ClientIO(io *ModbusIO) error {
+func (b *ModbusClient) ClientIO(io *ModbusIo) error {
 
 	if b.client == nil {
 		return errors.New("client is not set up")
 	}
 
 	// read value from remote device and update regs
-	switch io.ioNode.modbusIOType {
-	case data.PointValueModbusCoil:
+	switch io.ModbusIOType {
+	case data.PointValueModbusCoil, data.PointValueModbusDiscreteInput:
 		err := b.ReadBusBit(io)
 		if err != nil {
 			return err
 		}
 
-		if !io.ioNode.readOnly && io.ioNode.valueSet != io.ioNode.value {
-			vBool := data.FloatToBool(io.ioNode.valueSet)
-			// we need set the remote value
-			err := b.client.WriteSingleCoil(byte(io.ioNode.id), uint16(io.ioNode.address),
-				vBool)
+	case data.PointValueModbusHoldingRegister, data.PointValueModbusInputRegister:
+		err := b.ReadBusReg(io)
+		if err != nil {
+			return err
+		}
 
-			if err != nil {
-				return err
-			}
+	default:
+		return fmt.Errorf("unhandled modbus io type, io: %+v", io)
+	}
 
-			err = b.SendPoint(io.ioNode.nodeID, data.PointTypeValue, io.ioNode.valueSet)
-			if err != nil {
-				return err
-			}
-		}
+	return b.WriteClientIO(io)
+}
 
-	case data.PointValueModbusDiscreteInput:
-		err := b.ReadBusBit(io)
-		if err != nil {
-			return err
+// WriteClientIO writes the value set of a coil or holding register IO to the
+// remote device if it is different than the current value
+func (b *ModbusClient) WriteClientIO(io *ModbusIo) error {
+	if io.ReadOnly {
+		return nil
+	}
+
+	if io.ModbusIOType == data.PointValueModbusHoldingRegister &&
+		io.DataFormat == data.PointValueASCII {
+		// an empty value set is not written so the device value is not
+		// cleared before a value is set
+		text := io.valueSetText()
+		if text == "" || text == io.ValueText {
+			return nil
 		}
 
-	case data.PointValueModbusHoldingRegister:
-		err := b.ReadBusReg(io)
+		err := b.WriteBusHoldingReg(io)
 		if err != nil {
 			return err
 		}
 
-		if !io.ioNode.readOnly && io.ioNode.valueSet != io.ioNode.value {
-			// we need set the remote value
-			err := b.WriteBusHoldingReg(io.ioNode)
+		return b.sendIOValue(io, 0, text)
+	}
+
+	if io.ValueSet == io.Value {
+		return nil
+	}
 
-			if err != nil {
-				return err
-			}
+	switch io.ModbusIOType {
+	case data.PointValueModbusCoil:
+		vBool := data.FloatToBool(io.ValueSet)
+		// we need set the remote value
+		err := b.client.WriteSingleCoil(byte(io.DeviceID), uint16(io.Address),
+			vBool)
 
-			err = b.SendPoint(io.ioNode.nodeID, data.PointTypeValue, io.ioNode.valueSet)
-			if err != nil {
-				return err
-			}
+		if err != nil {
+			return err
 		}
 
-	case data.PointValueModbusInputRegister:
-		err := b.ReadBusReg(io)
+	case data.PointValueModbusHoldingRegister:
+		// we need set the remote value
+		err := b.WriteBusHoldingReg(io)
+
 		if err != nil {
 			return err
 		}
 
 	default:
-		return fmt.Errorf("unhandled modbus io type, io: %+v", io)
+		return nil
 	}
 
-	return nil
+	return b.SendPoint(io.ID, data.PointTypeValue, io.ValueSet)
 }
 
 // ServerIO processes an IO on a server bus
-func (b *Modbus) ServerIO(io *ModbusIONode) error {
+func (b *ModbusClient) ServerIO(io *ModbusIo) error {
+	regs := b.serverRegs(io)
+
 	// update regs with db value
-	switch io.modbusIOType {
+	switch io.ModbusIOType {
 	case data.PointValueModbusDiscreteInput:
-		err := b.regs.WriteCoil(io.address, data.FloatToBool(io.value))
+		err := regs.WriteCoil(io.Address, data.FloatToBool(io.Value))
 		if err != nil {
 			return err
 		}
 	case data.PointValueModbusCoil:
-		regValue, err := b.regs.ReadCoil(io.address)
+		regValue, err := regs.ReadCoil(io.Address)
 		if err != nil {
 			return err
 		}
 
-		dbValue := data.FloatToBool(io.value)
+		dbValue := data.FloatToBool(io.Value)
 
 		if regValue != dbValue {
-			err = b.SendPoint(io.nodeID, data.PointTypeValue, data.BoolToFloat(regValue))
+			err = b.SendPoint(io.ID, data.PointTypeValue, data.BoolToFloat(regValue))
 			if err != nil {
 				return err
 			}
@@ -438,68 +501,57 @@ func (b *Modbus) ServerIO(io *ModbusIONode) error {
 		}
 
 	case data.PointValueModbusHoldingRegister:
-		v, err := b.ReadReg(io)
+		v, text, err := b.ReadReg(io)
 		if err != nil {
 			return err
 		}
 
-		if io.value != v {
-			err = b.SendPoint(io.nodeID, data.PointTypeValue, v)
+		if io.Value != v || io.ValueText != text {
+			err = b.sendIOValue(io, v, text)
 			if err != nil {
 				return err
 			}
 		}
 
 	default:
-		return fmt.Errorf("unhandled modbus io type: %v", io.modbusIOType)
+		return fmt.Errorf("unhandled modbus io type: %v", io.ModbusIOType)
 	}
 
 	return nil
 }
 
-func regCount(regType string) int {
-	switch regType {
-	case data.PointValueUINT16, data.PointValueINT16:
-		return 1
-	case data.PointValueUINT32, data.PointValueINT32,
-		data.PointValueFLOAT32:
-		return 2
-	default:
-		log.Println("regCount, unknown data type: ", regType)
-		// be conservative
-		return 2
-	}
-}
-
 // InitRegs is used in server mode to initilize the internal modbus regs when a IO changes
-func (b *Modbus) InitRegs(io *ModbusIONode) {
-	if b.server == nil {
+func (b *ModbusClient) InitRegs(io *ModbusIo) {
+	if b.server == nil || b.config.ClientServer != data.PointValueServer {
 		return
 	}
 
+	b.updateServerReg(io)
+	regs := b.serverRegs(io)
+
 	// we initialize all values from database, even if they are written from
 	// another device so that we preserve the last known state
-	switch io.modbusIOType {
+	switch io.ModbusIOType {
 	case data.PointValueModbusDiscreteInput:
-		b.regs.AddCoil(io.address)
-		err := b.regs.WriteCoil(io.address, data.FloatToBool(io.value))
+		regs.AddCoil(io.Address)
+		err := regs.WriteCoil(io.Address, data.FloatToBool(io.Value))
 		if err != nil {
 			log.Println("Error writing coil: ", err)
 		}
 	case data.PointValueModbusCoil:
-		b.regs.AddCoil(io.address)
-		err := b.regs.WriteCoil(io.address, data.FloatToBool(io.value))
+		regs.AddCoil(io.Address)
+		err := regs.WriteCoil(io.Address, data.FloatToBool(io.Value))
 		if err != nil {
 			log.Println("Error writing coil: ", err)
 		}
 	case data.PointValueModbusInputRegister:
-		b.regs.AddReg(io.address, regCount(io.modbusDataType))
+		regs.AddReg(io.Address, io.formatRegCount())
 		err := b.WriteReg(io)
 		if err != nil {
 			log.Println("Error writing reg: ", err)
 		}
 	case data.PointValueModbusHoldingRegister:
-		b.regs.AddReg(io.address, regCount(io.modbusDataType))
+		regs.AddReg(io.Address, io.formatRegCount())
 		err := b.WriteReg(io)
 		if err != nil {
 			log.Println("Error writing reg: ", err)
@@ -508,135 +560,136 @@ func (b *Modbus) InitRegs(io *ModbusIONode) {
 }
 
 // ReadReg reads an value from a reg (internal, not bus)
-// This should only be used on server
-func (b *Modbus) ReadReg(io *ModbusIONode) (float64, error) {
-	var valueUnscaled float64
-	switch io.modbusDataType {
-	case data.PointValueUINT16, data.PointValueINT16:
-		v, err := b.regs.ReadReg(io.address)
-		if err != nil {
-			return 0, err
-		}
-		valueUnscaled = float64(v)
-	case data.PointValueUINT32:
-		v, err := b.regs.ReadRegUint32(io.address)
-		if err != nil {
-			return 0, err
-		}
-		valueUnscaled = float64(v)
-	case data.PointValueINT32:
-		v, err := b.regs.ReadRegInt32(io.address)
-		if err != nil {
-			return 0, err
-		}
-		valueUnscaled = float64(v)
-	case data.PointValueFLOAT32:
-		v, err := b.regs.ReadRegFloat32(io.address)
-		if err != nil {
-			return 0, err
-		}
-		valueUnscaled = float64(v)
-	default:
-		return 0, fmt.Errorf("unhandled data type: %v",
-			io.modbusDataType)
+// This should only be used on server. ASCII values are returned as text.
+func (b *ModbusClient) ReadReg(io *ModbusIo) (float64, string, error) {
+	regs, err := b.serverRegs(io).ReadRegs(io.Address, io.formatRegCount())
+	if err != nil {
+		return 0, "", err
 	}
-	return valueUnscaled*io.scale + io.offset, nil
+
+	return io.regsToValue(regs)
 }
 
 // WriteReg writes an io value to a reg
 // This should only be used on server
-func (b *Modbus) WriteReg(io *ModbusIONode) error {
-	unscaledValue := (io.value - io.offset) / io.scale
-	switch io.modbusDataType {
-	case data.PointValueUINT16, data.PointValueINT16:
-		err := b.regs.WriteReg(io.address, uint16(unscaledValue))
-		if err != nil {
-			return err
-		}
-	case data.PointValueUINT32:
-		err := b.regs.WriteRegUint32(io.address,
-			uint32(unscaledValue))
-		if err != nil {
-			return err
-		}
-	case data.PointValueINT32:
-		err := b.regs.WriteRegInt32(io.address,
-			int32(unscaledValue))
+func (b *ModbusClient) WriteReg(io *ModbusIo) error {
+	regs, err := io.valueToRegs(io.Value, io.ValueText)
+	if err != nil {
+		return err
+	}
+
+	serverRegs := b.serverRegs(io)
+
+	if io.DataFormat == data.PointValueBitField {
+		// only modify the bits in the mask
+		reg, err := serverRegs.ReadReg(io.Address)
 		if err != nil {
 			return err
 		}
-	case data.PointValueFLOAT32:
-		err := b.regs.WriteRegFloat32(io.address,
-			float32(unscaledValue))
+		regs[0] |= reg &^ io.BitMask
+	}
+
+	return serverRegs.WriteRegs(io.Address, regs)
+}
+
+// LogError increments the error counts on the bus and IO nodes
+func (b *ModbusClient) LogError(io *ModbusIo, err error) error {
+	errType, err := b.logBusError(io.Description, err)
+	if err != nil {
+		return err
+	}
+
+	return b.logIOError(io, errType)
+}
+
+// LogBlockError is used when a block read fails. The bus error count is
+// incremented once, and the error count of each IO in the block is incremented.
+func (b *ModbusClient) LogBlockError(blk modbusBlock, err error) error {
+	desc := fmt.Sprintf("block ID:%v %v:%v-%v", blk.id, blk.ioType, blk.address,
+		blk.address+blk.count-1)
+	errType, err := b.logBusError(desc, err)
+	if err != nil {
+		return err
+	}
+
+	for _, io := range blk.ios {
+		err := b.logIOError(io, errType)
 		if err != nil {
 			return err
 		}
-	default:
-		return fmt.Errorf("unhandled data type: %v",
-			io.modbusDataType)
 	}
+
 	return nil
 }
 
-// LogError ...
-func (b *Modbus) LogError(io *ModbusIONode, err error) error {
-	busCount := 0
-	ioCount := 0
-
-	if b.busNode.debugLevel >= 1 {
+// logBusError increments the bus error count for err and returns the error
+// count point type
+func (b *ModbusClient) logBusError(desc string, err error) (string, error) {
+	if b.config.Debug >= 1 {
 		log.Printf("Modbus %v:%v, error: %v\n",
-			b.busNode.portName, io.description, err)
+			b.config.Port, desc, err)
 	}
 
 	// if broken pipe error then close connection
 	if errors.Is(err, syscall.EPIPE) {
-		if b.busNode.debugLevel >= 1 {
+		if b.config.Debug >= 1 {
 			log.Printf("Broken pipe, closing connection")
 		}
 		b.ClosePort()
 	}
 
+	var busCount int
+
 	errType := modbusErrorToPointType(err)
 	switch errType {
 	case data.PointTypeErrorCountEOF:
-		busCount = b.busNode.errorCountEOF
-		ioCount = io.errorCountEOF
-		b.busNode.errorCountEOF++
-		io.errorCountEOF++
+		b.config.ErrorCountEOF++
+		busCount = b.config.ErrorCountEOF
 	case data.PointTypeErrorCountCRC:
-		busCount = b.busNode.errorCountCRC
-		ioCount = io.errorCountCRC
-		b.busNode.errorCountCRC++
-		io.errorCountCRC++
+		b.config.ErrorCountCRC++
+		busCount = b.config.ErrorCountCRC
 	default:
 		// probably a more general serial port error
 		b.ioErrorCount++
 		errType = data.PointTypeErrorCount
-		busCount = b.busNode.errorCount
-		ioCount = io.errorCount
-		b.busNode.errorCount++
-		io.errorCount++
+		b.config.ErrorCount++
+		busCount = b.config.ErrorCount
 	}
 
-	busCount++
-	ioCount++
-
 	p := data.Point{
 		Type:  errType,
 		Value: float64(busCount),
 	}
 
-	err = client.SendNodePoint(b.nc, b.busNode.nodeID, p, false)
-	if err != nil {
-		return err
+	return errType, client.SendNodePoint(b.nc, b.config.ID, p, false)
+}
+
+// logIOError increments the IO error count for the errType point type
+func (b *ModbusClient) logIOError(io *ModbusIo, errType string) error {
+	var ioCount int
+
+	switch errType {
+	case data.PointTypeErrorCountEOF:
+		io.ErrorCountEOF++
+		ioCount = io.ErrorCountEOF
+	case data.PointTypeErrorCountCRC:
+		io.ErrorCountCRC++
+		ioCount = io.ErrorCountCRC
+	default:
+		io.ErrorCount++
+		ioCount = io.ErrorCount
+	}
+
+	p := data.Point{
+		Type:  errType,
+		Value: float64(ioCount),
 	}
 
-	p.Value = float64(ioCount)
-	return client.SendNodePoint(b.nc, io.nodeID, p, false)
+	return client.SendNodePoint(b.nc, io.ID, p, false)
 }
 
 // ClosePort closes both the server and client ports
-func (b *Modbus) ClosePort() {
+func (b *ModbusClient) ClosePort() {
 	if b.server != nil {
 		err := b.server.Close()
 		if err != nil {
@@ -654,60 +707,129 @@ func (b *Modbus) ClosePort() {
 	}
 }
 
+// modbusASCIICharTimeout is the max time between characters in an ASCII
+// frame allowed by the Modbus spec
+const modbusASCIICharTimeout = time.Second
+
+// openClientTransport opens the transport for a bus. The serial port is
+// returned for serial protocols so the caller can check if it is still
+// present. baud is only used for serial protocols.
+func openClientTransport(config *Modbus, baud int) (modbus.Transport, serial.Port, error) {
+	switch config.Protocol {
+	case data.PointValueRTU, data.PointValueProtocolASCII:
+		mode := &serial.Mode{
+			BaudRate: baud,
+		}
+
+		serialPort, err := serial.Open(config.Port, mode)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Error opening serial port: %w", err)
+		}
+
+		if config.Protocol == data.PointValueProtocolASCII {
+			// ASCII devices can be slow, and the end of a frame is
+			// detected by the transport
+			port := respreader.NewReadWriteCloser(serialPort, time.Second, time.Millisecond*20)
+			return modbus.NewASCII(port, modbusASCIICharTimeout), serialPort, nil
+		}
+
+		port := respreader.NewReadWriteCloser(serialPort, time.Millisecond*100, time.Millisecond*20)
+
+		return modbus.NewRTU(port), serialPort, nil
+	case data.PointValueTCP:
+		sock, err := net.DialTimeout("tcp", config.URI, 5*time.Second)
+		if err != nil {
+			return nil, nil, err
+		}
+		return modbus.NewTCP(sock, 500*time.Millisecond,
+			modbus.TransportClient), nil, nil
+	case data.PointValueRTUOverTCP:
+		sock, err := net.DialTimeout("tcp", config.URI, 5*time.Second)
+		if err != nil {
+			return nil, nil, err
+		}
+		// allow extra time for the network on top of the serial timing
+		return modbus.NewRTUOverTCP(sock, time.Millisecond*500,
+			time.Millisecond*20), nil, nil
+	case data.PointValueUDP:
+		transport, err := modbus.NewUDPClient(config.URI, 500*time.Millisecond)
+		if err != nil {
+			return nil, nil, err
+		}
+		return transport, nil, nil
+	default:
+		return nil, nil, fmt.Errorf("Unsupported modbus protocol: %v", config.Protocol)
+	}
+}
+
 // SetupPort sets up io for the bus
-func (b *Modbus) SetupPort() error {
-	if b.busNode.debugLevel >= 1 {
-		log.Println("modbus: setting up modbus transport: ", b.busNode.portName)
+func (b *ModbusClient) SetupPort() error {
+	if b.scanning {
+		return errors.New("bus scan in progress")
+	}
+
+	if err := b.config.check(); err != nil {
+		return err
+	}
+
+	if b.config.Debug >= 1 {
+		log.Println("modbus: setting up modbus transport: ", b.config.Port)
 	}
 
 	b.ClosePort()
 
 	var transport modbus.Transport
 
-	switch b.busNode.protocol {
-	case data.PointValueRTU:
-		mode := &serial.Mode{
-			BaudRate: b.busNode.baud,
-		}
-
+	switch b.config.Protocol {
+	case data.PointValueRTU, data.PointValueProtocolASCII:
 		var err error
-		b.serialPort, err = serial.Open(b.busNode.portName, mode)
+		transport, b.serialPort, err = openClientTransport(&b.config, b.config.baudRate())
 		if err != nil {
-			b.serialPort = nil
-			return fmt.Errorf("Error opening serial port: %w", err)
+			return err
 		}
-
-		port := respreader.NewReadWriteCloser(b.serialPort, time.Millisecond*100, time.Millisecond*20)
-
-		transport = modbus.NewRTU(port)
-	case data.PointValueTCP:
-		switch b.busNode.busType {
+	case data.PointValueTCP, data.PointValueUDP:
+		switch b.config.ClientServer {
 		case data.PointValueClient:
-			sock, err := net.DialTimeout("tcp", b.busNode.uri, 5*time.Second)
+			var err error
+			transport, _, err = openClientTransport(&b.config, 0)
 			if err != nil {
 				return err
 			}
-			transport = modbus.NewTCP(sock, 500*time.Millisecond,
-				modbus.TransportClient)
 		case data.PointValueServer:
-			// TCPServer does all the setup
+			// TCPServer and UDPServer do all the setup
 		default:
-			log.Println("setting up modbus TCP, invalid bus type: ", b.busNode.busType)
+			log.Println("setting up modbus TCP, invalid bus type: ", b.config.ClientServer)
+		}
+	case data.PointValueRTUOverTCP:
+		var err error
+		transport, _, err = openClientTransport(&b.config, 0)
+		if err != nil {
+			return err
 		}
 
 	default:
-		return fmt.Errorf("Unsupported modbus protocol: %v", b.busNode.protocol)
+		return fmt.Errorf("Unsupported modbus protocol: %v", b.config.Protocol)
 	}
 
-	if b.busNode.busType == data.PointValueServer {
-		b.regs = &modbus.Regs{}
-		if b.busNode.protocol == data.PointValueRTU {
-			b.server = modbus.NewServer(byte(b.busNode.id), transport,
-				b.regs, b.busNode.debugLevel)
-		} else if b.busNode.protocol == data.PointValueTCP {
+	if b.config.ClientServer == data.PointValueServer {
+		regs := &modbus.Regs{}
+		b.regs = map[int]*modbus.Regs{b.config.DeviceID: regs}
+		b.ioRegs = nil
+		if b.config.isSerial() {
+			b.server = modbus.NewServer(byte(b.config.DeviceID), transport,
+				regs, b.config.Debug)
+		} else if b.config.Protocol == data.PointValueTCP {
 			var err error
-			b.server, err = modbus.NewTCPServer(b.busNode.id, 5,
-				b.busNode.portName, b.regs, b.busNode.debugLevel)
+			b.server, err = modbus.NewTCPServer(b.config.DeviceID, 5,
+				b.config.Port, regs, b.config.Debug)
+			if err != nil {
+				b.server = nil
+				return err
+			}
+		} else if b.config.Protocol == data.PointValueUDP {
+			var err error
+			b.server, err = modbus.NewUDPServer(byte(b.config.DeviceID),
+				b.config.Port, regs, b.config.Debug)
 			if err != nil {
 				b.server = nil
 				return err
@@ -719,40 +841,240 @@ func (b *Modbus) SetupPort() error {
 		go b.server.Listen(func(err error) {
 			log.Println("Modbus server error: ", err)
 		}, func() {
-			if b.busNode.debugLevel > 0 {
+			if b.config.Debug > 0 {
 				log.Println("Modbus reg change")
 			}
 			b.chRegChange <- true
 		}, func() {
-			if b.busNode.debugLevel > 0 {
+			if b.config.Debug > 0 {
 				log.Println("Modbus Listener done")
 			}
 		})
 
-		for _, io := range b.ios {
-			b.InitRegs(io.ioNode)
+		for _, io := range b.ios() {
+			b.InitRegs(io)
 		}
-	} else if b.busNode.busType == data.PointValueClient {
-		b.client = modbus.NewClient(transport, b.busNode.debugLevel)
+	} else if b.config.ClientServer == data.PointValueClient {
+		b.client = modbus.NewClient(transport, b.config.Debug)
+	} else if b.config.ClientServer == data.PointValueGateway {
+		gw, err := modbus.NewGateway(5, b.config.gatewayListenPort(), transport,
+			b.config.gatewayRespTimeout(),
+			b.config.Debug)
+		if err != nil {
+			transport.Close()
+			return err
+		}
+
+		b.server = gw
+
+		go gw.Listen(func(err error) {
+			if b.config.Debug > 0 {
+				log.Println("Modbus gateway error: ", err)
+			}
+		}, func() {}, func() {
+			if b.config.Debug > 0 {
+				log.Println("Modbus gateway done")
+			}
+		})
 	}
 
 	return nil
 }
 
-// Run is routine that runs the logic for a bus. Intended to be run as
-// a goroutine
-// It assumes an initial dataset is obtained from the database and all updates
-// come from NATs
-// this routine may need to run fast scan times, so it should be doing
-// slow things like reading the database.
-func (b *Modbus) Run() {
+// checkConfig logs config errors for the bus and IOs. IOs with an incomplete
+// config are skipped until they are fixed.
+func (b *ModbusClient) checkConfig() {
+	if err := b.config.check(); err != nil {
+		log.Printf("modbus %v: %v\n", b.config.Description, err)
+	}
+
+	for _, io := range b.config.IOs {
+		if err := io.check(); err != nil {
+			log.Printf("modbus io %v: %v\n", io.Description, err)
+		}
+	}
+}
+
+// resetErrorCount sets an error count point and its reset point to 0
+func (b *ModbusClient) resetErrorCount(id, countType, resetType string) {
+	pts := data.Points{
+		{Time: time.Now(), Type: countType, Value: 0},
+		{Time: time.Now(), Type: resetType, Value: 0},
+	}
+
+	err := client.SendNodePoints(b.nc, id, pts, true)
+	if err != nil {
+		log.Println("Send point error: ", err)
+	}
+}
+
+// busPoints handles config changes of the bus node. The points have already
+// been merged into the config.
+func (b *ModbusClient) busPoints(points data.Points, setScanTimer func()) {
+	setupPort := false
+
+	for _, p := range points {
+		switch p.Type {
+		case data.PointTypeClientServer,
+			data.PointTypeProtocol,
+			data.PointTypeID,
+			data.PointTypeDebug,
+			data.PointTypePort,
+			data.PointTypeBaud,
+			data.PointTypeURI,
+			data.PointTypeGatewayPort,
+			data.PointTypeGatewayTimeout:
+			setupPort = true
+			setScanTimer()
+
+		case data.PointTypeDisable:
+			if b.config.Disable {
+				b.StopScan()
+				b.ClosePort()
+			} else {
+				setupPort = true
+			}
+
+		case data.PointTypePollPeriod:
+			setScanTimer()
+
+		case data.PointTypeScanStart:
+			if b.config.ScanStart && b.config.ClientServer == data.PointValueClient {
+				b.StartScan()
+			} else {
+				b.StopScan()
+			}
+
+		case data.PointTypeModbusProfileCreate:
+			if b.config.ProfileCreate {
+				err := b.CreateProfileIOs()
+				if err != nil {
+					log.Println("Error creating profile IOs: ", err)
+				}
+
+				p := data.Point{Type: data.PointTypeModbusProfileCreate, Value: 0}
+				err = client.SendNodePoint(b.nc, b.config.ID, p, true)
+				if err != nil {
+					log.Println("Send point error: ", err)
+				}
+				b.config.ProfileCreate = false
+			}
+
+		case data.PointTypeErrorCountReset:
+			if b.config.ErrorCountReset {
+				b.resetErrorCount(b.config.ID, data.PointTypeErrorCount,
+					data.PointTypeErrorCountReset)
+				b.config.ErrorCount = 0
+				b.config.ErrorCountReset = false
+			}
+
+		case data.PointTypeErrorCountCRCReset:
+			if b.config.ErrorCountCRCReset {
+				b.resetErrorCount(b.config.ID, data.PointTypeErrorCountCRC,
+					data.PointTypeErrorCountCRCReset)
+				b.config.ErrorCountCRC = 0
+				b.config.ErrorCountCRCReset = false
+			}
+
+		case data.PointTypeErrorCountEOFReset:
+			if b.config.ErrorCountEOFReset {
+				b.resetErrorCount(b.config.ID, data.PointTypeErrorCountEOF,
+					data.PointTypeErrorCountEOFReset)
+				b.config.ErrorCountEOF = 0
+				b.config.ErrorCountEOFReset = false
+			}
+		}
+	}
+
+	if setupPort && !b.config.Disable {
+		if err := b.SetupPort(); err != nil {
+			log.Println("Error setting up modbus port: ", err)
+		}
+	}
+}
 
-	// if we reset any error count, we set this to avoid continually resetting
+// ioPoints handles config and value changes of an IO node. The points have
+// already been merged into the config.
+func (b *ModbusClient) ioPoints(io *ModbusIo, points data.Points) {
+	if err := io.check(); err != nil {
+		log.Printf("modbus io %v: %v\n", io.Description, err)
+		return
+	}
+
+	valueModified := false
+	valueSetModified := false
+
+	for _, p := range points {
+		switch p.Type {
+		case data.PointTypeID, data.PointTypeUnitZero:
+			b.InitRegs(io)
+			b.removeUnusedUnits()
+		case data.PointTypeAddress,
+			data.PointTypeModbusIOType,
+			data.PointTypeDataFormat,
+			data.PointTypeRegCount:
+			b.InitRegs(io)
+		case data.PointTypeValue:
+			valueModified = true
+		case data.PointTypeValueSet:
+			valueSetModified = true
+		case data.PointTypeErrorCountReset:
+			if io.ErrorCountReset {
+				b.resetErrorCount(io.ID, data.PointTypeErrorCount,
+					data.PointTypeErrorCountReset)
+				io.ErrorCount = 0
+				io.ErrorCountReset = false
+			}
+		case data.PointTypeErrorCountEOFReset:
+			if io.ErrorCountEOFReset {
+				b.resetErrorCount(io.ID, data.PointTypeErrorCountEOF,
+					data.PointTypeErrorCountEOFReset)
+				io.ErrorCountEOF = 0
+				io.ErrorCountEOFReset = false
+			}
+		case data.PointTypeErrorCountCRCReset:
+			if io.ErrorCountCRCReset {
+				b.resetErrorCount(io.ID, data.PointTypeErrorCountCRC,
+					data.PointTypeErrorCountCRCReset)
+				io.ErrorCountCRC = 0
+				io.ErrorCountCRCReset = false
+			}
+		}
+	}
+
+	if valueModified && b.config.ClientServer == data.PointValueServer &&
+		b.server != nil {
+		err := b.ServerIO(io)
+		if err != nil {
+			err := b.LogError(io, err)
+			if err != nil {
+				log.Println("Error logging error: ", err)
+			}
+		}
+	}
+
+	if valueSetModified && b.config.ClientServer == data.PointValueClient &&
+		b.client != nil && !b.scanning {
+		err := b.WriteClientIO(io)
+		if err != nil {
+			err := b.LogError(io, err)
+			if err != nil {
+				log.Println("Error logging error: ", err)
+			}
+		}
+	}
+}
+
+// Run the bus. Config changes of the bus and IO nodes are received from the
+// client manager and applied while running, so the bus does not need to be
+// restarted. This routine may need to run fast scan times, so it should not
+// be doing slow things like reading the database.
+func (b *ModbusClient) Run() error {
 	scanTimer := time.NewTicker(24 * time.Hour)
 
 	setScanTimer := func() {
-		if b.busNode.busType == data.PointValueClient {
-			scanTimer.Reset(time.Millisecond * time.Duration(b.busNode.pollPeriod))
+		if b.config.ClientServer == data.PointValueClient && b.config.PollPeriod > 0 {
+			scanTimer.Reset(time.Millisecond * time.Duration(b.config.PollPeriod))
 		} else {
 			scanTimer.Stop()
 		}
@@ -762,203 +1084,54 @@ func (b *Modbus) Run() {
 
 	checkIoTimer := time.NewTicker(time.Second * 10)
 
-	log.Println("initializing modbus port: ", b.busNode.portName)
+	b.checkConfig()
 
-	for {
-		select {
-		case point := <-b.chPoint:
-			p := point.point
-			if point.id == b.busNode.nodeID {
-				b.node.AddPoint(p)
-				var err error
-				b.busNode, err = NewModbusNode(b.node)
-				if err != nil {
-					log.Println("Error updating bus node: ", err)
-				}
-
-				switch point.point.Type {
-				case data.PointTypeClientServer,
-					data.PointTypeID,
-					data.PointTypeDebug,
-					data.PointTypePort,
-					data.PointTypeBaud,
-					data.PointTypeURI:
-					err := b.SetupPort()
-					if err != nil {
-						log.Println("Error setting up serial port: ", err)
-					}
-				case data.PointTypePollPeriod:
-					setScanTimer()
-
-				case data.PointTypeErrorCountReset:
-					if b.busNode.errorCountReset {
-						p := data.Point{Type: data.PointTypeErrorCount, Value: 0}
-						err := client.SendNodePoint(b.nc, b.busNode.nodeID, p, true)
-						if err != nil {
-							log.Println("Send point error: ", err)
-						}
-
-						p = data.Point{Type: data.PointTypeErrorCountReset, Value: 0}
-						err = client.SendNodePoint(b.nc, b.busNode.nodeID, p, true)
-						if err != nil {
-							log.Println("Send point error: ", err)
-						}
-					}
-
-				case data.PointTypeErrorCountCRCReset:
-					if b.busNode.errorCountCRCReset {
-						p := data.Point{Type: data.PointTypeErrorCountCRC, Value: 0}
-						err := client.SendNodePoint(b.nc, b.busNode.nodeID, p, true)
-						if err != nil {
-							log.Println("Send point error: ", err)
-						}
-
-						p = data.Point{Type: data.PointTypeErrorCountCRCReset, Value: 0}
-						err = client.SendNodePoint(b.nc, b.busNode.nodeID, p, true)
-						if err != nil {
-							log.Println("Send point error: ", err)
-						}
-					}
-
-				case data.PointTypeErrorCountEOFReset:
-					if b.busNode.errorCountEOFReset {
-						p := data.Point{Type: data.PointTypeErrorCountEOF, Value: 0}
-						err := client.SendNodePoint(b.nc, b.busNode.nodeID, p, true)
-						if err != nil {
-							log.Println("Send point error: ", err)
-						}
-
-						p = data.Point{Type: data.PointTypeErrorCountEOFReset, Value: 0}
-						err = client.SendNodePoint(b.nc, b.busNode.nodeID, p, true)
-						if err != nil {
-							log.Println("Send point error: ", err)
-						}
-					}
-				}
-			} else {
-				io, ok := b.ios[point.id]
-				if !ok {
-					log.Println("modbus received point for unknown node: ", point.id)
-					// FIXME, we could create a new IO here
-					continue
-				}
+	if err := b.SendProfiles(); err != nil {
+		log.Println("Error sending modbus device profiles: ", err)
+	}
 
-				valueModified := false
-				valueSetModified := false
-
-				// handle IO changes
-				switch p.Type {
-				case data.PointTypeID:
-					io.ioNode.id = int(p.Value)
-				case data.PointTypeDescription:
-					io.ioNode.description = p.Text
-				case data.PointTypeAddress:
-					io.ioNode.address = int(p.Value)
-					b.InitRegs(io.ioNode)
-				case data.PointTypeModbusIOType:
-					io.ioNode.modbusIOType = p.Text
-				case data.PointTypeDataFormat:
-					io.ioNode.modbusDataType = p.Text
-				case data.PointTypeReadOnly:
-					io.ioNode.readOnly = data.FloatToBool(p.Value)
-				case data.PointTypeScale:
-					io.ioNode.scale = p.Value
-				case data.PointTypeOffset:
-					io.ioNode.offset = p.Value
-				case data.PointTypeValue:
-					valueModified = true
-					io.ioNode.value = p.Value
-				case data.PointTypeValueSet:
-					valueSetModified = true
-					io.ioNode.valueSet = p.Value
-				case data.PointTypeDisable:
-					io.ioNode.disable = data.FloatToBool(p.Value)
-				case data.PointTypeErrorCount:
-					io.ioNode.errorCount = int(p.Value)
-				case data.PointTypeErrorCountEOF:
-					io.ioNode.errorCountEOF = int(p.Value)
-				case data.PointTypeErrorCountCRC:
-					io.ioNode.errorCountCRC = int(p.Value)
-				case data.PointTypeErrorCountReset:
-					io.ioNode.errorCountReset = data.FloatToBool(p.Value)
-					if io.ioNode.errorCountReset {
-						p := data.Point{Type: data.PointTypeErrorCount, Value: 0}
-						err := client.SendNodePoint(b.nc, io.ioNode.nodeID, p, true)
-						if err != nil {
-							log.Println("Send point error: ", err)
-						}
-
-						p = data.Point{Type: data.PointTypeErrorCountReset, Value: 0}
-						err = client.SendNodePoint(b.nc, io.ioNode.nodeID, p, true)
-						if err != nil {
-							log.Println("Send point error: ", err)
-						}
-					}
+	if !b.config.Disable {
+		log.Println("initializing modbus port: ", b.config.Port)
+		if err := b.SetupPort(); err != nil {
+			log.Println("SetupPort error: ", err)
+		}
+	}
 
-				case data.PointTypeErrorCountEOFReset:
-					io.ioNode.errorCountEOFReset = data.FloatToBool(p.Value)
-					if io.ioNode.errorCountEOFReset {
-						p := data.Point{Type: data.PointTypeErrorCountEOF, Value: 0}
-						err := client.SendNodePoint(b.nc, io.ioNode.nodeID, p, true)
-						if err != nil {
-							log.Println("Send point error: ", err)
-						}
-
-						p = data.Point{Type: data.PointTypeErrorCountEOFReset, Value: 0}
-						err = client.SendNodePoint(b.nc, io.ioNode.nodeID, p, true)
-						if err != nil {
-							log.Println("Send point error: ", err)
-						}
-					}
+	for {
+		select {
+		case <-b.stop:
+			b.StopScan()
+			log.Println("Stopping client IO for: ", b.config.Port)
+			b.ClosePort()
+			scanTimer.Stop()
+			checkIoTimer.Stop()
+			return nil
 
-				case data.PointTypeErrorCountCRCReset:
-					io.ioNode.errorCountCRCReset = data.FloatToBool(p.Value)
-					if io.ioNode.errorCountCRCReset {
-						p := data.Point{Type: data.PointTypeErrorCountCRC, Value: 0}
-						err := client.SendNodePoint(b.nc, io.ioNode.nodeID, p, true)
-						if err != nil {
-							log.Println("Send point error: ", err)
-						}
-
-						p = data.Point{Type: data.PointTypeErrorCountCRCReset, Value: 0}
-						err = client.SendNodePoint(b.nc, io.ioNode.nodeID, p, true)
-						if err != nil {
-							log.Println("Send point error: ", err)
-						}
-					}
-				default:
-					log.Println("modbus: unhandled io point: ", p)
-				}
+		case pts := <-b.newPoints:
+			err := data.MergePoints(pts.ID, pts.Points, &b.config)
+			if err != nil {
+				log.Println("modbus: error merging new points: ", err)
+				continue
+			}
 
-				if valueModified && b.busNode.busType == data.PointValueServer {
-					err := b.ServerIO(io.ioNode)
-					if err != nil {
-						err := b.LogError(io.ioNode, err)
-						if err != nil {
-							log.Println("Error logging error: ", err)
-						}
-					}
-				}
+			if pts.ID == b.config.ID {
+				b.busPoints(pts.Points, setScanTimer)
+			} else if io := b.config.findIO(pts.ID); io != nil {
+				b.ioPoints(io, pts.Points)
+			}
 
-				if valueSetModified && (b.busNode.busType == data.PointValueClient) &&
-					(io.ioNode.modbusDataType == data.PointValueModbusCoil ||
-						io.ioNode.modbusDataType == data.PointValueModbusHoldingRegister) &&
-					(io.ioNode.value != io.ioNode.valueSet) {
-					err := b.ClientIO(io)
-					if err != nil {
-						err := b.LogError(io.ioNode, err)
-						if err != nil {
-							log.Println("Error logging error: ", err)
-						}
-					}
-				}
+		case pts := <-b.newEdgePoints:
+			err := data.MergeEdgePoints(pts.ID, pts.Parent, pts.Points, &b.config)
+			if err != nil {
+				log.Println("modbus: error merging new edge points: ", err)
 			}
+
 		case <-b.chRegChange:
 			// this only happens on modbus servers
-			for _, io := range b.ios {
-				err := b.ServerIO(io.ioNode)
+			for _, io := range b.ios() {
+				err := b.ServerIO(io)
 				if err != nil {
-					err := b.LogError(io.ioNode, err)
+					err := b.LogError(io, err)
 					if err != nil {
 						log.Println("Error logging modbus error: ", err)
 					}
@@ -973,45 +1146,49 @@ func (b *Modbus) Run() {
 				_, portError = b.serialPort.GetModemStatusBits()
 			}
 
-			if b.busNode.disable {
+			if b.config.Disable {
 				b.ClosePort()
-			} else {
-				if (b.client == nil && b.server == nil) ||
-					b.ioErrorCount > 10 || portError != nil {
-					if b.busNode.debugLevel >= 1 {
-						log.Printf("Re-initializing modbus port, err cnt: %v, portError: %v\n", b.ioErrorCount, portError)
-					}
-					b.ioErrorCount = 0
-					// try to set up port
-					if err := b.SetupPort(); err != nil {
-						log.Println("SetupPort error: ", err)
-					}
+			} else if !b.scanning && ((b.client == nil && b.server == nil) ||
+				b.ioErrorCount > 10 || portError != nil) {
+				if b.config.Debug >= 1 {
+					log.Printf("Re-initializing modbus port, err cnt: %v, portError: %v\n", b.ioErrorCount, portError)
 				}
-				if err := b.CheckIOs(); err != nil {
-					log.Println("CheckIOs error: ", err)
+				b.ioErrorCount = 0
+				// try to set up port
+				if err := b.SetupPort(); err != nil {
+					log.Println("SetupPort error: ", err)
 				}
 			}
 
 		case <-scanTimer.C:
-			if b.busNode.busType == data.PointValueClient && !b.busNode.disable {
-				for _, io := range b.ios {
-					if io.ioNode.disable {
-						continue
-					}
-					// for scanning, we only need to process client ios
-					err := b.ClientIO(io)
-					if err != nil {
-						err := b.LogError(io.ioNode, err)
-						if err != nil {
-							log.Println("Error logging modbus error: ", err)
-						}
-					}
+			if b.config.ClientServer == data.PointValueClient && !b.config.Disable &&
+				!b.scanning {
+				// for scanning, we only need to process client ios
+				b.pollClientIOs()
+			}
+
+		case results := <-b.chScanDone:
+			b.scanning = false
+			b.scanCancel = nil
+			b.config.ScanStart = false
+			if b.config.ScanResults == nil {
+				b.config.ScanResults = make(map[string]float64)
+			}
+			for _, p := range results {
+				b.config.ScanResults[p.Key] = p.Value
+			}
+
+			p := data.Point{Type: data.PointTypeScanStart, Value: 0}
+			err := client.SendNodePoint(b.nc, b.config.ID, p, true)
+			if err != nil {
+				log.Println("Send point error: ", err)
+			}
+
+			if !b.config.Disable {
+				if err := b.SetupPort(); err != nil {
+					log.Println("SetupPort error: ", err)
 				}
 			}
-		case <-b.chDone:
-			log.Println("Stopping client IO for: ", b.busNode.portName)
-			b.ClosePort()
-			return
 		}
 	}
 }
@@ -1020,9 +1197,14 @@ func modbusErrorToPointType(err error) string {
 	switch err {
 	case io.EOF:
 		return data.PointTypeErrorCountEOF
-	case modbus.ErrCRC:
+	case modbus.ErrCRC, modbus.ErrLRC:
 		return data.PointTypeErrorCountCRC
 	default:
 		return ""
 	}
 }
+
+// modbusNoResponse returns true if err means the device did not respond
+func modbusNoResponse(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, os.ErrDeadlineExceeded)
+}
@@ -0,0 +1,123 @@
+package node
+
+import (
+	"testing"
+
+	"github.com/simpleiot/simpleiot/data"
+	"github.com/simpleiot/simpleiot/modbus"
+	"github.com/simpleiot/simpleiot/test"
+)
+
+func TestModbusServerUnits(t *testing.T) {
+	a, _ := test.NewIoSim()
+
+	busRegs := &modbus.Regs{}
+	b := &ModbusClient{
+		config: Modbus{
+			ClientServer: data.PointValueServer,
+			DeviceID:     1,
+			IOs: []ModbusIo{
+				{ID: "io1", ModbusIOType: data.PointValueModbusCoil},
+				{ID: "io5", DeviceID: 5, ModbusIOType: data.PointValueModbusCoil},
+			},
+		},
+		regs:   map[int]*modbus.Regs{1: busRegs},
+		server: modbus.NewServer(1, modbus.NewRTU(a), busRegs, 0),
+	}
+
+	io1 := b.config.findIO("io1")
+	io5 := b.config.findIO("io5")
+
+	if b.serverRegs(io1) != busRegs {
+		t.Fatal("IO without ID should use the bus unit")
+	}
+
+	regs5 := b.serverRegs(io5)
+	if regs5 == busRegs || b.serverRegs(io5) != regs5 {
+		t.Fatal("IO with ID should have its own unit")
+	}
+
+	b.config.IOs = b.config.IOs[:1]
+	b.removeUnusedUnits()
+
+	if _, ok := b.regs[5]; ok {
+		t.Fatal("unused unit not removed")
+	}
+
+	if _, ok := b.regs[1]; !ok {
+		t.Fatal("bus unit removed")
+	}
+}
+
+func TestModbusServerUnitZero(t *testing.T) {
+	a, _ := test.NewIoSim()
+
+	busRegs := &modbus.Regs{}
+	b := &ModbusClient{
+		config: Modbus{
+			ClientServer: data.PointValueServer,
+			DeviceID:     1,
+			IOs: []ModbusIo{
+				{ID: "io0", UnitZero: true, ModbusIOType: data.PointValueModbusCoil},
+			},
+		},
+		regs:   map[int]*modbus.Regs{1: busRegs},
+		server: modbus.NewServer(1, modbus.NewRTU(a), busRegs, 0),
+	}
+
+	io0 := b.config.findIO("io0")
+
+	if b.unitID(io0) != 0 {
+		t.Fatal("IO with unit zero set should use unit 0")
+	}
+
+	if regs := b.serverRegs(io0); regs == busRegs || b.regs[0] != regs {
+		t.Fatal("unit 0 should have its own registers")
+	}
+
+	io0.UnitZero = false
+	if b.unitID(io0) != 1 {
+		t.Fatal("IO without ID should use the bus unit")
+	}
+}
+
+func TestModbusServerRegMove(t *testing.T) {
+	a, _ := test.NewIoSim()
+
+	busRegs := &modbus.Regs{}
+	b := &ModbusClient{
+		config: Modbus{
+			ClientServer: data.PointValueServer,
+			DeviceID:     1,
+			IOs: []ModbusIo{
+				{ID: "io1", ModbusIOType: data.PointValueModbusHoldingRegister,
+					Address: 10, DataFormat: data.PointValueUINT32, Scale: 1},
+				{ID: "io2", ModbusIOType: data.PointValueModbusHoldingRegister,
+					Address: 11, DataFormat: data.PointValueUINT16, Scale: 1},
+			},
+		},
+		regs:   map[int]*modbus.Regs{1: busRegs},
+		server: modbus.NewServer(1, modbus.NewRTU(a), busRegs, 0),
+	}
+
+	for _, io := range b.ios() {
+		b.InitRegs(io)
+	}
+
+	io1 := b.config.findIO("io1")
+	io1.Address = 20
+	b.InitRegs(io1)
+
+	if _, err := busRegs.ReadReg(10); err == nil {
+		t.Fatal("old register not removed")
+	}
+
+	// still used by io2
+	if _, err := busRegs.ReadReg(11); err != nil {
+		t.Fatal("shared register removed: ", err)
+	}
+
+	if _, err := busRegs.ReadRegs(20, 2); err != nil {
+		t.Fatal("new registers not added: ", err)
+	}
+}
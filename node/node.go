@@ -20,18 +20,20 @@ type Manager struct {
 	nc             *nats.Conn
 	appVersion     string
 	osVersionField string
-	modbusManager  *ModbusManager
+	profileDir     string
 	rootNodeID     string
-	oneWireManager *oneWireManager
+	clients        *client.Group
 	chStop         chan struct{}
 }
 
-// NewManger creates a new Manager
-func NewManger(nc *nats.Conn, appVersion, osVersionField string) *Manager {
+// NewManger creates a new Manager. Modbus device profiles are loaded from
+// profileDir in addition to the built in profiles.
+func NewManger(nc *nats.Conn, appVersion, osVersionField, profileDir string) *Manager {
 	return &Manager{
 		nc:             nc,
 		appVersion:     appVersion,
 		osVersionField: osVersionField,
+		profileDir:     profileDir,
 		chStop:         make(chan struct{}),
 	}
 }
@@ -88,9 +90,6 @@ func (m *Manager) init() error {
 
 	}
 
-	m.modbusManager = NewModbusManager(m.nc, m.rootNodeID)
-	m.oneWireManager = newOneWireManager(m.nc, m.rootNodeID)
-
 	return nil
 }
 
@@ -100,20 +99,33 @@ func (m *Manager) Start() error {
 		return fmt.Errorf("Error initializing nodes: %v", err)
 	}
 
+	m.clients = client.NewGroup("Node clients")
+	m.clients.Add(client.NewManager(m.nc,
+		func(nc *nats.Conn, config Modbus) client.Client {
+			return NewModbusClient(nc, config, m.profileDir)
+		}, nil))
+	m.clients.Add(client.NewManager(m.nc, NewOneWireClient, nil))
+
+	chClientsDone := make(chan error, 1)
+	go func() {
+		chClientsDone <- m.clients.Run()
+	}()
+
 	t := time.NewTimer(time.Millisecond)
 
-	// TODO: this will not scale and needs to be made event driven
-	// on the creation of new nodes
+	// 1-wire busses are detected by polling as there are no events when a
+	// bus is added to the system
 	for {
 		select {
 		case <-m.chStop:
+			m.clients.Stop(nil)
+			<-chClientsDone
 			return errors.New("node manager stopping")
+		case err := <-chClientsDone:
+			return fmt.Errorf("node clients stopped: %v", err)
 		case <-t.C:
-			if m.modbusManager != nil {
-				_ = m.modbusManager.Update()
-			}
-			if m.oneWireManager != nil {
-				_ = m.oneWireManager.update()
+			if err := detectOneWireBusses(m.nc, m.rootNodeID); err != nil {
+				log.Println("Error detecting 1-wire busses: ", err)
 			}
 			t.Reset(time.Second * 20)
 		}
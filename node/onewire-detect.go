@@ -0,0 +1,82 @@
+package node
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+var reBusMaster = regexp.MustCompile(`w1_bus_master(\d+)`)
+
+// detectOneWireBusses creates a oneWire node for each 1-wire bus in the
+// system that does not have one yet. The busses are then run by the
+// 1-wire client manager.
+func detectOneWireBusses(nc *nats.Conn, rootNodeID string) error {
+	dirs, _ := filepath.Glob("/sys/bus/w1/devices/w1_bus_master*")
+	if len(dirs) == 0 {
+		return nil
+	}
+
+	nodes, err := client.GetNodes(nc, rootNodeID, "all", data.NodeTypeOneWire, false)
+	if err != nil {
+		return err
+	}
+
+	for _, dir := range dirs {
+		f, _ := os.Stat(dir)
+		if f.IsDir() {
+			ms := reBusMaster.FindStringSubmatch(dir)
+			if len(ms) < 2 {
+				continue
+			}
+
+			index, err := strconv.Atoi(ms[1])
+
+			if err != nil {
+				log.Println("Error extracting 1-wire bus number: ", err)
+			}
+
+			// loop through busses and make sure it exists
+			found := false
+			for _, n := range nodes {
+				i, _ := n.Points.ValueInt(data.PointTypeIndex, "")
+				if i == index {
+					found = true
+					break
+				}
+			}
+
+			if !found {
+				log.Printf("Adding 1-wire bus #%v\n", index)
+
+				n := data.NodeEdge{
+					Type:   data.NodeTypeOneWire,
+					Parent: rootNodeID,
+					Points: data.Points{
+						data.Point{
+							Type:  data.PointTypeIndex,
+							Value: float64(index),
+						},
+						data.Point{
+							Type: data.PointTypeDescription,
+							Text: "New bus, please edit",
+						},
+					},
+				}
+
+				err := client.SendNode(nc, n, "")
+				if err != nil {
+					log.Println("Error sending new 1-wire node: ", err)
+				}
+			}
+		}
+	}
+
+	return nil
+}
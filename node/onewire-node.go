@@ -1,32 +1,26 @@
 package node
 
-import (
-	"github.com/simpleiot/simpleiot/data"
-)
-
-type oneWireNode struct {
-	nodeID          string
-	description     string
-	index           int
-	debugLevel      int
-	pollPeriod      int
-	disable         bool
-	errorCount      int
-	errorCountReset bool
+// OneWire describes a 1-wire bus node. The IOs on the bus are oneWireIO
+// child nodes.
+type OneWire struct {
+	ID              string      `node:"id"`
+	Parent          string      `node:"parent"`
+	Description     string      `point:"description"`
+	Index           int         `point:"index"`
+	Debug           int         `point:"debug"`
+	PollPeriod      int         `point:"pollPeriod"`
+	Disable         bool        `point:"disable"`
+	ErrorCount      int         `point:"errorCount"`
+	ErrorCountReset bool        `point:"errorCountReset"`
+	IOs             []OneWireIo `child:"oneWireIO"`
 }
 
-func newOneWireNode(node data.NodeEdge) (*oneWireNode, error) {
-	ret := oneWireNode{
-		nodeID: node.ID,
+// findIO returns the IO with the node ID, or nil if it is not found
+func (ow *OneWire) findIO(id string) *OneWireIo {
+	for i := range ow.IOs {
+		if ow.IOs[i].ID == id {
+			return &ow.IOs[i]
+		}
 	}
-
-	ret.description, _ = node.Points.Text(data.PointTypeDescription, "")
-	ret.index, _ = node.Points.ValueInt(data.PointTypeIndex, "")
-	ret.debugLevel, _ = node.Points.ValueInt(data.PointTypeDebug, "")
-	ret.disable, _ = node.Points.ValueBool(data.PointTypeDisable, "")
-	ret.pollPeriod, _ = node.Points.ValueInt(data.PointTypePollPeriod, "")
-	ret.errorCount, _ = node.Points.ValueInt(data.PointTypeErrorCount, "")
-	ret.errorCountReset, _ = node.Points.ValueBool(data.PointTypeErrorCountReset, "")
-
-	return &ret, nil
+	return nil
 }
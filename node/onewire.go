@@ -12,171 +12,60 @@ import (
 	"github.com/simpleiot/simpleiot/data"
 )
 
-type oneWire struct {
-	node   data.NodeEdge
-	owNode *oneWireNode
-	ios    map[string]*oneWireIO
-
-	// data associated with running the bus
-	nc  *nats.Conn
-	sub *nats.Subscription
-
-	chDone  chan bool
-	chPoint chan pointWID
+// OneWireClient is a SIOT client that reads the temperature sensors on a
+// 1-wire bus
+type OneWireClient struct {
+	nc     *nats.Conn
+	config OneWire
+
+	// IOs that were sent to the server and are not in the config yet
+	added map[string]bool
+
+	stop          chan struct{}
+	newPoints     chan client.NewPoints
+	newEdgePoints chan client.NewPoints
 }
 
-func newOneWire(nc *nats.Conn, node data.NodeEdge) (*oneWire, error) {
-	ow := &oneWire{
-		nc:      nc,
-		node:    node,
-		ios:     make(map[string]*oneWireIO),
-		chDone:  make(chan bool),
-		chPoint: make(chan pointWID),
-	}
-
-	oneWireNode, err := newOneWireNode(node)
-	if err != nil {
-		return nil, err
+// NewOneWireClient creates a new 1-wire client
+func NewOneWireClient(nc *nats.Conn, config OneWire) client.Client {
+	return &OneWireClient{
+		nc:            nc,
+		config:        config,
+		added:         make(map[string]bool),
+		stop:          make(chan struct{}),
+		newPoints:     make(chan client.NewPoints),
+		newEdgePoints: make(chan client.NewPoints),
 	}
-
-	ow.owNode = oneWireNode
-
-	// closure is required so we don't get races accessing ow.busNode
-	func(id string) {
-		ow.sub, err = nc.Subscribe("p."+ow.owNode.nodeID, func(msg *nats.Msg) {
-			points, err := data.PbDecodePoints(msg.Data)
-			if err != nil {
-				// FIXME, send over channel
-				log.Println("Error decoding node data: ", err)
-				return
-			}
-
-			for _, p := range points {
-				ow.chPoint <- pointWID{id, p}
-			}
-		})
-	}(ow.owNode.nodeID)
-
-	if err != nil {
-		return nil, err
-	}
-
-	go ow.run()
-
-	return ow, nil
 }
 
-// stop stops the bus and resets various fields
-func (ow *oneWire) stop() {
-	if ow.sub != nil {
-		err := ow.sub.Unsubscribe()
-		if err != nil {
-			log.Println("Error unsubscribing from bus: ", err)
-		}
-	}
-	for _, io := range ow.ios {
-		io.stop()
-	}
-	ow.chDone <- true
+// Stop sends a signal to the Run function to exit
+func (ow *OneWireClient) Stop(_ error) {
+	close(ow.stop)
 }
 
-// CheckIOs goes through ios on the bus and handles any config changes
-func (ow *oneWire) CheckIOs() error {
-	nodes, err := client.GetNodes(ow.nc, ow.owNode.nodeID, "all", data.NodeTypeModbusIO, false)
-	if err != nil {
-		return err
-	}
-
-	found := make(map[string]bool)
-
-	for _, node := range nodes {
-		found[node.ID] = true
-		_, ok := ow.ios[node.ID]
-		if !ok {
-			// add ios
-			var err error
-			ioNode, err := newOneWireIONode(&node)
-			if err != nil {
-				log.Println("Error with IO node: ", err)
-				continue
-			}
-			io, err := newOneWireIO(ow.nc, ioNode, ow.chPoint)
-			if err != nil {
-				log.Println("Error creating new modbus IO: ", err)
-				continue
-			}
-			ow.ios[node.ID] = io
-		}
-	}
-
-	// remove ios that have been deleted
-	for id, io := range ow.ios {
-		_, ok := found[id]
-		if !ok {
-			// io was deleted so close and clear it
-			log.Println("modbus io removed: ", io.ioNode.description)
-			io.stop()
-			delete(ow.ios, id)
-		}
-	}
-
-	return nil
+// Points is called by the Manager when new points for the bus or IO nodes
+// are received
+func (ow *OneWireClient) Points(nodeID string, points []data.Point) {
+	ow.newPoints <- client.NewPoints{ID: nodeID, Points: points}
 }
 
-// checkIOs goes through ios on the bus and handles any config changes
-func (ow *oneWire) checkIOs() error {
-	nodes, err := client.GetNodes(ow.nc, ow.owNode.nodeID, "all", data.NodeTypeOneWireIO, false)
-	if err != nil {
-		return err
-	}
-
-	found := make(map[string]bool)
-
-	for _, node := range nodes {
-		found[node.ID] = true
-		_, ok := ow.ios[node.ID]
-		if !ok {
-			// add ios
-			var err error
-			ioNode, err := newOneWireIONode(&node)
-			if err != nil {
-				log.Println("Error with IO node: ", err)
-				continue
-			}
-			io, err := newOneWireIO(ow.nc, ioNode, ow.chPoint)
-			if err != nil {
-				log.Println("Error creating new modbus IO: ", err)
-				continue
-			}
-			ow.ios[node.ID] = io
-		}
-	}
-
-	// remove ios that have been deleted
-	for id, io := range ow.ios {
-		_, ok := found[id]
-		if !ok {
-			// io was deleted so close and clear it
-			log.Println("modbus io removed: ", io.ioNode.description)
-			io.stop()
-			delete(ow.ios, id)
-		}
-	}
-
-	return nil
+// EdgePoints is called by the Manager when new edge points for the bus or
+// IO nodes are received
+func (ow *OneWireClient) EdgePoints(nodeID, parentID string, points []data.Point) {
+	ow.newEdgePoints <- client.NewPoints{ID: nodeID, Parent: parentID, Points: points}
 }
 
-func (ow *oneWire) detect() {
-	// detect one wire busses
+// detect creates IO nodes for sensors on the bus that do not have one yet
+func (ow *OneWireClient) detect() {
 	dirs, _ := filepath.Glob("/sys/bus/w1/devices/28-*")
 
 	for _, dir := range dirs {
 		f, _ := os.Stat(dir)
 		if f.IsDir() {
 			id := path.Base(dir)
-			found := false
-			for _, io := range ow.ios {
-				if io.ioNode.id == id {
+			found := ow.added[id]
+			for _, io := range ow.config.IOs {
+				if io.DeviceID == id {
 					found = true
 					break
 				}
@@ -187,7 +76,7 @@ func (ow *oneWire) detect() {
 
 				n := data.NodeEdge{
 					Type:   data.NodeTypeOneWireIO,
-					Parent: ow.owNode.nodeID,
+					Parent: ow.config.ID,
 					Points: data.Points{
 						data.Point{
 							Type: data.PointTypeID,
@@ -203,18 +92,61 @@ func (ow *oneWire) detect() {
 				err := client.SendNode(ow.nc, n, "")
 				if err != nil {
 					log.Println("Error sending new 1-wire IO: ", err)
+					continue
 				}
+
+				// the client is restarted with the new IO
+				ow.added[id] = true
 			}
 		}
 	}
 }
 
-func (ow *oneWire) run() {
-	// if we reset any error count, we set this to avoid continually resetting
+// logError increments the error counts on the bus and IO nodes
+func (ow *OneWireClient) logError(io *OneWireIo, err error) {
+	if ow.config.Debug > 0 {
+		log.Printf("Error reading 1-wire io %v: %v\n", io.DeviceID, err)
+	}
+
+	ow.config.ErrorCount++
+	io.ErrorCount++
+
+	err = client.SendNodePoint(ow.nc, ow.config.ID, data.Point{
+		Type:  data.PointTypeErrorCount,
+		Value: float64(ow.config.ErrorCount),
+	}, false)
+	if err != nil {
+		log.Println("Error sending point: ", err)
+	}
+
+	err = client.SendNodePoint(ow.nc, io.ID, data.Point{
+		Type:  data.PointTypeErrorCount,
+		Value: float64(io.ErrorCount),
+	}, false)
+	if err != nil {
+		log.Println("Error sending point: ", err)
+	}
+}
+
+// resetErrorCount sets the error count of a node to 0
+func (ow *OneWireClient) resetErrorCount(id string) {
+	p := data.Points{
+		{Type: data.PointTypeErrorCount, Value: 0},
+		{Type: data.PointTypeErrorCountReset, Value: 0},
+	}
+
+	err := client.SendNodePoints(ow.nc, id, p, true)
+	if err != nil {
+		log.Println("Send point error: ", err)
+	}
+}
+
+// Run the bus. It returns when Stop is called.
+func (ow *OneWireClient) Run() error {
 	scanTimer := time.NewTicker(24 * time.Hour)
 
 	setScanTimer := func() {
-		pollPeriod := ow.owNode.pollPeriod
+		pollPeriod := ow.config.PollPeriod
 		if pollPeriod <= 0 {
 			pollPeriod = 3000
 		}
@@ -225,85 +157,64 @@ func (ow *oneWire) run() {
 
 	for {
 		select {
-		case point := <-ow.chPoint:
-			p := point.point
-			if point.id == ow.owNode.nodeID {
-				ow.node.AddPoint(p)
-				var err error
-				ow.owNode, err = newOneWireNode(ow.node)
-				if err != nil {
-					log.Println("Error updating OW node: ", err)
-				}
+		case <-ow.stop:
+			scanTimer.Stop()
+			return nil
 
-				switch point.point.Type {
-				case data.PointTypePollPeriod:
-					setScanTimer()
-				case data.PointTypeErrorCountReset:
-					if ow.owNode.errorCountReset {
-						p := data.Point{Type: data.PointTypeErrorCount, Value: 0}
-						err := client.SendNodePoint(ow.nc, ow.owNode.nodeID, p, true)
-						if err != nil {
-							log.Println("Send point error: ", err)
-						}
+		case pts := <-ow.newPoints:
+			err := data.MergePoints(pts.ID, pts.Points, &ow.config)
+			if err != nil {
+				log.Println("1-wire: error merging new points: ", err)
+				continue
+			}
 
-						p = data.Point{Type: data.PointTypeErrorCountReset, Value: 0}
-						err = client.SendNodePoint(ow.nc, ow.owNode.nodeID, p, true)
-						if err != nil {
-							log.Println("Send point error: ", err)
+			if pts.ID == ow.config.ID {
+				for _, p := range pts.Points {
+					switch p.Type {
+					case data.PointTypePollPeriod:
+						setScanTimer()
+					case data.PointTypeErrorCountReset:
+						if ow.config.ErrorCountReset {
+							ow.resetErrorCount(ow.config.ID)
+							ow.config.ErrorCount = 0
+							ow.config.ErrorCountReset = false
 						}
 					}
 				}
 				continue
 			}
 
-			io, ok := ow.ios[point.id]
-			if !ok {
-				log.Println("1-wire received point for unknown node: ", point.id)
+			io := ow.config.findIO(pts.ID)
+			if io == nil {
 				continue
 			}
 
-			err := io.point(p)
+			for _, p := range pts.Points {
+				if p.Type == data.PointTypeErrorCountReset && io.ErrorCountReset {
+					ow.resetErrorCount(io.ID)
+					io.ErrorCount = 0
+					io.ErrorCountReset = false
+				}
+			}
+
+		case pts := <-ow.newEdgePoints:
+			err := data.MergeEdgePoints(pts.ID, pts.Parent, pts.Points, &ow.config)
 			if err != nil {
-				log.Println("Error updating node point")
+				log.Println("1-wire: error merging new edge points: ", err)
 			}
 
-		case <-ow.chDone:
-			return
 		case <-scanTimer.C:
-			if ow.owNode.disable {
+			if ow.config.Disable {
 				continue
 			}
 
-			err := ow.checkIOs()
-			if err != nil {
-				log.Println("Error checking 1-wire ios: ", err)
-			}
 			ow.detect()
-			for _, io := range ow.ios {
-				err := io.read()
-				if err != nil {
-					if ow.owNode.debugLevel > 0 {
-						log.Printf("Error reading 1-wire io %v: %v\n",
-							io.ioNode.id, err)
-					}
-					busCount := ow.owNode.errorCount + 1
-					ioCount := io.ioNode.errorCount + 1
-
-					err = client.SendNodePoint(ow.nc, ow.owNode.nodeID, data.Point{
-						Type:  data.PointTypeErrorCount,
-						Value: float64(busCount),
-					}, false)
-					if err != nil {
-						log.Println("Error sending point: ", err)
-					}
 
-					err = client.SendNodePoint(ow.nc, io.ioNode.nodeID, data.Point{
-						Type:  data.PointTypeErrorCount,
-						Value: float64(ioCount),
-					}, false)
-					if err != nil {
-						log.Println("Error sending point: ", err)
-					}
+			for i := range ow.config.IOs {
+				io := &ow.config.IOs[i]
+				err := ow.readIO(io)
+				if err != nil {
+					ow.logError(io, err)
 				}
 			}
 		}
@@ -150,6 +150,7 @@ func Args(args []string) (Options, error) {
 	o := Options{
 		StoreFile:         storeFilePath,
 		ResetStore:        *flagResetStore,
+		DataDir:           dataDir,
 		HTTPPort:          port,
 		DebugHTTP:         *flagDebugHTTP,
 		DebugLifecycle:    *flagDebugLifecycle,
@@ -9,6 +9,7 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"path"
 	"sync"
 	"time"
 
@@ -257,7 +258,13 @@ func (s *Server) Run() error {
 	// Node manager
 	// ====================================
 
-	nodeManager := node.NewManger(s.nc, o.AppVersion, o.OSVersionField)
+	// Modbus device profiles can be added in <data dir>/modbus-profiles
+	var profileDir string
+	if o.DataDir != "" {
+		profileDir = path.Join(o.DataDir, "modbus-profiles")
+	}
+
+	nodeManager := node.NewManger(s.nc, o.AppVersion, o.OSVersionField, profileDir)
 
 	storeWg.Add(1)
 	g.Add(func() error {
@@ -34,12 +34,29 @@ var TestServerOptions2 = Options{
 	ID:           "inst2",
 }
 
-// TestServer starts a test server and returns a function to stop it
+// TestServerOptions3 options used for 3rd test server
+var TestServerOptions3 = Options{
+	StoreFile:    "test3.sqlite",
+	NatsPort:     8920,
+	HTTPPort:     "8921",
+	NatsHTTPPort: 8922,
+	NatsWSPort:   8923,
+	NatsServer:   "nats://localhost:8920",
+	ID:           "inst3",
+}
+
+// TestServer starts a test server and returns a function to stop it. Pass
+// "2" or "3" to start additional test servers.
 func TestServer(args ...string) (*nats.Conn, data.NodeEdge, func(), error) {
 	opts := TestServerOptions
 
 	if len(args) > 0 {
-		opts = TestServerOptions2
+		switch args[0] {
+		case "3":
+			opts = TestServerOptions3
+		default:
+			opts = TestServerOptions2
+		}
 	}
 
 	cleanup := func() {
@@ -0,0 +1,121 @@
+package store
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/data"
+	"github.com/simpleiot/simpleiot/internal/pb"
+	"google.golang.org/protobuf/proto"
+)
+
+// downstream instances are considered disconnected if we have not received a
+// heartbeat for this many sync periods
+const downstreamTimeoutPeriods = 3
+
+type downstream struct {
+	nodeType    string
+	description string
+	period      float64
+	lastSeen    time.Time
+}
+
+// downstreams tracks instances that sync to this instance. This is not
+// persisted as downstream instances send a heartbeat every sync period.
+type downstreams struct {
+	lock      sync.Mutex
+	instances map[string]downstream
+}
+
+func newDownstreams() *downstreams {
+	return &downstreams{instances: make(map[string]downstream)}
+}
+
+func (d *downstreams) heartbeat(id string, points data.Points) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	ds := downstream{lastSeen: time.Now()}
+
+	for _, p := range points {
+		switch p.Type {
+		case data.PointTypeNodeType:
+			ds.nodeType = p.Text
+		case data.PointTypeDescription:
+			ds.description = p.Text
+		case data.PointTypePeriod:
+			ds.period = p.Value
+		}
+	}
+
+	d.instances[id] = ds
+}
+
+func (d *downstreams) nodes() data.Nodes {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	var ret data.Nodes
+
+	for id, ds := range d.instances {
+		timeout := time.Duration(ds.period*downstreamTimeoutPeriods) * time.Second
+		connected := time.Since(ds.lastSeen) < timeout
+
+		ret = append(ret, data.NodeEdge{
+			ID:   id,
+			Type: ds.nodeType,
+			Points: data.Points{
+				{Type: data.PointTypeDescription, Text: ds.description},
+				{Type: data.PointTypePeriod, Value: ds.period},
+				{Time: ds.lastSeen, Type: data.PointTypeLastSeen,
+					Value: float64(ds.lastSeen.Unix())},
+				{Type: data.PointTypeConnected, Value: data.BoolToFloat(connected)},
+			},
+		})
+	}
+
+	return ret
+}
+
+func (st *Store) handleSyncHeartbeat(msg *nats.Msg) {
+	// subject is sync.heartbeat.<id>
+	chunks := strings.Split(msg.Subject, ".")
+	if len(chunks) != 3 {
+		log.Println("Store: sync heartbeat subject malformed: ", msg.Subject)
+		return
+	}
+
+	points, err := data.PbDecodePoints(msg.Data)
+	if err != nil {
+		log.Println("Store: error decoding sync heartbeat: ", err)
+		return
+	}
+
+	st.downstreams.heartbeat(chunks[2], points)
+}
+
+func (st *Store) handleSyncDownstream(msg *nats.Msg) {
+	resp := &pb.NodesRequest{}
+
+	nodes := st.downstreams.nodes()
+
+	var err error
+	resp.Nodes, err = nodes.ToPbNodes()
+	if err != nil {
+		resp.Error = err.Error()
+	}
+
+	d, err := proto.Marshal(resp)
+	if err != nil {
+		log.Println("marshal error: ", err)
+		return
+	}
+
+	err = st.nc.Publish(msg.Reply, d)
+	if err != nil {
+		log.Println("NATS: Error publishing response to downstream request: ", err)
+	}
+}
@@ -20,11 +20,15 @@ var reportMetricsPeriod = time.Minute
 
 // Store implements the SIOT NATS api
 type Store struct {
-	params        Params
-	nc            *nats.Conn
+	params Params
+	nc     *nats.Conn
+	// ncPoints receives points with echo turned off, so points the store
+	// republishes from batches are not stored again
+	ncPoints      *nats.Conn
 	subscriptions map[string]*nats.Subscription
 	db            *DbSqlite
 	authorizer    api.Authorizer
+	downstreams   *downstreams
 
 	// cycle metrics track how long it takes to handle a point
 	metricCycleNodePoint     *client.Metric
@@ -73,6 +77,7 @@ func NewStore(p Params) (*Store, error) {
 		nc:            p.Nc,
 		db:            db,
 		authorizer:    authorizer,
+		downstreams:   newDownstreams(),
 		subscriptions: make(map[string]*nats.Subscription),
 		chStop:        make(chan struct{}),
 		chStopMetrics: make(chan struct{}),
@@ -97,16 +102,41 @@ func (st *Store) GetAuthorizer() api.Authorizer {
 func (st *Store) Run() error {
 	nc := st.params.Nc
 	var err error
-	st.subscriptions["nodePoints"], err = nc.Subscribe("p.*", st.handleNodePoints)
+
+	st.ncPoints, err = nats.Connect(st.params.Server,
+		nats.Timeout(10*time.Second),
+		nats.Token(st.params.AuthToken),
+		nats.NoEcho(),
+		nats.RetryOnFailedConnect(true),
+		nats.MaxReconnects(-1),
+	)
+	if err != nil {
+		return fmt.Errorf("Error connecting store points client: %w", err)
+	}
+
+	defer st.ncPoints.Close()
+
+	st.subscriptions["nodePoints"], err = st.ncPoints.Subscribe("p.*", st.handleNodePoints)
 	if err != nil {
 		return fmt.Errorf("Subscribe node points error: %w", err)
 	}
 
-	st.subscriptions["edgePoints"], err = nc.Subscribe("p.*.*", st.handleEdgePoints)
+	st.subscriptions["edgePoints"], err = st.ncPoints.Subscribe("p.*.*", st.handleEdgePoints)
 	if err != nil {
 		return fmt.Errorf("Subscribe edge points error: %w", err)
 	}
 
+	st.subscriptions["batchPoints"], err = st.ncPoints.Subscribe("batch.*", st.handleBatchPoints)
+	if err != nil {
+		return fmt.Errorf("Subscribe batch points error: %w", err)
+	}
+
+	// make sure point subscriptions are in place before clients start
+	err = st.ncPoints.Flush()
+	if err != nil {
+		log.Println("Error flushing store points client: ", err)
+	}
+
 	if st.subscriptions["nodes"], err = nc.Subscribe("nodes.*.*", st.handleNodesRequest); err != nil {
 		return fmt.Errorf("Subscribe node error: %w", err)
 	}
@@ -137,6 +167,14 @@ func (st *Store) Run() error {
 		return fmt.Errorf("Subscribe dbMaint error: %w", err)
 	}
 
+	if st.subscriptions["sync.heartbeat"], err = nc.Subscribe(client.SubjectSyncHeartbeat("*"), st.handleSyncHeartbeat); err != nil {
+		return fmt.Errorf("Subscribe sync heartbeat error: %w", err)
+	}
+
+	if st.subscriptions["sync.downstream"], err = nc.Subscribe(client.SubjectSyncDownstream(), st.handleSyncDownstream); err != nil {
+		return fmt.Errorf("Subscribe sync downstream error: %w", err)
+	}
+
 done:
 	for {
 		select {
@@ -321,6 +359,74 @@ func (st *Store) handleEdgePoints(msg *nats.Msg) {
 	st.reply(msg.Reply, nil)
 }
 
+// handleBatchPoints processes node and edge points for multiple nodes in
+// a single message. This is typically used by sync clients on metered
+// connections.
+func (st *Store) handleBatchPoints(msg *nats.Msg) {
+	batch, err := client.DecodeBatchPointsMsg(msg)
+	if err != nil {
+		log.Println("Error decoding batch points: ", err)
+		st.reply(msg.Reply, err)
+		return
+	}
+
+	var retErr error
+
+	for _, b := range batch {
+		if len(b.Points) > 0 {
+			err := st.db.nodePoints(b.ID, b.Points)
+			if err != nil {
+				log.Printf("Error writing batch nodeID (%v) to Db: %v", b.ID, err)
+				retErr = err
+				continue
+			}
+
+			err = st.processPointsUpstream(b.ID, b.ID, b.Points)
+			if err != nil {
+				log.Println("Error processing point in upstream nodes: ", err)
+			}
+
+			st.republish(client.SubjectNodePoints(b.ID), b.Points)
+		}
+
+		if len(b.EdgePoints) > 0 {
+			err := st.db.edgePoints(b.ID, b.Parent, b.EdgePoints)
+			if err != nil {
+				log.Printf("Error writing batch edge points (%v:%v) to Db: %v",
+					b.ID, b.Parent, err)
+				retErr = err
+				continue
+			}
+
+			err = st.processEdgePointsUpstream(b.ID, b.ID, b.Parent, b.EdgePoints)
+			if err != nil {
+				log.Println("Error processing point in upstream nodes: ", err)
+			}
+
+			st.republish(client.SubjectEdgePoints(b.ID, b.Parent), b.EdgePoints)
+		}
+	}
+
+	st.reply(msg.Reply, retErr)
+}
+
+// republish publishes points from a batch on their point subject so that
+// subscribers to node points see the same messages as if the points were
+// sent individually. Points are published on the store points client, which
+// does not receive its own messages, so they are not stored twice.
+func (st *Store) republish(subject string, points data.Points) {
+	d, err := points.ToPb()
+	if err != nil {
+		log.Println("Error encoding batch points: ", err)
+		return
+	}
+
+	err = st.ncPoints.Publish(subject, d)
+	if err != nil {
+		log.Println("Error publishing batch points: ", err)
+	}
+}
+
 func (st *Store) handleNodesRequest(msg *nats.Msg) {
 	start := time.Now()
 	defer func() {
@@ -73,6 +73,109 @@ stopFor:
 	}
 }
 
+func TestStoreBatchPoints(t *testing.T) {
+	nc, root, stop, err := server.TestServer()
+
+	if err != nil {
+		t.Fatal("Error starting test server: ", err)
+	}
+
+	defer stop()
+
+	chPoints := make(chan data.Points)
+
+	sub, err := nc.Subscribe(client.SubjectNodePoints(root.ID), func(msg *nats.Msg) {
+		points, err := data.PbDecodePoints(msg.Data)
+		if err != nil {
+			fmt.Println("Error decoding points")
+			return
+		}
+
+		chPoints <- points
+	})
+
+	if err != nil {
+		t.Fatal("sub error: ", err)
+	}
+
+	defer func() {
+		_ = sub.Unsubscribe()
+	}()
+
+	batch := data.Nodes{
+		{ID: root.ID, Points: data.Points{
+			{Time: time.Now(), Type: data.PointTypeDescription, Text: "batched"},
+		}},
+	}
+
+	err = client.SendBatchPoints(nc, batch, true, true)
+	if err != nil {
+		t.Fatal("Error sending batch: ", err)
+	}
+
+stopFor:
+	for {
+		select {
+		case <-time.After(time.Second):
+			t.Fatal("Timeout waiting for batched points")
+		case p := <-chPoints:
+			if p[0].Type != data.PointTypeDescription {
+				continue
+			}
+			if p[0].Text != "batched" {
+				t.Fatal("wrong description: ", p[0].Text)
+			}
+			break stopFor // all is well
+		}
+	}
+
+	nodes, err := client.GetNodes(nc, "all", root.ID, "", false)
+	if err != nil || len(nodes) < 1 {
+		t.Fatal("Error getting root node: ", err)
+	}
+
+	if nodes[0].Desc() != "batched" {
+		t.Fatal("batched point not stored: ", nodes[0].Desc())
+	}
+}
+
+func TestStorePointsHeader(t *testing.T) {
+	nc, root, stop, err := server.TestServer()
+
+	if err != nil {
+		t.Fatal("Error starting test server: ", err)
+	}
+
+	defer stop()
+
+	// headers on point messages must not keep the store from storing points
+	points := data.Points{
+		{Time: time.Now(), Type: data.PointTypeDescription, Text: "header"},
+	}
+	d, err := points.ToPb()
+	if err != nil {
+		t.Fatal("Error encoding points: ", err)
+	}
+
+	msg := nats.NewMsg(client.SubjectNodePoints(root.ID))
+	msg.Header.Set("Siot-Stored", "1")
+	msg.Data = d
+
+	_, err = nc.RequestMsg(msg, time.Second)
+	if err != nil {
+		t.Fatal("Error sending points: ", err)
+	}
+
+	nodes, err := client.GetNodes(nc, "all", root.ID, "", false)
+	if err != nil || len(nodes) < 1 {
+		t.Fatal("Error getting root node: ", err)
+	}
+
+	if nodes[0].Desc() != "header" {
+		t.Fatal("point with header not stored: ", nodes[0].Desc())
+	}
+}
+
 func TestStoreMultiplePoints(t *testing.T) {
 	nc, root, stop, err := server.TestServer()
 	_ = nc